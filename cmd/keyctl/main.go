@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"strings"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/illmade-knight/go-key-service/internal/keyctl"
+	"github.com/illmade-knight/go-key-service/internal/storage/encrypted"
+	fs "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/client"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+)
+
+const usage = `Usage:
+  keyctl put URN [-in FILE]
+  keyctl get URN [-o raw|pem|jwk|json]
+  keyctl revoke URN
+  keyctl list [-entity-type T] [-updated-since RFC3339] [-o table|json]
+  keyctl fingerprint (URN | -in FILE)
+  keyctl verify URN [-in FILE | -fingerprint FP]
+
+Commands use the service at -server (or KEYCTL_SERVER), authenticated with
+the token in KEYCTL_TOKEN or the file at -token-file (or KEYCTL_TOKEN_FILE).
+For break-glass access when the service is down, -project operates directly
+on the Firestore collection instead, bypassing the service's authorization.
+`
+
+var commands = map[string]bool{"put": true, "get": true, "revoke": true, "list": true, "fingerprint": true, "verify": true}
+
+// keyctl is the operator's command-line client for the key directory.
+func main() {
+	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+	if len(os.Args) < 2 || !commands[os.Args[1]] {
+		_, _ = fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	// --- 1. Parse Flags ---
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() { _, _ = fmt.Fprint(os.Stderr, usage); flags.PrintDefaults() }
+	var (
+		server          = flags.String("server", os.Getenv("KEYCTL_SERVER"), "Base URL of the key service")
+		tokenFile       = flags.String("token-file", os.Getenv("KEYCTL_TOKEN_FILE"), "File holding the bearer token, re-read for each request")
+		projectID       = flags.String("project", "", "Break glass: GCP project of the Firestore database to operate on directly")
+		collectionName  = flags.String("collection", "public-keys", "Break glass: Firestore collection holding the keys")
+		keyringFile     = flags.String("keyring", "", "Break glass: local JSON keyring file of an encrypted store")
+		kmsKey          = flags.String("kms-key", "", "Break glass: Cloud KMS crypto key name of an encrypted store")
+		auditCollection = flags.String("audit-collection", "audit-log", "Break glass: Firestore collection holding the audit log (empty to disable)")
+		rawFormat       = flags.String("o", "", "Output format: raw, pem, jwk or json for get; table or json for list")
+		inPath          = flags.String("in", "", "File to read a key from (- for stdin)")
+		fingerprint     = flags.String("fingerprint", "", "Fingerprint the key must have")
+		entityType      = flags.String("entity-type", "", "List only this entity type")
+		updatedSince    = flags.String("updated-since", "", "List only keys stored at or after this RFC 3339 time")
+	)
+	positional, err := keyctl.ParseArgs(flags, os.Args[2:])
+	if err != nil {
+		os.Exit(2)
+	}
+
+	var entityURN urn.URN
+	needsURN := command != "list" && !(command == "fingerprint" && *inPath != "")
+	wantArgs := 0
+	if needsURN {
+		wantArgs = 1
+	}
+	if len(positional) != wantArgs {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if needsURN {
+		entityURN, err = urn.Parse(positional[0])
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid entity URN")
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// --- 2. Dependency Injection ---
+	var backend keyctl.Backend
+	if *projectID != "" {
+		logger.Warn().Str("project", *projectID).Msg("Operating directly on the store: the service's authorization is bypassed")
+		fsClient, err := firestore.NewClient(ctx, *projectID)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create Firestore client")
+		}
+		defer func() { _ = fsClient.Close() }()
+
+		var store keyservice.Store = fs.New(fsClient, *collectionName)
+		if *keyringFile != "" && *kmsKey != "" {
+			logger.Fatal().Msg("At most one of -keyring or -kms-key may be set")
+		}
+		if *kmsKey != "" {
+			kmsClient, err := kms.NewKeyManagementClient(ctx)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Failed to create KMS client")
+			}
+			defer func() { _ = kmsClient.Close() }()
+			store = encrypted.New(store, encrypted.NewKMSKeyEncrypter(kmsClient, *kmsKey))
+		} else if *keyringFile != "" {
+			encrypter, err := encrypted.LoadLocalKeyEncrypter(*keyringFile)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Failed to load keyring")
+			}
+			store = encrypted.New(store, encrypter)
+		}
+
+		storeBackend := keyctl.StoreBackend{Store: store, Actor: "keyctl"}
+		if current, err := user.Current(); err == nil {
+			storeBackend.Actor = "keyctl:" + current.Username
+		}
+		if *auditCollection != "" {
+			storeBackend.Audit = fs.NewAuditSink(fsClient, *auditCollection)
+		}
+		backend = storeBackend
+	} else {
+		if *server == "" {
+			logger.Fatal().Msg("-server or KEYCTL_SERVER is required")
+		}
+		var opts []client.Option
+		if token := os.Getenv("KEYCTL_TOKEN"); token != "" {
+			opts = append(opts, client.WithTokenSource(client.StaticToken(token)))
+		} else if *tokenFile != "" {
+			opts = append(opts, client.WithTokenSource(client.TokenSourceFunc(func(context.Context) (string, error) {
+				token, err := os.ReadFile(*tokenFile)
+				if err != nil {
+					return "", fmt.Errorf("failed to read token file: %w", err)
+				}
+				return strings.TrimSpace(string(token)), nil
+			})))
+		}
+		apiClient, err := client.New(*server, opts...)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create client")
+		}
+		backend = keyctl.APIBackend{Client: apiClient}
+	}
+
+	// --- 3. Run Command ---
+	switch command {
+	case "put":
+		key, err := readKey(*inPath)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to read key")
+		}
+		if err := backend.StoreKey(ctx, entityURN, key); err != nil {
+			logger.Fatal().Err(err).Msg("Failed to store key")
+		}
+		logger.Info().Str("entity_urn", entityURN.String()).Str("key_id", keyservice.Fingerprint(key)).Msg("Key stored")
+
+	case "get":
+		format, err := keyctl.ParseFormat(defaultString(*rawFormat, "raw"), keyctl.FormatRaw, keyctl.FormatPEM, keyctl.FormatJWK, keyctl.FormatJSON)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid output format")
+		}
+		rec, err := backend.GetKey(ctx, entityURN)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to get key")
+		}
+		if err := keyctl.WriteKey(os.Stdout, rec, format); err != nil {
+			logger.Fatal().Err(err).Msg("Failed to write key")
+		}
+
+	case "revoke":
+		if err := backend.RevokeKey(ctx, entityURN); err != nil {
+			logger.Fatal().Err(err).Msg("Failed to revoke key")
+		}
+		logger.Info().Str("entity_urn", entityURN.String()).Msg("Key revoked")
+
+	case "list":
+		format, err := keyctl.ParseFormat(defaultString(*rawFormat, "table"), keyctl.FormatTable, keyctl.FormatJSON)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid output format")
+		}
+		filter := keyservice.ListFilter{EntityType: *entityType}
+		if *updatedSince != "" {
+			filter.UpdatedSince, err = time.Parse(time.RFC3339, *updatedSince)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Invalid -updated-since")
+			}
+		}
+		records, err := keyctl.ListAll(ctx, backend, filter)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to list keys")
+		}
+		if err := keyctl.WriteRecords(os.Stdout, records, format); err != nil {
+			logger.Fatal().Err(err).Msg("Failed to write keys")
+		}
+
+	case "fingerprint":
+		var key []byte
+		var err error
+		if needsURN {
+			var rec keyservice.KeyRecord
+			rec, err = backend.GetKey(ctx, entityURN)
+			key = rec.Key
+		} else {
+			key, err = readKey(*inPath)
+		}
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to get key")
+		}
+		_, _ = fmt.Println(keyservice.Fingerprint(key))
+
+	case "verify":
+		want := keyctl.Expectation{Fingerprint: *fingerprint}
+		if *inPath != "" {
+			if *fingerprint != "" {
+				logger.Fatal().Msg("At most one of -in or -fingerprint may be set")
+			}
+			key, err := readKey(*inPath)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Failed to read key")
+			}
+			want.Key = key
+		}
+		checks, err := keyctl.Verify(ctx, backend, entityURN, want)
+		for _, check := range checks {
+			if check.Err != nil {
+				_, _ = fmt.Printf("FAIL %s: %v\n", check.Name, check.Err)
+			} else {
+				_, _ = fmt.Printf("ok   %s\n", check.Name)
+			}
+		}
+		if errors.Is(err, keyctl.ErrVerificationFailed) {
+			os.Exit(1)
+		}
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Verification failed")
+		}
+	}
+}
+
+// readKey reads a key file, or stdin for "-" or an empty path.
+func readKey(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func defaultString(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/internal/archive"
+	fs "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/rs/zerolog"
+)
+
+const usage = `Usage:
+  keyservice-archive export -project P [-collection C] -signing-key FILE [-format ndjson|tar] [-out FILE]
+  keyservice-archive import -project P [-collection C] -trusted-key FILE [-trusted-key FILE...] [-format ndjson|tar] [-in FILE]
+`
+
+// keyFiles collects repeated -trusted-key flags.
+type keyFiles []string
+
+func (k *keyFiles) String() string     { return fmt.Sprint(*k) }
+func (k *keyFiles) Set(v string) error { *k = append(*k, v); return nil }
+
+func main() {
+	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+	if len(os.Args) < 2 || (os.Args[1] != "export" && os.Args[1] != "import") {
+		_, _ = fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	// --- 1. Parse Flags ---
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var (
+		projectID      = flags.String("project", "", "GCP project of the Firestore database")
+		collectionName = flags.String("collection", "public-keys", "Firestore collection holding the keys")
+		rawFormat      = flags.String("format", "ndjson", "Archive format: ndjson or tar")
+		signingKeyFile = flags.String("signing-key", "", "PEM Ed25519 private key used to sign the export")
+		outPath        = flags.String("out", "-", "File to write the export to (- for stdout)")
+		inPath         = flags.String("in", "-", "File to read the import from (- for stdin)")
+		trustedKeys    keyFiles
+	)
+	flags.Var(&trustedKeys, "trusted-key", "PEM Ed25519 public key accepted as archive signer (repeatable)")
+	_ = flags.Parse(os.Args[2:])
+
+	if *projectID == "" {
+		logger.Fatal().Msg("-project is required")
+	}
+	format, err := archive.ParseFormat(*rawFormat)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid format")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// --- 2. Dependency Injection ---
+	fsClient, err := firestore.NewClient(ctx, *projectID)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create Firestore client")
+	}
+	defer func() { _ = fsClient.Close() }()
+	store := fs.New(fsClient, *collectionName)
+
+	// --- 3. Run Command ---
+	switch command {
+	case "export":
+		if *signingKeyFile == "" {
+			logger.Fatal().Msg("-signing-key is required for export")
+		}
+		signingKey, err := archive.LoadSigningKey(*signingKeyFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load signing key")
+		}
+		out := os.Stdout
+		if *outPath != "-" {
+			out, err = os.Create(*outPath)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Failed to create output file")
+			}
+		}
+		manifest, err := archive.Export(ctx, store, out, format, signingKey)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Export failed")
+		}
+		logger.Info().Int("record_count", manifest.RecordCount).Str("sha256", manifest.SHA256).Str("key_id", manifest.KeyID).Msg("Export finished")
+
+	case "import":
+		if len(trustedKeys) == 0 {
+			logger.Fatal().Msg("At least one -trusted-key is required for import")
+		}
+		var verificationKeys []ed25519.PublicKey
+		for _, path := range trustedKeys {
+			key, err := archive.LoadVerificationKey(path)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Failed to load trusted key")
+			}
+			verificationKeys = append(verificationKeys, key)
+		}
+		in := os.Stdin
+		if *inPath != "-" {
+			in, err = os.Open(*inPath)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Failed to open input file")
+			}
+		}
+		defer func() { _ = in.Close() }()
+		records, manifest, err := archive.Read(in, format, verificationKeys)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Archive rejected")
+		}
+		report, err := archive.Load(ctx, store, records)
+		if err != nil {
+			logger.Fatal().Err(err).Int("imported", report.Imported).Msg("Import failed; re-run to continue, already imported records are skipped")
+		}
+		logger.Info().Int("imported", report.Imported).Int("unchanged", report.Unchanged).Strs("stale", report.Stale).Str("sha256", manifest.SHA256).Msg("Import finished")
+	}
+}
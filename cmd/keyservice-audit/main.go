@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/internal/audit"
+	fs "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/rs/zerolog"
+)
+
+// keyservice-audit verifies the hash chain of the audit log, reporting the
+// first event that was deleted, reordered or modified. Record the head hash
+// it prints somewhere outside Firestore and pass it as -anchor on the next
+// run to also detect events removed from the end of the log.
+func main() {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	// --- 1. Parse Flags ---
+	var (
+		projectID      = flag.String("project", "", "GCP project of the Firestore database")
+		collectionName = flag.String("collection", "audit-log", "Firestore collection holding the audit log")
+		pageSize       = flag.Int("page-size", audit.DefaultPageSize, "Events read per query")
+		anchor         = flag.String("anchor", "", "Head hash of a previous verification that must still be in the chain")
+	)
+	flag.Parse()
+
+	if *projectID == "" {
+		logger.Fatal().Msg("-project is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// --- 2. Dependency Injection ---
+	fsClient, err := firestore.NewClient(ctx, *projectID)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create Firestore client")
+	}
+	defer func() { _ = fsClient.Close() }()
+
+	// --- 3. Verify ---
+	report, err := audit.Verify(ctx, fs.NewAuditSink(fsClient, *collectionName), audit.Options{PageSize: *pageSize, Anchor: *anchor})
+	if err != nil {
+		logger.Fatal().Err(err).Uint64("verified", report.Events).Str("last_good_hash", report.HeadHash).Msg("Audit log verification failed")
+	}
+	logger.Info().Uint64("events", report.Events).Str("head_hash", report.HeadHash).Msg("Audit log verified")
+}
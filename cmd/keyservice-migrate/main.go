@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/internal/migrate"
+	fs "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/rs/zerolog"
+)
+
+func main() {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	// --- 1. Parse Flags ---
+	var (
+		sourceProject         = flag.String("source-project", "", "GCP project of the source Firestore database")
+		sourceCollection      = flag.String("source-collection", "public-keys", "Source Firestore collection")
+		destinationProject    = flag.String("dest-project", "", "GCP project of the destination Firestore database")
+		destinationCollection = flag.String("dest-collection", "public-keys", "Destination Firestore collection")
+		checkpointPath        = flag.String("checkpoint", "keyservice-migrate.checkpoint.json", "Checkpoint file used to resume an interrupted run (empty to disable)")
+		pageSize              = flag.Int("page-size", migrate.DefaultPageSize, "Records read from the source per page")
+		recordsPerSecond      = flag.Float64("rate", 0, "Maximum destination writes per second (0 for unlimited)")
+		dryRun                = flag.Bool("dry-run", false, "Read and compare every record without writing")
+		verifyOnly            = flag.Bool("verify-only", false, "Skip copying and only run the verification pass")
+	)
+	flag.Parse()
+
+	if *sourceProject == "" || *destinationProject == "" {
+		logger.Fatal().Msg("Both -source-project and -dest-project are required")
+	}
+	if *sourceProject == *destinationProject && *sourceCollection == *destinationCollection {
+		logger.Fatal().Msg("Source and destination are the same collection")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// --- 2. Dependency Injection ---
+	sourceClient, err := firestore.NewClient(ctx, *sourceProject)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create source Firestore client")
+	}
+	defer func() { _ = sourceClient.Close() }()
+
+	destinationClient, err := firestore.NewClient(ctx, *destinationProject)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create destination Firestore client")
+	}
+	defer func() { _ = destinationClient.Close() }()
+
+	migrator := &migrate.Migrator{
+		Source:      fs.New(sourceClient, *sourceCollection),
+		Destination: fs.New(destinationClient, *destinationCollection),
+		Options: migrate.Options{
+			PageSize:         *pageSize,
+			DryRun:           *dryRun,
+			RecordsPerSecond: *recordsPerSecond,
+			CheckpointPath:   *checkpointPath,
+			SourceName:       *sourceProject + "/" + *sourceCollection,
+			DestinationName:  *destinationProject + "/" + *destinationCollection,
+		},
+		Logger: logger,
+	}
+
+	// --- 3. Copy ---
+	if !*verifyOnly {
+		report, err := migrator.Run(ctx)
+		if err != nil {
+			logger.Fatal().Err(err).Int("read", report.Read).Int("copied", report.Copied).Msg("Migration failed; re-run to resume from the checkpoint")
+		}
+		logger.Info().Bool("dry_run", *dryRun).Int("read", report.Read).Int("copied", report.Copied).Int("unchanged", report.Unchanged).Msg("Migration finished")
+		if *dryRun {
+			return
+		}
+	}
+
+	// --- 4. Verify ---
+	verification, err := migrator.Verify(ctx)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Verification failed to run")
+	}
+	event := logger.Info()
+	if !verification.OK() {
+		event = logger.Error()
+	}
+	event.
+		Int("source_count", verification.SourceCount).
+		Int("destination_count", verification.DestinationCount).
+		Strs("missing", verification.Missing).
+		Strs("mismatched", verification.Mismatched).
+		Str("source_digest", verification.SourceDigest).
+		Str("destination_digest", verification.DestinationDigest).
+		Bool("ok", verification.OK()).
+		Msg("Verification finished")
+	if !verification.OK() {
+		os.Exit(1)
+	}
+}
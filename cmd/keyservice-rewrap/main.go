@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cloud.google.com/go/firestore"
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/illmade-knight/go-key-service/internal/storage/encrypted"
+	fs "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/rs/zerolog"
+)
+
+// keyservice-rewrap completes a key encryption key rotation by re-wrapping
+// every stored data key with the current primary key. Records stored before
+// encryption was enabled are encrypted as well.
+func main() {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	// --- 1. Parse Flags ---
+	var (
+		projectID      = flag.String("project", "", "GCP project of the Firestore database")
+		collectionName = flag.String("collection", "public-keys", "Firestore collection holding the keys")
+		keyringFile    = flag.String("keyring", "", "Local JSON keyring file")
+		kmsKey         = flag.String("kms-key", "", "Cloud KMS crypto key name")
+	)
+	flag.Parse()
+
+	if *projectID == "" {
+		logger.Fatal().Msg("-project is required")
+	}
+	if (*keyringFile == "") == (*kmsKey == "") {
+		logger.Fatal().Msg("Exactly one of -keyring or -kms-key is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// --- 2. Dependency Injection ---
+	fsClient, err := firestore.NewClient(ctx, *projectID)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create Firestore client")
+	}
+	defer func() { _ = fsClient.Close() }()
+
+	var encrypter keyservice.KeyEncrypter
+	if *kmsKey != "" {
+		kmsClient, err := kms.NewKeyManagementClient(ctx)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create KMS client")
+		}
+		defer func() { _ = kmsClient.Close() }()
+		encrypter = encrypted.NewKMSKeyEncrypter(kmsClient, *kmsKey)
+	} else {
+		encrypter, err = encrypted.LoadLocalKeyEncrypter(*keyringFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load keyring")
+		}
+	}
+	store := encrypted.New(fs.New(fsClient, *collectionName), encrypter)
+
+	// --- 3. Rewrap ---
+	report, err := store.Rewrap(ctx)
+	if err != nil {
+		logger.Fatal().Err(err).Int("scanned", report.Scanned).Int("rewrapped", report.Rewrapped).Msg("Rewrap failed; it is safe to re-run")
+	}
+	logger.Info().Int("scanned", report.Scanned).Int("rewrapped", report.Rewrapped).Int("encrypted", report.Encrypted).Msg("Rewrap finished")
+}
@@ -12,11 +12,20 @@ import (
 	"time"
 
 	"cloud.google.com/go/firestore"
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/illmade-knight/go-key-service/internal/archive"
+	"github.com/illmade-knight/go-key-service/internal/authz"
+	"github.com/illmade-knight/go-key-service/internal/federation"
+	"github.com/illmade-knight/go-key-service/internal/mtls"
+	"github.com/illmade-knight/go-key-service/internal/storage/cache"
+	"github.com/illmade-knight/go-key-service/internal/storage/encrypted"
 	fs "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
 	"github.com/illmade-knight/go-key-service/keyservice"
 	"github.com/illmade-knight/go-key-service/keyservice/config"
 	ks "github.com/illmade-knight/go-key-service/pkg/keyservice"
 	"github.com/illmade-knight/go-microservice-base/pkg/middleware"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
 	"github.com/rs/zerolog"
 )
 
@@ -52,9 +61,43 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to create Firestore client")
 	}
 	defer func() { _ = fsClient.Close() }()
-	store := fs.New(fsClient, "public-keys")
+	var store ks.Store = fs.New(fsClient, "public-keys")
 	logger.Info().Str("project_id", cfg.ProjectID).Msg("Using Firestore key store")
 
+	// Optionally envelope-encrypt keys at rest.
+	switch {
+	case cfg.Encryption.KMSKey != "" && cfg.Encryption.KeyringFile != "":
+		logger.Fatal().Msg("Configure at most one of encryption.kms_key and encryption.keyring_file")
+	case cfg.Encryption.KMSKey != "":
+		kmsClient, err := kms.NewKeyManagementClient(context.Background())
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create KMS client")
+		}
+		defer func() { _ = kmsClient.Close() }()
+		store = encrypted.New(store, encrypted.NewKMSKeyEncrypter(kmsClient, cfg.Encryption.KMSKey))
+		logger.Info().Str("kms_key", cfg.Encryption.KMSKey).Msg("Encrypting keys at rest with Cloud KMS")
+	case cfg.Encryption.KeyringFile != "":
+		encrypter, err := encrypted.LoadLocalKeyEncrypter(cfg.Encryption.KeyringFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load encryption keyring")
+		}
+		store = encrypted.New(store, encrypter)
+		logger.Info().Msg("Encrypting keys at rest with the local keyring")
+	}
+
+	// Optionally cache keys per replica, evicting them across all replicas
+	// through a snapshot listener on the same collection.
+	invalidator := fs.NewInvalidator(fsClient, "public-keys", logger)
+	cacheCtx, cancelCache := context.WithCancel(context.Background())
+	defer cancelCache()
+	if cfg.Cache.TTL > 0 {
+		store, err = cache.New(cacheCtx, store, invalidator, cfg.Cache.TTL)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create key cache")
+		}
+		logger.Info().Dur("ttl", cfg.Cache.TTL).Msg("Using cross-replica key cache")
+	}
+
 	// --- 3. Service Initialization ---
 	sanitizedIdentityURL := strings.Trim(cfg.IdentityServiceURL, "\"")
 	jwksURL := sanitizedIdentityURL + "/.well-known/jwks.json"
@@ -63,16 +106,189 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to create auth middleware")
 	}
 
+	readMode, err := ks.ParseReadMode(cfg.Reads.Mode)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid read mode")
+	}
+
+	lookupRateLimit := ks.LookupRateLimit{
+		Hits:              cfg.RateLimit.Hits,
+		Misses:            cfg.RateLimit.Misses,
+		KeyBy:             cfg.RateLimit.KeyBy,
+		TrustForwardedFor: cfg.RateLimit.TrustForwardedFor,
+	}
+	if err := lookupRateLimit.Validate(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid rate limit configuration")
+	}
+	if err := lookupRateLimit.ValidateReadMode(readMode); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid rate limit configuration")
+	}
+	if err := cfg.Discovery.RateLimit.Validate(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid discovery rate limit")
+	}
+	if err := cfg.APIVersions.Validate(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid API version configuration")
+	}
+
 	// Create a ks.Config for the service New() function
 	serviceCfg := &ks.Config{
 		HTTPListenAddr: cfg.HTTPListenAddr,
+		GRPCListenAddr: cfg.GRPCListenAddr,
 		CorsConfig: middleware.CorsConfig{
 			AllowedOrigins: cfg.Cors.AllowedOrigins,
 			Role:           middleware.CorsRoleDefault,
 		},
+		AdminSubjects:             cfg.Admin.Subjects,
+		AdminRoleClaim:            cfg.Admin.RoleClaim,
+		AdminRole:                 cfg.Admin.Role,
+		TokenRequirements:         cfg.Tokens.TokenRequirements,
+		RouteTokenRequirements:    cfg.Tokens.Routes,
+		ReadMode:                  readMode,
+		LookupRateLimit:           lookupRateLimit,
+		IdentifierSalt:            cfg.Identifiers.Salt,
+		DiscoveryRateLimit:        cfg.Discovery.RateLimit,
+		ChallengeTTL:              cfg.ProofOfPossession.ChallengeTTL,
+		RequireProofOfPossession:  cfg.ProofOfPossession.Required,
+		RequireIdentitySignatures: cfg.CrossSigning.Required,
+		RequireAuditLog:           cfg.Audit.Required,
+		APIVersions:               cfg.APIVersions,
+	}
+	if cfg.Archive.SigningKeyFile != "" {
+		serviceCfg.ArchiveSigningKey, err = archive.LoadSigningKey(cfg.Archive.SigningKeyFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load archive signing key")
+		}
+	}
+	for _, path := range cfg.Archive.TrustedKeyFiles {
+		trustedKey, err := archive.LoadVerificationKey(path)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load archive verification key")
+		}
+		serviceCfg.ArchiveTrustedKeys = append(serviceCfg.ArchiveTrustedKeys, trustedKey)
+	}
+
+	if cfg.Federation.SigningKeyFile != "" {
+		if cfg.Federation.Domain == "" || cfg.Federation.PublicURL == "" {
+			logger.Fatal().Msg("federation.domain and federation.public_url are required with federation.signing_key_file")
+		}
+		serviceCfg.FederationSigningKey, err = archive.LoadSigningKey(cfg.Federation.SigningKeyFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load federation signing key")
+		}
+		serviceCfg.FederationDomain = cfg.Federation.Domain
+		serviceCfg.FederationURL = cfg.Federation.PublicURL
+		logger.Info().Str("domain", cfg.Federation.Domain).Msg("Serving federated key lookups")
 	}
 
-	service := keyservice.New(serviceCfg, store, authMiddleware, logger)
+	devices := fs.NewDeviceRegistry(fsClient, "device-owners")
+	challengeCollection := cfg.ProofOfPossession.Collection
+	if challengeCollection == "" {
+		challengeCollection = "key-challenges"
+	}
+	serviceOpts := []keyservice.Option{
+		keyservice.WithDeviceRegistry(devices),
+		keyservice.WithChallengeStore(fs.NewChallengeStore(fsClient, challengeCollection)),
+		keyservice.WithIdentifierIndex(fs.NewIdentifierIndex(fsClient, "identifier-hashes")),
+	}
+	if cfg.RateLimit.Collection != "" {
+		serviceOpts = append(serviceOpts, keyservice.WithRateLimitStore(fs.NewRateLimitStore(fsClient, cfg.RateLimit.Collection)))
+		logger.Info().Str("collection", cfg.RateLimit.Collection).Msg("Sharing rate limits between replicas")
+	}
+	if cfg.Authorization.PolicyFile != "" {
+		policy, err := config.LoadPolicy(cfg.Authorization.PolicyFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load authorization policy")
+		}
+		authorizer, err := authz.NewPolicyAuthorizer(*policy, authz.WithDeviceRegistry(devices))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create authorizer")
+		}
+		serviceOpts = append(serviceOpts, keyservice.WithAuthorizer(authorizer))
+		logger.Info().Str("policy_file", cfg.Authorization.PolicyFile).Int("rules", len(policy.Rules)).Msg("Loaded authorization policy")
+	}
+
+	if readMode == ks.ReadModeContacts {
+		if cfg.Reads.ContactsClaim == "" {
+			logger.Fatal().Msg("reads.contacts_claim is required in contacts read mode")
+		}
+		serviceOpts = append(serviceOpts, keyservice.WithReadAuthorizer(authz.NewClaimContacts(cfg.Reads.ContactsClaim)))
+	}
+	logger.Info().Str("read_mode", string(readMode)).Msg("Key read mode")
+
+	if cfg.Admin.JWKSURL != "" {
+		adminAuth, err := middleware.NewJWKSAuthMiddleware(cfg.Admin.JWKSURL)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to create admin auth middleware")
+		}
+		serviceOpts = append(serviceOpts, keyservice.WithAdminAuthMiddleware(adminAuth))
+	}
+
+	if len(cfg.Federation.TrustedDomains) > 0 {
+		var resolverOpts []federation.Option
+		if cfg.Federation.CacheTTL > 0 {
+			resolverOpts = append(resolverOpts, federation.WithCacheTTL(cfg.Federation.CacheTTL))
+		}
+		resolver, err := federation.NewResolver(cfg.Federation.TrustedDomains, resolverOpts...)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid federation configuration")
+		}
+		serviceOpts = append(serviceOpts, keyservice.WithKeyResolver(resolver))
+		logger.Info().Int("trusted_domains", len(cfg.Federation.TrustedDomains)).Msg("Resolving keys of federated domains")
+	}
+
+	if cfg.Audit.Required && cfg.Audit.Collection == "" {
+		logger.Fatal().Msg("audit.required needs an audit.collection")
+	}
+	if cfg.Audit.Collection != "" {
+		serviceOpts = append(serviceOpts, keyservice.WithAuditSink(fs.NewAuditSink(fsClient, cfg.Audit.Collection)))
+		logger.Info().Str("collection", cfg.Audit.Collection).Msg("Audit log enabled")
+	}
+
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		clientCertMode, err := ks.ParseClientCertMode(cfg.TLS.ClientAuth)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+		if clientCertMode != ks.ClientCertNone && cfg.TLS.ClientCAFile == "" {
+			logger.Fatal().Msg("tls.client_ca_file is required unless tls.client_auth is none")
+		}
+		reloader, err := mtls.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load TLS certificates")
+		}
+		reloadCtx, cancelReload := context.WithCancel(context.Background())
+		defer cancelReload()
+		go reloader.Watch(reloadCtx, cfg.TLS.ReloadInterval)
+		serviceOpts = append(serviceOpts, keyservice.WithTLS(reloader.TLSConfig(clientCertMode.TLSClientAuth())))
+
+		if len(cfg.TLS.Clients) > 0 {
+			mapper, err := mtls.NewMapper(cfg.TLS.Clients)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Invalid TLS client mappings")
+			}
+			serviceOpts = append(serviceOpts, keyservice.WithClientCertMapper(mapper))
+		}
+		logger.Info().Str("client_auth", string(clientCertMode)).Int("client_mappings", len(cfg.TLS.Clients)).Msg("TLS enabled")
+	}
+
+	// gRPC watchers share a single snapshot listener, fanned out in
+	// process.
+	if cfg.GRPCListenAddr != "" {
+		watchers := inmemory.NewInvalidator()
+		err := invalidator.Subscribe(cacheCtx, func(entityURN urn.URN) {
+			_ = watchers.Publish(cacheCtx, entityURN)
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to subscribe to key changes")
+		}
+		serviceOpts = append(serviceOpts, keyservice.WithInvalidator(watchers))
+		logger.Info().Str("address", cfg.GRPCListenAddr).Msg("gRPC API enabled")
+	}
+
+	service := keyservice.New(serviceCfg, store, authMiddleware, logger, serviceOpts...)
+	if err := serviceCfg.ValidateTokenRoutes(service.Routes()); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid tokens.routes configuration")
+	}
 	service.SetReady(true)
 
 	// --- 4. Start Service and Handle Shutdown ---
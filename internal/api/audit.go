@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RequestIDHeader carries the caller's request ID, recorded in the audit
+// log. Requests without one are assigned a random ID.
+const RequestIDHeader = "X-Request-ID"
+
+// Origin describes where a request came from, for the audit log.
+type Origin struct {
+	// ClientIP is the address of the connecting peer; ForwardedFor holds
+	// any X-Forwarded-For chain it presented, unverified.
+	ClientIP     string
+	ForwardedFor string
+	RequestID    string
+}
+
+// auditAppendTimeout bounds an append to the AuditSink. Appends outlive
+// the request that caused them, so that a client disconnecting after its
+// change was applied cannot leave the change unrecorded.
+const auditAppendTimeout = 10 * time.Second
+
+// auditAppendFailures counts audit events that could not be appended to
+// the AuditSink.
+var auditAppendFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "keyservice_audit_append_failures_total",
+	Help: "Audit events that could not be appended to the audit log.",
+})
+
+// intend records in the audit log that the mutations described by events
+// are about to be attempted, before they are. With RequireAuditLog set the
+// log must hold every change, so if the events cannot be appended intend
+// returns a 503 error and the caller answers with it without applying the
+// change; the outcome is appended by record once the change has been
+// attempted. Without RequireAuditLog, or an AuditSink, intend does nothing.
+func (a *API) intend(ctx context.Context, origin Origin, events ...keyservice.AuditEvent) error {
+	if !a.RequireAuditLog || a.AuditSink == nil || len(events) == 0 {
+		return nil
+	}
+	pending := make([]keyservice.AuditEvent, len(events))
+	for i, event := range events {
+		pending[i] = completeAuditEvent(ctx, origin, event)
+		pending[i].Outcome = keyservice.AuditPending
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditAppendTimeout)
+	defer cancel()
+	if _, appendErr := a.AuditSink.AppendAll(ctx, pending); appendErr != nil {
+		auditAppendFailures.Add(float64(len(pending)))
+		a.Logger.Error().Err(appendErr).Str("action", pending[0].Action).Int("events", len(pending)).Str("request_id", origin.RequestID).Msg("Failed to append to the audit log; change refused")
+		return reject(http.StatusServiceUnavailable, "Audit log unavailable; change not applied")
+	}
+	return nil
+}
+
+// record records a mutation attempt in the audit trail. The event is always
+// written as a structured log line marked with log_type "audit" and, if an
+// AuditSink is configured, appended to the tamper-evident audit log. The
+// caller fills in the action, entity and fingerprints; err is the outcome.
+//
+// A failed append is logged and counted but does not fail the request: the
+// change has been applied, and with RequireAuditLog set intend has already
+// recorded that it was about to be.
+func (a *API) record(ctx context.Context, origin Origin, event keyservice.AuditEvent, err error) {
+	event = a.logAudit(ctx, origin, event, err)
+	if a.AuditSink == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditAppendTimeout)
+	defer cancel()
+	if _, appendErr := a.AuditSink.Append(ctx, event); appendErr != nil {
+		auditAppendFailures.Inc()
+		a.Logger.Error().Err(appendErr).Str("action", event.Action).Str("entity_urn", event.EntityURN).Str("request_id", event.RequestID).Msg("Failed to append to the audit log")
+	}
+}
+
+// recordAll is record for the attempts of one bulk request, errs holding
+// their outcomes. The events are appended to the audit log together, in one
+// chain write where the sink allows.
+func (a *API) recordAll(ctx context.Context, origin Origin, events []keyservice.AuditEvent, errs []error) {
+	for i := range events {
+		events[i] = a.logAudit(ctx, origin, events[i], errs[i])
+	}
+	if a.AuditSink == nil || len(events) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditAppendTimeout)
+	defer cancel()
+	if _, appendErr := a.AuditSink.AppendAll(ctx, events); appendErr != nil {
+		auditAppendFailures.Add(float64(len(events)))
+		a.Logger.Error().Err(appendErr).Str("action", events[0].Action).Int("events", len(events)).Str("request_id", origin.RequestID).Msg("Failed to append to the audit log")
+	}
+}
+
+// completeAuditEvent fills in event's time and the request's details.
+func completeAuditEvent(ctx context.Context, origin Origin, event keyservice.AuditEvent) keyservice.AuditEvent {
+	event.Time = time.Now()
+	event.Actor, _ = GetUserIDFromContext(ctx)
+	event.ClientIP = origin.ClientIP
+	event.ForwardedFor = origin.ForwardedFor
+	event.RequestID = origin.RequestID
+	return event
+}
+
+// logAudit completes event with the request's details and outcome and
+// writes it as an audit log line.
+func (a *API) logAudit(ctx context.Context, origin Origin, event keyservice.AuditEvent, err error) keyservice.AuditEvent {
+	event = completeAuditEvent(ctx, origin, event)
+	event.Outcome = keyservice.AuditSuccess
+	logEvent := a.Logger.Info()
+	if err != nil {
+		event.Outcome = keyservice.AuditFailure
+		event.Error = err.Error()
+		logEvent = a.Logger.Warn().Err(err)
+	}
+	logEvent.
+		Str("log_type", "audit").
+		Str("action", event.Action).
+		Str("actor", event.Actor).
+		Str("entity_urn", event.EntityURN).
+		Str("old_fingerprint", event.OldFingerprint).
+		Str("new_fingerprint", event.NewFingerprint).
+		Str("outcome", event.Outcome).
+		Str("client_ip", event.ClientIP).
+		Str("request_id", event.RequestID).
+		Msg("Audit")
+	return event
+}
+
+// currentFingerprint returns the fingerprint of the entity's stored key
+// for the audit log, including a revoked key. It is only looked up when an
+// AuditSink is configured, sparing a read otherwise. Bulk requests use
+// currentFingerprints.
+func (a *API) currentFingerprint(ctx context.Context, entityURN urn.URN) string {
+	if a.AuditSink == nil {
+		return ""
+	}
+	rec, err := a.Store.GetRecord(ctx, entityURN)
+	if err != nil {
+		return ""
+	}
+	return keyservice.Fingerprint(rec.Key)
+}
+
+// currentFingerprints is currentFingerprint for many entities, read from
+// the store in one batch. Entities whose record cannot be read get an empty
+// fingerprint.
+func (a *API) currentFingerprints(ctx context.Context, entityURNs []urn.URN) []string {
+	fingerprints := make([]string, len(entityURNs))
+	if a.AuditSink == nil || len(entityURNs) == 0 {
+		return fingerprints
+	}
+	records, err := a.Store.GetRecords(ctx, entityURNs)
+	if err != nil {
+		a.Logger.Warn().Err(err).Int("entities", len(entityURNs)).Msg("Failed to read current keys for the audit log")
+		return fingerprints
+	}
+	for i, rec := range records {
+		fingerprints[i] = keyservice.Fingerprint(rec.Key)
+	}
+	return fingerprints
+}
+
+// httpOrigin returns the origin of an HTTP request.
+func httpOrigin(r *http.Request) Origin {
+	return Origin{
+		ClientIP:     remoteIP(r),
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		RequestID:    requestID(r),
+	}
+}
+
+// remoteIP returns the IP address of the connecting peer.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestID returns the request's ID from RequestIDHeader or, failing that,
+// a new random one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	return NewRequestID()
+}
+
+// NewRequestID returns a random request ID for requests that arrive without
+// one.
+func NewRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
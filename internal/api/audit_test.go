@@ -0,0 +1,172 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuditLog tests that key mutations are appended to the AuditSink.
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	testURN, err := urn.New(urn.SecureMessaging, "user", "user-123")
+	require.NoError(t, err)
+
+	storeKeyWithContext := func(ctx context.Context, apiHandler *api.API, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+testURN.String(), bytes.NewBufferString(key))
+		req.SetPathValue("entityURN", testURN.String())
+		req.RemoteAddr = "203.0.113.7:52100"
+		req.Header.Set(api.RequestIDHeader, "req-"+key)
+		req = req.WithContext(api.ContextWithUserID(ctx, "user-123"))
+		rr := httptest.NewRecorder()
+		apiHandler.StoreKeyHandler(rr, req)
+		return rr
+	}
+	storeKey := func(apiHandler *api.API, key string) *httptest.ResponseRecorder {
+		return storeKeyWithContext(ctx, apiHandler, key)
+	}
+
+	t.Run("Key rotation records the old and new fingerprints", func(t *testing.T) {
+		// Arrange
+		sink := inmemory.NewAuditSink()
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop(), AuditSink: sink}
+
+		// Act
+		storeKey(apiHandler, "key-1")
+		storeKey(apiHandler, "key-2")
+
+		// Assert
+		events, err := sink.List(ctx, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		rotation := events[1]
+		assert.Equal(t, string(keyservice.ActionStoreKey), rotation.Action)
+		assert.Equal(t, "user-123", rotation.Actor)
+		assert.Equal(t, testURN.String(), rotation.EntityURN)
+		assert.Equal(t, keyservice.Fingerprint([]byte("key-1")), rotation.OldFingerprint)
+		assert.Equal(t, keyservice.Fingerprint([]byte("key-2")), rotation.NewFingerprint)
+		assert.Equal(t, "203.0.113.7", rotation.ClientIP)
+		assert.Equal(t, "req-key-2", rotation.RequestID)
+		assert.Equal(t, keyservice.AuditSuccess, rotation.Outcome)
+		assert.NoError(t, keyservice.VerifyAuditEvent(events[0], rotation))
+	})
+
+	t.Run("Rejected upload is recorded as a failure", func(t *testing.T) {
+		// Arrange
+		sink := inmemory.NewAuditSink()
+		store := inmemory.New()
+		require.NoError(t, store.SetLocked(ctx, testURN, true))
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), AuditSink: sink}
+
+		// Act
+		storeKey(apiHandler, "key-1")
+
+		// Assert
+		events, err := sink.List(ctx, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, keyservice.AuditFailure, events[0].Outcome)
+		assert.NotEmpty(t, events[0].Error)
+	})
+	t.Run("Append outlives the request's cancellation", func(t *testing.T) {
+		// Arrange
+		sink := &contextSink{AuditSink: inmemory.NewAuditSink()}
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop(), AuditSink: sink}
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		// Act
+		storeKeyWithContext(cancelled, apiHandler, "key-1")
+
+		// Assert
+		assert.NoError(t, sink.err)
+		_, hasDeadline := sink.ctx.Deadline()
+		assert.True(t, hasDeadline, "the append must be bounded by a timeout")
+	})
+
+	t.Run("Failed append is only logged unless the audit log is required", func(t *testing.T) {
+		// Arrange
+		sink := &contextSink{AuditSink: inmemory.NewAuditSink(), fail: true}
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop(), AuditSink: sink}
+
+		// Act
+		rr := storeKey(apiHandler, "key-1")
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("Required audit log records the change before applying it", func(t *testing.T) {
+		// Arrange
+		sink := inmemory.NewAuditSink()
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop(), AuditSink: sink, RequireAuditLog: true}
+
+		// Act
+		rr := storeKey(apiHandler, "key-1")
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		events, err := sink.List(ctx, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, keyservice.AuditPending, events[0].Outcome)
+		assert.Equal(t, keyservice.AuditSuccess, events[1].Outcome)
+		for _, event := range events {
+			assert.Equal(t, testURN.String(), event.EntityURN)
+			assert.Equal(t, "req-key-1", event.RequestID)
+			assert.Equal(t, keyservice.Fingerprint([]byte("key-1")), event.NewFingerprint)
+		}
+	})
+
+	t.Run("Failed append is a 503 and the change is not applied when the audit log is required", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		sink := &contextSink{AuditSink: inmemory.NewAuditSink(), fail: true}
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), AuditSink: sink, RequireAuditLog: true}
+
+		// Act
+		rr := storeKey(apiHandler, "key-1")
+
+		// Assert
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Contains(t, rr.Body.String(), "not applied")
+		_, err := store.GetKey(ctx, testURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyNotFound)
+	})
+}
+
+// contextSink is an AuditSink that remembers the context of the last
+// append, failing appends if fail is set.
+type contextSink struct {
+	keyservice.AuditSink
+	fail bool
+	ctx  context.Context
+	err  error
+}
+
+func (s *contextSink) Append(ctx context.Context, event keyservice.AuditEvent) (keyservice.AuditEvent, error) {
+	s.ctx, s.err = ctx, ctx.Err()
+	if s.fail {
+		return keyservice.AuditEvent{}, errors.New("audit log unavailable")
+	}
+	return s.AuditSink.Append(ctx, event)
+}
+
+func (s *contextSink) AppendAll(ctx context.Context, events []keyservice.AuditEvent) ([]keyservice.AuditEvent, error) {
+	s.ctx, s.err = ctx, ctx.Err()
+	if s.fail {
+		return nil, errors.New("audit log unavailable")
+	}
+	return s.AuditSink.AppendAll(ctx, events)
+}
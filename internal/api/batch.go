@@ -0,0 +1,389 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// batchGetRequest is the JSON body accepted by BatchGetKeysHandler.
+type batchGetRequest struct {
+	EntityURNs []string `json:"entityUrns"`
+}
+
+// batchGetResponse is the JSON body returned by BatchGetKeysHandler.
+type batchGetResponse struct {
+	Keys     []keyRecordResponse `json:"keys"`
+	NotFound []string            `json:"notFound"`
+	Revoked  []string            `json:"revoked"`
+}
+
+// KeyBatch is the outcome of a batch read. Entities appear once, in request
+// order within each list.
+type KeyBatch struct {
+	Keys []keyservice.KeyRecord
+	// NotFound lists entities without a key, or whose key the caller may
+	// not read.
+	NotFound []urn.URN
+	Revoked  []urn.URN
+}
+
+// LookupBudget meters the entities looked up by one request, so a rate
+// limiter can charge batch reads per entity rather than per request.
+type LookupBudget interface {
+	// Spend charges one lookup, reporting false if the client has run out.
+	Spend(ctx context.Context) bool
+	// Miss charges a lookup of an entity that was not found.
+	Miss(ctx context.Context)
+}
+
+const lookupBudgetKey contextKey = "lookupBudget"
+
+// ContextWithLookupBudget returns a copy of ctx carrying budget.
+func ContextWithLookupBudget(ctx context.Context, budget LookupBudget) context.Context {
+	return context.WithValue(ctx, lookupBudgetKey, budget)
+}
+
+// LookupBudgetFromContext returns the LookupBudget in ctx, if any.
+func LookupBudgetFromContext(ctx context.Context) (LookupBudget, bool) {
+	budget, ok := ctx.Value(lookupBudgetKey).(LookupBudget)
+	return budget, ok
+}
+
+// BatchGetKeysHandler manages POST /keys:batchGet, returning the keys of up
+// to keyservice.MaxBatchGetKeys entities. It follows the ReadMode like
+// GetKeyHandler; entities the caller may not read are reported as not found.
+// Clients that accept NDJSONContentType get one line per entity instead,
+// streamed as the keys are read, and may name up to MaxStreamGetKeys.
+func (a *API) BatchGetKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var req batchGetRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	entityURNs := make([]urn.URN, 0, len(req.EntityURNs))
+	for _, raw := range req.EntityURNs {
+		entityURN, err := urn.Parse(raw)
+		if err != nil {
+			response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format: "+raw)
+			return
+		}
+		entityURNs = append(entityURNs, entityURN)
+	}
+	if accepts(r, NDJSONContentType) {
+		a.streamKeys(w, r, entityURNs)
+		return
+	}
+
+	batch, err := a.ReadKeys(r.Context(), entityURNs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := batchGetResponse{
+		Keys:     make([]keyRecordResponse, 0, len(batch.Keys)),
+		NotFound: make([]string, 0, len(batch.NotFound)),
+		Revoked:  make([]string, 0, len(batch.Revoked)),
+	}
+	for _, rec := range batch.Keys {
+		resp.Keys = append(resp.Keys, newKeyRecordResponse(rec))
+	}
+	for _, entityURN := range batch.NotFound {
+		resp.NotFound = append(resp.NotFound, entityURN.String())
+	}
+	for _, entityURN := range batch.Revoked {
+		resp.Revoked = append(resp.Revoked, entityURN.String())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ReadKeys applies ReadKey to up to keyservice.MaxBatchGetKeys entities,
+// ignoring duplicates. Entities without a servable key are listed rather
+// than failing the batch; a LookupBudget in ctx is charged per entity.
+func (a *API) ReadKeys(ctx context.Context, entityURNs []urn.URN) (KeyBatch, error) {
+	if len(entityURNs) == 0 || len(entityURNs) > keyservice.MaxBatchGetKeys {
+		return KeyBatch{}, reject(http.StatusBadRequest, "entityUrns must list between 1 and "+strconv.Itoa(keyservice.MaxBatchGetKeys)+" entities")
+	}
+	var batch KeyBatch
+	err := a.readEach(ctx, entityURNs, func(entityURN urn.URN, rec keyservice.KeyRecord, status int) error {
+		switch status {
+		case http.StatusOK:
+			batch.Keys = append(batch.Keys, rec)
+		case http.StatusGone:
+			batch.Revoked = append(batch.Revoked, entityURN)
+		default:
+			batch.NotFound = append(batch.NotFound, entityURN)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return KeyBatch{}, err
+	}
+	return batch, nil
+}
+
+// readEach applies ReadKey to entityURNs in order, ignoring duplicates, and
+// calls fn with each entity's record and http.StatusOK, or with
+// http.StatusNotFound or http.StatusGone if it has no servable key. Records
+// are read keyservice.MaxBatchGetKeys entities at a time with
+// servableRecords, and flush, if not nil, is called after each chunk. A
+// LookupBudget in ctx is charged per entity. It stops at the first error,
+// including one returned by fn or flush and the cancellation of ctx.
+func (a *API) readEach(ctx context.Context, entityURNs []urn.URN, fn func(entityURN urn.URN, rec keyservice.KeyRecord, status int) error, flush func() error) error {
+	budget, _ := LookupBudgetFromContext(ctx)
+	seen := make(map[string]bool, len(entityURNs))
+	for len(entityURNs) > 0 {
+		// Each entity is authorized before the chunk is read, and only the
+		// entities the caller may read are read.
+		chunk := make([]urn.URN, 0, keyservice.MaxBatchGetKeys)
+		records := make([]keyservice.KeyRecord, 0, keyservice.MaxBatchGetKeys)
+		errs := make([]error, 0, keyservice.MaxBatchGetKeys)
+		var readable []urn.URN
+		var positions []int
+		for len(entityURNs) > 0 && len(chunk) < keyservice.MaxBatchGetKeys {
+			entityURN := entityURNs[0]
+			entityURNs = entityURNs[1:]
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if seen[entityURN.String()] {
+				continue
+			}
+			seen[entityURN.String()] = true
+			if budget != nil && !budget.Spend(ctx) {
+				return reject(http.StatusTooManyRequests, "Too many requests")
+			}
+			err := a.AuthorizeRead(ctx, entityURN)
+			var apiErr *Error
+			switch {
+			case err == nil:
+				readable = append(readable, entityURN)
+				positions = append(positions, len(chunk))
+			case !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound:
+				return err
+			}
+			chunk = append(chunk, entityURN)
+			records = append(records, keyservice.KeyRecord{})
+			errs = append(errs, err)
+		}
+		if len(readable) > 0 {
+			readRecords, readErrs, err := a.servableRecords(ctx, readable)
+			if err != nil {
+				return err
+			}
+			for j, i := range positions {
+				records[i], errs[i] = readRecords[j], readErrs[j]
+			}
+		}
+
+		for i, entityURN := range chunk {
+			var apiErr *Error
+			err := errs[i]
+			switch {
+			case err == nil:
+				err = fn(entityURN, records[i], http.StatusOK)
+			case errors.As(err, &apiErr) && apiErr.Status == http.StatusGone:
+				err = fn(entityURN, keyservice.KeyRecord{}, http.StatusGone)
+			case errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+				if budget != nil {
+					budget.Miss(ctx)
+				}
+				err = fn(entityURN, keyservice.KeyRecord{}, http.StatusNotFound)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if flush != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// batchStoreRequest is the JSON body accepted by BatchStoreKeysHandler.
+type batchStoreRequest struct {
+	Keys []batchStoreItem `json:"keys"`
+}
+
+// batchStoreItem is one key of a bulk upload. The proof fields carry what
+// the X-Key-Challenge, X-Key-Signature, X-Signing-Key-URN and
+// X-Identity-Signature headers carry for a single upload.
+type batchStoreItem struct {
+	EntityURN         string `json:"entityUrn"`
+	Key               []byte `json:"key"`
+	Challenge         string `json:"challenge,omitempty"`
+	Signature         []byte `json:"signature,omitempty"`
+	SigningKeyURN     string `json:"signingKeyUrn,omitempty"`
+	IdentitySignature []byte `json:"identitySignature,omitempty"`
+}
+
+// batchStoreResponse is the JSON body returned by BatchStoreKeysHandler.
+type batchStoreResponse struct {
+	Results []batchStoreResult `json:"results"`
+}
+
+type batchStoreResult struct {
+	EntityURN string      `json:"entityUrn"`
+	Status    StoreStatus `json:"status"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// StoreStatus is the outcome of one upload in a bulk upload.
+type StoreStatus string
+
+const (
+	// StoreCreated means the key was stored.
+	StoreCreated StoreStatus = "created"
+	// StoreForbidden means the caller may not store the entity's key or
+	// its proof did not verify.
+	StoreForbidden StoreStatus = "forbidden"
+	// StoreInvalid means the upload was malformed or lacked a required
+	// proof.
+	StoreInvalid StoreStatus = "invalid"
+	// StoreLocked means the entity is locked against uploads.
+	StoreLocked StoreStatus = "locked"
+	// StoreFailed means the key could not be stored; retrying may succeed.
+	StoreFailed StoreStatus = "failed"
+)
+
+// StoreResult is the outcome of one upload in a bulk upload. Message
+// explains any status other than StoreCreated.
+type StoreResult struct {
+	Status  StoreStatus
+	Message string
+}
+
+// newStoreResult converts the error returned for one upload to its result.
+func newStoreResult(err error) StoreResult {
+	if err == nil {
+		return StoreResult{Status: StoreCreated}
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return StoreResult{Status: StoreFailed, Message: "Internal server error"}
+	}
+	switch {
+	case apiErr.Status == http.StatusForbidden:
+		return StoreResult{Status: StoreForbidden, Message: apiErr.Message}
+	case apiErr.Status == http.StatusLocked:
+		return StoreResult{Status: StoreLocked, Message: apiErr.Message}
+	case apiErr.Status < http.StatusInternalServerError:
+		return StoreResult{Status: StoreInvalid, Message: apiErr.Message}
+	default:
+		return StoreResult{Status: StoreFailed, Message: apiErr.Message}
+	}
+}
+
+// BatchStoreKeysHandler manages POST /keys:batchStore, storing up to
+// keyservice.MaxBatchStoreKeys keys with one result per key, in request
+// order. A batch is accepted as a whole, with 200 OK, even if some or all
+// of its keys are refused.
+func (a *API) BatchStoreKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var req batchStoreRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20)).Decode(&req); err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if len(req.Keys) == 0 || len(req.Keys) > keyservice.MaxBatchStoreKeys {
+		response.WriteJSONError(w, http.StatusBadRequest, "keys must list between 1 and "+strconv.Itoa(keyservice.MaxBatchStoreKeys)+" keys")
+		return
+	}
+
+	resp := batchStoreResponse{Results: make([]batchStoreResult, len(req.Keys))}
+	uploads := make([]KeyUpload, 0, len(req.Keys))
+	positions := make([]int, 0, len(req.Keys))
+	for i, item := range req.Keys {
+		resp.Results[i].EntityURN = item.EntityURN
+		entityURN, err := urn.Parse(item.EntityURN)
+		if err != nil {
+			resp.Results[i].Status = StoreInvalid
+			resp.Results[i].Error = "Invalid URN format"
+			continue
+		}
+		uploads = append(uploads, KeyUpload{
+			EntityURN:         entityURN,
+			Key:               item.Key,
+			Challenge:         item.Challenge,
+			ProofSignature:    item.Signature,
+			SigningKeyURN:     item.SigningKeyURN,
+			IdentitySignature: item.IdentitySignature,
+		})
+		positions = append(positions, i)
+	}
+
+	results, err := a.StoreKeys(r.Context(), httpOrigin(r), uploads)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for j, result := range results {
+		i := positions[j]
+		resp.Results[i].Status = result.Status
+		resp.Results[i].Error = result.Message
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// StoreKeys is StoreKey for up to keyservice.MaxBatchStoreKeys uploads.
+// Each upload is authorized and checked on its own and the accepted keys
+// are written with a single Store.StoreKeys call. It returns one result per
+// upload in order; an entity named more than once is only stored once.
+func (a *API) StoreKeys(ctx context.Context, origin Origin, uploads []KeyUpload) ([]StoreResult, error) {
+	if len(uploads) > keyservice.MaxBatchStoreKeys {
+		return nil, reject(http.StatusBadRequest, "keys must list at most "+strconv.Itoa(keyservice.MaxBatchStoreKeys)+" keys")
+	}
+
+	results := make([]StoreResult, len(uploads))
+	principals := make([]keyservice.Principal, 0, len(uploads))
+	writes := make([]keyservice.KeyWrite, 0, len(uploads))
+	entityURNs := make([]urn.URN, 0, len(uploads))
+	positions := make([]int, 0, len(uploads))
+	seen := make(map[string]bool, len(uploads))
+	for i, upload := range uploads {
+		if seen[upload.EntityURN.String()] {
+			results[i] = StoreResult{Status: StoreInvalid, Message: "Entity appears more than once in the batch"}
+			continue
+		}
+		seen[upload.EntityURN.String()] = true
+
+		principal, signatures, err := a.checkUpload(ctx, upload)
+		if err != nil {
+			results[i] = newStoreResult(err)
+			continue
+		}
+		principals = append(principals, principal)
+		writes = append(writes, keyservice.KeyWrite{EntityURN: upload.EntityURN, Key: upload.Key, Signatures: signatures})
+		entityURNs = append(entityURNs, upload.EntityURN)
+		positions = append(positions, i)
+	}
+	if len(writes) == 0 {
+		return results, nil
+	}
+
+	// The previous keys are read in one batch and the audit events
+	// appended together, so a large upload costs one read and one chain
+	// write rather than one of each per key.
+	oldFingerprints := a.currentFingerprints(ctx, entityURNs)
+	events := make([]keyservice.AuditEvent, len(writes))
+	for j, write := range writes {
+		events[j] = storeEvent(write.EntityURN, write.Key, oldFingerprints[j])
+	}
+	if err := a.intend(ctx, origin, events...); err != nil {
+		return nil, err
+	}
+	errs := a.Store.StoreKeys(ctx, writes)
+	for j, write := range writes {
+		results[positions[j]] = newStoreResult(a.storeResult(principals[j], write.EntityURN, errs[j]))
+	}
+	a.recordAll(ctx, origin, events, errs)
+	return results, nil
+}
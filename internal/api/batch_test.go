@@ -0,0 +1,315 @@
+package api_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/authz"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBatchGetKeysHandler tests POST /keys:batchGet.
+func TestBatchGetKeysHandler(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	carolURN, err := urn.New(urn.SecureMessaging, "user", "carol")
+	require.NoError(t, err)
+
+	store := inmemory.New()
+	require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+	require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+	require.NoError(t, store.RevokeKey(ctx, bobURN))
+
+	batchGet := func(apiHandler *api.API, reqCtx context.Context, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/keys:batchGet", strings.NewReader(body)).WithContext(reqCtx)
+		rr := httptest.NewRecorder()
+		apiHandler.BatchGetKeysHandler(rr, req)
+		return rr
+	}
+	type batchResponse struct {
+		Keys []struct {
+			EntityURN string `json:"entityUrn"`
+			Key       []byte `json:"key"`
+			KeyID     string `json:"keyId"`
+		} `json:"keys"`
+		NotFound []string `json:"notFound"`
+		Revoked  []string `json:"revoked"`
+	}
+
+	t.Run("Lists keys, missing and revoked entities", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		body := `{"entityUrns": ["` + aliceURN.String() + `", "` + bobURN.String() + `", "` + carolURN.String() + `", "` + aliceURN.String() + `"]}`
+
+		// Act
+		rr := batchGet(apiHandler, ctx, body)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp batchResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Keys, 1)
+		assert.Equal(t, aliceURN.String(), resp.Keys[0].EntityURN)
+		assert.Equal(t, []byte("alice-key"), resp.Keys[0].Key)
+		assert.Equal(t, keyservice.Fingerprint([]byte("alice-key")), resp.Keys[0].KeyID)
+		assert.Equal(t, []string{carolURN.String()}, resp.NotFound)
+		assert.Equal(t, []string{bobURN.String()}, resp.Revoked)
+	})
+
+	t.Run("Rejects malformed and oversized batches", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		tooMany := make([]string, keyservice.MaxBatchGetKeys+1)
+		for i := range tooMany {
+			tooMany[i] = aliceURN.String()
+		}
+		oversized, err := json.Marshal(map[string][]string{"entityUrns": tooMany})
+		require.NoError(t, err)
+
+		// Act
+		invalidJSON := batchGet(apiHandler, ctx, `{"entityUrns": `)
+		invalidURN := batchGet(apiHandler, ctx, `{"entityUrns": ["not-a-urn"]}`)
+		empty := batchGet(apiHandler, ctx, `{"entityUrns": []}`)
+		tooLarge := batchGet(apiHandler, ctx, string(oversized))
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, invalidJSON.Code)
+		assert.Equal(t, http.StatusBadRequest, invalidURN.Code)
+		assert.Equal(t, http.StatusBadRequest, empty.Code)
+		assert.Equal(t, http.StatusBadRequest, tooLarge.Code)
+	})
+
+	t.Run("Follows the read mode", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), ReadMode: keyservice.ReadModeContacts}
+		body := `{"entityUrns": ["` + aliceURN.String() + `", "` + carolURN.String() + `"]}`
+
+		// Act
+		anonymous := batchGet(apiHandler, ctx, body)
+		asCarol := batchGet(apiHandler, api.ContextWithUserID(ctx, "carol"), body)
+
+		// Assert
+		assert.Equal(t, http.StatusUnauthorized, anonymous.Code)
+		require.Equal(t, http.StatusOK, asCarol.Code)
+		var resp batchResponse
+		require.NoError(t, json.NewDecoder(asCarol.Body).Decode(&resp))
+		assert.Empty(t, resp.Keys)
+		assert.ElementsMatch(t, []string{aliceURN.String(), carolURN.String()}, resp.NotFound)
+	})
+}
+
+// countingStore counts the record reads made through it.
+type countingStore struct {
+	keyservice.Store
+	getRecord  int
+	getRecords int
+}
+
+func (c *countingStore) GetRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	c.getRecord++
+	return c.Store.GetRecord(ctx, entityURN)
+}
+
+func (c *countingStore) GetRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, error) {
+	c.getRecords++
+	return c.Store.GetRecords(ctx, entityURNs)
+}
+
+// countingSink counts the appends made through it.
+type countingSink struct {
+	keyservice.AuditSink
+	append    int
+	appendAll int
+}
+
+func (c *countingSink) Append(ctx context.Context, event keyservice.AuditEvent) (keyservice.AuditEvent, error) {
+	c.append++
+	return c.AuditSink.Append(ctx, event)
+}
+
+func (c *countingSink) AppendAll(ctx context.Context, events []keyservice.AuditEvent) ([]keyservice.AuditEvent, error) {
+	c.appendAll++
+	return c.AuditSink.AppendAll(ctx, events)
+}
+
+// TestBatchStoreKeysHandler tests POST /keys:batchStore.
+func TestBatchStoreKeysHandler(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+
+	batchStore := func(apiHandler *api.API, subject string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/keys:batchStore", strings.NewReader(body))
+		req = req.WithContext(api.ContextWithUserID(ctx, subject))
+		rr := httptest.NewRecorder()
+		apiHandler.BatchStoreKeysHandler(rr, req)
+		return rr
+	}
+	type batchResponse struct {
+		Results []struct {
+			EntityURN string `json:"entityUrn"`
+			Status    string `json:"status"`
+			Error     string `json:"error"`
+		} `json:"results"`
+	}
+	statuses := func(t *testing.T, rr *httptest.ResponseRecorder) []string {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp batchResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		var got []string
+		for _, result := range resp.Results {
+			got = append(got, result.EntityURN+" "+result.Status)
+		}
+		return got
+	}
+
+	t.Run("Authorizes and stores each key with its own result", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		sink := inmemory.NewAuditSink()
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), AuditSink: sink}
+		body := `{"keys": [
+			{"entityUrn": "` + aliceURN.String() + `", "key": "YWxpY2Uta2V5"},
+			{"entityUrn": "` + bobURN.String() + `", "key": "Ym9iLWtleQ=="},
+			{"entityUrn": "not-a-urn", "key": "aw=="},
+			{"entityUrn": "` + aliceURN.String() + `", "key": "YWdhaW4="}
+		]}`
+
+		// Act
+		rr := batchStore(apiHandler, "alice", body)
+
+		// Assert
+		assert.Equal(t, []string{
+			aliceURN.String() + " created",
+			bobURN.String() + " forbidden",
+			"not-a-urn invalid",
+			aliceURN.String() + " invalid",
+		}, statuses(t, rr))
+		key, err := store.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-key"), key)
+		_, err = store.GetKey(ctx, bobURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyNotFound)
+		events, err := sink.List(ctx, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, aliceURN.String(), events[0].EntityURN)
+		assert.Equal(t, keyservice.AuditSuccess, events[0].Outcome)
+	})
+
+	t.Run("Reads the previous keys and appends the audit events in one batch each", func(t *testing.T) {
+		// Arrange
+		store := &countingStore{Store: inmemory.New()}
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("old-key")))
+		sink := &countingSink{AuditSink: inmemory.NewAuditSink()}
+		operators, err := authz.NewPolicyAuthorizer(keyservice.Policy{Rules: []keyservice.PolicyRule{{
+			Effect:      keyservice.EffectAllow,
+			EntityTypes: []string{"user"},
+		}}})
+		require.NoError(t, err)
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), AuditSink: sink, Authorizer: operators}
+		body := `{"keys": [
+			{"entityUrn": "` + aliceURN.String() + `", "key": "YWxpY2Uta2V5"},
+			{"entityUrn": "` + bobURN.String() + `", "key": "Ym9iLWtleQ=="}
+		]}`
+
+		// Act
+		rr := batchStore(apiHandler, "operator", body)
+
+		// Assert
+		assert.Equal(t, []string{aliceURN.String() + " created", bobURN.String() + " created"}, statuses(t, rr))
+		assert.Equal(t, 0, store.getRecord)
+		assert.Equal(t, 1, store.getRecords)
+		assert.Equal(t, 0, sink.append)
+		assert.Equal(t, 1, sink.appendAll)
+		events, err := sink.List(ctx, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, keyservice.Fingerprint([]byte("old-key")), events[0].OldFingerprint)
+		assert.Equal(t, keyservice.Fingerprint([]byte("alice-key")), events[0].NewFingerprint)
+		assert.Empty(t, events[1].OldFingerprint)
+		assert.NoError(t, keyservice.VerifyAuditEvent(events[0], events[1]))
+	})
+
+	t.Run("Reports locked entities and missing proofs", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		require.NoError(t, store.SetLocked(ctx, bobURN, true))
+		operators, err := authz.NewPolicyAuthorizer(keyservice.Policy{Rules: []keyservice.PolicyRule{{
+			Effect:      keyservice.EffectAllow,
+			EntityTypes: []string{"user"},
+		}}})
+		require.NoError(t, err)
+		apiHandler := &api.API{
+			Store:                    store,
+			Logger:                   zerolog.Nop(),
+			Authorizer:               operators,
+			RequireProofOfPossession: true,
+			Challenges:               inmemory.NewChallengeStore(),
+		}
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		signingKey, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		// bob's upload carries a valid proof, so only the lock stops it.
+		bobChallenge, err := apiHandler.Challenges.Issue(ctx, bobURN, time.Minute)
+		require.NoError(t, err)
+		body, err := json.Marshal(map[string]any{"keys": []map[string]any{
+			{"entityUrn": aliceURN.String(), "key": signingKey},
+			{
+				"entityUrn": bobURN.String(),
+				"key":       signingKey,
+				"challenge": bobChallenge.Nonce,
+				"signature": ed25519.Sign(priv, keyservice.ProofMessage(bobChallenge.Nonce, bobURN)),
+			},
+		}})
+		require.NoError(t, err)
+
+		// Act
+		rr := batchStore(apiHandler, "operator", string(body))
+
+		// Assert
+		assert.Equal(t, []string{aliceURN.String() + " invalid", bobURN.String() + " locked"}, statuses(t, rr))
+	})
+
+	t.Run("Rejects malformed and oversized batches", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+		tooMany := make([]map[string]string, keyservice.MaxBatchStoreKeys+1)
+		for i := range tooMany {
+			tooMany[i] = map[string]string{"entityUrn": aliceURN.String(), "key": "aw=="}
+		}
+		oversized, err := json.Marshal(map[string]any{"keys": tooMany})
+		require.NoError(t, err)
+
+		// Act
+		invalidJSON := batchStore(apiHandler, "alice", `{"keys": `)
+		empty := batchStore(apiHandler, "alice", `{"keys": []}`)
+		tooLarge := batchStore(apiHandler, "alice", string(oversized))
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, invalidJSON.Code)
+		assert.Equal(t, http.StatusBadRequest, empty.Code)
+		assert.Equal(t, http.StatusBadRequest, tooLarge.Code)
+	})
+}
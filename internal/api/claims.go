@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+)
+
+// ClaimsContextKey is the key used to store the authenticated token's claims.
+const ClaimsContextKey contextKey = "claims"
+
+// GetClaimsFromContext retrieves the token claims stored by ClaimsMiddleware.
+func GetClaimsFromContext(ctx context.Context) (map[string]any, bool) {
+	claims, ok := ctx.Value(ClaimsContextKey).(map[string]any)
+	return claims, ok
+}
+
+// ContextWithClaims is a helper function for tests to inject token claims
+// into a context, simulating ClaimsMiddleware.
+func ContextWithClaims(ctx context.Context, claims map[string]any) context.Context {
+	return context.WithValue(ctx, ClaimsContextKey, claims)
+}
+
+// PrincipalFromContext assembles the authenticated caller from the user ID and
+// claims stored in the context.
+func PrincipalFromContext(ctx context.Context) (keyservice.Principal, bool) {
+	userID, ok := GetUserIDFromContext(ctx)
+	if !ok {
+		return keyservice.Principal{}, false
+	}
+	claims, _ := GetClaimsFromContext(ctx)
+	return keyservice.Principal{Subject: userID, Claims: claims}, true
+}
+
+// ClaimsMiddleware makes the claims of the request's bearer token available
+// to handlers and the authorization layer. It does NOT verify the token and
+// must only be chained after the JWKS authentication middleware, which
+// already has. A request without a user ID stored by that middleware is
+// rejected with 401 Unauthorized: the claims of a token nobody verified
+// never stand in for an authenticated caller. Requests authenticated by
+// client certificate keep the claims of their certificate mapping, as any
+// bearer token they carry was never verified.
+func ClaimsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if CertificateAuthenticated(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := GetUserIDFromContext(r.Context()); !ok {
+			response.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if claims, ok := bearerClaims(r); ok {
+			r = r.WithContext(ContextWithClaims(r.Context(), claims))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerClaims decodes the payload of the request's bearer JWT.
+func bearerClaims(r *http.Request) (map[string]any, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return nil, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// RequireToken rejects requests whose token claims do not meet reqs. A token
+// with the wrong audience or issuer is not meant for this route and gets 401
+// Unauthorized; a token lacking a required scope gets 403 Forbidden. Callers
+// authenticated by client certificate carry no token and are let through.
+// It must run after ClaimsMiddleware.
+func (a *API) RequireToken(reqs keyservice.TokenRequirements) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if reqs.IsZero() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if CertificateAuthenticated(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			logger := a.Logger.With().Str("path", r.URL.Path).Logger()
+			claims, ok := GetClaimsFromContext(r.Context())
+			if !ok {
+				logger.Warn().Msg("Token rejected: claims could not be read")
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				response.WriteJSONError(w, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+
+			if len(reqs.Audiences) > 0 && !slices.ContainsFunc(reqs.Audiences, func(aud string) bool { return claimContainsString(claims["aud"], aud) }) {
+				logger.Warn().Interface("aud", claims["aud"]).Msg("Token rejected: audience not accepted")
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="audience not accepted"`)
+				response.WriteJSONError(w, http.StatusUnauthorized, "Invalid token audience")
+				return
+			}
+			if reqs.Issuer != "" {
+				if iss, _ := claims["iss"].(string); iss != reqs.Issuer {
+					logger.Warn().Str("iss", iss).Msg("Token rejected: issuer not accepted")
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="issuer not accepted"`)
+					response.WriteJSONError(w, http.StatusUnauthorized, "Invalid token issuer")
+					return
+				}
+			}
+			granted := tokenScopes(claims)
+			for _, scope := range reqs.Scopes {
+				if !slices.Contains(granted, scope) {
+					logger.Warn().Str("required_scope", scope).Strs("granted_scopes", granted).Msg("Token rejected: missing scope")
+					w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope=`+strconv.Quote(strings.Join(reqs.Scopes, " ")))
+					response.WriteJSONError(w, http.StatusForbidden, "Insufficient scope: "+scope+" required")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// claimContainsString reports whether a string claim equals want or a list
+// claim contains it.
+func claimContainsString(claim any, want string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == want
+	case []any:
+		return slices.Contains(v, any(want))
+	}
+	return false
+}
+
+// tokenScopes returns the scopes granted by the space-delimited "scope" claim
+// (RFC 8693) or the "scp" list claim used by some identity providers.
+func tokenScopes(claims map[string]any) []string {
+	var scopes []string
+	for _, name := range []string{"scope", "scp"} {
+		switch v := claims[name].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(v)...)
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+		}
+	}
+	return scopes
+}
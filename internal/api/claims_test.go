@@ -0,0 +1,162 @@
+package api_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsignedToken builds a JWT-shaped token carrying payload. ClaimsMiddleware
+// does not verify signatures, so none is needed.
+func unsignedToken(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+// TestClaimsMiddleware tests that bearer token claims reach the handler.
+func TestClaimsMiddleware(t *testing.T) {
+	t.Run("Claims are added to the authenticated caller", func(t *testing.T) {
+		// Arrange
+		var principalSubject string
+		var roles any
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := api.PrincipalFromContext(r.Context())
+			require.True(t, ok)
+			principalSubject = principal.Subject
+			roles = principal.Claims["roles"]
+		})
+		req := httptest.NewRequest(http.MethodPost, "/keys/x", nil)
+		req = req.WithContext(api.ContextWithUserID(req.Context(), "user-123"))
+		req.Header.Set("Authorization", "Bearer "+unsignedToken(`{"sub":"user-123","roles":["group-admin"]}`))
+
+		// Act
+		api.ClaimsMiddleware(next).ServeHTTP(httptest.NewRecorder(), req)
+
+		// Assert
+		assert.Equal(t, "user-123", principalSubject)
+		assert.Equal(t, []any{"group-admin"}, roles)
+	})
+
+	t.Run("Requests without a bearer token pass through unchanged", func(t *testing.T) {
+		// Arrange
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			_, ok := api.GetClaimsFromContext(r.Context())
+			assert.False(t, ok)
+		})
+		req := httptest.NewRequest(http.MethodPost, "/keys/x", nil)
+		req = req.WithContext(api.ContextWithUserID(req.Context(), "user-123"))
+
+		// Act
+		api.ClaimsMiddleware(next).ServeHTTP(httptest.NewRecorder(), req)
+
+		// Assert
+		assert.True(t, called)
+	})
+
+	t.Run("The subject of an unverified token is not trusted", func(t *testing.T) {
+		// Arrange
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+		req := httptest.NewRequest(http.MethodPost, "/keys/x", nil)
+		req.Header.Set("Authorization", "Bearer "+unsignedToken(`{"sub":"user-123"}`))
+		rr := httptest.NewRecorder()
+
+		// Act
+		api.ClaimsMiddleware(next).ServeHTTP(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.False(t, called)
+	})
+}
+
+// TestRequireToken tests audience, issuer and scope enforcement.
+func TestRequireToken(t *testing.T) {
+	apiHandler := &api.API{Logger: zerolog.Nop()}
+	reqs := keyservice.TokenRequirements{
+		Audiences: []string{"key-service"},
+		Issuer:    "https://id.example.com",
+		Scopes:    []string{"keys:write"},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	serve := func(claims map[string]any) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/keys/x", nil)
+		if claims != nil {
+			req = req.WithContext(api.ContextWithClaims(context.Background(), claims))
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.RequireToken(reqs)(next).ServeHTTP(rr, req)
+		return rr
+	}
+
+	testCases := []struct {
+		name         string
+		claims       map[string]any
+		expectedCode int
+	}{
+		{
+			name:         "Success - space-delimited scope claim",
+			claims:       map[string]any{"aud": "key-service", "iss": "https://id.example.com", "scope": "keys:read keys:write"},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Success - audience list and scp claim",
+			claims:       map[string]any{"aud": []any{"other", "key-service"}, "iss": "https://id.example.com", "scp": []any{"keys:write"}},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Failure - 401 for the wrong audience",
+			claims:       map[string]any{"aud": "another-service", "iss": "https://id.example.com", "scope": "keys:write"},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Failure - 401 for the wrong issuer",
+			claims:       map[string]any{"aud": "key-service", "iss": "https://evil.example.com", "scope": "keys:write"},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Failure - 401 without claims",
+			claims:       nil,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Failure - 403 for a missing scope",
+			claims:       map[string]any{"aud": "key-service", "iss": "https://id.example.com", "scope": "keys:read"},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			rr := serve(tc.claims)
+
+			// Assert
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			if tc.expectedCode != http.StatusNoContent {
+				var errResp response.APIError
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+				assert.NotEmpty(t, errResp.Error)
+				assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	t.Run("Empty requirements pass every request", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		(&api.API{}).RequireToken(keyservice.TokenRequirements{})(next).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/keys/x", nil))
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+// certificateContextKey marks requests authenticated by a client
+// certificate rather than a bearer token.
+const certificateContextKey contextKey = "clientCertificate"
+
+// CertificateAuthenticated reports whether the request's principal was
+// established by ClientCertAuth.
+func CertificateAuthenticated(ctx context.Context) bool {
+	authenticated, _ := ctx.Value(certificateContextKey).(bool)
+	return authenticated
+}
+
+// ClientCertAuth authenticates requests carrying a verified TLS client
+// certificate that mapper maps to a principal, storing the principal's
+// subject and claims as a bearer token would. Other requests go through
+// tokenAuth. Only certificates verified during the handshake are
+// considered.
+func ClientCertAuth(mapper keyservice.ClientCertMapper, tokenAuth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		tokenAuthenticated := tokenAuth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				tokenAuthenticated.ServeHTTP(w, r)
+				return
+			}
+			principal, ok := mapper.PrincipalForCert(r.TLS.VerifiedChains[0][0])
+			if !ok {
+				tokenAuthenticated.ServeHTTP(w, r)
+				return
+			}
+			ctx := ContextWithUserID(r.Context(), principal.Subject)
+			ctx = ContextWithClaims(ctx, principal.Claims)
+			ctx = context.WithValue(ctx, certificateContextKey, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-key-service/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticMapper maps every certificate with the given common name to
+// principal.
+type staticMapper struct {
+	commonName string
+	principal  keyservice.Principal
+}
+
+func (m staticMapper) PrincipalForCert(cert *x509.Certificate) (keyservice.Principal, bool) {
+	return m.principal, cert.Subject.CommonName == m.commonName
+}
+
+// TestClientCertAuth tests authentication by verified client certificate.
+func TestClientCertAuth(t *testing.T) {
+	ca, err := test.NewCertificateAuthority("test-ca")
+	require.NoError(t, err)
+	clientCert, err := ca.IssueClient(pkix.Name{CommonName: "message-router"}, "")
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+	require.NoError(t, err)
+
+	mapper := staticMapper{
+		commonName: "message-router",
+		principal:  keyservice.Principal{Subject: "service:message-router", Claims: map[string]any{"sub": "service:message-router"}},
+	}
+	rejectTokens := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+	}
+	var seen keyservice.Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = api.PrincipalFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := api.ClientCertAuth(mapper, rejectTokens)(api.ClaimsMiddleware(next))
+
+	t.Run("Success - mapped certificate authenticates without a token", func(t *testing.T) {
+		// Arrange: the caller also sends an unverified token, which is ignored.
+		req := httptest.NewRequest(http.MethodGet, "/keys/x", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+		req.Header.Set("Authorization", "Bearer "+unsignedToken(`{"sub":"admin-1","roles":["keys-admin"]}`))
+		rr := httptest.NewRecorder()
+
+		// Act
+		handler.ServeHTTP(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "service:message-router", seen.Subject)
+		assert.NotContains(t, seen.Claims, "roles")
+	})
+
+	t.Run("Failure - unverified certificate falls back to token auth", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/keys/x", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/illmade-knight/go-key-service/internal/proof"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// IdentitySignatureHeader carries the base64 signature by the owner's
+// identity key over keyservice.SignedKeyMessage for a device key upload.
+const IdentitySignatureHeader = "X-Identity-Signature"
+
+// keySignatureResponse is the JSON representation of a key signature.
+type keySignatureResponse struct {
+	SignerURN   string `json:"signerUrn"`
+	SignerKeyID string `json:"signerKeyId"`
+	Signature   []byte `json:"signature"`
+}
+
+// signedKeyResponse is the JSON body returned by GetKeyHandler to clients
+// that accept application/json. Chain holds the signer of the key, the
+// signer of that key and so on, for as long as each signer still holds the
+// key that made the signature.
+type signedKeyResponse struct {
+	keyRecordResponse
+	Chain []keyRecordResponse `json:"chain,omitempty"`
+}
+
+// identitySignatures verifies the identity signature accompanying an
+// upload. Only device keys can be signed, by the stored key of the device's
+// owner, and if RequireIdentitySignatures is set they must be. It returns
+// the signatures to store with the key.
+func (a *API) identitySignatures(ctx context.Context, upload KeyUpload) ([]keyservice.KeySignature, error) {
+	entityURN := upload.EntityURN
+	logger := a.Logger.With().Str("entity_urn", entityURN.String()).Logger()
+	isDevice := entityURN.EntityType() == keyservice.DeviceEntityType
+
+	if len(upload.IdentitySignature) == 0 {
+		if isDevice && a.RequireIdentitySignatures {
+			logger.Warn().Msg("Device key upload without an identity signature")
+			return nil, reject(http.StatusBadRequest, "Device keys must be signed by the owner's identity key")
+		}
+		return nil, nil
+	}
+	if !isDevice || a.Devices == nil {
+		return nil, reject(http.StatusBadRequest, "Only device keys can be signed by an identity key")
+	}
+
+	owner, err := a.Devices.OwnerOf(ctx, entityURN)
+	if errors.Is(err, keyservice.ErrDeviceNotEnrolled) {
+		return nil, reject(http.StatusBadRequest, "Device is not enrolled")
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to resolve device owner")
+		return nil, err
+	}
+	identityKey, err := a.Store.GetKey(ctx, owner)
+	if errors.Is(err, keyservice.ErrKeyNotFound) || errors.Is(err, keyservice.ErrKeyRevoked) {
+		return nil, reject(http.StatusBadRequest, "Owner has no identity key")
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("owner_urn", owner.String()).Msg("Failed to get identity key")
+		return nil, err
+	}
+	signingKey, ok := proof.ParseSigningKey(identityKey)
+	if !ok {
+		return nil, reject(http.StatusBadRequest, "Identity key cannot sign")
+	}
+	if err := proof.Verify(signingKey, keyservice.SignedKeyMessage(entityURN, upload.Key), upload.IdentitySignature); err != nil {
+		logger.Warn().Err(err).Str("owner_urn", owner.String()).Msg("Device key upload with an invalid identity signature")
+		return nil, reject(http.StatusForbidden, "Invalid identity signature")
+	}
+
+	return []keyservice.KeySignature{{
+		SignerURN:   owner,
+		SignerKeyID: keyservice.Fingerprint(identityKey),
+		Signature:   upload.IdentitySignature,
+	}}, nil
+}
+
+// writeSignedKey writes entityURN's key, its signatures and its signature
+// chain as JSON.
+func (a *API) writeSignedKey(w http.ResponseWriter, r *http.Request, entityURN urn.URN) {
+	rec, err := a.servableRecord(r.Context(), entityURN)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := signedKeyResponse{keyRecordResponse: newKeyRecordResponse(rec)}
+	for _, signer := range a.SignatureChain(r.Context(), rec) {
+		resp.Chain = append(resp.Chain, newKeyRecordResponse(signer))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// SignatureChain returns the signer of rec, the signer of that key and so
+// on, for as long as each signer still holds the key that made the
+// signature and the caller in ctx may read it. Records are returned without
+// their administrative state.
+func (a *API) SignatureChain(ctx context.Context, rec keyservice.KeyRecord) []keyservice.KeyRecord {
+	var chain []keyservice.KeyRecord
+	seen := map[string]bool{rec.EntityURN.String(): true}
+	for len(chain) < keyservice.MaxSignatureChainDepth {
+		signer, ok := a.currentSigner(ctx, rec, seen)
+		if !ok {
+			break
+		}
+		chain = append(chain, publicRecord(signer))
+		seen[signer.EntityURN.String()] = true
+		rec = signer
+	}
+	return chain
+}
+
+// currentSigner returns the record of the first signer of rec not in seen
+// whose current key made its signature and whom the reader may read.
+func (a *API) currentSigner(ctx context.Context, rec keyservice.KeyRecord, seen map[string]bool) (keyservice.KeyRecord, bool) {
+	for _, sig := range rec.Signatures {
+		if seen[sig.SignerURN.String()] || !a.readPermitted(ctx, sig.SignerURN) {
+			continue
+		}
+		signer, err := a.Store.GetRecord(ctx, sig.SignerURN)
+		if err != nil || signer.Revoked || keyservice.Fingerprint(signer.Key) != sig.SignerKeyID {
+			continue
+		}
+		return signer, true
+	}
+	return keyservice.KeyRecord{}, false
+}
+
+// readPermitted is AuthorizeRead without the logging, for keys returned
+// alongside the one requested.
+func (a *API) readPermitted(ctx context.Context, target urn.URN) bool {
+	if a.ReadMode != keyservice.ReadModeContacts {
+		return true
+	}
+	reader, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return false
+	}
+	allowed, err := a.readAllowed(ctx, reader, target)
+	return err == nil && allowed
+}
+
+// publicRecord strips the administrative state from rec before it is
+// returned to a reader.
+func publicRecord(rec keyservice.KeyRecord) keyservice.KeyRecord {
+	return keyservice.KeyRecord{EntityURN: rec.EntityURN, Key: rec.Key, UpdatedAt: rec.UpdatedAt, Signatures: rec.Signatures}
+}
+
+// accepts reports whether the request's Accept header lists want.
+func accepts(r *http.Request, want string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == want {
+			return true
+		}
+	}
+	return false
+}
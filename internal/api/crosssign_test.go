@@ -0,0 +1,146 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCrossSigning tests identity signatures on device key uploads and the
+// signature chain returned by JSON reads.
+func TestCrossSigning(t *testing.T) {
+	ctx := api.ContextWithUserID(context.Background(), "alice")
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	phoneURN, err := urn.New(urn.SecureMessaging, "device", "alice-phone")
+	require.NoError(t, err)
+
+	identityPub, identityPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	identityKey, err := x509.MarshalPKIXPublicKey(identityPub)
+	require.NoError(t, err)
+	deviceKey := []byte("phone-public-key")
+
+	newAPI := func(t *testing.T) *api.API {
+		store := inmemory.New()
+		devices := inmemory.NewDeviceRegistry()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, identityKey))
+		require.NoError(t, devices.EnrollDevice(ctx, aliceURN, phoneURN))
+		return &api.API{Store: store, Devices: devices, Logger: zerolog.Nop()}
+	}
+	upload := func(apiHandler *api.API, entityURN urn.URN, key []byte, signature []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+entityURN.String(), bytes.NewReader(key)).WithContext(ctx)
+		req.SetPathValue("entityURN", entityURN.String())
+		if signature != nil {
+			req.Header.Set(api.IdentitySignatureHeader, base64.StdEncoding.EncodeToString(signature))
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.StoreKeyHandler(rr, req)
+		return rr
+	}
+	read := func(apiHandler *api.API, entityURN urn.URN) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/keys/"+entityURN.String(), nil)
+		req = req.WithContext(api.ContextWithAPIVersion(req.Context(), keyservice.APIVersionV2))
+		req.SetPathValue("entityURN", entityURN.String())
+		rr := httptest.NewRecorder()
+		apiHandler.GetKeyHandler(rr, req)
+		return rr
+	}
+	signature := ed25519.Sign(identityPriv, keyservice.SignedKeyMessage(phoneURN, deviceKey))
+
+	type signedKey struct {
+		EntityURN  string `json:"entityUrn"`
+		Key        []byte `json:"key"`
+		KeyID      string `json:"keyId"`
+		Signatures []struct {
+			SignerURN   string `json:"signerUrn"`
+			SignerKeyID string `json:"signerKeyId"`
+			Signature   []byte `json:"signature"`
+		} `json:"signatures"`
+		Chain []struct {
+			EntityURN string `json:"entityUrn"`
+			Key       []byte `json:"key"`
+		} `json:"chain"`
+	}
+
+	t.Run("Success - signed device key is returned with its signature chain", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+
+		// Act
+		uploadRR := upload(apiHandler, phoneURN, deviceKey, signature)
+		readRR := read(apiHandler, phoneURN)
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, uploadRR.Code)
+		require.Equal(t, http.StatusOK, readRR.Code)
+		var body signedKey
+		require.NoError(t, json.Unmarshal(readRR.Body.Bytes(), &body))
+		assert.Equal(t, deviceKey, body.Key)
+		assert.Equal(t, keyservice.Fingerprint(deviceKey), body.KeyID)
+		require.Len(t, body.Signatures, 1)
+		assert.Equal(t, aliceURN.String(), body.Signatures[0].SignerURN)
+		assert.Equal(t, keyservice.Fingerprint(identityKey), body.Signatures[0].SignerKeyID)
+		assert.True(t, ed25519.Verify(identityPub, keyservice.SignedKeyMessage(phoneURN, body.Key), body.Signatures[0].Signature))
+		require.Len(t, body.Chain, 1)
+		assert.Equal(t, aliceURN.String(), body.Chain[0].EntityURN)
+		assert.Equal(t, identityKey, body.Chain[0].Key)
+	})
+
+	t.Run("Success - chain ends when the identity key is replaced", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		require.Equal(t, http.StatusCreated, upload(apiHandler, phoneURN, deviceKey, signature).Code)
+		require.NoError(t, apiHandler.Store.StoreKey(ctx, aliceURN, []byte("new-identity-key")))
+
+		// Act
+		rr := read(apiHandler, phoneURN)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body signedKey
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Len(t, body.Signatures, 1)
+		assert.Empty(t, body.Chain)
+	})
+
+	t.Run("Failure - 403 Forbidden for a signature over another key", func(t *testing.T) {
+		apiHandler := newAPI(t)
+
+		rr := upload(apiHandler, phoneURN, []byte("other-key"), signature)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Failure - 400 Bad Request for an unsigned device key when required", func(t *testing.T) {
+		apiHandler := newAPI(t)
+		apiHandler.RequireIdentitySignatures = true
+
+		rr := upload(apiHandler, phoneURN, deviceKey, nil)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Failure - 400 Bad Request for a signed user key", func(t *testing.T) {
+		apiHandler := newAPI(t)
+
+		rr := upload(apiHandler, aliceURN, identityKey, ed25519.Sign(identityPriv, keyservice.SignedKeyMessage(aliceURN, identityKey)))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
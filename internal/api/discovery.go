@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+// discoveryRequest is the JSON body accepted by DiscoveryHandler.
+type discoveryRequest struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+// discoveryResponse is the JSON body returned by DiscoveryHandler.
+// Truncated lists the requested prefixes whose registrations were not all
+// matched, because the prefix has more than keyservice.MaxDiscoveryMatches
+// or the response reached keyservice.MaxDiscoveryResponseMatches.
+type discoveryResponse struct {
+	Matches   []discoveryMatch `json:"matches"`
+	Truncated []string         `json:"truncated"`
+}
+
+// discoveryMatch is the first keyservice.DiscoveryMatchLength characters of
+// a registered identifier hash sharing a requested prefix, and the key of
+// the entity that registered it. Callers compare HashPrefix with the hashes
+// of their contacts and confirm candidates by full hash.
+type discoveryMatch struct {
+	HashPrefix string `json:"hashPrefix"`
+	keyRecordResponse
+}
+
+// DiscoveryHandler manages POST /discovery, private contact discovery by
+// truncated identifier hash. Callers send the first
+// keyservice.DiscoveryPrefixLength characters of their contacts' hashes and
+// get back every registration sharing one of the prefixes, with its key and
+// the first keyservice.DiscoveryMatchLength characters of its hash; the
+// service never sees the hashes of contacts that are not registered, and
+// never hands out full hashes. Callers confirm a candidate by looking up
+// its full hash at /.well-known/keys/hu/{hash}, as they do for contacts in
+// truncated buckets. Each distinct prefix spends one token of the caller's
+// quota, so what one subject learns of the directory grows no faster than
+// DiscoveryRateLimit; what many accounts together learn is bounded only by
+// how many accounts the identity provider hands out, and is counted in
+// keyservice_discovery_prefixes_total for alerting. Keys the caller may not
+// read and revoked keys are left out.
+func (a *API) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	if a.Identifiers == nil || a.DiscoveryQuotas == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Contact discovery is not configured")
+		return
+	}
+	ctx := r.Context()
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		a.Logger.Error().Msg("User ID not found in context; middleware may be misconfigured.")
+		response.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req discoveryRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	limit := a.DiscoveryRateLimit
+	if limit.IsZero() {
+		limit = keyservice.DefaultDiscoveryRateLimit
+	}
+	maxPrefixes := min(keyservice.MaxDiscoveryPrefixes, limit.Burst)
+	prefixes := make([]string, 0, len(req.Prefixes))
+	seen := make(map[string]bool, len(req.Prefixes))
+	for _, prefix := range req.Prefixes {
+		if !keyservice.ValidIdentifierPrefix(prefix) {
+			response.WriteJSONError(w, http.StatusBadRequest, "prefixes must be the first "+strconv.Itoa(keyservice.DiscoveryPrefixLength)+" characters of identifier hashes")
+			return
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 || len(prefixes) > maxPrefixes {
+		response.WriteJSONError(w, http.StatusBadRequest, "prefixes must list between 1 and "+strconv.Itoa(maxPrefixes)+" distinct prefixes")
+		return
+	}
+
+	logger := a.Logger.With().Str("authed_user", principal.Subject).Int("prefixes", len(prefixes)).Logger()
+	if !a.takeDiscoveryQuota(w, r, logger, "discovery:"+principal.Subject, limit, len(prefixes)) {
+		return
+	}
+	discoveryPrefixes.Add(float64(len(prefixes)))
+
+	// The registrations of each prefix are read in one batch, and no more
+	// than MaxDiscoveryResponseMatches in all; prefixes beyond that are
+	// listed as truncated for the caller to confirm by full hash.
+	resp := discoveryResponse{Matches: []discoveryMatch{}, Truncated: []string{}}
+	remaining := keyservice.MaxDiscoveryResponseMatches
+	for _, prefix := range prefixes {
+		if remaining == 0 {
+			resp.Truncated = append(resp.Truncated, prefix)
+			continue
+		}
+		lookupLimit := min(keyservice.MaxDiscoveryMatches, remaining)
+		entries, err := a.Identifiers.LookupPrefix(ctx, prefix, lookupLimit+1)
+		if err != nil {
+			logger.Error().Err(err).Str("prefix", prefix).Msg("Failed to look up identifier prefix")
+			response.WriteJSONError(w, http.StatusInternalServerError, "Failed to look up identifiers")
+			return
+		}
+		if len(entries) > lookupLimit {
+			entries = entries[:lookupLimit]
+			resp.Truncated = append(resp.Truncated, prefix)
+		}
+		remaining -= len(entries)
+
+		readable := make([]keyservice.IdentifierEntry, 0, len(entries))
+		owners := make([]urn.URN, 0, len(entries))
+		for _, entry := range entries {
+			if err := a.AuthorizeRead(ctx, entry.Owner); err != nil {
+				continue
+			}
+			readable = append(readable, entry)
+			owners = append(owners, entry.Owner)
+		}
+		if len(owners) == 0 {
+			continue
+		}
+		records, errs, err := a.servableRecords(ctx, owners)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for i, entry := range readable {
+			if errs[i] != nil {
+				continue
+			}
+			resp.Matches = append(resp.Matches, discoveryMatch{HashPrefix: entry.Hash[:keyservice.DiscoveryMatchLength], keyRecordResponse: newKeyRecordResponse(records[i])})
+		}
+	}
+	logger.Info().Int("matches", len(resp.Matches)).Int("truncated", len(resp.Truncated)).Msg("Served contact discovery")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// discoveryPrefixes counts the hash prefixes served by DiscoveryHandler.
+// Its rate across all callers is how fast the directory is being learned;
+// alert on it to catch enumeration spread over many accounts.
+var discoveryPrefixes = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "keyservice_discovery_prefixes_total",
+	Help: "Hash prefixes served by contact discovery, across all callers.",
+})
+
+// takeDiscoveryQuota spends n tokens of the discovery quota under key,
+// "discovery:" and the caller's subject, writing an error response and
+// returning false if it is exhausted. The quota bounds what the caller can
+// learn, so it fails closed.
+func (a *API) takeDiscoveryQuota(w http.ResponseWriter, r *http.Request, logger zerolog.Logger, key string, limit keyservice.RateLimit, n int) bool {
+	quota, err := a.DiscoveryQuotas.Take(r.Context(), key, limit, n)
+	if err != nil {
+		logger.Error().Err(err).Str("quota", key).Msg("Discovery quota check failed")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to check discovery quota")
+		return false
+	}
+	if !quota.Allowed {
+		logger.Warn().Str("quota", key).Msg("Discovery quota exhausted")
+		if quota.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quota.RetryAfter.Seconds()))))
+		}
+		response.WriteJSONError(w, http.StatusTooManyRequests, "Discovery quota exhausted")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,238 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingQuotas is a RateLimitStore that is down.
+type failingQuotas struct{}
+
+func (failingQuotas) Take(ctx context.Context, key string, limit keyservice.RateLimit, n int) (keyservice.RateLimitResult, error) {
+	return keyservice.RateLimitResult{}, errors.New("quota store unavailable")
+}
+
+// discoveryResult is the JSON body returned by DiscoveryHandler.
+type discoveryResult struct {
+	Matches []struct {
+		HashPrefix string `json:"hashPrefix"`
+		EntityURN  string `json:"entityUrn"`
+		Key        []byte `json:"key"`
+	} `json:"matches"`
+	Truncated []string `json:"truncated"`
+}
+
+// TestDiscoveryHandler tests contact discovery by truncated identifier hash.
+func TestDiscoveryHandler(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	erinURN, err := urn.New(urn.SecureMessaging, "user", "erin")
+	require.NoError(t, err)
+
+	// alice and bob registered hashes sharing a prefix; erin's key is revoked.
+	aliceHash, err := keyservice.HashIdentifier("salt", "alice@example.com")
+	require.NoError(t, err)
+	prefix := aliceHash[:keyservice.DiscoveryPrefixLength]
+	bobHash := prefix + strings.Repeat("y", keyservice.IdentifierHashLength-len(prefix))
+	erinHash := prefix + strings.Repeat("9", keyservice.IdentifierHashLength-len(prefix))
+	carolHash, err := keyservice.HashIdentifier("salt", "carol@example.com")
+	require.NoError(t, err)
+
+	newAPI := func(t *testing.T) *api.API {
+		store := inmemory.New()
+		identifiers := inmemory.NewIdentifierIndex()
+		for entityURN, hash := range map[urn.URN]string{aliceURN: aliceHash, bobURN: bobHash, erinURN: erinHash} {
+			require.NoError(t, store.StoreKey(ctx, entityURN, []byte(entityURN.EntityID()+"-key")))
+			require.NoError(t, identifiers.RegisterIdentifier(ctx, hash, entityURN))
+		}
+		require.NoError(t, store.RevokeKey(ctx, erinURN))
+		return &api.API{
+			Store:              store,
+			Logger:             zerolog.Nop(),
+			Identifiers:        identifiers,
+			DiscoveryQuotas:    inmemory.NewRateLimitStore(),
+			DiscoveryRateLimit: keyservice.RateLimit{Rate: 0.001, Burst: 4},
+		}
+	}
+	discover := func(apiHandler *api.API, subject string, prefixes ...string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string][]string{"prefixes": prefixes})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/discovery", bytes.NewReader(body))
+		if subject != "" {
+			req = req.WithContext(api.ContextWithUserID(req.Context(), subject))
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.DiscoveryHandler(rr, req)
+		return rr
+	}
+
+	t.Run("Returns the servable registrations sharing each prefix", func(t *testing.T) {
+		// Act
+		rr := discover(newAPI(t), "dave", prefix, carolHash[:keyservice.DiscoveryPrefixLength])
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var result discoveryResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		found := make(map[string]string)
+		for _, match := range result.Matches {
+			found[match.HashPrefix] = match.EntityURN
+			assert.Equal(t, []byte(strings.TrimPrefix(match.EntityURN, "urn:sm:user:")+"-key"), match.Key)
+		}
+		matchLength := keyservice.DiscoveryMatchLength
+		assert.Equal(t, map[string]string{aliceHash[:matchLength]: aliceURN.String(), bobHash[:matchLength]: bobURN.String()}, found, "revoked keys are left out")
+		assert.NotContains(t, rr.Body.String(), aliceHash, "full hashes are never handed out")
+		assert.Empty(t, result.Truncated)
+	})
+
+	t.Run("Lists the prefixes whose matches were cut off", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		const zBase32 = "ybndrfg8ejkmcpqxot1uwisza345h769"
+		for i := range keyservice.MaxDiscoveryMatches + 1 {
+			entityURN, err := urn.New(urn.SecureMessaging, "user", fmt.Sprintf("user-%d", i))
+			require.NoError(t, err)
+			hash := strings.Repeat("y", keyservice.IdentifierHashLength-2) + string(zBase32[i/32]) + string(zBase32[i%32])
+			require.NoError(t, apiHandler.Store.StoreKey(ctx, entityURN, []byte("key")))
+			require.NoError(t, apiHandler.Identifiers.RegisterIdentifier(ctx, hash, entityURN))
+		}
+
+		// Act
+		rr := discover(apiHandler, "dave", "yyyy", prefix)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var result discoveryResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		assert.Equal(t, []string{"yyyy"}, result.Truncated)
+		assert.Len(t, result.Matches, keyservice.MaxDiscoveryMatches+2, "a full bucket of yyyy and alice and bob")
+	})
+
+	t.Run("Each distinct prefix spends the caller's quota", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		prefixes := []string{"yyyy", "yyyb", "yyyn"}
+
+		// Act
+		first := discover(apiHandler, "dave", append(prefixes, prefixes...)...)
+		second := discover(apiHandler, "dave", "yyyr", "yyyf")
+		otherCaller := discover(apiHandler, "frank", "yyyr", "yyyf")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, first.Code, "duplicates are charged once")
+		assert.Equal(t, http.StatusTooManyRequests, second.Code)
+		assert.NotEmpty(t, second.Header().Get("Retry-After"))
+		assert.Equal(t, http.StatusOK, otherCaller.Code, "quotas are per subject")
+	})
+
+	t.Run("Reads each prefix's keys in one batch", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		store := &countingStore{Store: apiHandler.Store}
+		apiHandler.Store = store
+
+		// Act
+		rr := discover(apiHandler, "dave", prefix, "yyyy")
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, 0, store.getRecord)
+		assert.Equal(t, 1, store.getRecords, "only prefixes with registrations are read")
+	})
+
+	t.Run("Caps the registrations read per request", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		apiHandler.DiscoveryRateLimit = keyservice.RateLimit{Rate: 0.001, Burst: keyservice.MaxDiscoveryPrefixes}
+		const zBase32 = "ybndrfg8ejkmcpqxot1uwisza345h769"
+		var prefixes []string
+		for p := 0; p*keyservice.MaxDiscoveryMatches < keyservice.MaxDiscoveryResponseMatches; p++ {
+			bucket := "yyy" + string(zBase32[p])
+			prefixes = append(prefixes, bucket)
+			for i := range keyservice.MaxDiscoveryMatches {
+				entityURN, err := urn.New(urn.SecureMessaging, "user", fmt.Sprintf("user-%d-%d", p, i))
+				require.NoError(t, err)
+				hash := bucket + strings.Repeat("y", keyservice.IdentifierHashLength-6) + string(zBase32[i/32]) + string(zBase32[i%32])
+				require.NoError(t, apiHandler.Store.StoreKey(ctx, entityURN, []byte("key")))
+				require.NoError(t, apiHandler.Identifiers.RegisterIdentifier(ctx, hash, entityURN))
+			}
+		}
+
+		// Act
+		rr := discover(apiHandler, "dave", append(prefixes, prefix)...)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var result discoveryResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		assert.Len(t, result.Matches, keyservice.MaxDiscoveryResponseMatches)
+		assert.Equal(t, []string{prefix}, result.Truncated, "prefixes beyond the cap are left for the caller to confirm by full hash")
+	})
+
+	t.Run("Malformed requests are rejected", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+
+		// Act & Assert
+		assert.Equal(t, http.StatusBadRequest, discover(apiHandler, "dave").Code, "no prefixes")
+		assert.Equal(t, http.StatusBadRequest, discover(apiHandler, "dave", aliceHash).Code, "full hash")
+		assert.Equal(t, http.StatusBadRequest, discover(apiHandler, "dave", "yyy").Code, "short prefix")
+		assert.Equal(t, http.StatusBadRequest, discover(apiHandler, "dave", "yyyy", "yyyb", "yyyn", "yyyr", "yyyf").Code, "more prefixes than the quota holds")
+	})
+
+	t.Run("Contacts mode leaves out keys the caller may not read", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		apiHandler.ReadMode = keyservice.ReadModeContacts
+
+		// Act
+		rr := discover(apiHandler, "alice", prefix)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var result discoveryResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.Len(t, result.Matches, 1)
+		assert.Equal(t, aliceHash[:keyservice.DiscoveryMatchLength], result.Matches[0].HashPrefix)
+	})
+
+	t.Run("Requires an authenticated caller", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, discover(newAPI(t), "", prefix).Code)
+	})
+
+	t.Run("Fails closed if quotas cannot be checked", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		apiHandler.DiscoveryQuotas = failingQuotas{}
+
+		// Act & Assert
+		assert.Equal(t, http.StatusInternalServerError, discover(apiHandler, "dave", prefix).Code)
+	})
+
+	t.Run("Disabled without an identifier index", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		apiHandler.Identifiers = nil
+
+		// Act & Assert
+		assert.Equal(t, http.StatusServiceUnavailable, discover(apiHandler, "dave", prefix).Code)
+	})
+}
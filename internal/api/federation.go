@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/federation"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// resolvesRemotely reports whether entityURN's key belongs to a trusted
+// federated domain and must be resolved rather than read from the store.
+// Such keys are only ever written by their own domain's key service.
+func (a *API) resolvesRemotely(entityURN urn.URN) bool {
+	return a.KeyResolver != nil && a.KeyResolver.Resolves(entityURN)
+}
+
+// resolveRecord resolves the key of an entity in a federated domain from
+// that domain's key service, converting failures to the errors reported to
+// the caller.
+func (a *API) resolveRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	logger := a.Logger.With().Str("entity_urn", entityURN.String()).Logger()
+	rec, err := a.KeyResolver.ResolveKey(ctx, entityURN)
+	switch {
+	case errors.Is(err, keyservice.ErrKeyRevoked):
+		logger.Info().Msg("Federated key revoked")
+		return keyservice.KeyRecord{}, reject(http.StatusGone, "Key revoked")
+	case errors.Is(err, keyservice.ErrKeyNotFound):
+		logger.Info().Msg("Federated key not found")
+		return keyservice.KeyRecord{}, reject(http.StatusNotFound, "Key not found")
+	case err != nil:
+		logger.Error().Err(err).Msg("Failed to resolve federated key")
+		return keyservice.KeyRecord{}, reject(http.StatusBadGateway, "Failed to resolve key from its domain")
+	}
+	return rec, nil
+}
+
+// writeFederatedKey writes the key of an entity in a federated domain,
+// resolved from that domain's key service, raw or as JSON like a local key.
+// Federated keys are returned without a signature chain.
+func (a *API) writeFederatedKey(w http.ResponseWriter, r *http.Request, entityURN urn.URN) {
+	rec, err := a.resolveRecord(r.Context(), entityURN)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if wantsSignedKey(r) {
+		writeJSON(w, http.StatusOK, signedKeyResponse{keyRecordResponse: newKeyRecordResponse(rec)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := w.Write(rec.Key); err != nil {
+		a.Logger.Error().Err(err).Str("entity_urn", entityURN.String()).Msg("write fail")
+	}
+}
+
+// FederationDocumentHandler manages GET /.well-known/key-service, describing
+// this key service to the key services of partner domains.
+func (a *API) FederationDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	if a.FederationSigningKey == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Federation is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, federation.NewDocument(a.FederationDomain, a.FederationURL, a.FederationSigningKey.Public().(ed25519.PublicKey)))
+}
+
+// FederatedKeyHandler manages GET /federation/keys/{entityURN}, the lookups
+// made by partner domains' key services. Only entities of FederationDomain
+// are served; every answer, including not found and revoked, is signed.
+func (a *API) FederatedKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if a.FederationSigningKey == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Federation is not configured")
+		return
+	}
+	entityURNStr := r.PathValue("entityURN")
+	entityURN, err := urn.Parse(entityURNStr)
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("raw_urn", entityURNStr).Msg("Invalid URN format")
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format")
+		return
+	}
+	if !a.authorizeRead(w, r, entityURN) {
+		return
+	}
+
+	var rec keyservice.KeyRecord
+	if domain, ok := keyservice.EntityDomain(entityURN); ok && domain == a.FederationDomain {
+		rec, err = a.Store.GetRecord(r.Context(), entityURN)
+		if err != nil && !errors.Is(err, keyservice.ErrKeyNotFound) {
+			a.Logger.Error().Err(err).Str("entity_urn", entityURN.String()).Msg("Failed to get key record")
+			response.WriteJSONError(w, http.StatusInternalServerError, "Failed to get key")
+			return
+		}
+	}
+	resp := federation.NewResponse(a.FederationDomain, entityURN, rec, time.Now())
+	body, signature, err := federation.Sign(resp, a.FederationSigningKey)
+	if err != nil {
+		a.Logger.Error().Err(err).Msg("Failed to sign federation response")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	status := http.StatusOK
+	switch resp.Status {
+	case federation.StatusNotFound:
+		status = http.StatusNotFound
+	case federation.StatusRevoked:
+		status = http.StatusGone
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(federation.KeyIDHeader, keyservice.Fingerprint(a.FederationSigningKey.Public().(ed25519.PublicKey)))
+	w.Header().Set(federation.SignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		a.Logger.Error().Err(err).Msg("write fail")
+	}
+}
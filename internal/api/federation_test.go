@@ -0,0 +1,290 @@
+package api_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/federation"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubResolver resolves the entities of partner.example from a map,
+// failing with err if set.
+type stubResolver struct {
+	records map[string]keyservice.KeyRecord
+	err     error
+}
+
+func (s *stubResolver) Resolves(entityURN urn.URN) bool {
+	domain, ok := keyservice.EntityDomain(entityURN)
+	return ok && domain == "partner.example"
+}
+
+func (s *stubResolver) ResolveKey(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	if s.err != nil {
+		return keyservice.KeyRecord{}, s.err
+	}
+	rec, ok := s.records[entityURN.String()]
+	if !ok {
+		return keyservice.KeyRecord{}, keyservice.ErrKeyNotFound
+	}
+	return rec, nil
+}
+
+// TestGetKeyHandler_Federated tests that GetKeyHandler resolves the keys of
+// federated entities through the KeyResolver.
+func TestGetKeyHandler_Federated(t *testing.T) {
+	ctx := context.Background()
+	carolURN, err := urn.New(urn.SecureMessaging, "user", "carol@partner.example")
+	require.NoError(t, err)
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+
+	newAPI := func(t *testing.T, resolver *stubResolver) *api.API {
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		return &api.API{Store: store, Logger: zerolog.Nop(), KeyResolver: resolver}
+	}
+	get := func(apiHandler *api.API, entityURN urn.URN, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/keys/"+entityURN.String(), nil)
+		req.SetPathValue("entityURN", entityURN.String())
+		if accept != "" {
+			// Only v2 negotiates the representation.
+			req = req.WithContext(api.ContextWithAPIVersion(req.Context(), keyservice.APIVersionV2))
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.GetKeyHandler(rr, req)
+		return rr
+	}
+	resolver := &stubResolver{records: map[string]keyservice.KeyRecord{
+		carolURN.String(): {EntityURN: carolURN, Key: []byte("carol-key")},
+	}}
+
+	t.Run("Raw federated key", func(t *testing.T) {
+		// Act
+		rr := get(newAPI(t, resolver), carolURN, "")
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "carol-key", rr.Body.String())
+	})
+
+	t.Run("JSON federated key", func(t *testing.T) {
+		// Act
+		rr := get(newAPI(t, resolver), carolURN, "application/json")
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, carolURN.String(), body["entityUrn"])
+		assert.Equal(t, keyservice.Fingerprint([]byte("carol-key")), body["keyId"])
+	})
+
+	t.Run("Local keys are still read from the store", func(t *testing.T) {
+		// Act
+		rr := get(newAPI(t, resolver), aliceURN, "")
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "alice-key", rr.Body.String())
+	})
+
+	t.Run("Errors from the federated domain", func(t *testing.T) {
+		testCases := []struct {
+			name       string
+			err        error
+			wantStatus int
+		}{
+			{name: "Not found", err: keyservice.ErrKeyNotFound, wantStatus: http.StatusNotFound},
+			{name: "Revoked", err: keyservice.ErrKeyRevoked, wantStatus: http.StatusGone},
+			{name: "Invalid answer", err: federation.ErrInvalidResponse, wantStatus: http.StatusBadGateway},
+			{name: "Unreachable", err: errors.New("connection refused"), wantStatus: http.StatusBadGateway},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Act
+				rr := get(newAPI(t, &stubResolver{err: tc.err}), carolURN, "")
+
+				// Assert
+				assert.Equal(t, tc.wantStatus, rr.Code)
+			})
+		}
+	})
+}
+
+// TestFederatedKeyHandler tests the signed answers to partner domains'
+// lookups.
+func TestFederatedKeyHandler(t *testing.T) {
+	ctx := context.Background()
+	publicKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	daveURN, err := urn.New(urn.SecureMessaging, "user", "dave@example.com")
+	require.NoError(t, err)
+	erinURN, err := urn.New(urn.SecureMessaging, "user", "erin@example.com")
+	require.NoError(t, err)
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+
+	store := inmemory.New()
+	require.NoError(t, store.StoreKey(ctx, daveURN, []byte("dave-key")))
+	require.NoError(t, store.StoreKey(ctx, erinURN, []byte("erin-key")))
+	require.NoError(t, store.RevokeKey(ctx, erinURN))
+	require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+	apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), FederationSigningKey: signingKey, FederationDomain: "example.com", FederationURL: "https://keys.example.com"}
+
+	lookup := func(apiHandler *api.API, entityURN urn.URN) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/federation/keys/"+entityURN.String(), nil)
+		req.SetPathValue("entityURN", entityURN.String())
+		rr := httptest.NewRecorder()
+		apiHandler.FederatedKeyHandler(rr, req)
+		return rr
+	}
+	verified := func(t *testing.T, rr *httptest.ResponseRecorder) federation.Response {
+		t.Helper()
+		assert.Equal(t, keyservice.Fingerprint(publicKey), rr.Header().Get(federation.KeyIDHeader))
+		signature, err := base64.StdEncoding.DecodeString(rr.Header().Get(federation.SignatureHeader))
+		require.NoError(t, err)
+		require.True(t, ed25519.Verify(publicKey, rr.Body.Bytes(), signature), "answer must be signed")
+		var resp federation.Response
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return resp
+	}
+
+	testCases := []struct {
+		name       string
+		entityURN  urn.URN
+		wantStatus int
+		wantAnswer string
+		wantKey    []byte
+	}{
+		{name: "Found", entityURN: daveURN, wantStatus: http.StatusOK, wantAnswer: federation.StatusFound, wantKey: []byte("dave-key")},
+		{name: "Revoked", entityURN: erinURN, wantStatus: http.StatusGone, wantAnswer: federation.StatusRevoked},
+		{name: "Entity outside the domain", entityURN: aliceURN, wantStatus: http.StatusNotFound, wantAnswer: federation.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			rr := lookup(apiHandler, tc.entityURN)
+
+			// Assert
+			require.Equal(t, tc.wantStatus, rr.Code)
+			resp := verified(t, rr)
+			assert.Equal(t, "example.com", resp.Domain)
+			assert.Equal(t, tc.entityURN.String(), resp.EntityURN)
+			assert.Equal(t, tc.wantAnswer, resp.Status)
+			assert.Equal(t, tc.wantKey, resp.Key)
+		})
+	}
+
+	t.Run("Discovery document lists the signing key", func(t *testing.T) {
+		// Arrange
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.FederationDocumentHandler(rr, httptest.NewRequest(http.MethodGet, keyservice.FederationDiscoveryPath, nil))
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var doc federation.Document
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+		assert.Equal(t, federation.NewDocument("example.com", "https://keys.example.com", publicKey), doc)
+	})
+
+	t.Run("Disabled without a signing key", func(t *testing.T) {
+		// Act
+		rr := lookup(&api.API{Store: store, Logger: zerolog.Nop()}, daveURN)
+
+		// Assert
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
+
+// TestFederatedDomains_ReadsAndWrites tests that every read path resolves
+// the keys of federated entities and that they cannot be written locally.
+func TestFederatedDomains_ReadsAndWrites(t *testing.T) {
+	ctx := context.Background()
+	carolURN, err := urn.New(urn.SecureMessaging, "user", "carol@partner.example")
+	require.NoError(t, err)
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	resolver := &stubResolver{records: map[string]keyservice.KeyRecord{
+		carolURN.String(): {EntityURN: carolURN, Key: []byte("carol-key")},
+	}}
+	newAPI := func(t *testing.T) *api.API {
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		return &api.API{Store: store, Logger: zerolog.Nop(), KeyResolver: resolver}
+	}
+
+	t.Run("Batch reads resolve federated keys", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		// A stale local copy must never be served.
+		require.NoError(t, apiHandler.Store.StoreKey(ctx, carolURN, []byte("forged-key")))
+		daveURN, err := urn.New(urn.SecureMessaging, "user", "dave@partner.example")
+		require.NoError(t, err)
+
+		// Act
+		batch, err := apiHandler.ReadKeys(ctx, []urn.URN{aliceURN, carolURN, daveURN})
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, batch.Keys, 2)
+		assert.Equal(t, []byte("alice-key"), batch.Keys[0].Key)
+		assert.Equal(t, []byte("carol-key"), batch.Keys[1].Key)
+		assert.Equal(t, []urn.URN{daveURN}, batch.NotFound)
+	})
+
+	t.Run("Writes of federated keys are refused", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+carolURN.String(), strings.NewReader("forged-key"))
+		req.SetPathValue("entityURN", carolURN.String())
+		req = req.WithContext(api.ContextWithUserID(req.Context(), "carol@partner.example"))
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.StoreKeyHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		_, err := apiHandler.Store.GetKey(ctx, carolURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyNotFound)
+	})
+
+	t.Run("Federated devices cannot be enrolled", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI(t)
+		apiHandler.Devices = inmemory.NewDeviceRegistry()
+		deviceURN, err := urn.New(urn.SecureMessaging, keyservice.DeviceEntityType, "x@partner.example")
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, "/keys/"+aliceURN.String()+"/devices/"+deviceURN.String(), nil)
+		req.SetPathValue("entityURN", aliceURN.String())
+		req.SetPathValue("deviceURN", deviceURN.String())
+		req = req.WithContext(api.ContextWithUserID(req.Context(), "alice"))
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.EnrollDeviceHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
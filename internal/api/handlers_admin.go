@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/archive"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+)
+
+// maxListPageSize caps the page size a caller may request from ListKeysHandler.
+const maxListPageSize = 1000
+
+// maxImportBytes caps the size of an archive accepted by ImportHandler.
+const maxImportBytes = 256 << 20
+
+// keyRecordResponse is the JSON representation of a stored key record.
+type keyRecordResponse struct {
+	EntityURN string    `json:"entityUrn"`
+	Key       []byte    `json:"key"`
+	UpdatedAt time.Time `json:"updatedAt,omitzero"`
+	Revoked   bool      `json:"revoked,omitempty"`
+	RevokedAt time.Time `json:"revokedAt,omitzero"`
+	Locked    bool      `json:"locked,omitempty"`
+	// KeyID is the keyservice.Fingerprint of Key, which signatures by this
+	// key refer to.
+	KeyID      string                 `json:"keyId,omitempty"`
+	Signatures []keySignatureResponse `json:"signatures,omitempty"`
+}
+
+// newKeyRecordResponse converts a stored record to its JSON representation.
+func newKeyRecordResponse(rec keyservice.KeyRecord) keyRecordResponse {
+	resp := keyRecordResponse{
+		EntityURN: rec.EntityURN.String(),
+		Key:       rec.Key,
+		UpdatedAt: rec.UpdatedAt,
+		Revoked:   rec.Revoked,
+		RevokedAt: rec.RevokedAt,
+		Locked:    rec.Locked,
+	}
+	resp.KeyID = keyservice.Fingerprint(rec.Key)
+	for _, sig := range rec.Signatures {
+		resp.Signatures = append(resp.Signatures, keySignatureResponse{
+			SignerURN:   sig.SignerURN.String(),
+			SignerKeyID: sig.SignerKeyID,
+			Signature:   sig.Signature,
+		})
+	}
+	return resp
+}
+
+// listKeysResponse is the JSON body returned by ListKeysHandler.
+type listKeysResponse struct {
+	Keys          []keyRecordResponse `json:"keys"`
+	NextPageToken string              `json:"nextPageToken,omitempty"`
+}
+
+// AdminOnly rejects requests whose authenticated user is neither one of the
+// configured AdminSubjects nor holds the AdminRole. It must run after the
+// authentication middleware and ClaimsMiddleware.
+func (a *API) AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			a.Logger.Error().Msg("User ID not found in context; middleware may be misconfigured.")
+			response.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		hasRole := a.AdminRole != "" && claimContainsString(principal.Claims[a.AdminRoleClaim], a.AdminRole)
+		if !hasRole && !slices.Contains(a.AdminSubjects, principal.Subject) {
+			a.Logger.Warn().Str("authed_user", principal.Subject).Str("path", r.URL.Path).Msg("Authorization failed: User is not an administrator.")
+			response.WriteJSONError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListKeysHandler manages GET /admin/keys, returning one page of stored key
+// records. Supported query parameters are entityType, updatedSince (RFC 3339),
+// pageSize and pageToken. Clients that accept NDJSONContentType get every
+// record from pageToken on instead, one per line, streamed a page of
+// pageSize records at a time.
+func (a *API) ListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := keyservice.ListFilter{EntityType: query.Get("entityType")}
+
+	if raw := query.Get("updatedSince"); raw != "" {
+		updatedSince, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			response.WriteJSONError(w, http.StatusBadRequest, "updatedSince must be an RFC 3339 timestamp")
+			return
+		}
+		filter.UpdatedSince = updatedSince
+	}
+	if raw := query.Get("pageSize"); raw != "" {
+		pageSize, err := strconv.Atoi(raw)
+		if err != nil || pageSize < 1 || pageSize > maxListPageSize {
+			response.WriteJSONError(w, http.StatusBadRequest, "pageSize must be between 1 and "+strconv.Itoa(maxListPageSize))
+			return
+		}
+		filter.PageSize = pageSize
+	}
+	if accepts(r, NDJSONContentType) {
+		a.streamListKeys(w, r, filter, query.Get("pageToken"))
+		return
+	}
+
+	page, err := a.Store.ListKeys(r.Context(), filter, query.Get("pageToken"))
+	if err != nil {
+		a.Logger.Error().Err(err).Msg("Failed to list keys")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to list keys")
+		return
+	}
+
+	resp := listKeysResponse{Keys: make([]keyRecordResponse, 0, len(page.Records)), NextPageToken: page.NextPageToken}
+	for _, rec := range page.Records {
+		resp.Keys = append(resp.Keys, newKeyRecordResponse(rec))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ExportHandler manages GET /admin/export, streaming every key record as a
+// signed archive. The format query parameter selects ndjson (default) or tar.
+func (a *API) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if a.ArchiveSigningKey == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Export is not configured")
+		return
+	}
+	format, err := archive.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "format must be ndjson or tar")
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="keys.`+string(format)+`"`)
+	manifest, err := archive.Export(r.Context(), a.Store, w, format, a.ArchiveSigningKey)
+	if err != nil {
+		// The response has already started; the missing manifest makes the
+		// truncated archive unimportable.
+		a.Logger.Error().Err(err).Msg("Export failed mid-stream")
+		return
+	}
+	a.Logger.Info().Int("record_count", manifest.RecordCount).Str("sha256", manifest.SHA256).Msg("Exported key archive")
+}
+
+// ImportHandler manages POST /admin/import. The archive format is taken from
+// the format query parameter, or from the Content-Type header. Nothing is
+// written unless the manifest verifies against a trusted key.
+func (a *API) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	if len(a.ArchiveTrustedKeys) == 0 {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Import is not configured")
+		return
+	}
+	rawFormat := r.URL.Query().Get("format")
+	if rawFormat == "" && r.Header.Get("Content-Type") == archive.FormatTar.ContentType() {
+		rawFormat = string(archive.FormatTar)
+	}
+	format, err := archive.ParseFormat(rawFormat)
+	if err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "format must be ndjson or tar")
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	records, manifest, err := archive.Read(body, format, a.ArchiveTrustedKeys)
+	if err != nil {
+		a.Logger.Warn().Err(err).Msg("Rejected key archive")
+		if errors.Is(err, archive.ErrInvalidArchive) {
+			response.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteJSONError(w, http.StatusBadRequest, "Cannot read request body")
+		return
+	}
+
+	// The import as a whole is announced before any record is written,
+	// and its outcome recorded with an event for every record written.
+	importEvent := keyservice.AuditEvent{Action: "admin:import", NewFingerprint: manifest.SHA256}
+	origin := httpOrigin(r)
+	if err := a.intend(r.Context(), origin, importEvent); err != nil {
+		writeError(w, err)
+		return
+	}
+	report, err := archive.Load(r.Context(), a.Store, records)
+	events := make([]keyservice.AuditEvent, 0, len(report.Writes)+1)
+	errs := make([]error, 0, len(report.Writes)+1)
+	events = append(events, importEvent)
+	errs = append(errs, err)
+	for _, write := range report.Writes {
+		events = append(events, keyservice.AuditEvent{
+			Action:         "admin:import",
+			EntityURN:      write.Record.EntityURN.String(),
+			OldFingerprint: keyservice.Fingerprint(write.PreviousKey),
+			NewFingerprint: keyservice.Fingerprint(write.Record.Key),
+		})
+		errs = append(errs, write.Err)
+	}
+	a.recordAll(r.Context(), origin, events, errs)
+	if err != nil {
+		a.Logger.Error().Err(err).Int("imported", report.Imported).Msg("Import failed")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to import keys")
+		return
+	}
+	a.Logger.Info().Int("imported", report.Imported).Int("unchanged", report.Unchanged).Int("stale", len(report.Stale)).Str("sha256", manifest.SHA256).Msg("Imported key archive")
+	writeJSON(w, http.StatusOK, report)
+}
+
+// writeJSON encodes v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
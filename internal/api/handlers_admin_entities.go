@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// maxBulkOperations caps the number of entities in one BulkAdminHandler call.
+const maxBulkOperations = 1000
+
+// AdminOperation is an administrative action on a single entity.
+type AdminOperation string
+
+const (
+	// AdminRevoke stops the entity's key from being served.
+	AdminRevoke AdminOperation = "revoke"
+	// AdminLock rejects further uploads for the entity.
+	AdminLock AdminOperation = "lock"
+	// AdminUnlock accepts uploads for the entity again.
+	AdminUnlock AdminOperation = "unlock"
+)
+
+// bulkRequest is the JSON body accepted by BulkAdminHandler.
+type bulkRequest struct {
+	Operation  AdminOperation `json:"operation"`
+	EntityURNs []string       `json:"entityUrns"`
+}
+
+// bulkResult is the outcome of a bulk operation for one entity. Status is
+// ok, not_found, invalid or error.
+type bulkResult struct {
+	EntityURN string `json:"entityUrn"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// bulkResponse is the JSON body returned by BulkAdminHandler.
+type bulkResponse struct {
+	Results []bulkResult `json:"results"`
+}
+
+// InspectKeyHandler manages GET /admin/keys/{entityURN}, returning the full
+// record of an entity including revoked keys and its lock.
+func (a *API) InspectKeyHandler(w http.ResponseWriter, r *http.Request) {
+	entityURN, ok := a.adminPathURN(w, r)
+	if !ok {
+		return
+	}
+	rec, err := a.Store.GetRecord(r.Context(), entityURN)
+	if errors.Is(err, keyservice.ErrKeyNotFound) {
+		response.WriteJSONError(w, http.StatusNotFound, "Key not found")
+		return
+	}
+	if err != nil {
+		a.Logger.Error().Err(err).Str("entity_urn", entityURN.String()).Msg("Failed to inspect key")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to inspect key")
+		return
+	}
+	writeJSON(w, http.StatusOK, newKeyRecordResponse(rec))
+}
+
+// RevokeKeyHandler manages POST /admin/keys/{entityURN}/revoke.
+func (a *API) RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	a.adminEntityOperation(w, r, AdminRevoke)
+}
+
+// LockEntityHandler manages PUT /admin/keys/{entityURN}/lock.
+func (a *API) LockEntityHandler(w http.ResponseWriter, r *http.Request) {
+	a.adminEntityOperation(w, r, AdminLock)
+}
+
+// UnlockEntityHandler manages DELETE /admin/keys/{entityURN}/lock.
+func (a *API) UnlockEntityHandler(w http.ResponseWriter, r *http.Request) {
+	a.adminEntityOperation(w, r, AdminUnlock)
+}
+
+// BulkAdminHandler manages POST /admin/bulk, applying one operation to up to
+// maxBulkOperations entities. Each entity is processed on its own and the
+// attempts are recorded in the audit log together; the response lists a
+// result per entity in request order.
+func (a *API) BulkAdminHandler(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	switch req.Operation {
+	case AdminRevoke, AdminLock, AdminUnlock:
+	default:
+		response.WriteJSONError(w, http.StatusBadRequest, "operation must be revoke, lock or unlock")
+		return
+	}
+	if len(req.EntityURNs) == 0 || len(req.EntityURNs) > maxBulkOperations {
+		response.WriteJSONError(w, http.StatusBadRequest, "entityUrns must list between 1 and "+strconv.Itoa(maxBulkOperations)+" entities")
+		return
+	}
+
+	resp := bulkResponse{Results: make([]bulkResult, len(req.EntityURNs))}
+	entityURNs := make([]urn.URN, 0, len(req.EntityURNs))
+	positions := make([]int, 0, len(req.EntityURNs))
+	for i, raw := range req.EntityURNs {
+		resp.Results[i] = bulkResult{EntityURN: raw, Status: "ok"}
+		entityURN, err := urn.Parse(raw)
+		if err != nil {
+			resp.Results[i].Status, resp.Results[i].Error = "invalid", "Invalid URN format"
+			continue
+		}
+		entityURNs = append(entityURNs, entityURN)
+		positions = append(positions, i)
+	}
+
+	// The previous keys are read in one batch and the audit events
+	// appended together, as for batch uploads.
+	var oldFingerprints []string
+	if req.Operation == AdminRevoke {
+		oldFingerprints = a.currentFingerprints(r.Context(), entityURNs)
+	}
+	events := make([]keyservice.AuditEvent, len(entityURNs))
+	for j, entityURN := range entityURNs {
+		events[j] = adminEvent(req.Operation, entityURN)
+		if oldFingerprints != nil {
+			events[j].OldFingerprint = oldFingerprints[j]
+		}
+	}
+	origin := httpOrigin(r)
+	if err := a.intend(r.Context(), origin, events...); err != nil {
+		writeError(w, err)
+		return
+	}
+	errs := make([]error, len(entityURNs))
+	for j, entityURN := range entityURNs {
+		errs[j] = a.performAdminOperation(r.Context(), req.Operation, entityURN)
+		result := &resp.Results[positions[j]]
+		switch {
+		case errors.Is(errs[j], keyservice.ErrKeyNotFound):
+			result.Status, result.Error = "not_found", "Key not found"
+		case errs[j] != nil:
+			result.Status, result.Error = "error", "Operation failed"
+		}
+	}
+	a.recordAll(r.Context(), origin, events, errs)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// adminEntityOperation applies op to the entity in the request path.
+func (a *API) adminEntityOperation(w http.ResponseWriter, r *http.Request, op AdminOperation) {
+	entityURN, ok := a.adminPathURN(w, r)
+	if !ok {
+		return
+	}
+	err := a.applyAdminOperation(r, op, entityURN)
+	if errors.Is(err, keyservice.ErrKeyNotFound) {
+		response.WriteJSONError(w, http.StatusNotFound, "Key not found")
+		return
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		writeError(w, err)
+		return
+	}
+	if err != nil {
+		response.WriteJSONError(w, http.StatusInternalServerError, "Operation failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyAdminOperation performs op on entityURN, recording it in the audit
+// trail.
+func (a *API) applyAdminOperation(r *http.Request, op AdminOperation, entityURN urn.URN) error {
+	event := adminEvent(op, entityURN)
+	if op == AdminRevoke {
+		event.OldFingerprint = a.currentFingerprint(r.Context(), entityURN)
+	}
+	origin := httpOrigin(r)
+	if err := a.intend(r.Context(), origin, event); err != nil {
+		return err
+	}
+	err := a.performAdminOperation(r.Context(), op, entityURN)
+	a.record(r.Context(), origin, event, err)
+	return err
+}
+
+// adminEvent returns the audit event for op on entityURN. The caller fills
+// in the old fingerprint of a revoked key.
+func adminEvent(op AdminOperation, entityURN urn.URN) keyservice.AuditEvent {
+	return keyservice.AuditEvent{Action: "admin:" + string(op), EntityURN: entityURN.String()}
+}
+
+// performAdminOperation performs op on entityURN without recording it.
+func (a *API) performAdminOperation(ctx context.Context, op AdminOperation, entityURN urn.URN) error {
+	var err error
+	switch op {
+	case AdminRevoke:
+		err = a.Store.RevokeKey(ctx, entityURN)
+	case AdminLock:
+		err = a.Store.SetLocked(ctx, entityURN, true)
+	case AdminUnlock:
+		err = a.Store.SetLocked(ctx, entityURN, false)
+	}
+	if err != nil && !errors.Is(err, keyservice.ErrKeyNotFound) {
+		a.Logger.Error().Err(err).Str("operation", string(op)).Str("entity_urn", entityURN.String()).Msg("Admin operation failed")
+	}
+	return err
+}
+
+// adminPathURN parses the entity URN from the request path, writing a 400
+// response if it is invalid.
+func (a *API) adminPathURN(w http.ResponseWriter, r *http.Request) (urn.URN, bool) {
+	entityURNStr := r.PathValue("entityURN")
+	entityURN, err := urn.Parse(entityURNStr)
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("raw_urn", entityURNStr).Msg("Invalid URN format in request path")
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format in request path")
+		return urn.URN{}, false
+	}
+	return entityURN, true
+}
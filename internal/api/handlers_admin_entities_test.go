@@ -0,0 +1,189 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdminEntityHandlers tests the inspect, revoke, lock and unlock handlers.
+func TestAdminEntityHandlers(t *testing.T) {
+	ctx := context.Background()
+	testURN, err := urn.New(urn.SecureMessaging, "user", "user-123")
+	require.NoError(t, err)
+	missingURN, err := urn.New(urn.SecureMessaging, "user", "missing")
+	require.NoError(t, err)
+
+	newRequest := func(method, target string, entityURN string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetPathValue("entityURN", entityURN)
+		return req.WithContext(api.ContextWithUserID(ctx, "admin-1"))
+	}
+
+	t.Run("Success - revoked key is no longer served but can be inspected", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, testURN, []byte("my-public-key")))
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+
+		// Act
+		revokeRR := httptest.NewRecorder()
+		apiHandler.RevokeKeyHandler(revokeRR, newRequest(http.MethodPost, "/admin/keys/"+testURN.String()+"/revoke", testURN.String()))
+		inspectRR := httptest.NewRecorder()
+		apiHandler.InspectKeyHandler(inspectRR, newRequest(http.MethodGet, "/admin/keys/"+testURN.String(), testURN.String()))
+
+		// Assert
+		assert.Equal(t, http.StatusNoContent, revokeRR.Code)
+		_, err := store.GetKey(ctx, testURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyRevoked)
+
+		require.Equal(t, http.StatusOK, inspectRR.Code)
+		var body struct {
+			EntityURN string `json:"entityUrn"`
+			Key       []byte `json:"key"`
+			Revoked   bool   `json:"revoked"`
+		}
+		require.NoError(t, json.Unmarshal(inspectRR.Body.Bytes(), &body))
+		assert.Equal(t, testURN.String(), body.EntityURN)
+		assert.Equal(t, []byte("my-public-key"), body.Key)
+		assert.True(t, body.Revoked)
+	})
+
+	t.Run("Success - lock rejects uploads until unlocked", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+
+		// Act & Assert
+		rr := httptest.NewRecorder()
+		apiHandler.LockEntityHandler(rr, newRequest(http.MethodPut, "/admin/keys/"+testURN.String()+"/lock", testURN.String()))
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.ErrorIs(t, store.StoreKey(ctx, testURN, []byte("key")), keyservice.ErrEntityLocked)
+
+		rr = httptest.NewRecorder()
+		apiHandler.UnlockEntityHandler(rr, newRequest(http.MethodDelete, "/admin/keys/"+testURN.String()+"/lock", testURN.String()))
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.NoError(t, store.StoreKey(ctx, testURN, []byte("key")))
+	})
+
+	t.Run("Failure - 404 Not Found when revoking an unknown entity", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.RevokeKeyHandler(rr, newRequest(http.MethodPost, "/admin/keys/"+missingURN.String()+"/revoke", missingURN.String()))
+
+		// Assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Failure - 400 Bad Request for an invalid URN", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.InspectKeyHandler(rr, newRequest(http.MethodGet, "/admin/keys/not-a-urn", "not-a-urn"))
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+// TestBulkAdminHandler tests the POST /admin/bulk endpoint handler.
+func TestBulkAdminHandler(t *testing.T) {
+	ctx := context.Background()
+	testURN, err := urn.New(urn.SecureMessaging, "user", "user-123")
+	require.NoError(t, err)
+	missingURN, err := urn.New(urn.SecureMessaging, "user", "missing")
+	require.NoError(t, err)
+
+	bulk := func(apiHandler *api.API, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/bulk", bytes.NewBufferString(body))
+		req = req.WithContext(api.ContextWithUserID(ctx, "admin-1"))
+		rr := httptest.NewRecorder()
+		apiHandler.BulkAdminHandler(rr, req)
+		return rr
+	}
+
+	t.Run("Success - reports a result per entity", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, testURN, []byte("my-public-key")))
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		body := `{"operation":"revoke","entityUrns":["` + testURN.String() + `","` + missingURN.String() + `","not-a-urn"]}`
+
+		// Act
+		rr := bulk(apiHandler, body)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp struct {
+			Results []struct {
+				EntityURN string `json:"entityUrn"`
+				Status    string `json:"status"`
+			} `json:"results"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Len(t, resp.Results, 3)
+		assert.Equal(t, "ok", resp.Results[0].Status)
+		assert.Equal(t, "not_found", resp.Results[1].Status)
+		assert.Equal(t, "invalid", resp.Results[2].Status)
+		_, err := store.GetKey(ctx, testURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyRevoked)
+	})
+
+	t.Run("Reads the previous keys and appends the audit events in one batch each", func(t *testing.T) {
+		// Arrange
+		store := &countingStore{Store: inmemory.New()}
+		require.NoError(t, store.StoreKey(ctx, testURN, []byte("my-public-key")))
+		sink := &countingSink{AuditSink: inmemory.NewAuditSink()}
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), AuditSink: sink}
+		body := `{"operation":"revoke","entityUrns":["` + testURN.String() + `","` + missingURN.String() + `","not-a-urn"]}`
+
+		// Act
+		rr := bulk(apiHandler, body)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, 0, store.getRecord)
+		assert.Equal(t, 1, store.getRecords)
+		assert.Equal(t, 0, sink.append)
+		assert.Equal(t, 1, sink.appendAll)
+		events, err := sink.List(ctx, 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, keyservice.AuditSuccess, events[0].Outcome)
+		assert.Equal(t, keyservice.Fingerprint([]byte("my-public-key")), events[0].OldFingerprint)
+		assert.Equal(t, missingURN.String(), events[1].EntityURN)
+		assert.Equal(t, keyservice.AuditFailure, events[1].Outcome)
+	})
+
+	t.Run("Failure - 400 Bad Request for an unknown operation", func(t *testing.T) {
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+
+		rr := bulk(apiHandler, `{"operation":"delete","entityUrns":["`+testURN.String()+`"]}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Failure - 400 Bad Request without entities", func(t *testing.T) {
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+
+		rr := bulk(apiHandler, `{"operation":"lock","entityUrns":[]}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,216 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdminOnly tests the administrator check applied to the /admin routes.
+func TestAdminOnly(t *testing.T) {
+	apiHandler := &api.API{Logger: zerolog.Nop(), AdminSubjects: []string{"admin-1"}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	t.Run("Success - administrator passes through", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+		req = req.WithContext(api.ContextWithUserID(context.Background(), "admin-1"))
+		rr := httptest.NewRecorder()
+
+		apiHandler.AdminOnly(next).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("Failure - 403 Forbidden for other users", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+		req = req.WithContext(api.ContextWithUserID(context.Background(), "user-123"))
+		rr := httptest.NewRecorder()
+
+		apiHandler.AdminOnly(next).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Success - holder of the admin role passes through", func(t *testing.T) {
+		roleHandler := &api.API{Logger: zerolog.Nop(), AdminRoleClaim: "roles", AdminRole: "key-admin"}
+		ctx := api.ContextWithUserID(context.Background(), "user-123")
+		ctx = api.ContextWithClaims(ctx, map[string]any{"sub": "user-123", "roles": []any{"reader", "key-admin"}})
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		roleHandler.AdminOnly(next).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+}
+
+// TestListKeysHandler tests the GET /admin/keys endpoint handler.
+func TestListKeysHandler(t *testing.T) {
+	testURN, err := urn.New(urn.SecureMessaging, "device", "device-abc")
+	require.NoError(t, err)
+	updatedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	logger := zerolog.Nop()
+
+	t.Run("Success - filters are passed to the store", func(t *testing.T) {
+		// Arrange
+		expectedFilter := keyservice.ListFilter{EntityType: "device", UpdatedSince: updatedAt, PageSize: 10}
+		mockStore := new(MockStore)
+		mockStore.On("ListKeys", mock.Anything, expectedFilter, "token-1").Return(keyservice.KeyPage{
+			Records:       []keyservice.KeyRecord{{EntityURN: testURN, Key: []byte("device-key"), UpdatedAt: updatedAt}},
+			NextPageToken: "token-2",
+		}, nil)
+
+		apiHandler := &api.API{Store: mockStore, Logger: logger}
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys?entityType=device&updatedSince=2025-01-02T03:04:05Z&pageSize=10&pageToken=token-1", nil)
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.ListKeysHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var body struct {
+			Keys []struct {
+				EntityURN string    `json:"entityUrn"`
+				Key       []byte    `json:"key"`
+				UpdatedAt time.Time `json:"updatedAt"`
+			} `json:"keys"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		require.Len(t, body.Keys, 1)
+		assert.Equal(t, testURN.String(), body.Keys[0].EntityURN)
+		assert.Equal(t, []byte("device-key"), body.Keys[0].Key)
+		assert.True(t, updatedAt.Equal(body.Keys[0].UpdatedAt))
+		assert.Equal(t, "token-2", body.NextPageToken)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Failure - invalid updatedSince", func(t *testing.T) {
+		// Arrange
+		mockStore := new(MockStore)
+		apiHandler := &api.API{Store: mockStore, Logger: logger}
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys?updatedSince=yesterday", nil)
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.ListKeysHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		var errResp response.APIError
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+		assert.Equal(t, "updatedSince must be an RFC 3339 timestamp", errResp.Error)
+		mockStore.AssertNotCalled(t, "ListKeys", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+// TestExportImportHandlers tests GET /admin/export and POST /admin/import
+// together against in-memory stores.
+func TestExportImportHandlers(t *testing.T) {
+	testURN, err := urn.New(urn.SecureMessaging, "user", "user-123")
+	require.NoError(t, err)
+	publicKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	logger := zerolog.Nop()
+
+	source := inmemory.New()
+	require.NoError(t, source.StoreKey(context.Background(), testURN, []byte("my-public-key")))
+
+	t.Run("Success - exported archive imports into another store", func(t *testing.T) {
+		// Arrange
+		exporter := &api.API{Store: source, Logger: logger, ArchiveSigningKey: signingKey}
+		exportReq := httptest.NewRequest(http.MethodGet, "/admin/export?format=tar", nil)
+		exportRR := httptest.NewRecorder()
+		exporter.ExportHandler(exportRR, exportReq)
+		require.Equal(t, http.StatusOK, exportRR.Code)
+		assert.Equal(t, "application/x-tar", exportRR.Header().Get("Content-Type"))
+
+		destination := inmemory.New()
+		importer := &api.API{Store: destination, Logger: logger, ArchiveTrustedKeys: []ed25519.PublicKey{publicKey}}
+		importReq := httptest.NewRequest(http.MethodPost, "/admin/import", bytes.NewReader(exportRR.Body.Bytes()))
+		importReq.Header.Set("Content-Type", "application/x-tar")
+		importRR := httptest.NewRecorder()
+
+		// Act
+		importer.ImportHandler(importRR, importReq)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, importRR.Code)
+		assert.JSONEq(t, `{"imported":1,"unchanged":0}`, importRR.Body.String())
+		key, err := destination.GetKey(context.Background(), testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("my-public-key"), key)
+	})
+
+	t.Run("Success - import records an audit event per record written", func(t *testing.T) {
+		// Arrange
+		exporter := &api.API{Store: source, Logger: logger, ArchiveSigningKey: signingKey}
+		exportRR := httptest.NewRecorder()
+		exporter.ExportHandler(exportRR, httptest.NewRequest(http.MethodGet, "/admin/export", nil))
+		require.Equal(t, http.StatusOK, exportRR.Code)
+
+		sink := inmemory.NewAuditSink()
+		importer := &api.API{Store: inmemory.New(), Logger: logger, AuditSink: sink, RequireAuditLog: true, ArchiveTrustedKeys: []ed25519.PublicKey{publicKey}}
+		importRR := httptest.NewRecorder()
+
+		// Act
+		importer.ImportHandler(importRR, httptest.NewRequest(http.MethodPost, "/admin/import", bytes.NewReader(exportRR.Body.Bytes())))
+
+		// Assert
+		require.Equal(t, http.StatusOK, importRR.Code)
+		events, err := sink.List(context.Background(), 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		assert.Equal(t, keyservice.AuditPending, events[0].Outcome)
+		assert.Empty(t, events[0].EntityURN)
+		assert.Equal(t, events[0].NewFingerprint, events[1].NewFingerprint)
+		assert.Equal(t, keyservice.AuditSuccess, events[1].Outcome)
+		assert.Equal(t, "admin:import", events[2].Action)
+		assert.Equal(t, testURN.String(), events[2].EntityURN)
+		assert.Equal(t, keyservice.Fingerprint([]byte("my-public-key")), events[2].NewFingerprint)
+		assert.Equal(t, keyservice.AuditSuccess, events[2].Outcome)
+	})
+
+	t.Run("Failure - import of an unsigned archive", func(t *testing.T) {
+		// Arrange
+		destination := inmemory.New()
+		importer := &api.API{Store: destination, Logger: logger, ArchiveTrustedKeys: []ed25519.PublicKey{publicKey}}
+		body := `{"record":{"entityUrn":"` + testURN.String() + `","key":"bXkta2V5"}}` + "\n"
+		req := httptest.NewRequest(http.MethodPost, "/admin/import", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+
+		// Act
+		importer.ImportHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		_, err := destination.GetKey(context.Background(), testURN)
+		assert.Error(t, err)
+	})
+
+	t.Run("Failure - export without a signing key", func(t *testing.T) {
+		apiHandler := &api.API{Store: source, Logger: logger}
+		rr := httptest.NewRecorder()
+
+		apiHandler.ExportHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/export", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
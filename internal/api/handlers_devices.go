@@ -0,0 +1,257 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/illmade-knight/go-key-service/internal/proof"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// listDeviceKeysResponse is the JSON body returned by ListDeviceKeysHandler.
+type listDeviceKeysResponse struct {
+	Devices []keyRecordResponse `json:"devices"`
+}
+
+// EnrollDeviceHandler manages PUT /keys/{entityURN}/devices/{deviceURN},
+// making the entity the owner of the device. A device that already has a
+// key can only be enrolled with its consent: the caller must be the device,
+// or send in ChallengeHeader a nonce from EnrollmentChallengeHandler and in
+// SignatureHeader the device key's signature over
+// keyservice.EnrollmentMessage. Otherwise enrolling would let the caller
+// overwrite the key of a device they do not hold. As the challenge is
+// single use, a consent cannot be replayed to enroll the device again after
+// it has been unenrolled.
+func (a *API) EnrollDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	owner, device, ok := a.authorizeDeviceChange(w, r)
+	if !ok {
+		return
+	}
+
+	logger := a.Logger.With().Str("owner_urn", owner.String()).Str("device_urn", device.String()).Logger()
+	if err := a.checkDeviceConsent(r, owner, device); err != nil {
+		logger.Warn().Err(err).Msg("Rejected enrollment of a device with a stored key")
+		writeError(w, err)
+		return
+	}
+	event := keyservice.AuditEvent{Action: "devices:enroll", EntityURN: device.String()}
+	origin := httpOrigin(r)
+	if err := a.intend(r.Context(), origin, event); err != nil {
+		writeError(w, err)
+		return
+	}
+	err := a.Devices.EnrollDevice(r.Context(), owner, device)
+	a.record(r.Context(), origin, event, err)
+	if err != nil {
+		if errors.Is(err, keyservice.ErrDeviceOwnedByOther) {
+			logger.Warn().Err(err).Msg("Device is already enrolled to another owner")
+			response.WriteJSONError(w, http.StatusConflict, "Device is enrolled to another owner")
+			return
+		}
+		logger.Error().Err(err).Msg("Failed to enroll device")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to enroll device")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	logger.Info().Msg("Enrolled device")
+}
+
+// EnrollmentChallengeHandler manages POST
+// /keys/{entityURN}/devices/{deviceURN}/challenge, issuing a single-use
+// nonce for the device to sign when consenting to its enrollment. Only
+// callers who may manage the entity's devices get one.
+func (a *API) EnrollmentChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if a.Challenges == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Enrollment challenges are not configured")
+		return
+	}
+	_, device, ok := a.authorizeDeviceChange(w, r)
+	if !ok {
+		return
+	}
+
+	ttl := a.ChallengeTTL
+	if ttl <= 0 {
+		ttl = keyservice.DefaultChallengeTTL
+	}
+	challenge, err := a.Challenges.Issue(r.Context(), device, ttl)
+	if err != nil {
+		a.Logger.Error().Err(err).Str("device_urn", device.String()).Msg("Failed to issue enrollment challenge")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to issue challenge")
+		return
+	}
+	writeJSON(w, http.StatusOK, challengeResponse{Nonce: challenge.Nonce, ExpiresAt: challenge.ExpiresAt})
+}
+
+// UnenrollDeviceHandler manages DELETE /keys/{entityURN}/devices/{deviceURN},
+// removing the entity's ownership of the device. The device's key is kept.
+func (a *API) UnenrollDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	owner, device, ok := a.authorizeDeviceChange(w, r)
+	if !ok {
+		return
+	}
+
+	logger := a.Logger.With().Str("owner_urn", owner.String()).Str("device_urn", device.String()).Logger()
+	event := keyservice.AuditEvent{Action: "devices:unenroll", EntityURN: device.String()}
+	origin := httpOrigin(r)
+	if err := a.intend(r.Context(), origin, event); err != nil {
+		writeError(w, err)
+		return
+	}
+	err := a.Devices.UnenrollDevice(r.Context(), owner, device)
+	a.record(r.Context(), origin, event, err)
+	if err != nil {
+		if errors.Is(err, keyservice.ErrDeviceNotEnrolled) {
+			response.WriteJSONError(w, http.StatusNotFound, "Device not enrolled")
+			return
+		}
+		logger.Error().Err(err).Msg("Failed to unenroll device")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to unenroll device")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	logger.Info().Msg("Unenrolled device")
+}
+
+// ListDeviceKeysHandler manages GET /keys/{entityURN}/devices, returning the
+// keys of every device the entity owns. Like GetKeyHandler it is subject to
+// the ReadMode. Devices without a stored key, or with a revoked one, are
+// omitted.
+func (a *API) ListDeviceKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if a.Devices == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Device registry is not configured")
+		return
+	}
+	entityURNStr := r.PathValue("entityURN")
+	owner, err := urn.Parse(entityURNStr)
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("raw_urn", entityURNStr).Msg("Invalid URN format")
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format")
+		return
+	}
+	if !a.authorizeRead(w, r, owner) {
+		return
+	}
+
+	logger := a.Logger.With().Str("owner_urn", owner.String()).Logger()
+	devices, err := a.Devices.ListDevices(r.Context(), owner)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list devices")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to list devices")
+		return
+	}
+
+	resp := listDeviceKeysResponse{Devices: make([]keyRecordResponse, 0, len(devices))}
+	for _, device := range devices {
+		rec, err := a.servableRecord(r.Context(), device)
+		var apiErr *Error
+		if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.Status == http.StatusGone) {
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("device_urn", device.String()).Msg("Failed to get device key")
+			response.WriteJSONError(w, http.StatusInternalServerError, "Failed to get device keys")
+			return
+		}
+		resp.Devices = append(resp.Devices, keyRecordResponse{EntityURN: device.String(), Key: rec.Key})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checkDeviceConsent checks that a device with a stored key, even a revoked
+// one, consents to being enrolled to owner. Devices owner already owns and
+// devices without a key need no consent.
+func (a *API) checkDeviceConsent(r *http.Request, owner, device urn.URN) error {
+	ctx := r.Context()
+	if current, err := a.Devices.OwnerOf(ctx, device); err == nil && current.String() == owner.String() {
+		return nil
+	} else if err != nil && !errors.Is(err, keyservice.ErrDeviceNotEnrolled) {
+		return err
+	}
+	rec, err := a.Store.GetRecord(ctx, device)
+	if errors.Is(err, keyservice.ErrKeyNotFound) || (err == nil && rec.Key == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok && principal.Subject == device.EntityID() {
+		return nil
+	}
+
+	raw := r.Header.Get(SignatureHeader)
+	nonce := r.Header.Get(ChallengeHeader)
+	if raw == "" || nonce == "" {
+		return reject(http.StatusForbidden, "Device already has a key: enrollment must be signed by the device key over a challenge from POST /keys/{entityURN}/devices/{deviceURN}/challenge")
+	}
+	signature, err := decodeSignature(raw)
+	if err != nil {
+		return reject(http.StatusBadRequest, "Invalid "+SignatureHeader+" header")
+	}
+	signingKey, ok := proof.ParseSigningKey(rec.Key)
+	if !ok {
+		return reject(http.StatusForbidden, "Device already has a key that cannot sign an enrollment")
+	}
+	if a.Challenges == nil {
+		return reject(http.StatusServiceUnavailable, "Enrollment challenges are not configured")
+	}
+	if err := a.Challenges.Consume(ctx, device, nonce); err != nil {
+		if errors.Is(err, keyservice.ErrChallengeInvalid) {
+			return reject(http.StatusForbidden, "Invalid or expired challenge")
+		}
+		return err
+	}
+	if err := proof.Verify(signingKey, keyservice.EnrollmentMessage(nonce, owner, device), signature); err != nil {
+		return reject(http.StatusForbidden, "Invalid enrollment signature")
+	}
+	return nil
+}
+
+// authorizeDeviceChange parses the owner and device URNs from the request
+// path and checks that the caller may manage the owner's devices. It writes
+// the error response and returns false if the request must not proceed.
+func (a *API) authorizeDeviceChange(w http.ResponseWriter, r *http.Request) (owner, device urn.URN, ok bool) {
+	if a.Devices == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Device registry is not configured")
+		return owner, device, false
+	}
+	principal, found := PrincipalFromContext(r.Context())
+	if !found {
+		a.Logger.Error().Msg("User ID not found in context; middleware may be misconfigured.")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return owner, device, false
+	}
+
+	owner, err := urn.Parse(r.PathValue("entityURN"))
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("raw_urn", r.PathValue("entityURN")).Msg("Invalid URN format in request path")
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format in request path")
+		return owner, device, false
+	}
+	device, err = urn.Parse(r.PathValue("deviceURN"))
+	if err != nil || device.EntityType() != keyservice.DeviceEntityType {
+		a.Logger.Warn().Err(err).Str("raw_urn", r.PathValue("deviceURN")).Msg("Invalid device URN in request path")
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid device URN in request path")
+		return owner, device, false
+	}
+	if a.resolvesRemotely(owner) || a.resolvesRemotely(device) {
+		a.Logger.Warn().Str("authed_user", principal.Subject).Str("target_urn", device.String()).Msg("Rejected device change in a federated domain")
+		response.WriteJSONError(w, http.StatusForbidden, "Keys of federated domains are managed by their own key service")
+		return owner, device, false
+	}
+
+	allowed, err := a.authorizer().Authorize(r.Context(), principal, keyservice.ActionManageDevices, owner)
+	if err != nil {
+		a.Logger.Error().Err(err).Str("authed_user", principal.Subject).Str("target_urn", owner.String()).Msg("Authorization check failed")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return owner, device, false
+	}
+	if !allowed {
+		a.Logger.Warn().Str("authed_user", principal.Subject).Str("target_urn", owner.String()).Msg("Authorization failed: User attempted to manage another entity's devices.")
+		response.WriteJSONError(w, http.StatusForbidden, "Forbidden")
+		return owner, device, false
+	}
+	return owner, device, true
+}
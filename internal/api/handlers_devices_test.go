@@ -0,0 +1,280 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deviceRequest builds a request for the device routes, authenticated as
+// userID unless it is empty.
+func deviceRequest(method string, owner, device urn.URN, userID string, body []byte) *http.Request {
+	target := "/keys/" + owner.String() + "/devices"
+	if !device.IsZero() {
+		target += "/" + device.String()
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.SetPathValue("entityURN", owner.String())
+	if !device.IsZero() {
+		req.SetPathValue("deviceURN", device.String())
+	}
+	if userID != "" {
+		req = req.WithContext(api.ContextWithUserID(context.Background(), userID))
+	}
+	return req
+}
+
+// TestDeviceOwnership tests enrollment, device key writes by the owner and
+// listing an owner's device keys.
+func TestDeviceOwnership(t *testing.T) {
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	phone, err := urn.New(urn.SecureMessaging, "device", "phone")
+	require.NoError(t, err)
+	tablet, err := urn.New(urn.SecureMessaging, "device", "tablet")
+	require.NoError(t, err)
+
+	newAPI := func() *api.API {
+		return &api.API{Store: inmemory.New(), Logger: zerolog.Nop(), Devices: inmemory.NewDeviceRegistry(), Challenges: inmemory.NewChallengeStore()}
+	}
+
+	t.Run("Success - owner enrolls a device and stores its key", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+
+		// Act: enroll, then store the device key as its owner
+		enrollRR := httptest.NewRecorder()
+		apiHandler.EnrollDeviceHandler(enrollRR, deviceRequest(http.MethodPut, alice, phone, "alice", nil))
+
+		storeReq := httptest.NewRequest(http.MethodPost, "/keys/"+phone.String(), bytes.NewReader([]byte("phone-key")))
+		storeReq.SetPathValue("entityURN", phone.String())
+		storeReq = storeReq.WithContext(api.ContextWithUserID(context.Background(), "alice"))
+		storeRR := httptest.NewRecorder()
+		apiHandler.StoreKeyHandler(storeRR, storeReq)
+
+		// Assert
+		assert.Equal(t, http.StatusNoContent, enrollRR.Code)
+		assert.Equal(t, http.StatusCreated, storeRR.Code)
+	})
+
+	t.Run("Failure - 403 storing the key of a device owned by someone else", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.NoError(t, apiHandler.Devices.EnrollDevice(context.Background(), alice, phone))
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+phone.String(), bytes.NewReader([]byte("phone-key")))
+		req.SetPathValue("entityURN", phone.String())
+		req = req.WithContext(api.ContextWithUserID(context.Background(), "mallory"))
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.StoreKeyHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Failure - 403 enrolling a device for another user", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.EnrollDeviceHandler(rr, deviceRequest(http.MethodPut, alice, phone, "mallory", nil))
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Failure - 409 enrolling a device owned by someone else", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+		require.NoError(t, err)
+		require.NoError(t, apiHandler.Devices.EnrollDevice(context.Background(), bob, phone))
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.EnrollDeviceHandler(rr, deviceRequest(http.MethodPut, alice, phone, "alice", nil))
+
+		// Assert
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Failure - 403 taking over a device that already has a key", func(t *testing.T) {
+		// Arrange: the phone published its key before anyone enrolled it.
+		apiHandler := newAPI()
+		bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+		require.NoError(t, err)
+		require.NoError(t, apiHandler.Store.StoreKey(context.Background(), phone, []byte("phone-key")))
+
+		// Act: bob enrolls the phone, then overwrites its key
+		enrollRR := httptest.NewRecorder()
+		apiHandler.EnrollDeviceHandler(enrollRR, deviceRequest(http.MethodPut, bob, phone, "bob", nil))
+		storeReq := httptest.NewRequest(http.MethodPost, "/keys/"+phone.String(), bytes.NewReader([]byte("bob-key")))
+		storeReq.SetPathValue("entityURN", phone.String())
+		storeReq = storeReq.WithContext(api.ContextWithUserID(context.Background(), "bob"))
+		storeRR := httptest.NewRecorder()
+		apiHandler.StoreKeyHandler(storeRR, storeReq)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, enrollRR.Code)
+		assert.Equal(t, http.StatusForbidden, storeRR.Code)
+		key, err := apiHandler.Store.GetKey(context.Background(), phone)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("phone-key"), key)
+	})
+
+	// enrollmentChallenge fetches an enrollment challenge for phone as alice.
+	enrollmentChallenge := func(t *testing.T, apiHandler *api.API) string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		req := deviceRequest(http.MethodPost, alice, phone, "alice", nil)
+		apiHandler.EnrollmentChallengeHandler(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var challenge struct {
+			Nonce string `json:"nonce"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+		return challenge.Nonce
+	}
+	signedEnrollment := func(priv ed25519.PrivateKey, nonce string, device urn.URN) *http.Request {
+		req := deviceRequest(http.MethodPut, alice, phone, "alice", nil)
+		req.Header.Set(api.ChallengeHeader, nonce)
+		req.Header.Set(api.SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, keyservice.EnrollmentMessage(nonce, alice, device))))
+		return req
+	}
+
+	t.Run("Success - enrolling a device with a key signed by the device", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		phoneKey, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		require.NoError(t, apiHandler.Store.StoreKey(context.Background(), phone, phoneKey))
+		forged := signedEnrollment(priv, enrollmentChallenge(t, apiHandler), tablet)
+		signed := signedEnrollment(priv, enrollmentChallenge(t, apiHandler), phone)
+
+		// Act
+		forgedRR := httptest.NewRecorder()
+		apiHandler.EnrollDeviceHandler(forgedRR, forged)
+		signedRR := httptest.NewRecorder()
+		apiHandler.EnrollDeviceHandler(signedRR, signed)
+		againRR := httptest.NewRecorder()
+		apiHandler.EnrollDeviceHandler(againRR, deviceRequest(http.MethodPut, alice, phone, "alice", nil))
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, forgedRR.Code)
+		assert.Equal(t, http.StatusNoContent, signedRR.Code)
+		assert.Equal(t, http.StatusNoContent, againRR.Code, "re-enrolling to the same owner needs no signature")
+	})
+
+	t.Run("Failure - an enrollment consent cannot be replayed", func(t *testing.T) {
+		// Arrange: alice enrolls the phone with its consent, then the phone
+		// leaves her.
+		apiHandler := newAPI()
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		phoneKey, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		require.NoError(t, apiHandler.Store.StoreKey(context.Background(), phone, phoneKey))
+		nonce := enrollmentChallenge(t, apiHandler)
+		firstRR := httptest.NewRecorder()
+		apiHandler.EnrollDeviceHandler(firstRR, signedEnrollment(priv, nonce, phone))
+		require.Equal(t, http.StatusNoContent, firstRR.Code)
+		require.NoError(t, apiHandler.Devices.UnenrollDevice(context.Background(), alice, phone))
+
+		// Act
+		replayRR := httptest.NewRecorder()
+		apiHandler.EnrollDeviceHandler(replayRR, signedEnrollment(priv, nonce, phone))
+		unsignedRR := httptest.NewRecorder()
+		unsigned := deviceRequest(http.MethodPut, alice, phone, "alice", nil)
+		unsigned.Header.Set(api.SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, keyservice.EnrollmentMessage("", alice, phone))))
+		apiHandler.EnrollDeviceHandler(unsignedRR, unsigned)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, replayRR.Code)
+		assert.Equal(t, http.StatusForbidden, unsignedRR.Code, "a signature without a challenge is refused")
+	})
+
+	t.Run("Failure - 400 when the device URN is not a device", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.EnrollDeviceHandler(rr, deviceRequest(http.MethodPut, alice, alice, "alice", nil))
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Success - unenroll, then 404 for an unknown device", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.NoError(t, apiHandler.Devices.EnrollDevice(context.Background(), alice, phone))
+
+		// Act
+		firstRR := httptest.NewRecorder()
+		apiHandler.UnenrollDeviceHandler(firstRR, deviceRequest(http.MethodDelete, alice, phone, "alice", nil))
+		secondRR := httptest.NewRecorder()
+		apiHandler.UnenrollDeviceHandler(secondRR, deviceRequest(http.MethodDelete, alice, phone, "alice", nil))
+
+		// Assert
+		assert.Equal(t, http.StatusNoContent, firstRR.Code)
+		assert.Equal(t, http.StatusNotFound, secondRR.Code)
+	})
+
+	t.Run("Success - lists the keys of enrolled devices", func(t *testing.T) {
+		// Arrange: two devices, only one of which has published a key.
+		apiHandler := newAPI()
+		ctx := context.Background()
+		require.NoError(t, apiHandler.Devices.EnrollDevice(ctx, alice, phone))
+		require.NoError(t, apiHandler.Devices.EnrollDevice(ctx, alice, tablet))
+		require.NoError(t, apiHandler.Store.StoreKey(ctx, phone, []byte("phone-key")))
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.ListDeviceKeysHandler(rr, deviceRequest(http.MethodGet, alice, urn.URN{}, "", nil))
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body struct {
+			Devices []struct {
+				EntityURN string `json:"entityUrn"`
+				Key       []byte `json:"key"`
+			} `json:"devices"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		require.Len(t, body.Devices, 1)
+		assert.Equal(t, phone.String(), body.Devices[0].EntityURN)
+		assert.Equal(t, []byte("phone-key"), body.Devices[0].Key)
+	})
+
+	t.Run("Failure - 503 without a device registry", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.EnrollDeviceHandler(rr, deviceRequest(http.MethodPut, alice, phone, "alice", nil))
+
+		// Assert
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
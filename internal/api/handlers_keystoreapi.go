@@ -2,9 +2,14 @@ package api
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/illmade-knight/go-key-service/internal/authz"
 	"github.com/illmade-knight/go-key-service/pkg/keyservice"
 	"github.com/illmade-knight/go-microservice-base/pkg/response" // ADDED: Import the new response helper
 	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
@@ -16,6 +21,101 @@ type API struct {
 	Store     keyservice.Store
 	Logger    zerolog.Logger
 	JWTSecret string
+	// AdminSubjects lists the JWT subjects allowed to call the /admin routes.
+	AdminSubjects []string
+	// AdminRoleClaim and AdminRole also admit callers whose token claim
+	// AdminRoleClaim holds AdminRole. Unused if AdminRole is empty.
+	AdminRoleClaim string
+	AdminRole      string
+	// ArchiveSigningKey signs exported archives; export is disabled if nil.
+	ArchiveSigningKey ed25519.PrivateKey
+	// ArchiveTrustedKeys verify imported archives; import is disabled if empty.
+	ArchiveTrustedKeys []ed25519.PublicKey
+	// Authorizer decides who may write which keys. If nil, the
+	// keyservice.DefaultPolicy is enforced; keyservice.New always sets it.
+	Authorizer keyservice.Authorizer
+	// Devices records device ownership; the device routes are disabled if
+	// nil.
+	Devices keyservice.DeviceRegistry
+	// ReadMode controls who may fetch keys; empty means public.
+	ReadMode keyservice.ReadMode
+	// ReadAuthorizer decides which other entities' keys a reader may fetch
+	// in contacts mode. If nil, readers may only fetch their own keys.
+	ReadAuthorizer keyservice.ReadAuthorizer
+	// AuditSink receives a hash-chained record of every key mutation. If
+	// nil, mutations are only audited in the log. Failed appends are
+	// counted in keyservice_audit_append_failures_total.
+	AuditSink keyservice.AuditSink
+	// RequireAuditLog appends a pending audit event before every mutation
+	// and refuses the mutation with 503 Service Unavailable, without
+	// applying it, if that append fails.
+	RequireAuditLog bool
+	// RequireProofOfPossession makes uploads of signature-capable keys
+	// carry a signature over a challenge issued by Challenges.
+	RequireProofOfPossession bool
+	// Challenges issues proof-of-possession challenges; the challenge route
+	// is disabled if nil.
+	Challenges keyservice.ChallengeStore
+	// ChallengeTTL bounds how long a challenge stays valid; zero means
+	// keyservice.DefaultChallengeTTL.
+	ChallengeTTL time.Duration
+	// RequireIdentitySignatures makes device key uploads carry a signature
+	// by the owner's identity key.
+	RequireIdentitySignatures bool
+	// KeyResolver resolves the keys of entities in trusted federated
+	// domains for GetKeyHandler. If nil, every key is read from Store.
+	KeyResolver keyservice.KeyResolver
+	// FederationSigningKey signs the answers to partner domains' lookups;
+	// the federation routes are disabled if nil. FederationDomain is the
+	// lower-case domain whose entities they serve and FederationURL the
+	// HTTPS base URL partners reach this service at.
+	FederationSigningKey ed25519.PrivateKey
+	FederationDomain     string
+	FederationURL        string
+	// Identifiers maps hashed external identifiers to entities for the
+	// well-known hashed identifier lookup, which is disabled if nil.
+	// Uploads may only register the hashes, under IdentifierSalt, of the
+	// caller's verified email address and phone number; registration is
+	// disabled if IdentifierSalt is empty.
+	Identifiers    keyservice.IdentifierIndex
+	IdentifierSalt string
+	// DiscoveryQuotas holds each subject's POST /discovery quota of hash
+	// prefixes, refilled at DiscoveryRateLimit, where zero means
+	// keyservice.DefaultDiscoveryRateLimit. Discovery is disabled if
+	// DiscoveryQuotas or Identifiers is nil.
+	DiscoveryQuotas    keyservice.RateLimitStore
+	DiscoveryRateLimit keyservice.RateLimit
+
+	defaultAuthorizerOnce sync.Once
+	defaultAuthorizer     keyservice.Authorizer
+}
+
+// authorizer returns the configured Authorizer or, built once, one
+// enforcing keyservice.DefaultPolicy against Devices. Should the default
+// policy fail to build, every authorization check fails with the error.
+func (a *API) authorizer() keyservice.Authorizer {
+	if a.Authorizer != nil {
+		return a.Authorizer
+	}
+	a.defaultAuthorizerOnce.Do(func() {
+		defaultAuthorizer, err := authz.NewPolicyAuthorizer(keyservice.DefaultPolicy(), authz.WithDeviceRegistry(a.Devices))
+		if err != nil {
+			a.defaultAuthorizer = failedAuthorizer{err: err}
+			return
+		}
+		a.defaultAuthorizer = defaultAuthorizer
+	})
+	return a.defaultAuthorizer
+}
+
+// failedAuthorizer denies every request with the error that prevented the
+// real Authorizer from being built.
+type failedAuthorizer struct {
+	err error
+}
+
+func (f failedAuthorizer) Authorize(ctx context.Context, principal keyservice.Principal, action keyservice.Action, target urn.URN) (bool, error) {
+	return false, f.err
 }
 
 type contextKey string
@@ -37,16 +137,6 @@ func ContextWithUserID(ctx context.Context, userID string) context.Context {
 
 // StoreKeyHandler manages the POST requests for entity keys.
 func (a *API) StoreKeyHandler(w http.ResponseWriter, r *http.Request) {
-	// 1. Get the authenticated user's ID securely from the JWT context.
-	authedUserID, ok := GetUserIDFromContext(r.Context())
-	if !ok {
-		a.Logger.Error().Msg("User ID not found in context; middleware may be misconfigured.")
-		// CHANGED: Use standardized JSON error response
-		response.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
-		return
-	}
-
-	// 2. Get the target URN from the URL path.
 	entityURNStr := r.PathValue("entityURN")
 	entityURN, err := urn.Parse(entityURNStr)
 	if err != nil {
@@ -56,35 +146,46 @@ func (a *API) StoreKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. THE CRITICAL SECURITY CHECK:
-	if authedUserID != entityURN.EntityID() {
-		a.Logger.Warn().Str("authed_user", authedUserID).Str("target_urn", entityURN.String()).Msg("Authorization failed: User attempted to store key for another entity.")
-		// CHANGED: Use standardized JSON error response
-		response.WriteJSONError(w, http.StatusForbidden, "Forbidden")
-		return
-	}
-
-	logger := a.Logger.With().Str("entity_urn", entityURN.String()).Logger()
 	key, err := io.ReadAll(r.Body)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to read request body")
+		a.Logger.Error().Err(err).Str("entity_urn", entityURN.String()).Msg("Failed to read request body")
 		response.WriteJSONError(w, http.StatusBadRequest, "Cannot read request body")
 		return
 	}
 
-	logger.Info().Int("byteLength", len(key)).Msg("[Checkpoint 2: RECEIPT] Key received from client")
+	upload := KeyUpload{
+		EntityURN:     entityURN,
+		Key:           key,
+		Challenge:     r.Header.Get(ChallengeHeader),
+		SigningKeyURN: r.Header.Get(SigningKeyURNHeader),
+	}
+	// A missing or malformed proof is reported as missing.
+	upload.ProofSignature, _ = decodeSignature(r.Header.Get(SignatureHeader))
+	if raw := r.Header.Get(IdentitySignatureHeader); raw != "" {
+		upload.IdentitySignature, err = decodeSignature(raw)
+		if err != nil {
+			response.WriteJSONError(w, http.StatusBadRequest, "Invalid identity signature encoding")
+			return
+		}
+	}
+	upload.IdentifierHashes, err = parseIdentifierHashes(r.Header.Get(IdentifierHashesHeader))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-	if err := a.Store.StoreKey(r.Context(), entityURN, key); err != nil {
-		logger.Error().Err(err).Msg("Failed to store key")
-		// CHANGED: Use standardized JSON error response
-		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to store key")
+	if err := a.StoreKey(r.Context(), httpOrigin(r), upload); err != nil {
+		writeError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
-	logger.Info().Msg("Successfully stored public key")
 }
 
-// GetKeyHandler remains public as clients need to fetch others' public keys.
+// GetKeyHandler is public by default as clients need to fetch others' public
+// keys; the ReadMode can restrict it. Clients that accept application/json,
+// and v2 clients that do not ask for application/octet-stream, get the key
+// with its signatures and signature chain instead of the raw key. Keys of
+// entities in trusted federated domains are resolved through KeyResolver.
 func (a *API) GetKeyHandler(w http.ResponseWriter, r *http.Request) {
 	entityURNStr := r.PathValue("entityURN")
 	entityURN, err := urn.Parse(entityURNStr)
@@ -94,9 +195,31 @@ func (a *API) GetKeyHandler(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format")
 		return
 	}
+	if !a.authorizeRead(w, r, entityURN) {
+		return
+	}
+	a.writeKey(w, r, entityURN)
+}
+
+// writeKey replies with entityURN's key in the representation the client
+// asked for. The caller must already be authorized to read it.
+func (a *API) writeKey(w http.ResponseWriter, r *http.Request, entityURN urn.URN) {
+	if a.resolvesRemotely(entityURN) {
+		a.writeFederatedKey(w, r, entityURN)
+		return
+	}
+	if wantsSignedKey(r) {
+		a.writeSignedKey(w, r, entityURN)
+		return
+	}
 
 	logger := a.Logger.With().Str("entity_urn", entityURN.String()).Logger()
 	key, err := a.Store.GetKey(r.Context(), entityURN)
+	if errors.Is(err, keyservice.ErrKeyRevoked) {
+		logger.Info().Msg("Key revoked")
+		response.WriteJSONError(w, http.StatusGone, "Key revoked")
+		return
+	}
 	if err != nil {
 		logger.Warn().Err(err).Msg("Key not found")
 		// CHANGED: Use standardized JSON error response
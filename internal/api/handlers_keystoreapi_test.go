@@ -13,6 +13,8 @@ import (
 	"testing"
 
 	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/authz"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
 	"github.com/illmade-knight/go-microservice-base/pkg/response" // ADDED: For the APIError struct
 	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
 	"github.com/rs/zerolog"
@@ -32,6 +34,18 @@ func (m *MockStore) StoreKey(ctx context.Context, entityURN urn.URN, key []byte)
 	return args.Error(0)
 }
 
+// StoreSignedKey is the mock implementation for storing a signed key.
+func (m *MockStore) StoreSignedKey(ctx context.Context, entityURN urn.URN, key []byte, signatures []keyservice.KeySignature) error {
+	args := m.Called(ctx, entityURN, key, signatures)
+	return args.Error(0)
+}
+
+// StoreKeys is the mock implementation for storing keys in bulk.
+func (m *MockStore) StoreKeys(ctx context.Context, writes []keyservice.KeyWrite) []error {
+	args := m.Called(ctx, writes)
+	return args.Get(0).([]error)
+}
+
 // GetKey is the mock implementation for retrieving a key.
 func (m *MockStore) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error) {
 	args := m.Called(ctx, entityURN)
@@ -41,6 +55,42 @@ func (m *MockStore) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, erro
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+// ListKeys is the mock implementation for listing keys.
+func (m *MockStore) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	args := m.Called(ctx, filter, pageToken)
+	return args.Get(0).(keyservice.KeyPage), args.Error(1)
+}
+
+// GetRecord is the mock implementation for inspecting a key record.
+func (m *MockStore) GetRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	args := m.Called(ctx, entityURN)
+	return args.Get(0).(keyservice.KeyRecord), args.Error(1)
+}
+
+// GetRecords is the mock implementation for reading many records.
+func (m *MockStore) GetRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, error) {
+	args := m.Called(ctx, entityURNs)
+	return args.Get(0).([]keyservice.KeyRecord), args.Error(1)
+}
+
+// RevokeKey is the mock implementation for revoking a key.
+func (m *MockStore) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	args := m.Called(ctx, entityURN)
+	return args.Error(0)
+}
+
+// SetLocked is the mock implementation for locking an entity.
+func (m *MockStore) SetLocked(ctx context.Context, entityURN urn.URN, locked bool) error {
+	args := m.Called(ctx, entityURN, locked)
+	return args.Error(0)
+}
+
+// ReplaceRecord is the mock implementation for replacing a record.
+func (m *MockStore) ReplaceRecord(ctx context.Context, rec keyservice.KeyRecord, previousKey []byte) error {
+	args := m.Called(ctx, rec, previousKey)
+	return args.Error(0)
+}
+
 // TestStoreKeyHandler tests the POST /keys/{entityURN} endpoint handler.
 func TestStoreKeyHandler(t *testing.T) {
 	testURN, err := urn.New(urn.SecureMessaging, "user", "user-123")
@@ -98,6 +148,57 @@ func TestStoreKeyHandler(t *testing.T) {
 		mockStore.AssertNotCalled(t, "StoreKey", mock.Anything, mock.Anything, mock.Anything)
 	})
 
+	t.Run("Success - custom authorization policy", func(t *testing.T) {
+		// Arrange: a group key published by a group administrator.
+		groupURN, err := urn.New(urn.SecureMessaging, "group", "team-1")
+		require.NoError(t, err)
+		authorizer, err := authz.NewPolicyAuthorizer(keyservice.Policy{Rules: []keyservice.PolicyRule{{
+			Effect:      keyservice.EffectAllow,
+			EntityTypes: []string{"group"},
+			Claims:      map[string]string{"roles": "group-admin"},
+		}}})
+		require.NoError(t, err)
+		mockStore := new(MockStore)
+		mockStore.On("StoreKey", mock.Anything, groupURN, []byte(testKey)).Return(nil)
+
+		apiHandler := &api.API{Store: mockStore, Logger: logger, Authorizer: authorizer}
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+groupURN.String(), bytes.NewReader([]byte(testKey)))
+		req.SetPathValue("entityURN", groupURN.String())
+		ctx := api.ContextWithUserID(context.Background(), "user-123")
+		ctx = api.ContextWithClaims(ctx, map[string]any{"roles": []any{"group-admin"}})
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.StoreKeyHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Failure - 423 Locked", func(t *testing.T) {
+		// Arrange
+		mockStore := new(MockStore)
+		mockStore.On("StoreKey", mock.Anything, testURN, []byte(testKey)).Return(keyservice.ErrEntityLocked)
+
+		apiHandler := &api.API{Store: mockStore, Logger: logger}
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+testURN.String(), bytes.NewReader([]byte(testKey)))
+		req.SetPathValue("entityURN", testURN.String())
+		req = req.WithContext(api.ContextWithUserID(context.Background(), "user-123"))
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.StoreKeyHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusLocked, rr.Code)
+		var errResp response.APIError
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+		assert.Equal(t, "Entity is locked", errResp.Error)
+		mockStore.AssertExpectations(t)
+	})
+
 	t.Run("Failure - Invalid URN", func(t *testing.T) {
 		// Arrange
 		mockStore := new(MockStore)
@@ -174,6 +275,27 @@ func TestGetKeyHandler(t *testing.T) {
 		assert.Equal(t, "Key not found", errResp.Error)
 		mockStore.AssertExpectations(t)
 	})
+
+	t.Run("Failure - 410 Gone for a revoked key", func(t *testing.T) {
+		// Arrange
+		mockStore := new(MockStore)
+		mockStore.On("GetKey", mock.Anything, testURN).Return(nil, keyservice.ErrKeyRevoked)
+
+		apiHandler := &api.API{Store: mockStore, Logger: logger}
+		req := httptest.NewRequest(http.MethodGet, "/keys/"+testURN.String(), nil)
+		req.SetPathValue("entityURN", testURN.String())
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.GetKeyHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusGone, rr.Code)
+		var errResp response.APIError
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+		assert.Equal(t, "Key revoked", errResp.Error)
+		mockStore.AssertExpectations(t)
+	})
 }
 
 // NOTE: To make ContextWithUserID accessible, you may need to export it
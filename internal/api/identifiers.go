@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Headers of the hashed identifier lookup.
+const (
+	// IdentifierHashesHeader carries the comma-separated hashes, from
+	// keyservice.HashIdentifier, under which a key upload registers its
+	// entity.
+	IdentifierHashesHeader = "X-Identifier-Hashes"
+	// EntityURNHeader names the entity whose key answers a hashed
+	// identifier lookup.
+	EntityURNHeader = "X-Entity-URN"
+)
+
+// parseIdentifierHashes splits the value of IdentifierHashesHeader,
+// rejecting malformed hashes and more than keyservice.MaxIdentifierHashes.
+func parseIdentifierHashes(header string) ([]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+	var hashes []string
+	for _, hash := range strings.Split(header, ",") {
+		hash = strings.TrimSpace(hash)
+		if !keyservice.ValidIdentifierHash(hash) {
+			return nil, reject(http.StatusBadRequest, "Invalid identifier hash")
+		}
+		hashes = append(hashes, hash)
+	}
+	if len(hashes) > keyservice.MaxIdentifierHashes {
+		return nil, reject(http.StatusBadRequest, "Too many identifier hashes")
+	}
+	return hashes, nil
+}
+
+// checkIdentifiers checks that the caller may register the upload's
+// identifier hashes: each must be the hash of an email address or phone
+// number the identity provider verified for the caller, and must not be held
+// by another entity. The hashes are only registered once the key is stored.
+func (a *API) checkIdentifiers(ctx context.Context, principal keyservice.Principal, upload KeyUpload) error {
+	if len(upload.IdentifierHashes) == 0 {
+		return nil
+	}
+	if a.Identifiers == nil || a.IdentifierSalt == "" {
+		return reject(http.StatusServiceUnavailable, "Identifier registration is not configured")
+	}
+	logger := a.Logger.With().Str("entity_urn", upload.EntityURN.String()).Str("authed_user", principal.Subject).Logger()
+	verified := make(map[string]bool)
+	for _, identifier := range keyservice.VerifiedIdentifiers(principal.Claims) {
+		if hash, err := keyservice.HashIdentifier(a.IdentifierSalt, identifier); err == nil {
+			verified[hash] = true
+		}
+	}
+	for _, hash := range upload.IdentifierHashes {
+		if !verified[hash] {
+			logger.Warn().Str("identifier_hash", hash).Msg("Rejected identifier hash the caller has not verified")
+			return reject(http.StatusForbidden, "Identifier hash does not match a verified email address or phone number of the caller")
+		}
+		owner, err := a.Identifiers.LookupIdentifier(ctx, hash)
+		if errors.Is(err, keyservice.ErrIdentifierNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("identifier_hash", hash).Msg("Failed to look up identifier hash")
+			return reject(http.StatusInternalServerError, "Failed to register identifier hash")
+		}
+		if owner.String() != upload.EntityURN.String() {
+			logger.Warn().Str("identifier_hash", hash).Msg("Rejected identifier hash registered to another entity")
+			return reject(http.StatusConflict, "Identifier hash is registered to another entity")
+		}
+	}
+	return nil
+}
+
+// registerIdentifiers maps the upload's identifier hashes, already checked
+// by checkIdentifiers, to its entity once its key is stored. A hash another
+// entity registered in the meantime is reported as a conflict; the key
+// stays stored.
+func (a *API) registerIdentifiers(ctx context.Context, upload KeyUpload) error {
+	if len(upload.IdentifierHashes) == 0 {
+		return nil
+	}
+	logger := a.Logger.With().Str("entity_urn", upload.EntityURN.String()).Logger()
+	for _, hash := range upload.IdentifierHashes {
+		err := a.Identifiers.RegisterIdentifier(ctx, hash, upload.EntityURN)
+		if errors.Is(err, keyservice.ErrIdentifierTaken) {
+			logger.Warn().Str("identifier_hash", hash).Msg("Identifier hash was registered to another entity during the upload")
+			return reject(http.StatusConflict, "Key stored, but an identifier hash is registered to another entity")
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("identifier_hash", hash).Msg("Failed to register identifier hash")
+			return reject(http.StatusInternalServerError, "Key stored, but registering an identifier hash failed")
+		}
+	}
+	logger.Info().Int("count", len(upload.IdentifierHashes)).Msg("Registered identifier hashes")
+	return nil
+}
+
+// UnregisterIdentifierHandler manages
+// DELETE /keys/{entityURN}/identifiers/{hash}, removing the entity's
+// registration of an identifier hash. Callers who may store the entity's
+// key may remove its hashes.
+func (a *API) UnregisterIdentifierHandler(w http.ResponseWriter, r *http.Request) {
+	if a.Identifiers == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Identifier lookup is not configured")
+		return
+	}
+	entityURN, err := urn.Parse(r.PathValue("entityURN"))
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("raw_urn", r.PathValue("entityURN")).Msg("Invalid URN format in request path")
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format in request path")
+		return
+	}
+	hash := r.PathValue("hash")
+	if !keyservice.ValidIdentifierHash(hash) {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid identifier hash")
+		return
+	}
+	if _, err := a.AuthorizeKeyWrite(r.Context(), entityURN); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	event := keyservice.AuditEvent{Action: "identifiers:unregister", EntityURN: entityURN.String()}
+	origin := httpOrigin(r)
+	if err := a.intend(r.Context(), origin, event); err != nil {
+		writeError(w, err)
+		return
+	}
+	err = a.Identifiers.UnregisterIdentifier(r.Context(), hash, entityURN)
+	a.record(r.Context(), origin, event, err)
+	if errors.Is(err, keyservice.ErrIdentifierNotFound) {
+		response.WriteJSONError(w, http.StatusNotFound, "Identifier hash not registered to the entity")
+		return
+	}
+	if err != nil {
+		a.Logger.Error().Err(err).Str("entity_urn", entityURN.String()).Str("identifier_hash", hash).Msg("Failed to unregister identifier hash")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to unregister identifier hash")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// assignIdentifierRequest is the JSON body accepted by
+// AssignIdentifierHandler.
+type assignIdentifierRequest struct {
+	EntityURN string `json:"entityUrn"`
+}
+
+// AssignIdentifierHandler manages PUT /admin/identifiers/{hash}, mapping an
+// identifier hash to the entity in the body whoever held it before, for
+// resolving disputed registrations.
+func (a *API) AssignIdentifierHandler(w http.ResponseWriter, r *http.Request) {
+	hash, ok := a.adminIdentifierHash(w, r)
+	if !ok {
+		return
+	}
+	var req assignIdentifierRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	owner, err := urn.Parse(req.EntityURN)
+	if err != nil {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format")
+		return
+	}
+
+	event := keyservice.AuditEvent{Action: "admin:assign-identifier", EntityURN: owner.String()}
+	origin := httpOrigin(r)
+	if err := a.intend(r.Context(), origin, event); err != nil {
+		writeError(w, err)
+		return
+	}
+	err = a.Identifiers.AssignIdentifier(r.Context(), hash, owner)
+	a.record(r.Context(), origin, event, err)
+	if err != nil {
+		a.Logger.Error().Err(err).Str("identifier_hash", hash).Msg("Failed to assign identifier hash")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to assign identifier hash")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveIdentifierHandler manages DELETE /admin/identifiers/{hash},
+// removing an identifier hash whoever registered it.
+func (a *API) RemoveIdentifierHandler(w http.ResponseWriter, r *http.Request) {
+	hash, ok := a.adminIdentifierHash(w, r)
+	if !ok {
+		return
+	}
+	owner, err := a.Identifiers.LookupIdentifier(r.Context(), hash)
+	if err == nil {
+		event := keyservice.AuditEvent{Action: "admin:remove-identifier", EntityURN: owner.String()}
+		origin := httpOrigin(r)
+		if err := a.intend(r.Context(), origin, event); err != nil {
+			writeError(w, err)
+			return
+		}
+		err = a.Identifiers.UnregisterIdentifier(r.Context(), hash, owner)
+		a.record(r.Context(), origin, event, err)
+	}
+	if errors.Is(err, keyservice.ErrIdentifierNotFound) {
+		response.WriteJSONError(w, http.StatusNotFound, "Identifier hash not registered")
+		return
+	}
+	if err != nil {
+		a.Logger.Error().Err(err).Str("identifier_hash", hash).Msg("Failed to remove identifier hash")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to remove identifier hash")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminIdentifierHash returns the identifier hash in the request path,
+// writing the error response and returning false if there is none or no
+// index is configured.
+func (a *API) adminIdentifierHash(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if a.Identifiers == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Identifier lookup is not configured")
+		return "", false
+	}
+	hash := r.PathValue("hash")
+	if !keyservice.ValidIdentifierHash(hash) {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid identifier hash")
+		return "", false
+	}
+	return hash, true
+}
+
+// IdentifierKeyHandler manages GET /.well-known/keys/hu/{hash}, the Web Key
+// Directory style lookup of a key by the hash of its owner's email address
+// or phone number. The key is served like GET /keys/{entityURN}, with the
+// entity named in EntityURNHeader, and unknown hashes are not found.
+func (a *API) IdentifierKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if a.Identifiers == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Identifier lookup is not configured")
+		return
+	}
+	hash := r.PathValue("hash")
+	if !keyservice.ValidIdentifierHash(hash) {
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid identifier hash")
+		return
+	}
+
+	entityURN, err := a.Identifiers.LookupIdentifier(r.Context(), hash)
+	if errors.Is(err, keyservice.ErrIdentifierNotFound) {
+		response.WriteJSONError(w, http.StatusNotFound, "Key not found")
+		return
+	}
+	if err != nil {
+		a.Logger.Error().Err(err).Str("identifier_hash", hash).Msg("Failed to look up identifier hash")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to look up identifier")
+		return
+	}
+	if !a.authorizeRead(w, r, entityURN) {
+		return
+	}
+	w.Header().Set(EntityURNHeader, entityURN.String())
+	a.writeKey(w, r, entityURN)
+}
@@ -0,0 +1,245 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIdentifierKeyHandler tests the registration of identifier hashes at
+// upload, their removal and the lookup of keys by hash.
+func TestIdentifierKeyHandler(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	aliceEmail, err := keyservice.HashIdentifier("salt", "alice@example.com")
+	require.NoError(t, err)
+	alicePhone, err := keyservice.HashIdentifier("salt", "+44 20 7946 0000")
+	require.NoError(t, err)
+	bobEmail, err := keyservice.HashIdentifier("salt", "bob@example.com")
+	require.NoError(t, err)
+
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	// verifiedClaims are the identifiers each caller's token vouches for.
+	verifiedClaims := map[string]map[string]any{
+		"alice": {"email": "alice@example.com", "email_verified": true, "phone_number": "+44 20 7946 0000", "phone_number_verified": true},
+		"bob":   {"email": "bob@example.com", "email_verified": true, "phone_number": "+44 20 7946 0000", "phone_number_verified": false},
+		// carol's provider handed her alice's old email address.
+		"carol": {"email": "alice@example.com", "email_verified": true},
+	}
+
+	newAPI := func() *api.API {
+		return &api.API{Store: inmemory.New(), Logger: zerolog.Nop(), Identifiers: inmemory.NewIdentifierIndex(), IdentifierSalt: "salt"}
+	}
+	store := func(apiHandler *api.API, entityURN urn.URN, subject string, hashes ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+entityURN.String(), bytes.NewReader([]byte(subject+"-key")))
+		req.SetPathValue("entityURN", entityURN.String())
+		req = req.WithContext(api.ContextWithClaims(api.ContextWithUserID(req.Context(), subject), verifiedClaims[subject]))
+		if len(hashes) > 0 {
+			req.Header.Set(api.IdentifierHashesHeader, strings.Join(hashes, ", "))
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.StoreKeyHandler(rr, req)
+		return rr
+	}
+	lookup := func(apiHandler *api.API, hash, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/keys/hu/"+hash, nil)
+		req.SetPathValue("hash", hash)
+		if accept != "" {
+			// Only v2 negotiates the representation.
+			req = req.WithContext(api.ContextWithAPIVersion(req.Context(), keyservice.APIVersionV2))
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.IdentifierKeyHandler(rr, req)
+		return rr
+	}
+
+	t.Run("Keys are found by every hash registered at upload", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.Equal(t, http.StatusCreated, store(apiHandler, aliceURN, "alice", aliceEmail, alicePhone).Code)
+
+		// Act
+		byEmail := lookup(apiHandler, aliceEmail, "")
+		byPhone := lookup(apiHandler, alicePhone, "application/json")
+
+		// Assert
+		require.Equal(t, http.StatusOK, byEmail.Code)
+		assert.Equal(t, aliceURN.String(), byEmail.Header().Get(api.EntityURNHeader))
+		assert.Equal(t, "alice-key", byEmail.Body.String())
+		require.Equal(t, http.StatusOK, byPhone.Code)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(byPhone.Body.Bytes(), &body))
+		assert.Equal(t, aliceURN.String(), body["entityUrn"])
+	})
+
+	t.Run("Hashes the caller has not verified are refused", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+
+		// Act
+		someoneElses := store(apiHandler, bobURN, "bob", bobEmail, aliceEmail)
+		unverified := store(apiHandler, bobURN, "bob", alicePhone)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, someoneElses.Code)
+		assert.Equal(t, http.StatusForbidden, unverified.Code, "the phone number claim is not verified")
+		assert.Equal(t, http.StatusNotFound, lookup(apiHandler, bobEmail, "").Code)
+		_, err = apiHandler.Store.GetKey(ctx, bobURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyNotFound, "the key is not stored")
+	})
+
+	t.Run("A hash registered by another entity is refused", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		carolURN, err := urn.New(urn.SecureMessaging, "user", "carol")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, store(apiHandler, aliceURN, "alice", aliceEmail).Code)
+
+		// Act
+		rr := store(apiHandler, carolURN, "carol", aliceEmail)
+
+		// Assert
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, aliceURN.String(), lookup(apiHandler, aliceEmail, "").Header().Get(api.EntityURNHeader))
+		_, err = apiHandler.Store.GetKey(ctx, carolURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyNotFound, "the key is not stored")
+	})
+
+	t.Run("Hashes are not registered if the key is not stored", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.NoError(t, apiHandler.Store.SetLocked(ctx, aliceURN, true))
+
+		// Act
+		rr := store(apiHandler, aliceURN, "alice", aliceEmail)
+
+		// Assert
+		assert.Equal(t, http.StatusLocked, rr.Code)
+		assert.Equal(t, http.StatusNotFound, lookup(apiHandler, aliceEmail, "").Code)
+	})
+
+	t.Run("The entity can unregister its hashes", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.Equal(t, http.StatusCreated, store(apiHandler, aliceURN, "alice", aliceEmail).Code)
+		unregister := func(subject string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodDelete, "/keys/"+aliceURN.String()+"/identifiers/"+aliceEmail, nil)
+			req.SetPathValue("entityURN", aliceURN.String())
+			req.SetPathValue("hash", aliceEmail)
+			req = req.WithContext(api.ContextWithUserID(req.Context(), subject))
+			rr := httptest.NewRecorder()
+			apiHandler.UnregisterIdentifierHandler(rr, req)
+			return rr
+		}
+
+		// Act
+		byOther := unregister("mallory")
+		byOwner := unregister("alice")
+		again := unregister("alice")
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, byOther.Code)
+		assert.Equal(t, http.StatusNoContent, byOwner.Code)
+		assert.Equal(t, http.StatusNotFound, again.Code)
+		assert.Equal(t, http.StatusNotFound, lookup(apiHandler, aliceEmail, "").Code)
+	})
+
+	t.Run("Administrators can reassign and remove hashes", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.Equal(t, http.StatusCreated, store(apiHandler, aliceURN, "alice", aliceEmail).Code)
+		adminRequest := func(method string, body string) *http.Request {
+			req := httptest.NewRequest(method, "/admin/identifiers/"+aliceEmail, strings.NewReader(body))
+			req.SetPathValue("hash", aliceEmail)
+			return req.WithContext(api.ContextWithUserID(req.Context(), "admin"))
+		}
+
+		// Act
+		assignRR := httptest.NewRecorder()
+		apiHandler.AssignIdentifierHandler(assignRR, adminRequest(http.MethodPut, `{"entityUrn":"`+bobURN.String()+`"}`))
+		reassigned := lookup(apiHandler, aliceEmail, "").Code
+		owner, err := apiHandler.Identifiers.LookupIdentifier(ctx, aliceEmail)
+		require.NoError(t, err)
+		removeRR := httptest.NewRecorder()
+		apiHandler.RemoveIdentifierHandler(removeRR, adminRequest(http.MethodDelete, ""))
+		againRR := httptest.NewRecorder()
+		apiHandler.RemoveIdentifierHandler(againRR, adminRequest(http.MethodDelete, ""))
+
+		// Assert
+		assert.Equal(t, http.StatusNoContent, assignRR.Code)
+		assert.Equal(t, bobURN, owner)
+		assert.Equal(t, http.StatusNotFound, reassigned, "bob has no key yet")
+		assert.Equal(t, http.StatusNoContent, removeRR.Code)
+		assert.Equal(t, http.StatusNotFound, againRR.Code)
+	})
+
+	t.Run("Malformed and excess hashes are rejected", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		tooMany := make([]string, keyservice.MaxIdentifierHashes+1)
+		for i := range tooMany {
+			tooMany[i], err = keyservice.HashIdentifier("salt", "alice+"+string(rune('a'+i))+"@example.com")
+			require.NoError(t, err)
+		}
+
+		// Act & Assert
+		assert.Equal(t, http.StatusBadRequest, store(apiHandler, aliceURN, "alice", "alice@example.com").Code)
+		assert.Equal(t, http.StatusBadRequest, store(apiHandler, aliceURN, "alice", tooMany...).Code)
+		assert.Equal(t, http.StatusBadRequest, lookup(apiHandler, "alice@example.com", "").Code)
+	})
+
+	t.Run("Unknown hashes are not found", func(t *testing.T) {
+		// Act
+		rr := lookup(newAPI(), bobEmail, "")
+
+		// Assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Empty(t, rr.Header().Get(api.EntityURNHeader))
+	})
+
+	t.Run("Denied reads do not reveal the entity", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.Equal(t, http.StatusCreated, store(apiHandler, aliceURN, "alice", aliceEmail).Code)
+		apiHandler.ReadMode = keyservice.ReadModeContacts
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/keys/hu/"+aliceEmail, nil)
+		req.SetPathValue("hash", aliceEmail)
+		req = req.WithContext(api.ContextWithUserID(req.Context(), "mallory"))
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.IdentifierKeyHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Empty(t, rr.Header().Get(api.EntityURNHeader))
+	})
+
+	t.Run("Disabled without an index", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+		withoutSalt := newAPI()
+		withoutSalt.IdentifierSalt = ""
+
+		// Act & Assert
+		assert.Equal(t, http.StatusServiceUnavailable, lookup(apiHandler, aliceEmail, "").Code)
+		assert.Equal(t, http.StatusServiceUnavailable, store(apiHandler, aliceURN, "alice", aliceEmail).Code)
+		assert.Equal(t, http.StatusServiceUnavailable, store(withoutSalt, aliceURN, "alice", aliceEmail).Code)
+		assert.Equal(t, http.StatusCreated, store(apiHandler, aliceURN, "alice").Code, "uploads without hashes are unaffected")
+	})
+}
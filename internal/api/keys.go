@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Error is a key operation refused for a reason the caller can act on. It
+// carries the HTTP status and message the HTTP handlers reply with; other
+// transports map the status to their own codes. Any other error returned by
+// the operations below is an internal failure that has already been logged.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// reject returns an *Error with the given status and message.
+func reject(status int, message string) error {
+	return &Error{Status: status, Message: message}
+}
+
+// writeError replies to an HTTP request with err, hiding the details of
+// internal failures.
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		response.WriteJSONError(w, apiErr.Status, apiErr.Message)
+		return
+	}
+	response.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// KeyUpload is a key to store together with the proofs accompanying it,
+// whichever transport it arrived over.
+type KeyUpload struct {
+	EntityURN urn.URN
+	Key       []byte
+	// Challenge and ProofSignature prove possession of Key or, if
+	// SigningKeyURN is set, of that entity's stored key.
+	Challenge      string
+	ProofSignature []byte
+	SigningKeyURN  string
+	// IdentitySignature is the device owner's identity key signature over
+	// keyservice.SignedKeyMessage.
+	IdentitySignature []byte
+	// IdentifierHashes are registered in Identifiers as mapping to
+	// EntityURN, so contacts can find the key by hashed email address or
+	// phone number.
+	IdentifierHashes []string
+}
+
+// AuthorizeKeyWrite checks that the authenticated caller in ctx may store
+// entityURN's key and returns the caller.
+func (a *API) AuthorizeKeyWrite(ctx context.Context, entityURN urn.URN) (keyservice.Principal, error) {
+	// 1. Get the authenticated caller securely from the JWT context.
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		a.Logger.Error().Msg("User ID not found in context; middleware may be misconfigured.")
+		return keyservice.Principal{}, errors.New("no authenticated caller in context")
+	}
+
+	// Keys of federated domains are read from their own key service, so a
+	// local copy would only ever be served by mistake.
+	if a.resolvesRemotely(entityURN) {
+		a.Logger.Warn().Str("authed_user", principal.Subject).Str("target_urn", entityURN.String()).Msg("Rejected write of a federated domain's key")
+		return keyservice.Principal{}, reject(http.StatusForbidden, "Keys of federated domains are managed by their own key service")
+	}
+
+	// 2. THE CRITICAL SECURITY CHECK, delegated to the authorization policy.
+	allowed, err := a.authorizer().Authorize(ctx, principal, keyservice.ActionStoreKey, entityURN)
+	if err != nil {
+		a.Logger.Error().Err(err).Str("authed_user", principal.Subject).Str("target_urn", entityURN.String()).Msg("Authorization check failed")
+		return keyservice.Principal{}, err
+	}
+	if !allowed {
+		a.Logger.Warn().Str("authed_user", principal.Subject).Str("target_urn", entityURN.String()).Msg("Authorization failed: User attempted to store key for another entity.")
+		return keyservice.Principal{}, reject(http.StatusForbidden, "Forbidden")
+	}
+	return principal, nil
+}
+
+// StoreKey authorizes the caller in ctx, checks the upload's proofs and
+// stores its key, recording the attempt in the audit log.
+func (a *API) StoreKey(ctx context.Context, origin Origin, upload KeyUpload) error {
+	principal, signatures, err := a.checkUpload(ctx, upload)
+	if err != nil {
+		return err
+	}
+
+	if err := a.checkIdentifiers(ctx, principal, upload); err != nil {
+		return err
+	}
+
+	event := storeEvent(upload.EntityURN, upload.Key, a.currentFingerprint(ctx, upload.EntityURN))
+	if err := a.intend(ctx, origin, event); err != nil {
+		return err
+	}
+	if len(signatures) > 0 {
+		err = a.Store.StoreSignedKey(ctx, upload.EntityURN, upload.Key, signatures)
+	} else {
+		err = a.Store.StoreKey(ctx, upload.EntityURN, upload.Key)
+	}
+	a.record(ctx, origin, event, err)
+	if err := a.storeResult(principal, upload.EntityURN, err); err != nil {
+		return err
+	}
+	return a.registerIdentifiers(ctx, upload)
+}
+
+// checkUpload authorizes the caller in ctx to store the upload's key and
+// checks its proofs, returning the caller and the key's signatures.
+func (a *API) checkUpload(ctx context.Context, upload KeyUpload) (keyservice.Principal, []keyservice.KeySignature, error) {
+	principal, err := a.AuthorizeKeyWrite(ctx, upload.EntityURN)
+	if err != nil {
+		return keyservice.Principal{}, nil, err
+	}
+	a.Logger.Info().Str("entity_urn", upload.EntityURN.String()).Int("byteLength", len(upload.Key)).Msg("[Checkpoint 2: RECEIPT] Key received from client")
+
+	if err := a.checkProof(ctx, principal, upload); err != nil {
+		return keyservice.Principal{}, nil, err
+	}
+	signatures, err := a.identitySignatures(ctx, upload)
+	if err != nil {
+		return keyservice.Principal{}, nil, err
+	}
+	return principal, signatures, nil
+}
+
+// storeEvent returns the audit event for storing key as entityURN's key in
+// place of the key with oldFingerprint.
+func storeEvent(entityURN urn.URN, key []byte, oldFingerprint string) keyservice.AuditEvent {
+	return keyservice.AuditEvent{
+		Action:         string(keyservice.ActionStoreKey),
+		EntityURN:      entityURN.String(),
+		OldFingerprint: oldFingerprint,
+		NewFingerprint: keyservice.Fingerprint(key),
+	}
+}
+
+// storeResult logs the outcome of storing entityURN's key and converts a
+// store error to the error reported to the caller.
+func (a *API) storeResult(principal keyservice.Principal, entityURN urn.URN, err error) error {
+	logger := a.Logger.With().Str("entity_urn", entityURN.String()).Logger()
+	if err != nil {
+		if errors.Is(err, keyservice.ErrEntityLocked) {
+			logger.Warn().Err(err).Str("authed_user", principal.Subject).Msg("Rejected key upload for a locked entity")
+			return reject(http.StatusLocked, "Entity is locked")
+		}
+		logger.Error().Err(err).Msg("Failed to store key")
+		return reject(http.StatusInternalServerError, "Failed to store key")
+	}
+	logger.Info().Msg("Successfully stored public key")
+	return nil
+}
+
+// ReadKey applies the ReadMode to a read of entityURN's key by the caller in
+// ctx and returns the entity's record if its key can be served.
+func (a *API) ReadKey(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	if err := a.AuthorizeRead(ctx, entityURN); err != nil {
+		return keyservice.KeyRecord{}, err
+	}
+	return a.servableRecord(ctx, entityURN)
+}
+
+// servableRecord returns entityURN's record with administrative state
+// stripped, failing if there is no key to serve. Keys of entities in trusted
+// federated domains are resolved through KeyResolver.
+func (a *API) servableRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	if a.resolvesRemotely(entityURN) {
+		return a.resolveRecord(ctx, entityURN)
+	}
+	rec, err := a.Store.GetRecord(ctx, entityURN)
+	return a.servable(entityURN, rec, err)
+}
+
+// servableRecords is servableRecord for many entities, reading the local
+// ones from the store in one GetRecords call. It returns a record or an
+// error per entity, in order, and fails as a whole only if the read does.
+func (a *API) servableRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, []error, error) {
+	records := make([]keyservice.KeyRecord, len(entityURNs))
+	errs := make([]error, len(entityURNs))
+	local := make([]urn.URN, 0, len(entityURNs))
+	positions := make([]int, 0, len(entityURNs))
+	for i, entityURN := range entityURNs {
+		if a.resolvesRemotely(entityURN) {
+			records[i], errs[i] = a.resolveRecord(ctx, entityURN)
+			continue
+		}
+		local = append(local, entityURN)
+		positions = append(positions, i)
+	}
+	if len(local) == 0 {
+		return records, errs, nil
+	}
+	stored, err := a.Store.GetRecords(ctx, local)
+	if err != nil {
+		a.Logger.Error().Err(err).Int("entities", len(local)).Msg("Failed to read keys")
+		return nil, nil, reject(http.StatusInternalServerError, "Failed to read keys")
+	}
+	for j, rec := range stored {
+		records[positions[j]], errs[positions[j]] = a.servable(local[j], rec, nil)
+	}
+	return records, errs, nil
+}
+
+// servable returns rec, read from the store with the outcome err, with
+// administrative state stripped, failing if it holds no key to serve.
+func (a *API) servable(entityURN urn.URN, rec keyservice.KeyRecord, err error) (keyservice.KeyRecord, error) {
+	logger := a.Logger.With().Str("entity_urn", entityURN.String()).Logger()
+	if err == nil && rec.Revoked {
+		logger.Info().Msg("Key revoked")
+		return keyservice.KeyRecord{}, reject(http.StatusGone, "Key revoked")
+	}
+	if err != nil || len(rec.Key) == 0 {
+		logger.Warn().Err(err).Msg("Key not found")
+		return keyservice.KeyRecord{}, reject(http.StatusNotFound, "Key not found")
+	}
+	return publicRecord(rec), nil
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/proof"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Headers carrying a key upload's proof of possession.
+const (
+	// ChallengeHeader carries the nonce from POST /keys/{entityURN}/challenge,
+	// or from POST /keys/{entityURN}/devices/{deviceURN}/challenge when
+	// enrolling a device.
+	ChallengeHeader = "X-Key-Challenge"
+	// SignatureHeader carries the base64 signature over
+	// keyservice.ProofMessage.
+	SignatureHeader = "X-Key-Signature"
+	// SigningKeyURNHeader names an entity whose stored key made the
+	// signature instead of the uploaded key, for keys that cannot sign.
+	SigningKeyURNHeader = "X-Signing-Key-URN"
+)
+
+// challengeResponse is the JSON body returned by ChallengeHandler.
+type challengeResponse struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ChallengeHandler manages POST /keys/{entityURN}/challenge, issuing a
+// single-use nonce for the next key upload to sign. Only callers who may
+// store the entity's key get one.
+func (a *API) ChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if a.Challenges == nil {
+		response.WriteJSONError(w, http.StatusServiceUnavailable, "Proof of possession is not configured")
+		return
+	}
+	entityURNStr := r.PathValue("entityURN")
+	entityURN, err := urn.Parse(entityURNStr)
+	if err != nil {
+		a.Logger.Warn().Err(err).Str("raw_urn", entityURNStr).Msg("Invalid URN format in request path")
+		response.WriteJSONError(w, http.StatusBadRequest, "Invalid URN format in request path")
+		return
+	}
+	if _, err := a.AuthorizeKeyWrite(r.Context(), entityURN); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ttl := a.ChallengeTTL
+	if ttl <= 0 {
+		ttl = keyservice.DefaultChallengeTTL
+	}
+	challenge, err := a.Challenges.Issue(r.Context(), entityURN, ttl)
+	if err != nil {
+		a.Logger.Error().Err(err).Str("entity_urn", entityURN.String()).Msg("Failed to issue challenge")
+		response.WriteJSONError(w, http.StatusInternalServerError, "Failed to issue challenge")
+		return
+	}
+	writeJSON(w, http.StatusOK, challengeResponse{Nonce: challenge.Nonce, ExpiresAt: challenge.ExpiresAt})
+}
+
+// checkProof checks the proof of possession accompanying an upload. The
+// signature must be made with the uploaded key or, if the upload names a
+// SigningKeyURN, with the stored key of that entity, which must be linked to
+// the uploading entity and which the caller must also be allowed to write.
+// Keys that cannot sign must name a linked signing key, so no upload goes
+// without a proof.
+func (a *API) checkProof(ctx context.Context, principal keyservice.Principal, upload KeyUpload) error {
+	if !a.RequireProofOfPossession {
+		return nil
+	}
+	entityURN := upload.EntityURN
+	logger := a.Logger.With().Str("entity_urn", entityURN.String()).Str("authed_user", principal.Subject).Logger()
+
+	signingKey, ok := proof.ParseSigningKey(upload.Key)
+	if upload.SigningKeyURN != "" {
+		var err error
+		signingKey, err = a.linkedSigningKey(ctx, principal, entityURN, upload.SigningKeyURN)
+		if err != nil {
+			logger.Warn().Err(err).Str("signing_key_urn", upload.SigningKeyURN).Msg("Rejected linked signing key")
+			return err
+		}
+	} else if !ok {
+		logger.Warn().Msg("Upload of a key that cannot sign without a linked signing key")
+		return reject(http.StatusBadRequest, "Keys that cannot sign need a proof by a linked signing key named in "+SigningKeyURNHeader)
+	}
+
+	if a.Challenges == nil {
+		logger.Error().Msg("Proof of possession is required but no challenge store is configured")
+		return errors.New("no challenge store configured")
+	}
+	if upload.Challenge == "" || len(upload.ProofSignature) == 0 {
+		logger.Warn().Msg("Key upload without proof of possession")
+		return reject(http.StatusBadRequest, "Proof of possession required: sign a challenge from POST /keys/{entityURN}/challenge")
+	}
+	if err := a.Challenges.Consume(ctx, entityURN, upload.Challenge); err != nil {
+		if errors.Is(err, keyservice.ErrChallengeInvalid) {
+			logger.Warn().Err(err).Msg("Key upload with an invalid challenge")
+			return reject(http.StatusForbidden, "Invalid or expired challenge")
+		}
+		logger.Error().Err(err).Msg("Failed to consume challenge")
+		return err
+	}
+	if err := proof.Verify(signingKey, keyservice.ProofMessage(upload.Challenge, entityURN), upload.ProofSignature); err != nil {
+		logger.Warn().Err(err).Msg("Key upload with an invalid proof of possession")
+		return reject(http.StatusForbidden, "Invalid proof of possession")
+	}
+	return nil
+}
+
+// linkedSigningKey returns the stored signing key of the entity named by
+// rawURN, which must be entityURN itself, the owner of device entityURN or a
+// device entityURN owns.
+func (a *API) linkedSigningKey(ctx context.Context, principal keyservice.Principal, entityURN urn.URN, rawURN string) (crypto.PublicKey, error) {
+	signingURN, err := urn.Parse(rawURN)
+	if err != nil {
+		return nil, reject(http.StatusBadRequest, "Invalid signing key URN")
+	}
+	if signingURN.String() != entityURN.String() {
+		linked, err := a.linked(ctx, entityURN, signingURN)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			return nil, reject(http.StatusForbidden, "Signing key is not linked to the entity")
+		}
+		allowed, err := a.authorizer().Authorize(ctx, principal, keyservice.ActionStoreKey, signingURN)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, reject(http.StatusForbidden, "Forbidden")
+		}
+	}
+	stored, err := a.Store.GetKey(ctx, signingURN)
+	if err != nil {
+		return nil, reject(http.StatusBadRequest, "Signing key not found")
+	}
+	signingKey, ok := proof.ParseSigningKey(stored)
+	if !ok {
+		return nil, reject(http.StatusBadRequest, "Signing key cannot sign")
+	}
+	return signingKey, nil
+}
+
+// linked reports whether one of two different entities is a device owned by
+// the other.
+func (a *API) linked(ctx context.Context, entityURN, signingURN urn.URN) (bool, error) {
+	if a.Devices == nil {
+		return false, nil
+	}
+	for _, pair := range [][2]urn.URN{{entityURN, signingURN}, {signingURN, entityURN}} {
+		device, owner := pair[0], pair[1]
+		if device.EntityType() != keyservice.DeviceEntityType {
+			continue
+		}
+		current, err := a.Devices.OwnerOf(ctx, device)
+		if errors.Is(err, keyservice.ErrDeviceNotEnrolled) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if current.String() == owner.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// decodeSignature accepts standard or URL-safe base64, padded or not.
+func decodeSignature(raw string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if signature, err := enc.DecodeString(raw); err == nil && len(signature) > 0 {
+			return signature, nil
+		}
+	}
+	return nil, errors.New("signature is not base64")
+}
@@ -0,0 +1,208 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/authz"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProofOfPossession tests the challenge route and the proof checked by
+// StoreKeyHandler.
+func TestProofOfPossession(t *testing.T) {
+	ctx := api.ContextWithUserID(context.Background(), "alice")
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signingKey, err := x509.MarshalPKIXPublicKey(edPub)
+	require.NoError(t, err)
+
+	newAPI := func() *api.API {
+		return &api.API{
+			Store:                    inmemory.New(),
+			Logger:                   zerolog.Nop(),
+			Challenges:               inmemory.NewChallengeStore(),
+			RequireProofOfPossession: true,
+		}
+	}
+	challenge := func(apiHandler *api.API, entityURN urn.URN) string {
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+entityURN.String()+"/challenge", nil).WithContext(ctx)
+		req.SetPathValue("entityURN", entityURN.String())
+		rr := httptest.NewRecorder()
+		apiHandler.ChallengeHandler(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body struct {
+			Nonce string `json:"nonce"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		return body.Nonce
+	}
+	upload := func(apiHandler *api.API, entityURN urn.URN, key []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+entityURN.String(), bytes.NewReader(key)).WithContext(ctx)
+		req.SetPathValue("entityURN", entityURN.String())
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.StoreKeyHandler(rr, req)
+		return rr
+	}
+	sign := func(nonce string, entityURN urn.URN) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(edPriv, keyservice.ProofMessage(nonce, entityURN)))
+	}
+
+	t.Run("Success - upload signed with the uploaded key", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		nonce := challenge(apiHandler, aliceURN)
+
+		// Act
+		rr := upload(apiHandler, aliceURN, signingKey, map[string]string{api.ChallengeHeader: nonce, api.SignatureHeader: sign(nonce, aliceURN)})
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("Failure - 400 without a proof", func(t *testing.T) {
+		rr := upload(newAPI(), aliceURN, signingKey, nil)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Failure - 403 for a signature by another key", func(t *testing.T) {
+		// Arrange: the upload is someone else's public key.
+		apiHandler := newAPI()
+		otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		otherKey, err := x509.MarshalPKIXPublicKey(otherPub)
+		require.NoError(t, err)
+		nonce := challenge(apiHandler, aliceURN)
+
+		// Act
+		rr := upload(apiHandler, aliceURN, otherKey, map[string]string{api.ChallengeHeader: nonce, api.SignatureHeader: sign(nonce, aliceURN)})
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Failure - 403 when a challenge is reused", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		nonce := challenge(apiHandler, aliceURN)
+		headers := map[string]string{api.ChallengeHeader: nonce, api.SignatureHeader: sign(nonce, aliceURN)}
+		require.Equal(t, http.StatusCreated, upload(apiHandler, aliceURN, signingKey, headers).Code)
+
+		// Act
+		rr := upload(apiHandler, aliceURN, signingKey, headers)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Failure - 400 for a key that cannot sign without a linked signing key", func(t *testing.T) {
+		x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		encryptionKey, err := x509.MarshalPKIXPublicKey(x25519.PublicKey())
+		require.NoError(t, err)
+
+		rr := upload(newAPI(), aliceURN, encryptionKey, nil)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Success - key that cannot sign vouched for by the entity's stored signing key", func(t *testing.T) {
+		// Arrange
+		apiHandler := newAPI()
+		require.NoError(t, apiHandler.Store.StoreKey(context.Background(), aliceURN, signingKey))
+		x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		encryptionKey, err := x509.MarshalPKIXPublicKey(x25519.PublicKey())
+		require.NoError(t, err)
+		nonce := challenge(apiHandler, aliceURN)
+
+		// Act
+		rr := upload(apiHandler, aliceURN, encryptionKey, map[string]string{
+			api.ChallengeHeader:     nonce,
+			api.SignatureHeader:     sign(nonce, aliceURN),
+			api.SigningKeyURNHeader: aliceURN.String(),
+		})
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("Failure - 403 for a signing key not linked to the entity", func(t *testing.T) {
+		// Arrange: the policy lets alice write any key, but the phone is not
+		// enrolled as one of her devices.
+		apiHandler := newAPI()
+		anyone, err := authz.NewPolicyAuthorizer(keyservice.Policy{Rules: []keyservice.PolicyRule{{Effect: keyservice.EffectAllow}}})
+		require.NoError(t, err)
+		apiHandler.Authorizer = anyone
+		require.NoError(t, apiHandler.Store.StoreKey(context.Background(), aliceURN, signingKey))
+		apiHandler.Devices = inmemory.NewDeviceRegistry()
+		phoneURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+		require.NoError(t, err)
+		nonce := challenge(apiHandler, phoneURN)
+
+		// Act
+		rr := upload(apiHandler, phoneURN, []byte("opaque-device-key"), map[string]string{
+			api.ChallengeHeader:     nonce,
+			api.SignatureHeader:     sign(nonce, phoneURN),
+			api.SigningKeyURNHeader: aliceURN.String(),
+		})
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Success - device key signed with the owner's linked signing key", func(t *testing.T) {
+		// Arrange: alice's signing key is stored; her device's key is opaque.
+		apiHandler := newAPI()
+		require.NoError(t, apiHandler.Store.StoreKey(context.Background(), aliceURN, signingKey))
+		devices := inmemory.NewDeviceRegistry()
+		apiHandler.Devices = devices
+		phoneURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+		require.NoError(t, err)
+		require.NoError(t, devices.EnrollDevice(context.Background(), aliceURN, phoneURN))
+		nonce := challenge(apiHandler, phoneURN)
+
+		// Act
+		rr := upload(apiHandler, phoneURN, []byte("opaque-device-key"), map[string]string{
+			api.ChallengeHeader:     nonce,
+			api.SignatureHeader:     sign(nonce, phoneURN),
+			api.SigningKeyURNHeader: aliceURN.String(),
+		})
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("Failure - 503 for challenges without a challenge store", func(t *testing.T) {
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+		req := httptest.NewRequest(http.MethodPost, "/keys/"+aliceURN.String()+"/challenge", nil).WithContext(ctx)
+		req.SetPathValue("entityURN", aliceURN.String())
+		rr := httptest.NewRecorder()
+
+		apiHandler.ChallengeHandler(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// AuthorizeRead applies the configured ReadMode to a read of target's key
+// by the caller in ctx. Reads denied in contacts mode are refused exactly
+// like missing keys so they reveal nothing about who is registered.
+func (a *API) AuthorizeRead(ctx context.Context, target urn.URN) error {
+	if a.ReadMode == "" || a.ReadMode == keyservice.ReadModePublic {
+		return nil
+	}
+	reader, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return reject(http.StatusUnauthorized, "Authentication required")
+	}
+	if a.ReadMode != keyservice.ReadModeContacts {
+		return nil
+	}
+
+	allowed, err := a.readAllowed(ctx, reader, target)
+	if err != nil {
+		a.Logger.Error().Err(err).Str("reader", reader.Subject).Str("target_urn", target.String()).Msg("Read authorization check failed")
+		return err
+	}
+	if !allowed {
+		a.Logger.Info().Str("reader", reader.Subject).Str("target_urn", target.String()).Msg("Read denied: target is not a contact")
+		return reject(http.StatusNotFound, "Key not found")
+	}
+	return nil
+}
+
+// authorizeRead is AuthorizeRead for HTTP handlers. It writes the error
+// response and returns false if the read must not proceed.
+func (a *API) authorizeRead(w http.ResponseWriter, r *http.Request, target urn.URN) bool {
+	if err := a.AuthorizeRead(r.Context(), target); err != nil {
+		writeError(w, err)
+		return false
+	}
+	return true
+}
+
+// readAllowed reports whether reader may fetch target's key in contacts mode.
+// Readers may always fetch their own keys and those of their own devices; a
+// contact's devices are readable if the contact is.
+func (a *API) readAllowed(ctx context.Context, reader keyservice.Principal, target urn.URN) (bool, error) {
+	if reader.Subject == target.EntityID() {
+		return true, nil
+	}
+	targets := []urn.URN{target}
+	if target.EntityType() == keyservice.DeviceEntityType && a.Devices != nil {
+		owner, err := a.Devices.OwnerOf(ctx, target)
+		switch {
+		case errors.Is(err, keyservice.ErrDeviceNotEnrolled):
+		case err != nil:
+			return false, fmt.Errorf("failed to resolve owner of device %s: %w", target.String(), err)
+		case owner.EntityID() == reader.Subject:
+			return true, nil
+		default:
+			targets = append(targets, owner)
+		}
+	}
+	if a.ReadAuthorizer == nil {
+		return false, nil
+	}
+	for _, t := range targets {
+		allowed, err := a.ReadAuthorizer.AuthorizeRead(ctx, reader, t)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/authz"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetKeyHandler_ReadModes tests the authenticated and contacts read modes.
+func TestGetKeyHandler_ReadModes(t *testing.T) {
+	ctx := context.Background()
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	bobPhone, err := urn.New(urn.SecureMessaging, "device", "bob-phone")
+	require.NoError(t, err)
+
+	store := inmemory.New()
+	for _, entity := range []urn.URN{alice, bob, bobPhone} {
+		require.NoError(t, store.StoreKey(ctx, entity, []byte(entity.EntityID()+"-key")))
+	}
+	devices := inmemory.NewDeviceRegistry()
+	require.NoError(t, devices.EnrollDevice(ctx, bob, bobPhone))
+
+	getKey := func(apiHandler *api.API, target urn.URN, reader string, claims map[string]any) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/keys/"+target.String(), nil)
+		req.SetPathValue("entityURN", target.String())
+		if reader != "" {
+			reqCtx := api.ContextWithUserID(context.Background(), reader)
+			req = req.WithContext(api.ContextWithClaims(reqCtx, claims))
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.GetKeyHandler(rr, req)
+		return rr
+	}
+
+	t.Run("Authenticated mode requires a caller", func(t *testing.T) {
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), ReadMode: keyservice.ReadModeAuthenticated}
+
+		assert.Equal(t, http.StatusUnauthorized, getKey(apiHandler, bob, "", nil).Code)
+		assert.Equal(t, http.StatusOK, getKey(apiHandler, bob, "alice", nil).Code)
+	})
+
+	t.Run("Contacts mode allows own keys and contacts' keys only", func(t *testing.T) {
+		apiHandler := &api.API{
+			Store:          store,
+			Logger:         zerolog.Nop(),
+			Devices:        devices,
+			ReadMode:       keyservice.ReadModeContacts,
+			ReadAuthorizer: authz.NewClaimContacts("contacts"),
+		}
+		withBob := map[string]any{"contacts": []any{bob.String()}}
+
+		assert.Equal(t, http.StatusOK, getKey(apiHandler, alice, "alice", nil).Code, "own key")
+		assert.Equal(t, http.StatusOK, getKey(apiHandler, bob, "alice", withBob).Code, "contact's key")
+		assert.Equal(t, http.StatusOK, getKey(apiHandler, bobPhone, "alice", withBob).Code, "contact's device key")
+		assert.Equal(t, http.StatusOK, getKey(apiHandler, bobPhone, "bob", nil).Code, "own device key")
+
+		denied := getKey(apiHandler, bob, "alice", nil)
+		missing := getKey(apiHandler, alice, "mallory", map[string]any{"contacts": []any{"urn:sm:user:nobody"}})
+		assert.Equal(t, http.StatusNotFound, denied.Code)
+		assert.Equal(t, http.StatusNotFound, missing.Code)
+		assert.Equal(t, denied.Body.String(), missing.Body.String(), "denied reads look like missing keys")
+	})
+
+	t.Run("Contacts mode without a ReadAuthorizer only allows own keys", func(t *testing.T) {
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop(), ReadMode: keyservice.ReadModeContacts}
+
+		assert.Equal(t, http.StatusOK, getKey(apiHandler, alice, "alice", nil).Code)
+		assert.Equal(t, http.StatusNotFound, getKey(apiHandler, bob, "alice", nil).Code)
+	})
+}
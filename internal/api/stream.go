@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// NDJSONContentType is the media type of streamed responses: one JSON value
+// per line. Clients ask for a stream by accepting it.
+const NDJSONContentType = "application/x-ndjson"
+
+// MaxStreamGetKeys is the largest number of entities a streamed batch
+// lookup may name. Streamed lookups hold one chunk of records at a time, so
+// they may name far more entities than keyservice.MaxBatchGetKeys.
+const MaxStreamGetKeys = 10000
+
+// ndjsonWriter writes a streamed response. Lines are flushed as soon as
+// each chunk read from the store has been written, so a slow client blocks
+// the writer, and with it the reads from the store, instead of output
+// piling up in memory.
+type ndjsonWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	enc *json.Encoder
+}
+
+// newNDJSONWriter starts a 200 OK NDJSON response.
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	return &ndjsonWriter{w: w, rc: http.NewResponseController(w), enc: json.NewEncoder(w)}
+}
+
+// write buffers v as one line. It fails once the client has gone away.
+func (s *ndjsonWriter) write(v any) error {
+	return s.enc.Encode(v)
+}
+
+// flush sends the lines written so far.
+func (s *ndjsonWriter) flush() error {
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// streamError is the last line of a stream that failed after it started.
+// Clients must treat a stream ending in one, or ending without a newline,
+// as incomplete.
+type streamError struct {
+	Error string `json:"error"`
+}
+
+// fail ends the stream with err, hiding the details of internal failures.
+func (s *ndjsonWriter) fail(err error) {
+	message := "Internal server error"
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		message = apiErr.Message
+	}
+	if s.write(streamError{Error: message}) == nil {
+		_ = s.flush()
+	}
+}
+
+// batchStreamLine is one line of a streamed batch lookup: the entity's key
+// record with Status "found", or only the entity with Status "notFound" or
+// "revoked".
+type batchStreamLine struct {
+	*keyRecordResponse
+	EntityURN string `json:"entityUrn"`
+	Status    string `json:"status"`
+}
+
+// streamKeys writes the keys of entityURNs as NDJSON, one line per entity
+// in request order. Keys are read keyservice.MaxBatchGetKeys entities at a
+// time, and the next chunk is only read once the previous one has been
+// flushed.
+func (a *API) streamKeys(w http.ResponseWriter, r *http.Request, entityURNs []urn.URN) {
+	if len(entityURNs) == 0 || len(entityURNs) > MaxStreamGetKeys {
+		response.WriteJSONError(w, http.StatusBadRequest, "entityUrns must list between 1 and "+strconv.Itoa(MaxStreamGetKeys)+" entities")
+		return
+	}
+	ctx := r.Context()
+	var stream *ndjsonWriter
+	err := a.readEach(ctx, entityURNs, func(entityURN urn.URN, rec keyservice.KeyRecord, status int) error {
+		if stream == nil {
+			stream = newNDJSONWriter(w)
+		}
+		line := batchStreamLine{EntityURN: entityURN.String()}
+		switch status {
+		case http.StatusOK:
+			resp := newKeyRecordResponse(rec)
+			line.keyRecordResponse, line.Status = &resp, "found"
+		case http.StatusGone:
+			line.Status = "revoked"
+		default:
+			line.Status = "notFound"
+		}
+		return stream.write(line)
+	}, func() error {
+		if stream == nil {
+			return nil
+		}
+		return stream.flush()
+	})
+	a.endStream(ctx, w, stream, err)
+}
+
+// streamListKeys writes every record matching filter from pageToken on as
+// NDJSON, one keyRecordResponse per line. Records are read from the store a
+// page at a time and the next page is only read once the previous one has
+// been written.
+func (a *API) streamListKeys(w http.ResponseWriter, r *http.Request, filter keyservice.ListFilter, pageToken string) {
+	ctx := r.Context()
+	var stream *ndjsonWriter
+	err := func() error {
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			page, err := a.Store.ListKeys(ctx, filter, pageToken)
+			if err != nil {
+				a.Logger.Error().Err(err).Msg("Failed to list keys")
+				return reject(http.StatusInternalServerError, "Failed to list keys")
+			}
+			if stream == nil {
+				stream = newNDJSONWriter(w)
+			}
+			for _, rec := range page.Records {
+				if err := stream.write(newKeyRecordResponse(rec)); err != nil {
+					return err
+				}
+			}
+			if err := stream.flush(); err != nil {
+				return err
+			}
+			if page.NextPageToken == "" {
+				return nil
+			}
+			pageToken = page.NextPageToken
+		}
+	}()
+	a.endStream(ctx, w, stream, err)
+}
+
+// endStream finishes a stream that ended with err. Errors before the first
+// line are replied to as usual; later ones end the stream with a
+// streamError line, unless the client has gone away.
+func (a *API) endStream(ctx context.Context, w http.ResponseWriter, stream *ndjsonWriter, err error) {
+	switch {
+	case err == nil:
+		if stream == nil {
+			newNDJSONWriter(w)
+		}
+	case ctx.Err() != nil:
+		a.Logger.Info().Err(err).Msg("Client went away mid-stream")
+	case stream == nil:
+		writeError(w, err)
+	default:
+		a.Logger.Warn().Err(err).Msg("Stream failed after it started")
+		stream.fail(err)
+	}
+}
@@ -0,0 +1,310 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lazyStore generates records as they are read and counts them, so a test
+// can tell how far the reads have run ahead of the client. Only GetRecord,
+// GetRecords and ListKeys are implemented.
+type lazyStore struct {
+	keyservice.Store
+	total int
+	read  atomic.Int64
+}
+
+func (s *lazyStore) record(i int) keyservice.KeyRecord {
+	entityURN, _ := urn.New(urn.SecureMessaging, "user", fmt.Sprintf("user-%06d", i))
+	return keyservice.KeyRecord{EntityURN: entityURN, Key: bytes.Repeat([]byte{'k'}, 1024)}
+}
+
+func (s *lazyStore) GetRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	s.read.Add(1)
+	return keyservice.KeyRecord{EntityURN: entityURN, Key: bytes.Repeat([]byte{'k'}, 1024)}, nil
+}
+
+func (s *lazyStore) GetRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, error) {
+	s.read.Add(int64(len(entityURNs)))
+	records := make([]keyservice.KeyRecord, len(entityURNs))
+	for i, entityURN := range entityURNs {
+		records[i] = keyservice.KeyRecord{EntityURN: entityURN, Key: bytes.Repeat([]byte{'k'}, 1024)}
+	}
+	return records, nil
+}
+
+func (s *lazyStore) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	start := 0
+	if pageToken != "" {
+		_, _ = fmt.Sscan(pageToken, &start)
+	}
+	end := min(start+filter.PageSize, s.total)
+	var page keyservice.KeyPage
+	for i := start; i < end; i++ {
+		page.Records = append(page.Records, s.record(i))
+	}
+	s.read.Add(int64(len(page.Records)))
+	if end < s.total {
+		page.NextPageToken = fmt.Sprint(end)
+	}
+	return page, nil
+}
+
+// slowClient is a ResponseWriter that hands each flushed line to the test
+// over an unbuffered channel, so the handler blocks until the test reads
+// it. Once ctx is done it fails writes like a dropped connection.
+type slowClient struct {
+	ctx    context.Context
+	header http.Header
+	status int
+	buf    bytes.Buffer
+	lines  chan []byte
+}
+
+func newSlowClient(ctx context.Context) *slowClient {
+	return &slowClient{ctx: ctx, header: make(http.Header), lines: make(chan []byte)}
+}
+
+func (c *slowClient) Header() http.Header  { return c.header }
+func (c *slowClient) WriteHeader(code int) { c.status = code }
+
+func (c *slowClient) Write(p []byte) (int, error) {
+	if c.ctx.Err() != nil {
+		return 0, c.ctx.Err()
+	}
+	return c.buf.Write(p)
+}
+
+func (c *slowClient) FlushError() error {
+	for {
+		line, err := c.buf.ReadBytes('\n')
+		if err != nil {
+			c.buf.Write(line)
+			return nil
+		}
+		select {
+		case c.lines <- line:
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+	}
+}
+
+// serve runs handler in the background, closing the client's lines once it
+// returns.
+func (c *slowClient) serve(handler http.HandlerFunc, r *http.Request) {
+	go func() {
+		defer close(c.lines)
+		handler(c, r)
+	}()
+}
+
+// TestStreaming tests the NDJSON modes of POST /keys:batchGet and
+// GET /admin/keys.
+func TestStreaming(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	carolURN, err := urn.New(urn.SecureMessaging, "user", "carol")
+	require.NoError(t, err)
+
+	batchGetBody := func(t *testing.T, entityURNs []string) string {
+		t.Helper()
+		body, err := json.Marshal(map[string][]string{"entityUrns": entityURNs})
+		require.NoError(t, err)
+		return string(body)
+	}
+	decodeLines := func(t *testing.T, body string) []map[string]any {
+		t.Helper()
+		var lines []map[string]any
+		for _, raw := range strings.SplitAfter(body, "\n") {
+			if raw == "" {
+				continue
+			}
+			require.True(t, strings.HasSuffix(raw, "\n"), "unterminated line %q", raw)
+			var line map[string]any
+			require.NoError(t, json.Unmarshal([]byte(raw), &line))
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	t.Run("Batch lookup streams a line per entity beyond the batch limit", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+		require.NoError(t, store.RevokeKey(ctx, bobURN))
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		entityURNs := []string{aliceURN.String(), bobURN.String(), carolURN.String()}
+		for i := range keyservice.MaxBatchGetKeys {
+			entityURNs = append(entityURNs, fmt.Sprintf("urn:sm:user:missing-%d", i))
+		}
+		req := httptest.NewRequest(http.MethodPost, "/keys:batchGet", strings.NewReader(batchGetBody(t, entityURNs)))
+		req.Header.Set("Accept", api.NDJSONContentType)
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.BatchGetKeysHandler(rr, req)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, api.NDJSONContentType, rr.Header().Get("Content-Type"))
+		lines := decodeLines(t, rr.Body.String())
+		require.Len(t, lines, len(entityURNs))
+		assert.Equal(t, aliceURN.String(), lines[0]["entityUrn"])
+		assert.Equal(t, "found", lines[0]["status"])
+		assert.Equal(t, keyservice.Fingerprint([]byte("alice-key")), lines[0]["keyId"])
+		assert.Equal(t, map[string]any{"entityUrn": bobURN.String(), "status": "revoked"}, lines[1])
+		assert.Equal(t, map[string]any{"entityUrn": carolURN.String(), "status": "notFound"}, lines[2])
+	})
+
+	t.Run("Batch lookup reads the store a chunk at a time", func(t *testing.T) {
+		// Arrange
+		store := &countingStore{Store: inmemory.New()}
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		entityURNs := make([]string, 2*keyservice.MaxBatchGetKeys+1)
+		for i := range entityURNs {
+			entityURNs[i] = fmt.Sprintf("urn:sm:user:u-%d", i)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/keys:batchGet", strings.NewReader(batchGetBody(t, entityURNs)))
+		req.Header.Set("Accept", api.NDJSONContentType)
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.BatchGetKeysHandler(rr, req)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Len(t, decodeLines(t, rr.Body.String()), len(entityURNs))
+		assert.Equal(t, 0, store.getRecord)
+		assert.Equal(t, 3, store.getRecords)
+	})
+
+	t.Run("Batch lookup beyond the stream limit is rejected", func(t *testing.T) {
+		// Arrange
+		apiHandler := &api.API{Store: inmemory.New(), Logger: zerolog.Nop()}
+		entityURNs := make([]string, api.MaxStreamGetKeys+1)
+		for i := range entityURNs {
+			entityURNs[i] = fmt.Sprintf("urn:sm:user:u-%d", i)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/keys:batchGet", strings.NewReader(batchGetBody(t, entityURNs)))
+		req.Header.Set("Accept", api.NDJSONContentType)
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.BatchGetKeysHandler(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Admin listing streams every page", func(t *testing.T) {
+		// Arrange
+		store := &lazyStore{total: 25}
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys?pageSize=10", nil)
+		req.Header.Set("Accept", api.NDJSONContentType)
+		rr := httptest.NewRecorder()
+
+		// Act
+		apiHandler.ListKeysHandler(rr, req)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		lines := decodeLines(t, rr.Body.String())
+		require.Len(t, lines, 25)
+		assert.Equal(t, "urn:sm:user:user-000000", lines[0]["entityUrn"])
+		assert.Equal(t, "urn:sm:user:user-000024", lines[24]["entityUrn"])
+	})
+
+	t.Run("Memory stays bounded: reads run at most a page ahead of a slow client", func(t *testing.T) {
+		// Arrange
+		const total, pageSize = 5000, 50
+		store := &lazyStore{total: total}
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/keys?pageSize=%d", pageSize), nil)
+		req.Header.Set("Accept", api.NDJSONContentType)
+		client := newSlowClient(ctx)
+
+		// Act
+		client.serve(apiHandler.ListKeysHandler, req)
+		received, maxAhead := 0, int64(0)
+		for range client.lines {
+			received++
+			maxAhead = max(maxAhead, store.read.Load()-int64(received))
+		}
+
+		// Assert
+		assert.Equal(t, total, received)
+		assert.LessOrEqual(t, maxAhead, int64(pageSize))
+	})
+
+	t.Run("Backpressure: a client that stops reading stops the lookups", func(t *testing.T) {
+		// Arrange
+		store := &lazyStore{}
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		entityURNs := make([]string, 1000)
+		for i := range entityURNs {
+			entityURNs[i] = fmt.Sprintf("urn:sm:user:u-%d", i)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/keys:batchGet", strings.NewReader(batchGetBody(t, entityURNs)))
+		req.Header.Set("Accept", api.NDJSONContentType)
+		client := newSlowClient(ctx)
+
+		// Act: read two lines, then stall.
+		client.serve(apiHandler.BatchGetKeysHandler, req)
+		<-client.lines
+		<-client.lines
+		time.Sleep(50 * time.Millisecond)
+		readWhileStalled := store.read.Load()
+		remaining := 0
+		for range client.lines {
+			remaining++
+		}
+
+		// Assert: only the chunk being sent was read ahead.
+		assert.Equal(t, int64(keyservice.MaxBatchGetKeys), readWhileStalled)
+		assert.Equal(t, len(entityURNs)-2, remaining)
+	})
+
+	t.Run("A client going away ends the stream", func(t *testing.T) {
+		// Arrange
+		store := &lazyStore{total: 100000}
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		reqCtx, cancel := context.WithCancel(ctx)
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys?pageSize=10", nil).WithContext(reqCtx)
+		req.Header.Set("Accept", api.NDJSONContentType)
+		client := newSlowClient(reqCtx)
+
+		// Act
+		client.serve(apiHandler.ListKeysHandler, req)
+		for range 3 {
+			<-client.lines
+		}
+		cancel()
+		for range client.lines {
+		}
+
+		// Assert
+		assert.LessOrEqual(t, store.read.Load(), int64(20))
+	})
+}
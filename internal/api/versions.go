@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+const apiVersionKey contextKey = "apiVersion"
+
+// ContextWithAPIVersion returns a copy of ctx recording the API version a
+// request was made under.
+func ContextWithAPIVersion(ctx context.Context, version keyservice.APIVersion) context.Context {
+	return context.WithValue(ctx, apiVersionKey, version)
+}
+
+// APIVersionFromContext returns the API version a request was made under.
+// Requests without one, such as those on unversioned paths, are v1.
+func APIVersionFromContext(ctx context.Context) keyservice.APIVersion {
+	if version, ok := ctx.Value(apiVersionKey).(keyservice.APIVersion); ok {
+		return version
+	}
+	return keyservice.APIVersionV1
+}
+
+// wantsSignedKey reports whether GetKeyHandler should return the key as JSON
+// rather than raw bytes. v1, and so the unversioned paths, always return the
+// raw key whatever the Accept header, as clients sending
+// "Accept: application/json, */*" have always got it. From v2 JSON is the
+// default and clients get the raw key by accepting application/octet-stream
+// instead.
+func wantsSignedKey(r *http.Request) bool {
+	if APIVersionFromContext(r.Context()) == keyservice.APIVersionV1 {
+		return false
+	}
+	return accepts(r, "application/json") || !accepts(r, "application/octet-stream")
+}
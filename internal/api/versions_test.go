@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetKeyHandlerVersions tests the default representation of a key in
+// each API version.
+func TestGetKeyHandlerVersions(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	store := inmemory.New()
+	require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+	apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+
+	read := func(reqCtx context.Context, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/keys/"+aliceURN.String(), nil).WithContext(reqCtx)
+		req.SetPathValue("entityURN", aliceURN.String())
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		apiHandler.GetKeyHandler(rr, req)
+		return rr
+	}
+	v1 := api.ContextWithAPIVersion(ctx, keyservice.APIVersionV1)
+	v2 := api.ContextWithAPIVersion(ctx, keyservice.APIVersionV2)
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		accept   string
+		wantJSON bool
+	}{
+		{name: "Unversioned requests get the raw key", ctx: ctx},
+		{name: "v1 requests get the raw key", ctx: v1, accept: "*/*"},
+		{name: "Unversioned requests accepting JSON get the raw key", ctx: ctx, accept: "application/json, */*"},
+		{name: "v1 requests accepting JSON get the raw key", ctx: v1, accept: "application/json"},
+		{name: "v2 requests get JSON", ctx: v2, accept: "*/*", wantJSON: true},
+		{name: "v2 requests accepting JSON get JSON", ctx: v2, accept: "application/json, application/octet-stream", wantJSON: true},
+		{name: "v2 requests accepting octet-stream get the raw key", ctx: v2, accept: "application/octet-stream"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			rr := read(tc.ctx, tc.accept)
+
+			// Assert
+			require.Equal(t, http.StatusOK, rr.Code)
+			if !tc.wantJSON {
+				assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+				assert.Equal(t, []byte("alice-key"), rr.Body.Bytes())
+				return
+			}
+			var body struct {
+				EntityURN string `json:"entityUrn"`
+				Key       []byte `json:"key"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			assert.Equal(t, aliceURN.String(), body.EntityURN)
+			assert.Equal(t, []byte("alice-key"), body.Key)
+		})
+	}
+}
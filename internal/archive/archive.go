@@ -0,0 +1,519 @@
+// Package archive exports the key directory as a signed archive and imports
+// such archives back into any keyservice.Store.
+//
+// Two formats are supported. NDJSON archives hold one {"record": ...} line per
+// key followed by a final {"manifest": ...} line. Tar archives hold one JSON
+// document per key under records/ followed by manifest.json. In both formats
+// the manifest carries the record count and a SHA-256 digest over the encoded
+// records, and is signed with an Ed25519 key so that an archive can only be
+// imported if it is complete, unmodified and produced by a trusted exporter.
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Format identifies an archive encoding.
+type Format string
+
+const (
+	// FormatNDJSON is newline-delimited JSON.
+	FormatNDJSON Format = "ndjson"
+	// FormatTar is a tar of JSON documents.
+	FormatTar Format = "tar"
+)
+
+// ManifestVersion identifies the manifest layout.
+const ManifestVersion = "keyservice-archive/v1"
+
+// manifestName is the tar entry holding the manifest.
+const manifestName = "manifest.json"
+
+// ErrInvalidArchive is returned when an archive is malformed, incomplete or
+// not signed by a trusted key.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Record is the archived form of a keyservice.KeyRecord.
+type Record struct {
+	EntityURN  string      `json:"entityUrn"`
+	Key        []byte      `json:"key"`
+	UpdatedAt  time.Time   `json:"updatedAt,omitzero"`
+	Revoked    bool        `json:"revoked,omitempty"`
+	RevokedAt  time.Time   `json:"revokedAt,omitzero"`
+	Locked     bool        `json:"locked,omitempty"`
+	Signatures []Signature `json:"signatures,omitempty"`
+}
+
+// Signature is the archived form of a keyservice.KeySignature.
+type Signature struct {
+	SignerURN   string `json:"signerUrn"`
+	SignerKeyID string `json:"signerKeyId"`
+	Signature   []byte `json:"signature"`
+}
+
+// newRecord converts rec to its archived form.
+func newRecord(rec keyservice.KeyRecord) Record {
+	archived := Record{
+		EntityURN: rec.EntityURN.String(),
+		Key:       rec.Key,
+		UpdatedAt: rec.UpdatedAt,
+		Revoked:   rec.Revoked,
+		RevokedAt: rec.RevokedAt,
+		Locked:    rec.Locked,
+	}
+	for _, sig := range rec.Signatures {
+		archived.Signatures = append(archived.Signatures, Signature{SignerURN: sig.SignerURN.String(), SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+	}
+	return archived
+}
+
+// keyRecord converts an archived record back to a keyservice.KeyRecord.
+func (r Record) keyRecord() (keyservice.KeyRecord, error) {
+	entityURN, err := urn.Parse(r.EntityURN)
+	if err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("record has an invalid URN: %w", err)
+	}
+	rec := keyservice.KeyRecord{
+		EntityURN: entityURN,
+		Key:       r.Key,
+		UpdatedAt: r.UpdatedAt,
+		Revoked:   r.Revoked,
+		RevokedAt: r.RevokedAt,
+		Locked:    r.Locked,
+	}
+	for _, sig := range r.Signatures {
+		signerURN, err := urn.Parse(sig.SignerURN)
+		if err != nil {
+			return keyservice.KeyRecord{}, fmt.Errorf("signature on %s has an invalid signer URN: %w", r.EntityURN, err)
+		}
+		rec.Signatures = append(rec.Signatures, keyservice.KeySignature{SignerURN: signerURN, SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+	}
+	return rec, nil
+}
+
+// Manifest describes and authenticates the records of an archive.
+type Manifest struct {
+	Version     string    `json:"version"`
+	CreatedAt   time.Time `json:"createdAt"`
+	RecordCount int       `json:"recordCount"`
+	// SHA256 is the hex digest over every encoded record, in archive order.
+	SHA256 string `json:"sha256"`
+	// KeyID identifies the signing key; see KeyID.
+	KeyID     string `json:"keyId"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// ParseFormat validates a format name, defaulting to NDJSON.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatNDJSON:
+		return FormatNDJSON, nil
+	case FormatTar:
+		return FormatTar, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format %q", s)
+	}
+}
+
+// ContentType returns the HTTP media type of the format.
+func (f Format) ContentType() string {
+	if f == FormatTar {
+		return "application/x-tar"
+	}
+	return "application/x-ndjson"
+}
+
+// KeyID derives a short, stable identifier for a signing key.
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Export streams every record in store, including locks on entities with no
+// key, to w, followed by a manifest signed with signingKey. Records are written as they are read, so memory use does
+// not grow with the size of the directory. It returns the manifest written.
+func Export(ctx context.Context, store keyservice.Store, w io.Writer, format Format, signingKey ed25519.PrivateKey) (Manifest, error) {
+	enc := newEncoder(w, format)
+	digest := sha256.New()
+	count := 0
+
+	pageToken := ""
+	for {
+		page, err := store.ListKeys(ctx, keyservice.ListFilter{IncludeLocked: true}, pageToken)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to list keys: %w", err)
+		}
+		for _, rec := range page.Records {
+			data, err := json.Marshal(newRecord(rec))
+			if err != nil {
+				return Manifest{}, fmt.Errorf("failed to encode key for entity %s: %w", rec.EntityURN.String(), err)
+			}
+			count++
+			digest.Write(data)
+			if err := enc.writeRecord(count, data); err != nil {
+				return Manifest{}, fmt.Errorf("failed to write archive: %w", err)
+			}
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	manifest := Manifest{
+		Version:     ManifestVersion,
+		CreatedAt:   time.Now().UTC(),
+		RecordCount: count,
+		SHA256:      hex.EncodeToString(digest.Sum(nil)),
+		KeyID:       KeyID(signingKey.Public().(ed25519.PublicKey)),
+	}
+	manifest.Signature = ed25519.Sign(signingKey, manifest.signedBytes())
+	if err := enc.writeManifest(manifest); err != nil {
+		return Manifest{}, fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Read decodes an archive and verifies its manifest against trustedKeys. No
+// record is returned unless the whole archive is valid.
+func Read(r io.Reader, format Format, trustedKeys []ed25519.PublicKey) ([]keyservice.KeyRecord, Manifest, error) {
+	digest := sha256.New()
+	var (
+		records  []keyservice.KeyRecord
+		manifest *Manifest
+	)
+	addRecord := func(data []byte) error {
+		if manifest != nil {
+			return fmt.Errorf("%w: record after manifest", ErrInvalidArchive)
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("%w: malformed record: %v", ErrInvalidArchive, err)
+		}
+		keyRecord, err := rec.keyRecord()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		digest.Write(data)
+		records = append(records, keyRecord)
+		return nil
+	}
+	setManifest := func(m Manifest) error {
+		if manifest != nil {
+			return fmt.Errorf("%w: duplicate manifest", ErrInvalidArchive)
+		}
+		manifest = &m
+		return nil
+	}
+
+	var err error
+	if format == FormatTar {
+		err = readTar(r, addRecord, setManifest)
+	} else {
+		err = readNDJSON(r, addRecord, setManifest)
+	}
+	if err != nil {
+		return nil, Manifest{}, err
+	}
+	if manifest == nil {
+		return nil, Manifest{}, fmt.Errorf("%w: missing manifest", ErrInvalidArchive)
+	}
+	if err := manifest.verify(trustedKeys, len(records), digest); err != nil {
+		return nil, Manifest{}, err
+	}
+	return records, *manifest, nil
+}
+
+// ImportReport summarises an import.
+type ImportReport struct {
+	Imported  int `json:"imported"`
+	Unchanged int `json:"unchanged"`
+	// Stale lists the entities skipped because the store already holds a
+	// newer record for them.
+	Stale []string `json:"stale,omitempty"`
+	// Writes lists the writes attempted, in order, for the caller to
+	// record in its audit log.
+	Writes []ImportWrite `json:"-"`
+}
+
+// ImportWrite is one record Load attempted to write, with the key it
+// replaced and the outcome.
+type ImportWrite struct {
+	Record      keyservice.KeyRecord
+	PreviousKey []byte
+	Err         error
+}
+
+// Load writes records into store, each whole in a single ReplaceRecord so
+// that its key, signatures, revocation, lock and timestamps land together,
+// whether or not the entity is locked. Records already stored unchanged are
+// skipped, so loading the same archive twice is harmless, and so are records
+// older than the one stored, which are reported as stale.
+func Load(ctx context.Context, store keyservice.Store, records []keyservice.KeyRecord) (ImportReport, error) {
+	var report ImportReport
+	for _, rec := range records {
+		entityKey := rec.EntityURN.String()
+		existing, err := store.GetRecord(ctx, rec.EntityURN)
+		switch {
+		case errors.Is(err, keyservice.ErrKeyNotFound):
+			existing = keyservice.KeyRecord{}
+		case err != nil:
+			return report, fmt.Errorf("failed to read key for entity %s: %w", entityKey, err)
+		case sameRecord(existing, rec):
+			report.Unchanged++
+			continue
+		case existing.UpdatedAt.After(rec.UpdatedAt):
+			report.Stale = append(report.Stale, entityKey)
+			continue
+		}
+
+		// The write is conditional on the key read above, so a change that
+		// lands in between is not overwritten.
+		previousKey := existing.Key
+		if previousKey == nil {
+			previousKey = []byte{}
+		}
+		err = store.ReplaceRecord(ctx, rec, previousKey)
+		report.Writes = append(report.Writes, ImportWrite{Record: rec, PreviousKey: existing.Key, Err: err})
+		if errors.Is(err, keyservice.ErrKeyChanged) {
+			report.Stale = append(report.Stale, entityKey)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to import key for entity %s: %w", entityKey, err)
+		}
+		report.Imported++
+	}
+	return report, nil
+}
+
+// sameRecord reports whether two records hold the same key, signatures,
+// revocation and lock state.
+func sameRecord(a, b keyservice.KeyRecord) bool {
+	return bytes.Equal(a.Key, b.Key) && a.Revoked == b.Revoked && a.Locked == b.Locked &&
+		keyservice.EqualSignatures(a.Signatures, b.Signatures)
+}
+
+// signedBytes is the canonical encoding covered by the signature: the
+// manifest without its signature.
+func (m Manifest) signedBytes() []byte {
+	m.Signature = nil
+	data, _ := json.Marshal(m)
+	return data
+}
+
+func (m Manifest) verify(trustedKeys []ed25519.PublicKey, recordCount int, digest hash.Hash) error {
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("%w: unsupported manifest version %q", ErrInvalidArchive, m.Version)
+	}
+	var signer ed25519.PublicKey
+	for _, key := range trustedKeys {
+		if KeyID(key) == m.KeyID {
+			signer = key
+			break
+		}
+	}
+	if signer == nil {
+		return fmt.Errorf("%w: manifest signed by untrusted key %q", ErrInvalidArchive, m.KeyID)
+	}
+	if !ed25519.Verify(signer, m.signedBytes(), m.Signature) {
+		return fmt.Errorf("%w: manifest signature does not verify", ErrInvalidArchive)
+	}
+	if m.RecordCount != recordCount {
+		return fmt.Errorf("%w: manifest lists %d records but archive holds %d", ErrInvalidArchive, m.RecordCount, recordCount)
+	}
+	if m.SHA256 != hex.EncodeToString(digest.Sum(nil)) {
+		return fmt.Errorf("%w: record digest does not match manifest", ErrInvalidArchive)
+	}
+	return nil
+}
+
+// encoder writes records and the manifest in one of the archive formats.
+type encoder struct {
+	format Format
+	w      io.Writer
+	tw     *tar.Writer
+}
+
+func newEncoder(w io.Writer, format Format) *encoder {
+	e := &encoder{format: format, w: w}
+	if format == FormatTar {
+		e.tw = tar.NewWriter(w)
+	}
+	return e
+}
+
+func (e *encoder) writeRecord(seq int, data []byte) error {
+	if e.tw != nil {
+		return e.writeTarFile(fmt.Sprintf("records/%08d.json", seq), data)
+	}
+	// The encoded record is embedded verbatim so the digest covers exactly
+	// the bytes the reader will see.
+	line := make([]byte, 0, len(data)+12)
+	line = append(line, `{"record":`...)
+	line = append(line, data...)
+	line = append(line, "}\n"...)
+	_, err := e.w.Write(line)
+	return err
+}
+
+func (e *encoder) writeManifest(m Manifest) error {
+	if e.tw != nil {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := e.writeTarFile(manifestName, data); err != nil {
+			return err
+		}
+		return e.tw.Close()
+	}
+	data, err := json.Marshal(struct {
+		Manifest Manifest `json:"manifest"`
+	}{m})
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func (e *encoder) writeTarFile(name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now().UTC(), Typeflag: tar.TypeReg}
+	if err := e.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := e.tw.Write(data)
+	return err
+}
+
+func readNDJSON(r io.Reader, addRecord func([]byte) error, setManifest func(Manifest) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var raw struct {
+			Record   json.RawMessage `json:"record"`
+			Manifest *Manifest       `json:"manifest"`
+		}
+		if err := json.Unmarshal(line, &raw); err != nil {
+			return fmt.Errorf("%w: malformed line: %v", ErrInvalidArchive, err)
+		}
+		switch {
+		case raw.Record != nil:
+			if err := addRecord(raw.Record); err != nil {
+				return err
+			}
+		case raw.Manifest != nil:
+			if err := setManifest(*raw.Manifest); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: line is neither a record nor a manifest", ErrInvalidArchive)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	return nil
+}
+
+func readTar(r io.Reader, addRecord func([]byte) error, setManifest func(Manifest) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Name == manifestName {
+			var m Manifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return fmt.Errorf("%w: malformed manifest: %v", ErrInvalidArchive, err)
+			}
+			if err := setManifest(m); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := addRecord(data); err != nil {
+			return err
+		}
+	}
+}
+
+// LoadSigningKey reads a PEM encoded PKCS #8 Ed25519 private key.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key at %s: %w", path, err)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key at %s is not an Ed25519 key", path)
+	}
+	return signingKey, nil
+}
+
+// LoadVerificationKey reads a PEM encoded PKIX Ed25519 public key.
+func LoadVerificationKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verification key at %s: %w", path, err)
+	}
+	verificationKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("verification key at %s is not an Ed25519 key", path)
+	}
+	return verificationKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file at %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	return block, nil
+}
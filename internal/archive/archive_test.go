@@ -0,0 +1,204 @@
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/archive"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	publicKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	trusted := []ed25519.PublicKey{publicKey}
+
+	source := inmemory.New()
+	for i := 0; i < 3; i++ {
+		entityURN, err := urn.New(urn.SecureMessaging, "user", fmt.Sprintf("user-%d", i))
+		require.NoError(t, err)
+		require.NoError(t, source.StoreKey(ctx, entityURN, []byte(fmt.Sprintf("key-%d", i))))
+	}
+
+	for _, format := range []archive.Format{archive.FormatNDJSON, archive.FormatTar} {
+		t.Run(string(format)+" round trip is idempotent", func(t *testing.T) {
+			// Arrange
+			var buf bytes.Buffer
+			manifest, err := archive.Export(ctx, source, &buf, format, signingKey)
+			require.NoError(t, err)
+			destination := inmemory.New()
+
+			// Act
+			records, readManifest, err := archive.Read(bytes.NewReader(buf.Bytes()), format, trusted)
+			require.NoError(t, err)
+			first, err := archive.Load(ctx, destination, records)
+			require.NoError(t, err)
+			second, err := archive.Load(ctx, destination, records)
+			require.NoError(t, err)
+
+			// Assert
+			assert.Equal(t, 3, manifest.RecordCount)
+			assert.Equal(t, manifest.SHA256, readManifest.SHA256)
+			assert.Equal(t, 3, first.Imported)
+			assert.Len(t, first.Writes, 3)
+			assert.Equal(t, archive.ImportReport{Unchanged: 3}, second)
+		})
+	}
+
+	t.Run("Round trip keeps signatures", func(t *testing.T) {
+		// Arrange
+		signed := inmemory.New()
+		deviceURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+		require.NoError(t, err)
+		ownerURN, err := urn.New(urn.SecureMessaging, "user", "owner")
+		require.NoError(t, err)
+		signatures := []keyservice.KeySignature{{SignerURN: ownerURN, SignerKeyID: "owner-key-id", Signature: []byte("sig")}}
+		require.NoError(t, signed.StoreSignedKey(ctx, deviceURN, []byte("device-key"), signatures))
+		var buf bytes.Buffer
+		_, err = archive.Export(ctx, signed, &buf, archive.FormatNDJSON, signingKey)
+		require.NoError(t, err)
+		destination := inmemory.New()
+
+		// Act
+		records, _, err := archive.Read(bytes.NewReader(buf.Bytes()), archive.FormatNDJSON, trusted)
+		require.NoError(t, err)
+		_, err = archive.Load(ctx, destination, records)
+		require.NoError(t, err)
+
+		// Assert
+		rec, err := destination.GetRecord(ctx, deviceURN)
+		require.NoError(t, err)
+		assert.Equal(t, signatures, rec.Signatures)
+	})
+
+	t.Run("Round trip keeps revocation, locks and timestamps", func(t *testing.T) {
+		// Arrange
+		stateful := inmemory.New()
+		revokedURN, err := urn.New(urn.SecureMessaging, "user", "revoked")
+		require.NoError(t, err)
+		require.NoError(t, stateful.StoreKey(ctx, revokedURN, []byte("revoked-key")))
+		require.NoError(t, stateful.RevokeKey(ctx, revokedURN))
+		lockedURN, err := urn.New(urn.SecureMessaging, "user", "locked")
+		require.NoError(t, err)
+		require.NoError(t, stateful.SetLocked(ctx, lockedURN, true))
+		want, err := stateful.GetRecord(ctx, revokedURN)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, err = archive.Export(ctx, stateful, &buf, archive.FormatNDJSON, signingKey)
+		require.NoError(t, err)
+		destination := inmemory.New()
+		// A lock in the destination does not abort the import.
+		require.NoError(t, destination.SetLocked(ctx, revokedURN, true))
+
+		// Act
+		records, _, err := archive.Read(bytes.NewReader(buf.Bytes()), archive.FormatNDJSON, trusted)
+		require.NoError(t, err)
+		report, err := archive.Load(ctx, destination, records)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, 2, report.Imported)
+		assert.Equal(t, []string{lockedURN.String(), revokedURN.String()}, writtenURNs(report))
+		revoked, err := destination.GetRecord(ctx, revokedURN)
+		require.NoError(t, err)
+		assert.True(t, revoked.Revoked)
+		assert.False(t, revoked.Locked)
+		assert.True(t, want.RevokedAt.Equal(revoked.RevokedAt), "the archived revocation time is kept")
+		assert.True(t, want.UpdatedAt.Equal(revoked.UpdatedAt), "the archived update time is kept")
+		locked, err := destination.GetRecord(ctx, lockedURN)
+		require.NoError(t, err)
+		assert.True(t, locked.Locked)
+		assert.Empty(t, locked.Key)
+	})
+
+	t.Run("Keeps newer destination records and reports them as stale", func(t *testing.T) {
+		// Arrange
+		var buf bytes.Buffer
+		_, err := archive.Export(ctx, source, &buf, archive.FormatNDJSON, signingKey)
+		require.NoError(t, err)
+		records, _, err := archive.Read(bytes.NewReader(buf.Bytes()), archive.FormatNDJSON, trusted)
+		require.NoError(t, err)
+		destination := inmemory.New()
+		newerURN, err := urn.New(urn.SecureMessaging, "user", "user-1")
+		require.NoError(t, err)
+		require.NoError(t, destination.StoreKey(ctx, newerURN, []byte("rotated-key")))
+
+		// Act
+		report, err := archive.Load(ctx, destination, records)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, 2, report.Imported)
+		assert.Equal(t, []string{newerURN.String()}, report.Stale)
+		assert.NotContains(t, writtenURNs(report), newerURN.String())
+		key, err := destination.GetKey(ctx, newerURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("rotated-key"), key)
+	})
+
+	t.Run("Rejects an archive signed by an untrusted key", func(t *testing.T) {
+		// Arrange
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, err = archive.Export(ctx, source, &buf, archive.FormatNDJSON, otherKey)
+		require.NoError(t, err)
+
+		// Act
+		_, _, err = archive.Read(&buf, archive.FormatNDJSON, trusted)
+
+		// Assert
+		require.ErrorIs(t, err, archive.ErrInvalidArchive)
+		assert.Contains(t, err.Error(), "untrusted key")
+	})
+
+	t.Run("Rejects a tampered record", func(t *testing.T) {
+		// Arrange
+		var buf bytes.Buffer
+		_, err := archive.Export(ctx, source, &buf, archive.FormatNDJSON, signingKey)
+		require.NoError(t, err)
+		tampered := strings.Replace(buf.String(), "user-1", "user-9", 1)
+
+		// Act
+		_, _, err = archive.Read(strings.NewReader(tampered), archive.FormatNDJSON, trusted)
+
+		// Assert
+		require.ErrorIs(t, err, archive.ErrInvalidArchive)
+		assert.Contains(t, err.Error(), "digest")
+	})
+
+	t.Run("Rejects a truncated archive", func(t *testing.T) {
+		// Arrange: drop the manifest line.
+		var buf bytes.Buffer
+		_, err := archive.Export(ctx, source, &buf, archive.FormatNDJSON, signingKey)
+		require.NoError(t, err)
+		lines := strings.SplitAfter(strings.TrimSpace(buf.String()), "\n")
+		truncated := strings.Join(lines[:len(lines)-1], "")
+
+		// Act
+		_, _, err = archive.Read(strings.NewReader(truncated), archive.FormatNDJSON, trusted)
+
+		// Assert
+		require.ErrorIs(t, err, archive.ErrInvalidArchive)
+		assert.Contains(t, err.Error(), "missing manifest")
+	})
+}
+
+// writtenURNs returns the entities of the writes in report.
+func writtenURNs(report archive.ImportReport) []string {
+	urns := make([]string, 0, len(report.Writes))
+	for _, write := range report.Writes {
+		urns = append(urns, write.Record.EntityURN.String())
+	}
+	return urns
+}
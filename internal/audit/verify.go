@@ -0,0 +1,67 @@
+// Package audit verifies the hash chain of the key service audit log.
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+// DefaultPageSize is the number of events Verify reads per call to List.
+const DefaultPageSize = 500
+
+// Options tunes Verify.
+type Options struct {
+	// PageSize is the number of events read per call to List; zero means
+	// DefaultPageSize.
+	PageSize int
+	// Anchor is the hash of a previously verified event. If set, the chain
+	// must still contain it, which detects events removed from the end of
+	// the log, something the chain alone cannot reveal.
+	Anchor string
+}
+
+// Report summarizes a verified chain.
+type Report struct {
+	// Events is the number of events verified.
+	Events uint64 `json:"events"`
+	// HeadHash is the hash of the last event, worth recording outside the
+	// log and passing as the Anchor of the next verification.
+	HeadHash string `json:"headHash"`
+}
+
+// Verify walks the whole chain in sink, checking every link and hash. It
+// stops at the first break, returning an error wrapping
+// keyservice.ErrAuditChainBroken and a report of the intact prefix.
+func Verify(ctx context.Context, sink keyservice.AuditSink, opts Options) (Report, error) {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	var report Report
+	var prev keyservice.AuditEvent
+	anchored := opts.Anchor == ""
+	for {
+		events, err := sink.List(ctx, prev.Sequence, pageSize)
+		if err != nil {
+			return report, fmt.Errorf("failed to read audit log after event %d: %w", prev.Sequence, err)
+		}
+		for _, event := range events {
+			if err := keyservice.VerifyAuditEvent(prev, event); err != nil {
+				return report, err
+			}
+			prev = event
+			anchored = anchored || event.Hash == opts.Anchor
+			report.Events++
+			report.HeadHash = event.Hash
+		}
+		if len(events) < pageSize {
+			break
+		}
+	}
+	if !anchored {
+		return report, fmt.Errorf("%w: anchor %s not found in %d events", keyservice.ErrAuditChainBroken, opts.Anchor, report.Events)
+	}
+	return report, nil
+}
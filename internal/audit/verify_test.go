@@ -0,0 +1,108 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/audit"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tamperingSink alters the events read from the wrapped sink.
+type tamperingSink struct {
+	keyservice.AuditSink
+	tamper func([]keyservice.AuditEvent) []keyservice.AuditEvent
+}
+
+func (s *tamperingSink) List(ctx context.Context, afterSequence uint64, limit int) ([]keyservice.AuditEvent, error) {
+	events, err := s.AuditSink.List(ctx, afterSequence, limit)
+	return s.tamper(events), err
+}
+
+func seed(t *testing.T, n int) *inmemory.AuditSink {
+	t.Helper()
+	sink := inmemory.NewAuditSink()
+	for i := 0; i < n; i++ {
+		_, err := sink.Append(context.Background(), keyservice.AuditEvent{Action: "keys:write", Actor: "user-123", Time: time.Now()})
+		require.NoError(t, err)
+	}
+	return sink
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Intact chain verifies across pages", func(t *testing.T) {
+		// Arrange
+		sink := seed(t, 5)
+
+		// Act
+		report, err := audit.Verify(ctx, sink, audit.Options{PageSize: 2})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), report.Events)
+		assert.NotEmpty(t, report.HeadHash)
+	})
+
+	t.Run("Modified event breaks the chain", func(t *testing.T) {
+		// Arrange
+		sink := &tamperingSink{AuditSink: seed(t, 5), tamper: func(events []keyservice.AuditEvent) []keyservice.AuditEvent {
+			for i := range events {
+				if events[i].Sequence == 3 {
+					events[i].Actor = "admin-1"
+				}
+			}
+			return events
+		}}
+
+		// Act
+		report, err := audit.Verify(ctx, sink, audit.Options{PageSize: 2})
+
+		// Assert
+		assert.ErrorIs(t, err, keyservice.ErrAuditChainBroken)
+		assert.Equal(t, uint64(2), report.Events)
+	})
+
+	t.Run("Deleted event breaks the chain", func(t *testing.T) {
+		// Arrange
+		sink := &tamperingSink{AuditSink: seed(t, 5), tamper: func(events []keyservice.AuditEvent) []keyservice.AuditEvent {
+			kept := events[:0]
+			for _, event := range events {
+				if event.Sequence != 2 {
+					kept = append(kept, event)
+				}
+			}
+			return kept
+		}}
+
+		// Act
+		_, err := audit.Verify(ctx, sink, audit.Options{})
+
+		// Assert
+		assert.ErrorIs(t, err, keyservice.ErrAuditChainBroken)
+	})
+
+	t.Run("Truncated log is detected with an anchor", func(t *testing.T) {
+		// Arrange
+		sink := seed(t, 3)
+		earlier, err := audit.Verify(ctx, sink, audit.Options{})
+		require.NoError(t, err)
+		truncated := &tamperingSink{AuditSink: sink, tamper: func(events []keyservice.AuditEvent) []keyservice.AuditEvent {
+			if len(events) > 2 {
+				return events[:2]
+			}
+			return events
+		}}
+
+		// Act
+		_, err = audit.Verify(ctx, truncated, audit.Options{Anchor: earlier.HeadHash})
+
+		// Assert
+		assert.ErrorIs(t, err, keyservice.ErrAuditChainBroken)
+	})
+}
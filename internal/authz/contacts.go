@@ -0,0 +1,26 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// ClaimContacts is a keyservice.ReadAuthorizer that trusts the identity
+// service to list each reader's contacts in a token claim. The claim holds
+// contact URNs or entity IDs.
+type ClaimContacts struct {
+	claim string
+}
+
+// NewClaimContacts returns a ReadAuthorizer reading contacts from claim.
+func NewClaimContacts(claim string) *ClaimContacts {
+	return &ClaimContacts{claim: claim}
+}
+
+// AuthorizeRead allows the read if target appears in the reader's contacts.
+func (c *ClaimContacts) AuthorizeRead(ctx context.Context, reader keyservice.Principal, target urn.URN) (bool, error) {
+	contacts := reader.Claims[c.claim]
+	return claimContains(contacts, target.String()) || claimContains(contacts, target.EntityID()), nil
+}
@@ -0,0 +1,42 @@
+package authz_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/authz"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimContacts(t *testing.T) {
+	ctx := context.Background()
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	carol, err := urn.New(urn.SecureMessaging, "user", "carol")
+	require.NoError(t, err)
+	readAuthz := authz.NewClaimContacts("contacts")
+
+	t.Run("Contacts may be listed by URN or entity ID", func(t *testing.T) {
+		byURN := keyservice.Principal{Subject: "alice", Claims: map[string]any{"contacts": []any{bob.String()}}}
+		byID := keyservice.Principal{Subject: "alice", Claims: map[string]any{"contacts": []any{"bob"}}}
+
+		allowed, err := readAuthz.AuthorizeRead(ctx, byURN, bob)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		allowed, err = readAuthz.AuthorizeRead(ctx, byID, bob)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		allowed, err = readAuthz.AuthorizeRead(ctx, byID, carol)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("A missing claim allows nothing", func(t *testing.T) {
+		allowed, err := readAuthz.AuthorizeRead(ctx, keyservice.Principal{Subject: "alice"}, bob)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+	})
+}
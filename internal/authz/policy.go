@@ -0,0 +1,116 @@
+// Package authz evaluates declarative keyservice.Policy rules.
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// PolicyAuthorizer is a keyservice.Authorizer driven by a keyservice.Policy.
+type PolicyAuthorizer struct {
+	policy  keyservice.Policy
+	devices keyservice.DeviceRegistry
+}
+
+// Option customises a PolicyAuthorizer.
+type Option func(*PolicyAuthorizer)
+
+// WithDeviceRegistry resolves device ownership for rules using the
+// device_owner subject relation. Without a registry such rules never match.
+func WithDeviceRegistry(devices keyservice.DeviceRegistry) Option {
+	return func(p *PolicyAuthorizer) { p.devices = devices }
+}
+
+// NewPolicyAuthorizer validates policy and returns an Authorizer for it.
+func NewPolicyAuthorizer(policy keyservice.Policy, opts ...Option) (*PolicyAuthorizer, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid authorization policy: %w", err)
+	}
+	p := &PolicyAuthorizer{policy: policy}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// Authorize allows the request if an allow rule matches and no deny rule does.
+func (p *PolicyAuthorizer) Authorize(ctx context.Context, principal keyservice.Principal, action keyservice.Action, target urn.URN) (bool, error) {
+	allowed := false
+	for _, rule := range p.policy.Rules {
+		ok, err := p.matches(ctx, rule, principal, action, target)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+		if rule.Effect == keyservice.EffectDeny {
+			return false, nil
+		}
+		allowed = true
+	}
+	return allowed, nil
+}
+
+func (p *PolicyAuthorizer) matches(ctx context.Context, rule keyservice.PolicyRule, principal keyservice.Principal, action keyservice.Action, target urn.URN) (bool, error) {
+	if len(rule.Actions) > 0 && !slices.Contains(rule.Actions, action) {
+		return false, nil
+	}
+	if len(rule.EntityTypes) > 0 && !slices.Contains(rule.EntityTypes, target.EntityType()) {
+		return false, nil
+	}
+	for name, want := range rule.Claims {
+		if !claimContains(principal.Claims[name], want) {
+			return false, nil
+		}
+	}
+	if principal.Subject == "" && rule.Subject != keyservice.SubjectAny {
+		return false, nil
+	}
+	switch rule.Subject {
+	case keyservice.SubjectEntityID:
+		return principal.Subject == target.EntityID(), nil
+	case keyservice.SubjectDeviceOwner:
+		return p.ownsDevice(ctx, principal, target)
+	}
+	return true, nil
+}
+
+// ownsDevice reports whether target is a device enrolled to an owner whose
+// entity ID is the principal's subject.
+func (p *PolicyAuthorizer) ownsDevice(ctx context.Context, principal keyservice.Principal, target urn.URN) (bool, error) {
+	if p.devices == nil || target.EntityType() != keyservice.DeviceEntityType {
+		return false, nil
+	}
+	owner, err := p.devices.OwnerOf(ctx, target)
+	if errors.Is(err, keyservice.ErrDeviceNotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve owner of device %s: %w", target.String(), err)
+	}
+	return owner.EntityID() == principal.Subject, nil
+}
+
+// claimContains reports whether a decoded JSON claim equals want or, for a
+// list claim, contains it.
+func claimContains(claim any, want string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == want
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	case []string:
+		return slices.Contains(v, want)
+	}
+	return false
+}
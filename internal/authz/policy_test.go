@@ -0,0 +1,108 @@
+package authz_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/authz"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	userURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	groupURN, err := urn.New(urn.SecureMessaging, "group", "team-1")
+	require.NoError(t, err)
+	alice := keyservice.Principal{Subject: "alice"}
+	mallory := keyservice.Principal{Subject: "mallory"}
+
+	t.Run("Default policy only allows storing your own key", func(t *testing.T) {
+		authorizer, err := authz.NewPolicyAuthorizer(keyservice.DefaultPolicy())
+		require.NoError(t, err)
+
+		allowed, err := authorizer.Authorize(ctx, alice, keyservice.ActionStoreKey, userURN)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		allowed, err = authorizer.Authorize(ctx, mallory, keyservice.ActionStoreKey, userURN)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("Claim rules match string and list claims", func(t *testing.T) {
+		policy := keyservice.Policy{Rules: []keyservice.PolicyRule{{
+			Effect:      keyservice.EffectAllow,
+			Actions:     []keyservice.Action{keyservice.ActionStoreKey},
+			EntityTypes: []string{"group"},
+			Claims:      map[string]string{"roles": "group-admin"},
+		}}}
+		authorizer, err := authz.NewPolicyAuthorizer(policy)
+		require.NoError(t, err)
+		admin := keyservice.Principal{Subject: "bob", Claims: map[string]any{"roles": []any{"member", "group-admin"}}}
+
+		allowed, err := authorizer.Authorize(ctx, admin, keyservice.ActionStoreKey, groupURN)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		allowed, err = authorizer.Authorize(ctx, admin, keyservice.ActionStoreKey, userURN)
+		require.NoError(t, err)
+		assert.False(t, allowed, "rule is limited to group entities")
+
+		allowed, err = authorizer.Authorize(ctx, alice, keyservice.ActionStoreKey, groupURN)
+		require.NoError(t, err)
+		assert.False(t, allowed, "caller lacks the claim")
+	})
+
+	t.Run("Deny rules override allow rules", func(t *testing.T) {
+		policy := keyservice.DefaultPolicy()
+		policy.Rules = append(policy.Rules, keyservice.PolicyRule{
+			Effect: keyservice.EffectDeny,
+			Claims: map[string]string{"suspended": "true"},
+		})
+		authorizer, err := authz.NewPolicyAuthorizer(policy)
+		require.NoError(t, err)
+		suspended := keyservice.Principal{Subject: "alice", Claims: map[string]any{"suspended": "true"}}
+
+		allowed, err := authorizer.Authorize(ctx, suspended, keyservice.ActionStoreKey, userURN)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("Device owners may store their devices' keys", func(t *testing.T) {
+		deviceURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+		require.NoError(t, err)
+		devices := inmemory.NewDeviceRegistry()
+		require.NoError(t, devices.EnrollDevice(ctx, userURN, deviceURN))
+		authorizer, err := authz.NewPolicyAuthorizer(keyservice.DefaultPolicy(), authz.WithDeviceRegistry(devices))
+		require.NoError(t, err)
+
+		allowed, err := authorizer.Authorize(ctx, alice, keyservice.ActionStoreKey, deviceURN)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		allowed, err = authorizer.Authorize(ctx, mallory, keyservice.ActionStoreKey, deviceURN)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+
+		require.NoError(t, devices.UnenrollDevice(ctx, userURN, deviceURN))
+		allowed, err = authorizer.Authorize(ctx, alice, keyservice.ActionStoreKey, deviceURN)
+		require.NoError(t, err)
+		assert.False(t, allowed, "ownership ends on unenrollment")
+	})
+
+	t.Run("Invalid policies are rejected", func(t *testing.T) {
+		_, err := authz.NewPolicyAuthorizer(keyservice.Policy{Rules: []keyservice.PolicyRule{{Effect: "maybe"}}})
+		assert.Error(t, err)
+
+		_, err = authz.NewPolicyAuthorizer(keyservice.Policy{Rules: []keyservice.PolicyRule{{Effect: keyservice.EffectAllow, Subject: "friend"}}})
+		assert.Error(t, err)
+
+		_, err = authz.NewPolicyAuthorizer(keyservice.Policy{Rules: []keyservice.PolicyRule{{Effect: keyservice.EffectAllow, Actions: []keyservice.Action{"keys:wirte"}}}})
+		assert.ErrorContains(t, err, "unknown action")
+	})
+}
@@ -0,0 +1,202 @@
+// Package federation lets the key services of partner domains resolve each
+// other's keys.
+//
+// Each domain publishes a Document at https://{domain}/.well-known/key-service
+// naming its key service and the Ed25519 keys it signs responses with. A
+// lookup, GET {keyService}/federation/keys/{entityURN}, is answered with a
+// Response signed over its exact body. The Response names the domain, the
+// entity and when it was issued, so it cannot be passed off as another
+// domain's, as another entity's or, after MaxResponseAge, as current.
+package federation
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+const (
+	// KeysPath is the path of a federated key lookup on a key service,
+	// followed by the entity URN.
+	KeysPath = "/federation/keys/"
+	// SignatureHeader carries the base64 Ed25519 signature over a Response
+	// body.
+	SignatureHeader = "X-Federation-Signature"
+	// KeyIDHeader names the Document signing key that made the signature.
+	KeyIDHeader = "X-Federation-Key-Id"
+	// MaxResponseAge bounds how long after it was issued a Response is
+	// accepted. It also bounds the clock skew tolerated between domains.
+	MaxResponseAge = 5 * time.Minute
+)
+
+// Response statuses.
+const (
+	StatusFound    = "found"
+	StatusNotFound = "notFound"
+	StatusRevoked  = "revoked"
+)
+
+var (
+	// ErrInvalidDocument is returned, wrapped, when a domain's discovery
+	// document is malformed or describes another domain.
+	ErrInvalidDocument = errors.New("invalid federation document")
+	// ErrInvalidResponse is returned, wrapped, when a lookup response is
+	// malformed, stale, not signed by the domain or not about the entity
+	// asked for.
+	ErrInvalidResponse = errors.New("invalid federation response")
+)
+
+// Document describes a domain's key service.
+type Document struct {
+	Domain string `json:"domain"`
+	// KeyService is the HTTPS base URL of the domain's key service.
+	KeyService string `json:"keyService"`
+	// SigningKeys verify the service's responses. Listing the next key
+	// ahead of using it lets a domain rotate keys without failed lookups.
+	SigningKeys []SigningKey `json:"signingKeys"`
+}
+
+// SigningKey is an Ed25519 public key that signs a domain's responses.
+type SigningKey struct {
+	// KeyID is the keyservice.Fingerprint of Key.
+	KeyID string `json:"keyId"`
+	Key   []byte `json:"key"`
+}
+
+// NewDocument describes the key service at keyServiceURL, serving domain and
+// signing with signingKeys.
+func NewDocument(domain, keyServiceURL string, signingKeys ...ed25519.PublicKey) Document {
+	doc := Document{Domain: domain, KeyService: keyServiceURL, SigningKeys: []SigningKey{}}
+	for _, key := range signingKeys {
+		doc.SigningKeys = append(doc.SigningKeys, SigningKey{KeyID: keyservice.Fingerprint(key), Key: key})
+	}
+	return doc
+}
+
+// verificationKeys checks that doc describes domain's key service and
+// returns its signing keys by ID.
+func (d Document) verificationKeys(domain string) (map[string]ed25519.PublicKey, error) {
+	if d.Domain != domain {
+		return nil, fmt.Errorf("%w: document of %s describes %q", ErrInvalidDocument, domain, d.Domain)
+	}
+	keyService, err := url.Parse(d.KeyService)
+	if err != nil || keyService.Scheme != "https" || keyService.Host == "" {
+		return nil, fmt.Errorf("%w: key service of %s is not an HTTPS URL", ErrInvalidDocument, domain)
+	}
+	keys := make(map[string]ed25519.PublicKey)
+	for _, key := range d.SigningKeys {
+		if len(key.Key) != ed25519.PublicKeySize || key.KeyID != keyservice.Fingerprint(key.Key) {
+			return nil, fmt.Errorf("%w: signing key %q of %s is malformed", ErrInvalidDocument, key.KeyID, domain)
+		}
+		keys[key.KeyID] = key.Key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s lists no signing keys", ErrInvalidDocument, domain)
+	}
+	return keys, nil
+}
+
+// Response is a key service's signed answer to a federated lookup.
+type Response struct {
+	Domain    string    `json:"domain"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	EntityURN string    `json:"entityUrn"`
+	// Status is StatusFound, StatusNotFound or StatusRevoked. Only found
+	// responses carry the key.
+	Status     string      `json:"status"`
+	Key        []byte      `json:"key,omitempty"`
+	UpdatedAt  time.Time   `json:"updatedAt,omitzero"`
+	Signatures []Signature `json:"signatures,omitempty"`
+}
+
+// Signature is the federated form of a keyservice.KeySignature.
+type Signature struct {
+	SignerURN   string `json:"signerUrn"`
+	SignerKeyID string `json:"signerKeyId"`
+	Signature   []byte `json:"signature"`
+}
+
+// NewResponse answers a lookup of entityURN in domain with rec: found if it
+// holds a servable key, revoked if it was revoked and not found otherwise,
+// including for the zero record.
+func NewResponse(domain string, entityURN urn.URN, rec keyservice.KeyRecord, issuedAt time.Time) Response {
+	resp := Response{Domain: domain, IssuedAt: issuedAt.UTC(), EntityURN: entityURN.String(), Status: StatusNotFound}
+	switch {
+	case rec.Revoked:
+		resp.Status = StatusRevoked
+	case len(rec.Key) > 0:
+		resp.Status, resp.Key, resp.UpdatedAt = StatusFound, rec.Key, rec.UpdatedAt
+		for _, sig := range rec.Signatures {
+			resp.Signatures = append(resp.Signatures, Signature{SignerURN: sig.SignerURN.String(), SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+		}
+	}
+	return resp
+}
+
+// Sign encodes resp and signs the encoding with signingKey. The body must be
+// sent unchanged, with the signature in SignatureHeader and the key's
+// keyservice.Fingerprint in KeyIDHeader.
+func Sign(resp Response, signingKey ed25519.PrivateKey) (body, signature []byte, err error) {
+	body, err = json.Marshal(resp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode federation response: %w", err)
+	}
+	return body, ed25519.Sign(signingKey, body), nil
+}
+
+// openResponse verifies a response body signed by the key keyID of keys and
+// checks that it is a current answer from domain about entityURN.
+func openResponse(body []byte, keyID string, signature []byte, keys map[string]ed25519.PublicKey, domain string, entityURN urn.URN, now time.Time) (Response, error) {
+	key, ok := keys[keyID]
+	if !ok {
+		return Response{}, fmt.Errorf("%w: signed with unknown key %q", ErrInvalidResponse, keyID)
+	}
+	if !ed25519.Verify(key, body, signature) {
+		return Response{}, fmt.Errorf("%w: bad signature", ErrInvalidResponse)
+	}
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return Response{}, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	switch {
+	case resp.Domain != domain:
+		return Response{}, fmt.Errorf("%w: issued by %q", ErrInvalidResponse, resp.Domain)
+	case resp.EntityURN != entityURN.String():
+		return Response{}, fmt.Errorf("%w: about %q", ErrInvalidResponse, resp.EntityURN)
+	case resp.IssuedAt.Before(now.Add(-MaxResponseAge)) || resp.IssuedAt.After(now.Add(MaxResponseAge)):
+		return Response{}, fmt.Errorf("%w: issued at %s", ErrInvalidResponse, resp.IssuedAt.Format(time.RFC3339))
+	}
+	return resp, nil
+}
+
+// record converts a found response to the entity's key record, or returns
+// the keyservice error matching any other status.
+func (r Response) record(entityURN urn.URN) (keyservice.KeyRecord, error) {
+	switch r.Status {
+	case StatusFound:
+	case StatusNotFound:
+		return keyservice.KeyRecord{}, keyservice.ErrKeyNotFound
+	case StatusRevoked:
+		return keyservice.KeyRecord{}, keyservice.ErrKeyRevoked
+	default:
+		return keyservice.KeyRecord{}, fmt.Errorf("%w: unknown status %q", ErrInvalidResponse, r.Status)
+	}
+	if len(r.Key) == 0 {
+		return keyservice.KeyRecord{}, fmt.Errorf("%w: found without a key", ErrInvalidResponse)
+	}
+	rec := keyservice.KeyRecord{EntityURN: entityURN, Key: r.Key, UpdatedAt: r.UpdatedAt}
+	for _, sig := range r.Signatures {
+		signerURN, err := urn.Parse(sig.SignerURN)
+		if err != nil {
+			return keyservice.KeyRecord{}, fmt.Errorf("%w: signature has an invalid signer URN: %v", ErrInvalidResponse, err)
+		}
+		rec.Signatures = append(rec.Signatures, keyservice.KeySignature{SignerURN: signerURN, SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+	}
+	return rec, nil
+}
@@ -0,0 +1,270 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// DefaultCacheTTL is how long a Resolver caches resolved keys and discovery
+// documents unless configured otherwise.
+const DefaultCacheTTL = 5 * time.Minute
+
+// MaxCachedKeys bounds the number of resolved keys a Resolver caches, so
+// lookups of many foreign entities cannot grow it without limit.
+const MaxCachedKeys = 10000
+
+// maxBodySize bounds the documents and responses read from peers.
+const maxBodySize = 1 << 20
+
+// cachedDocument is a domain's verified discovery document.
+type cachedDocument struct {
+	keyService string
+	keys       map[string]ed25519.PublicKey
+	expires    time.Time
+}
+
+// cachedKey is the outcome of a lookup: a record, or ErrKeyNotFound or
+// ErrKeyRevoked.
+type cachedKey struct {
+	rec     keyservice.KeyRecord
+	err     error
+	expires time.Time
+}
+
+// Resolver resolves the keys of entities in trusted partner domains from
+// their key services. It implements keyservice.KeyResolver.
+type Resolver struct {
+	client  *http.Client
+	domains map[string]keyservice.FederatedDomain
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	documents map[string]cachedDocument
+	keys      map[string]cachedKey
+}
+
+// Option customises a Resolver.
+type Option func(*Resolver)
+
+// WithHTTPClient makes requests to peers with client, for example one
+// presenting a client certificate to peers that require it.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Resolver) { r.client = client }
+}
+
+// WithCacheTTL caches resolved keys and discovery documents for ttl instead
+// of DefaultCacheTTL.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(r *Resolver) { r.ttl = ttl }
+}
+
+// WithClock replaces the clock used to expire cache entries and check the
+// age of responses.
+func WithClock(now func() time.Time) Option {
+	return func(r *Resolver) { r.now = now }
+}
+
+// NewResolver creates a Resolver trusting domains.
+func NewResolver(domains []keyservice.FederatedDomain, opts ...Option) (*Resolver, error) {
+	r := &Resolver{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		domains:   make(map[string]keyservice.FederatedDomain),
+		ttl:       DefaultCacheTTL,
+		now:       time.Now,
+		documents: make(map[string]cachedDocument),
+		keys:      make(map[string]cachedKey),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	for _, domain := range domains {
+		domain.Domain = strings.ToLower(domain.Domain)
+		if domain.Domain == "" || strings.ContainsAny(domain.Domain, "/@") {
+			return nil, fmt.Errorf("invalid federated domain %q", domain.Domain)
+		}
+		if _, ok := r.domains[domain.Domain]; ok {
+			return nil, fmt.Errorf("federated domain %s is listed twice", domain.Domain)
+		}
+		if domain.DiscoveryURL != "" {
+			discoveryURL, err := url.Parse(domain.DiscoveryURL)
+			if err != nil || discoveryURL.Scheme != "https" || discoveryURL.Host == "" {
+				return nil, fmt.Errorf("discovery URL of federated domain %s is not an HTTPS URL", domain.Domain)
+			}
+		}
+		r.domains[domain.Domain] = domain
+	}
+	return r, nil
+}
+
+// Resolves reports whether entityURN belongs to a trusted domain.
+func (r *Resolver) Resolves(entityURN urn.URN) bool {
+	domain, ok := keyservice.EntityDomain(entityURN)
+	if !ok {
+		return false
+	}
+	_, trusted := r.domains[domain]
+	return trusted
+}
+
+// ResolveKey fetches the entity's key from its domain's key service and
+// verifies the response against the domain's discovery document. Keys,
+// and the absence or revocation of one, are cached; failures are not.
+func (r *Resolver) ResolveKey(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	if !r.Resolves(entityURN) {
+		return keyservice.KeyRecord{}, fmt.Errorf("%s: %w", entityURN.String(), keyservice.ErrUntrustedDomain)
+	}
+	if cached, ok := r.cachedKey(entityURN); ok {
+		return cached.rec, cached.err
+	}
+
+	domain, _ := keyservice.EntityDomain(entityURN)
+	rec, err := r.fetchKey(ctx, domain, entityURN)
+	if err == nil || errors.Is(err, keyservice.ErrKeyNotFound) || errors.Is(err, keyservice.ErrKeyRevoked) {
+		r.cacheKey(entityURN, rec, err)
+	}
+	return rec, err
+}
+
+// fetchKey looks entityURN up at domain's key service.
+func (r *Resolver) fetchKey(ctx context.Context, domain string, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	doc, err := r.document(ctx, domain, false)
+	if err != nil {
+		return keyservice.KeyRecord{}, err
+	}
+	body, keyID, signature, err := r.lookup(ctx, doc.keyService, entityURN)
+	if err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("failed to look up %s at %s: %w", entityURN.String(), domain, err)
+	}
+	resp, err := openResponse(body, keyID, signature, doc.keys, domain, entityURN, r.now())
+	if _, known := doc.keys[keyID]; err != nil && !known {
+		// The domain may have rotated its signing key since its document
+		// was cached.
+		if doc, err = r.document(ctx, domain, true); err != nil {
+			return keyservice.KeyRecord{}, err
+		}
+		resp, err = openResponse(body, keyID, signature, doc.keys, domain, entityURN, r.now())
+	}
+	if err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("failed to look up %s at %s: %w", entityURN.String(), domain, err)
+	}
+	return resp.record(entityURN)
+}
+
+// lookup fetches the signed response of the key service at keyService to a
+// lookup of entityURN.
+func (r *Resolver) lookup(ctx context.Context, keyService string, entityURN urn.URN) (body []byte, keyID string, signature []byte, err error) {
+	lookupURL := strings.TrimSuffix(keyService, "/") + KeysPath + url.PathEscape(entityURN.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lookupURL, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Found, not found and revoked are all signed answers.
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound, http.StatusGone:
+	default:
+		return nil, "", nil, fmt.Errorf("key service answered %d", resp.StatusCode)
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	signature, err = base64.StdEncoding.DecodeString(resp.Header.Get(SignatureHeader))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("%w: malformed signature", ErrInvalidResponse)
+	}
+	return body, resp.Header.Get(KeyIDHeader), signature, nil
+}
+
+// document returns domain's verified discovery document, from the cache
+// unless refresh is set.
+func (r *Resolver) document(ctx context.Context, domain string, refresh bool) (cachedDocument, error) {
+	r.mu.Lock()
+	cached, ok := r.documents[domain]
+	r.mu.Unlock()
+	if ok && !refresh && r.now().Before(cached.expires) {
+		return cached, nil
+	}
+
+	discoveryURL := r.domains[domain].DiscoveryURL
+	if discoveryURL == "" {
+		discoveryURL = "https://" + domain + keyservice.FederationDiscoveryPath
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return cachedDocument{}, fmt.Errorf("failed to discover key service of %s: %w", domain, err)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return cachedDocument{}, fmt.Errorf("failed to discover key service of %s: %w", domain, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return cachedDocument{}, fmt.Errorf("failed to discover key service of %s: %s answered %d", domain, discoveryURL, resp.StatusCode)
+	}
+	var doc Document
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&doc); err != nil {
+		return cachedDocument{}, fmt.Errorf("%w: %s: %v", ErrInvalidDocument, discoveryURL, err)
+	}
+	keys, err := doc.verificationKeys(domain)
+	if err != nil {
+		return cachedDocument{}, err
+	}
+
+	cached = cachedDocument{keyService: doc.KeyService, keys: keys, expires: r.now().Add(r.ttl)}
+	r.mu.Lock()
+	r.documents[domain] = cached
+	r.mu.Unlock()
+	return cached, nil
+}
+
+// cachedKey returns the unexpired outcome of an earlier lookup of entityURN.
+func (r *Resolver) cachedKey(entityURN urn.URN) (cachedKey, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached, ok := r.keys[entityURN.String()]
+	if !ok || !r.now().Before(cached.expires) {
+		return cachedKey{}, false
+	}
+	return cached, true
+}
+
+// cacheKey records the outcome of a lookup of entityURN. Once the cache is
+// full, expired entries are dropped to make room; if none have expired the
+// outcome is not cached.
+func (r *Resolver) cacheKey(entityURN urn.URN, rec keyservice.KeyRecord, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if len(r.keys) >= MaxCachedKeys {
+		for k, cached := range r.keys {
+			if !now.Before(cached.expires) {
+				delete(r.keys, k)
+			}
+		}
+		if len(r.keys) >= MaxCachedKeys {
+			return
+		}
+	}
+	r.keys[entityURN.String()] = cachedKey{rec: rec, err: err, expires: now.Add(r.ttl)}
+}
@@ -0,0 +1,242 @@
+package federation_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/federation"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const partnerDomain = "partner.example"
+
+// partner is the key service of partnerDomain, served over TLS.
+type partner struct {
+	server  *httptest.Server
+	store   *inmemory.Store
+	handler atomic.Pointer[http.ServeMux]
+	lookups atomic.Int64
+}
+
+func newPartner(t *testing.T) *partner {
+	t.Helper()
+	p := &partner{store: inmemory.New()}
+	p.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.handler.Load().ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.server.Close)
+	partnerAPI := p.newAPI(t)
+	p.serve(partnerAPI, partnerAPI)
+	return p
+}
+
+// newAPI returns an API serving the partner's store with a new signing key.
+func (p *partner) newAPI(t *testing.T) *api.API {
+	t.Helper()
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &api.API{
+		Store:                p.store,
+		Logger:               zerolog.Nop(),
+		FederationSigningKey: signingKey,
+		FederationDomain:     partnerDomain,
+		FederationURL:        p.server.URL,
+	}
+}
+
+// serve answers discovery with documents and lookups with lookups.
+func (p *partner) serve(documents, lookups *api.API) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+keyservice.FederationDiscoveryPath, documents.FederationDocumentHandler)
+	mux.HandleFunc("GET /federation/keys/{entityURN}", func(w http.ResponseWriter, r *http.Request) {
+		p.lookups.Add(1)
+		lookups.FederatedKeyHandler(w, r)
+	})
+	p.handler.Store(mux)
+}
+
+// resolver returns a Resolver trusting the partner's domain.
+func (p *partner) resolver(t *testing.T, opts ...federation.Option) *federation.Resolver {
+	t.Helper()
+	opts = append([]federation.Option{federation.WithHTTPClient(p.server.Client())}, opts...)
+	resolver, err := federation.NewResolver([]keyservice.FederatedDomain{{
+		Domain:       partnerDomain,
+		DiscoveryURL: p.server.URL + keyservice.FederationDiscoveryPath,
+	}}, opts...)
+	require.NoError(t, err)
+	return resolver
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	carolURN, err := urn.New(urn.SecureMessaging, "user", "carol@"+partnerDomain)
+	require.NoError(t, err)
+	daveURN, err := urn.New(urn.SecureMessaging, "user", "dave@"+partnerDomain)
+	require.NoError(t, err)
+	localURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	strangerURN, err := urn.New(urn.SecureMessaging, "user", "eve@elsewhere.example")
+	require.NoError(t, err)
+
+	t.Run("Resolves only entities of trusted domains", func(t *testing.T) {
+		// Arrange
+		resolver := newPartner(t).resolver(t)
+
+		// Act & Assert
+		assert.True(t, resolver.Resolves(carolURN))
+		assert.False(t, resolver.Resolves(localURN))
+		assert.False(t, resolver.Resolves(strangerURN))
+		_, err := resolver.ResolveKey(ctx, strangerURN)
+		assert.ErrorIs(t, err, keyservice.ErrUntrustedDomain)
+	})
+
+	t.Run("Resolves a key and caches it", func(t *testing.T) {
+		// Arrange
+		p := newPartner(t)
+		require.NoError(t, p.store.StoreKey(ctx, carolURN, []byte("carol-key")))
+		now := time.Now()
+		resolver := p.resolver(t, federation.WithClock(func() time.Time { return now }), federation.WithCacheTTL(time.Minute))
+
+		// Act
+		first, err := resolver.ResolveKey(ctx, carolURN)
+		require.NoError(t, err)
+		require.NoError(t, p.store.StoreKey(ctx, carolURN, []byte("carol-new-key")))
+		cached, err := resolver.ResolveKey(ctx, carolURN)
+		require.NoError(t, err)
+		now = now.Add(2 * time.Minute)
+		refreshed, err := resolver.ResolveKey(ctx, carolURN)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, []byte("carol-key"), first.Key)
+		assert.Equal(t, carolURN.String(), first.EntityURN.String())
+		assert.Equal(t, []byte("carol-key"), cached.Key)
+		assert.Equal(t, []byte("carol-new-key"), refreshed.Key)
+		assert.Equal(t, int64(2), p.lookups.Load())
+	})
+
+	t.Run("Signed not found and revoked answers map to the store errors", func(t *testing.T) {
+		// Arrange
+		p := newPartner(t)
+		require.NoError(t, p.store.StoreKey(ctx, carolURN, []byte("carol-key")))
+		require.NoError(t, p.store.RevokeKey(ctx, carolURN))
+		resolver := p.resolver(t)
+
+		// Act
+		_, revokedErr := resolver.ResolveKey(ctx, carolURN)
+		_, missingErr := resolver.ResolveKey(ctx, daveURN)
+		_, cachedErr := resolver.ResolveKey(ctx, daveURN)
+
+		// Assert
+		assert.ErrorIs(t, revokedErr, keyservice.ErrKeyRevoked)
+		assert.ErrorIs(t, missingErr, keyservice.ErrKeyNotFound)
+		assert.ErrorIs(t, cachedErr, keyservice.ErrKeyNotFound)
+		assert.Equal(t, int64(2), p.lookups.Load(), "not found answers are cached")
+	})
+
+	t.Run("Follows a signing key rotation", func(t *testing.T) {
+		// Arrange
+		p := newPartner(t)
+		require.NoError(t, p.store.StoreKey(ctx, carolURN, []byte("carol-key")))
+		require.NoError(t, p.store.StoreKey(ctx, daveURN, []byte("dave-key")))
+		resolver := p.resolver(t)
+		_, err := resolver.ResolveKey(ctx, carolURN)
+		require.NoError(t, err)
+		rotated := p.newAPI(t)
+		p.serve(rotated, rotated)
+
+		// Act
+		rec, err := resolver.ResolveKey(ctx, daveURN)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []byte("dave-key"), rec.Key)
+	})
+
+	t.Run("Rejects answers not signed by a key of the domain's document", func(t *testing.T) {
+		// Arrange
+		p := newPartner(t)
+		require.NoError(t, p.store.StoreKey(ctx, carolURN, []byte("carol-key")))
+		p.serve(p.newAPI(t), p.newAPI(t))
+
+		// Act
+		_, err := p.resolver(t).ResolveKey(ctx, carolURN)
+
+		// Assert
+		assert.ErrorIs(t, err, federation.ErrInvalidResponse)
+	})
+
+	t.Run("Rejects stale answers", func(t *testing.T) {
+		// Arrange
+		p := newPartner(t)
+		require.NoError(t, p.store.StoreKey(ctx, carolURN, []byte("carol-key")))
+		later := func() time.Time { return time.Now().Add(federation.MaxResponseAge + time.Minute) }
+
+		// Act
+		_, err := p.resolver(t, federation.WithClock(later)).ResolveKey(ctx, carolURN)
+
+		// Assert
+		assert.ErrorIs(t, err, federation.ErrInvalidResponse)
+	})
+
+	t.Run("Rejects a document describing another domain", func(t *testing.T) {
+		// Arrange
+		p := newPartner(t)
+		impostor := p.newAPI(t)
+		impostor.FederationDomain = "elsewhere.example"
+		p.serve(impostor, impostor)
+
+		// Act
+		_, err := p.resolver(t).ResolveKey(ctx, carolURN)
+
+		// Assert
+		assert.ErrorIs(t, err, federation.ErrInvalidDocument)
+		assert.Zero(t, p.lookups.Load())
+	})
+
+	t.Run("Failures are not cached", func(t *testing.T) {
+		// Arrange
+		p := newPartner(t)
+		require.NoError(t, p.store.StoreKey(ctx, carolURN, []byte("carol-key")))
+		resolver := p.resolver(t)
+		healthy := p.handler.Load()
+		unavailable := http.NewServeMux()
+		unavailable.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		p.handler.Store(unavailable)
+		_, err := resolver.ResolveKey(ctx, carolURN)
+		require.Error(t, err)
+		p.handler.Store(healthy)
+
+		// Act
+		rec, err := resolver.ResolveKey(ctx, carolURN)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []byte("carol-key"), rec.Key)
+	})
+}
+
+func TestNewResolver(t *testing.T) {
+	_, err := federation.NewResolver([]keyservice.FederatedDomain{{Domain: "a.example"}, {Domain: "A.example"}})
+	assert.Error(t, err, "duplicate domains are rejected")
+
+	_, err = federation.NewResolver([]keyservice.FederatedDomain{{Domain: "a.example", DiscoveryURL: "http://a.example/.well-known/key-service"}})
+	assert.Error(t, err, "discovery must use HTTPS")
+
+	_, err = federation.NewResolver([]keyservice.FederatedDomain{{Domain: ""}})
+	assert.Error(t, err)
+}
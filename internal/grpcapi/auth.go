@@ -0,0 +1,137 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticator authenticates gRPC calls with the HTTP middleware chains of
+// the equivalent routes, so bearer tokens in the "authorization" metadata
+// and TLS client certificates are checked, and lookups rate limited, exactly
+// as they are over HTTP. A rate limiter's Retry-After is sent as the
+// "retry-after" header metadata.
+type Authenticator struct {
+	// Routes maps full method names to the middleware chain authenticating
+	// them. Methods without a chain are public.
+	Routes map[string]func(http.Handler) http.Handler
+}
+
+// UnaryInterceptor authenticates unary calls.
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor authenticates streaming calls.
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate runs a request carrying the call's credentials through the
+// method's middleware chain and returns the context the chain handed on,
+// which identifies the caller.
+func (a *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	chain, ok := a.Routes[method]
+	if !ok || chain == nil {
+		return ctx, nil
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		r.Header.Add("Authorization", v)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if p.Addr != nil {
+			r.RemoteAddr = p.Addr.String()
+		}
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := info.State
+			r.TLS = &state
+		}
+	}
+
+	var authenticated context.Context
+	rec := &statusRecorder{header: make(http.Header)}
+	chain(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		authenticated = r.Context()
+	})).ServeHTTP(rec, r)
+	if authenticated != nil {
+		return authenticated, nil
+	}
+	if retryAfter := rec.header.Get("Retry-After"); retryAfter != "" {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+	}
+	return nil, rec.err()
+}
+
+// authenticatedStream is a ServerStream carrying the authenticated context.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// statusRecorder captures the response written by a middleware that
+// rejected a call.
+type statusRecorder struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func (r *statusRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	r.body = append(r.body, b...)
+	return len(b), nil
+}
+
+// err converts the recorded rejection to a gRPC status.
+func (r *statusRecorder) err() error {
+	var body response.APIError
+	message := http.StatusText(r.status)
+	if json.Unmarshal(r.body, &body) == nil && body.Error != "" {
+		message = body.Error
+	}
+	code := codeFor(r.status)
+	if code == codes.Internal {
+		return status.Error(codes.Internal, "Internal server error")
+	}
+	return status.Error(code, message)
+}
@@ -0,0 +1,170 @@
+package grpcapi_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/grpcapi"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream is a ServerStream that only carries a context.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthenticator(t *testing.T) {
+	const method = "/keyservice.v1.KeyService/StoreKey"
+	forbidden := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response.WriteJSONError(w, http.StatusForbidden, "Insufficient scope")
+		})
+	}
+	limited := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "1")
+			response.WriteJSONError(w, http.StatusTooManyRequests, "Too many requests")
+		})
+	}
+	missing := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response.WriteJSONError(w, http.StatusNotFound, "Key not found")
+		})
+	}
+	broken := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response.WriteJSONError(w, http.StatusBadGateway, "JWKS unavailable")
+		})
+	}
+
+	// unary runs the unary interceptor for method with ctx and returns the
+	// subject the handler saw.
+	unary := func(authenticator *grpcapi.Authenticator, ctx context.Context) (string, error) {
+		var subject string
+		_, err := authenticator.UnaryInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ any) (any, error) {
+			subject, _ = api.GetUserIDFromContext(ctx)
+			return nil, nil
+		})
+		return subject, err
+	}
+
+	t.Run("Bearer token in metadata authenticates unary calls", func(t *testing.T) {
+		// Arrange
+		authenticator := &grpcapi.Authenticator{Routes: map[string]func(http.Handler) http.Handler{method: fakeAuth}}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer alice"))
+
+		// Act
+		subject, err := unary(authenticator, ctx)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "alice", subject)
+	})
+
+	t.Run("Rejections map to gRPC codes", func(t *testing.T) {
+		testCases := []struct {
+			name    string
+			chain   func(http.Handler) http.Handler
+			code    codes.Code
+			message string
+		}{
+			{name: "missing token", chain: fakeAuth, code: codes.Unauthenticated, message: "Invalid token"},
+			{name: "forbidden", chain: forbidden, code: codes.PermissionDenied, message: "Insufficient scope"},
+			{name: "rate limited", chain: limited, code: codes.ResourceExhausted, message: "Too many requests"},
+			{name: "not found", chain: missing, code: codes.NotFound, message: "Key not found"},
+			{name: "other failure", chain: broken, code: codes.Internal, message: "Internal server error"},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Arrange
+				authenticator := &grpcapi.Authenticator{Routes: map[string]func(http.Handler) http.Handler{method: tc.chain}}
+
+				// Act
+				_, err := unary(authenticator, context.Background())
+
+				// Assert
+				assert.Equal(t, tc.code, status.Code(err))
+				assert.Equal(t, tc.message, status.Convert(err).Message())
+			})
+		}
+	})
+
+	t.Run("Methods without a chain are public", func(t *testing.T) {
+		// Arrange
+		authenticator := &grpcapi.Authenticator{}
+
+		// Act
+		subject, err := unary(authenticator, context.Background())
+
+		// Assert
+		require.NoError(t, err)
+		assert.Empty(t, subject)
+	})
+
+	t.Run("Peer address and TLS state reach the chain", func(t *testing.T) {
+		// Arrange
+		var remoteAddr string
+		var peerTLS *tls.ConnectionState
+		capture := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				remoteAddr, peerTLS = r.RemoteAddr, r.TLS
+				next.ServeHTTP(w, r)
+			})
+		}
+		authenticator := &grpcapi.Authenticator{Routes: map[string]func(http.Handler) http.Handler{method: capture}}
+		state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr:     &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242},
+			AuthInfo: credentials.TLSInfo{State: state},
+		})
+
+		// Act
+		_, err := unary(authenticator, ctx)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "203.0.113.7:4242", remoteAddr)
+		require.NotNil(t, peerTLS)
+		assert.Len(t, peerTLS.VerifiedChains, 1)
+	})
+
+	t.Run("Streams see the authenticated context", func(t *testing.T) {
+		// Arrange
+		const streamMethod = "/keyservice.v1.KeyService/WatchKeys"
+		authenticator := &grpcapi.Authenticator{Routes: map[string]func(http.Handler) http.Handler{streamMethod: fakeAuth}}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer bob"))
+
+		// Act
+		var subject string
+		err := authenticator.StreamInterceptor()(nil, &fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: streamMethod, IsServerStream: true}, func(_ any, ss grpc.ServerStream) error {
+			subject, _ = api.GetUserIDFromContext(ss.Context())
+			return nil
+		})
+		errAnonymous := authenticator.StreamInterceptor()(nil, &fakeStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: streamMethod}, func(any, grpc.ServerStream) error {
+			return nil
+		})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "bob", subject)
+		assert.Equal(t, codes.Unauthenticated, status.Code(errAnonymous))
+	})
+}
@@ -0,0 +1,342 @@
+// Package grpcapi serves the keyservice.v1.KeyService gRPC API. It is a thin
+// transport over internal/api, so gRPC calls share the store, authorization
+// policy, read mode, proof checks and audit log of the HTTP routes.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-key-service/pkg/keyservicepb"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements keyservicepb.KeyServiceServer on top of an api.API.
+// Callers are authenticated by the Authenticator interceptors before a
+// method runs.
+type Server struct {
+	keyservicepb.UnimplementedKeyServiceServer
+
+	API *api.API
+	// Invalidator announces key changes to WatchKeys. Without one,
+	// WatchKeys is unavailable.
+	Invalidator keyservice.Invalidator
+	Logger      zerolog.Logger
+}
+
+// GetKey returns an entity's key with its signatures and signature chain.
+func (s *Server) GetKey(ctx context.Context, req *keyservicepb.GetKeyRequest) (*keyservicepb.GetKeyResponse, error) {
+	entityURN, err := parseURN(req.GetEntityUrn())
+	if err != nil {
+		return nil, err
+	}
+	rec, err := s.API.ReadKey(ctx, entityURN)
+	if err != nil {
+		if isNotFound(err) {
+			chargeMiss(ctx)
+		}
+		return nil, grpcError(err)
+	}
+
+	resp := &keyservicepb.GetKeyResponse{Key: newKey(rec)}
+	for _, signer := range s.API.SignatureChain(ctx, rec) {
+		resp.Chain = append(resp.Chain, newKey(signer))
+	}
+	return resp, nil
+}
+
+// StoreKey creates or replaces an entity's key.
+func (s *Server) StoreKey(ctx context.Context, req *keyservicepb.StoreKeyRequest) (*keyservicepb.StoreKeyResponse, error) {
+	entityURN, err := parseURN(req.GetEntityUrn())
+	if err != nil {
+		return nil, err
+	}
+	upload := api.KeyUpload{
+		EntityURN:         entityURN,
+		Key:               req.GetKey(),
+		Challenge:         req.GetChallenge(),
+		ProofSignature:    req.GetProofSignature(),
+		SigningKeyURN:     req.GetSigningKeyUrn(),
+		IdentitySignature: req.GetIdentitySignature(),
+	}
+	if err := s.API.StoreKey(ctx, origin(ctx), upload); err != nil {
+		return nil, grpcError(err)
+	}
+	return &keyservicepb.StoreKeyResponse{}, nil
+}
+
+// BatchGetKeys returns the keys of up to keyservice.MaxBatchGetKeys
+// entities. Entities without a servable key are listed by URN instead of
+// failing the call.
+func (s *Server) BatchGetKeys(ctx context.Context, req *keyservicepb.BatchGetKeysRequest) (*keyservicepb.BatchGetKeysResponse, error) {
+	entityURNs, err := parseBatch(req.GetEntityUrns())
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := s.API.ReadKeys(ctx, entityURNs)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &keyservicepb.BatchGetKeysResponse{}
+	for _, rec := range batch.Keys {
+		resp.Keys = append(resp.Keys, newKey(rec))
+	}
+	for _, entityURN := range batch.NotFound {
+		resp.NotFoundUrns = append(resp.NotFoundUrns, entityURN.String())
+	}
+	for _, entityURN := range batch.Revoked {
+		resp.RevokedUrns = append(resp.RevokedUrns, entityURN.String())
+	}
+	return resp, nil
+}
+
+// WatchKeys sends the current state of each requested entity's key, then an
+// event whenever one changes, until the client goes away. Changes arriving
+// faster than they can be sent are coalesced, so a slow client sees the
+// latest state rather than every intermediate one.
+func (s *Server) WatchKeys(req *keyservicepb.WatchKeysRequest, stream keyservicepb.KeyService_WatchKeysServer) error {
+	if s.Invalidator == nil {
+		return status.Error(codes.Unavailable, "Key change notifications are not configured")
+	}
+	entityURNs, err := parseBatch(req.GetEntityUrns())
+	if err != nil {
+		return err
+	}
+	// The initial state is a lookup of every entity; later changes are
+	// pushed by the service and not charged.
+	if budget, ok := api.LookupBudgetFromContext(stream.Context()); ok {
+		for range entityURNs[1:] {
+			if !budget.Spend(stream.Context()) {
+				return status.Error(codes.ResourceExhausted, "Too many requests")
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	watched := make(map[string]bool, len(entityURNs))
+	for _, entityURN := range entityURNs {
+		watched[entityURN.String()] = true
+	}
+
+	// Subscribe before reading the initial state so no change falls in
+	// between. Every entity starts out pending.
+	var mu sync.Mutex
+	pending := make(map[string]bool, len(watched))
+	for key := range watched {
+		pending[key] = true
+	}
+	changed := make(chan struct{}, 1)
+	changed <- struct{}{}
+	err = s.Invalidator.Subscribe(ctx, func(entityURN urn.URN) {
+		if !watched[entityURN.String()] {
+			return
+		}
+		mu.Lock()
+		pending[entityURN.String()] = true
+		mu.Unlock()
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		s.Logger.Error().Err(err).Msg("Failed to subscribe to key changes")
+		return status.Error(codes.Unavailable, "Key change notifications are unavailable")
+	}
+
+	last := make(map[string]*keyservicepb.KeyEvent, len(watched))
+	initial := true
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+
+		mu.Lock()
+		due := pending
+		pending = make(map[string]bool)
+		mu.Unlock()
+
+		for _, entityURN := range entityURNs {
+			key := entityURN.String()
+			if !due[key] {
+				continue
+			}
+			event, err := s.keyEvent(ctx, entityURN)
+			if err != nil {
+				return err
+			}
+			if initial && event.GetType() == keyservicepb.KeyEvent_NOT_FOUND {
+				chargeMiss(ctx)
+			}
+			if proto.Equal(last[key], event) {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+			last[key] = event
+		}
+		initial = false
+	}
+}
+
+// keyEvent describes the current state of entityURN's key as the caller in
+// ctx may see it. Only failures that apply to the whole call are returned as
+// errors.
+func (s *Server) keyEvent(ctx context.Context, entityURN urn.URN) (*keyservicepb.KeyEvent, error) {
+	event := &keyservicepb.KeyEvent{EntityUrn: entityURN.String()}
+	rec, err := s.API.ReadKey(ctx, entityURN)
+	var apiErr *api.Error
+	switch {
+	case err == nil:
+		event.Type = keyservicepb.KeyEvent_STORED
+		event.Key = newKey(rec)
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusGone:
+		event.Type = keyservicepb.KeyEvent_REVOKED
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+		event.Type = keyservicepb.KeyEvent_NOT_FOUND
+	default:
+		return nil, grpcError(err)
+	}
+	return event, nil
+}
+
+// newKey converts a stored record to its protobuf form.
+func newKey(rec keyservice.KeyRecord) *keyservicepb.Key {
+	key := &keyservicepb.Key{
+		EntityUrn: rec.EntityURN.String(),
+		Key:       rec.Key,
+		KeyId:     keyservice.Fingerprint(rec.Key),
+	}
+	if !rec.UpdatedAt.IsZero() {
+		key.UpdatedAt = timestamppb.New(rec.UpdatedAt)
+	}
+	for _, sig := range rec.Signatures {
+		key.Signatures = append(key.Signatures, &keyservicepb.KeySignature{
+			SignerUrn:   sig.SignerURN.String(),
+			SignerKeyId: sig.SignerKeyID,
+			Signature:   sig.Signature,
+		})
+	}
+	return key
+}
+
+// parseURN parses an entity URN from a request.
+func parseURN(raw string) (urn.URN, error) {
+	entityURN, err := urn.Parse(raw)
+	if err != nil {
+		return urn.URN{}, status.Error(codes.InvalidArgument, "Invalid URN format")
+	}
+	return entityURN, nil
+}
+
+// parseBatch parses the entity URNs of a batch request, dropping duplicates.
+func parseBatch(raw []string) ([]urn.URN, error) {
+	if len(raw) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No entity URNs requested")
+	}
+	if len(raw) > keyservice.MaxBatchGetKeys {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("At most %d entity URNs may be requested at once", keyservice.MaxBatchGetKeys))
+	}
+	seen := make(map[string]bool, len(raw))
+	entityURNs := make([]urn.URN, 0, len(raw))
+	for _, r := range raw {
+		entityURN, err := parseURN(r)
+		if err != nil {
+			return nil, err
+		}
+		if seen[entityURN.String()] {
+			continue
+		}
+		seen[entityURN.String()] = true
+		entityURNs = append(entityURNs, entityURN)
+	}
+	return entityURNs, nil
+}
+
+// grpcError converts an error from internal/api to a gRPC status, hiding
+// the details of internal failures.
+func grpcError(err error) error {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		return status.Error(codes.Internal, "Internal server error")
+	}
+	return status.Error(codeFor(apiErr.Status), apiErr.Message)
+}
+
+// isNotFound reports whether err is the API's 404 Not Found.
+func isNotFound(err error) bool {
+	var apiErr *api.Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// chargeMiss charges a lookup of an entity that was not found to the rate
+// limit budget the read chain placed in ctx, as the HTTP limiter does for a
+// 404 response.
+func chargeMiss(ctx context.Context) {
+	if budget, ok := api.LookupBudgetFromContext(ctx); ok {
+		budget.Miss(ctx)
+	}
+}
+
+// codeFor maps an HTTP status to the equivalent gRPC code.
+func codeFor(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusLocked:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// origin describes the caller for the audit log: the peer address plus the
+// x-forwarded-for and x-request-id metadata, if present.
+func origin(ctx context.Context) api.Origin {
+	var o api.Origin
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		o.ClientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(o.ClientIP); err == nil {
+			o.ClientIP = host
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-forwarded-for"); len(values) > 0 {
+		o.ForwardedFor = values[0]
+	}
+	if values := md.Get("x-request-id"); len(values) > 0 && values[0] != "" {
+		o.RequestID = values[0]
+	} else {
+		o.RequestID = api.NewRequestID()
+	}
+	return o
+}
@@ -0,0 +1,298 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/grpcapi"
+	"github.com/illmade-knight/go-key-service/internal/ratelimit"
+	"github.com/illmade-knight/go-key-service/internal/storage/cache"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-key-service/pkg/keyservicepb"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeAuth stands in for the JWKS middleware: "Bearer <subject>"
+// authenticates as subject and anything else is rejected with 401.
+func fakeAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subject == "" {
+			response.WriteJSONError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(api.ContextWithUserID(r.Context(), subject)))
+	})
+}
+
+// newTestClient serves srv over an in-memory connection, authenticating the
+// methods in routes, and returns a client for it.
+func newTestClient(t *testing.T, srv *grpcapi.Server, routes map[string]func(http.Handler) http.Handler) keyservicepb.KeyServiceClient {
+	t.Helper()
+	authenticator := &grpcapi.Authenticator{Routes: routes}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authenticator.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(authenticator.StreamInterceptor()),
+	)
+	keyservicepb.RegisterKeyServiceServer(server, srv)
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return keyservicepb.NewKeyServiceClient(conn)
+}
+
+// withToken attaches a fake bearer token for subject to ctx.
+func withToken(ctx context.Context, subject string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+subject)
+}
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	carolURN, err := urn.New(urn.SecureMessaging, "user", "carol")
+	require.NoError(t, err)
+
+	// newServer returns a server whose store announces changes to the
+	// returned invalidator, as the cache does in production.
+	newServer := func(t *testing.T) (*grpcapi.Server, keyservice.Store, keyservicepb.KeyServiceClient) {
+		invalidator := inmemory.NewInvalidator()
+		store, err := cache.New(ctx, inmemory.New(), invalidator, time.Minute)
+		require.NoError(t, err)
+		srv := &grpcapi.Server{
+			API:         &api.API{Store: store, Logger: zerolog.Nop()},
+			Invalidator: invalidator,
+			Logger:      zerolog.Nop(),
+		}
+		client := newTestClient(t, srv, map[string]func(http.Handler) http.Handler{
+			keyservicepb.KeyService_StoreKey_FullMethodName: fakeAuth,
+		})
+		return srv, store, client
+	}
+
+	t.Run("StoreKey and GetKey round trip", func(t *testing.T) {
+		// Arrange
+		_, _, client := newServer(t)
+
+		// Act
+		_, err := client.StoreKey(withToken(ctx, "alice"), &keyservicepb.StoreKeyRequest{EntityUrn: aliceURN.String(), Key: []byte("alice-key")})
+		require.NoError(t, err)
+		resp, err := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: aliceURN.String()})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, aliceURN.String(), resp.GetKey().GetEntityUrn())
+		assert.Equal(t, []byte("alice-key"), resp.GetKey().GetKey())
+		assert.Equal(t, keyservice.Fingerprint([]byte("alice-key")), resp.GetKey().GetKeyId())
+		assert.NotNil(t, resp.GetKey().GetUpdatedAt())
+	})
+
+	t.Run("StoreKey applies the authorization policy", func(t *testing.T) {
+		// Arrange
+		_, _, client := newServer(t)
+
+		// Act
+		_, errForbidden := client.StoreKey(withToken(ctx, "bob"), &keyservicepb.StoreKeyRequest{EntityUrn: aliceURN.String(), Key: []byte("k")})
+		_, errAnonymous := client.StoreKey(ctx, &keyservicepb.StoreKeyRequest{EntityUrn: aliceURN.String(), Key: []byte("k")})
+		_, errBadURN := client.StoreKey(withToken(ctx, "alice"), &keyservicepb.StoreKeyRequest{EntityUrn: "not-a-urn", Key: []byte("k")})
+
+		// Assert
+		assert.Equal(t, codes.PermissionDenied, status.Code(errForbidden))
+		assert.Equal(t, codes.Unauthenticated, status.Code(errAnonymous))
+		assert.Equal(t, codes.InvalidArgument, status.Code(errBadURN))
+	})
+
+	t.Run("StoreKey is refused for locked entities", func(t *testing.T) {
+		// Arrange
+		_, store, client := newServer(t)
+		require.NoError(t, store.SetLocked(ctx, aliceURN, true))
+
+		// Act
+		_, err := client.StoreKey(withToken(ctx, "alice"), &keyservicepb.StoreKeyRequest{EntityUrn: aliceURN.String(), Key: []byte("k")})
+
+		// Assert
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("GetKey reports missing and revoked keys as not found", func(t *testing.T) {
+		// Arrange
+		_, store, client := newServer(t)
+		require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+		require.NoError(t, store.RevokeKey(ctx, bobURN))
+
+		// Act
+		_, errMissing := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: aliceURN.String()})
+		_, errRevoked := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: bobURN.String()})
+
+		// Assert
+		assert.Equal(t, codes.NotFound, status.Code(errMissing))
+		assert.Equal(t, codes.NotFound, status.Code(errRevoked))
+		assert.Equal(t, "Key revoked", status.Convert(errRevoked).Message())
+	})
+
+	t.Run("Reads are charged to the lookup rate limits", func(t *testing.T) {
+		// Arrange: a miss budget of one lookup
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		limiter := ratelimit.New(inmemory.NewRateLimitStore(), keyservice.LookupRateLimit{
+			Hits:   keyservice.RateLimit{Rate: 0.001, Burst: 10},
+			Misses: keyservice.RateLimit{Rate: 0.001, Burst: 1},
+		}, zerolog.Nop())
+		srv := &grpcapi.Server{API: &api.API{Store: store, Logger: zerolog.Nop()}, Logger: zerolog.Nop()}
+		client := newTestClient(t, srv, map[string]func(http.Handler) http.Handler{
+			keyservicepb.KeyService_GetKey_FullMethodName:       limiter.Middleware,
+			keyservicepb.KeyService_BatchGetKeys_FullMethodName: limiter.Middleware,
+		})
+
+		// Act
+		_, errMissing := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: carolURN.String()})
+		_, errLimited := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: aliceURN.String()})
+		_, errBatch := client.BatchGetKeys(ctx, &keyservicepb.BatchGetKeysRequest{EntityUrns: []string{aliceURN.String()}})
+
+		// Assert
+		assert.Equal(t, codes.NotFound, status.Code(errMissing))
+		assert.Equal(t, codes.ResourceExhausted, status.Code(errLimited), "the miss spent the miss budget")
+		assert.Equal(t, codes.ResourceExhausted, status.Code(errBatch))
+	})
+
+	t.Run("BatchGetKeys sorts entities by state", func(t *testing.T) {
+		// Arrange
+		_, store, client := newServer(t)
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+		require.NoError(t, store.RevokeKey(ctx, bobURN))
+
+		// Act
+		resp, err := client.BatchGetKeys(ctx, &keyservicepb.BatchGetKeysRequest{
+			EntityUrns: []string{aliceURN.String(), bobURN.String(), carolURN.String(), aliceURN.String()},
+		})
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, resp.GetKeys(), 1)
+		assert.Equal(t, []byte("alice-key"), resp.GetKeys()[0].GetKey())
+		assert.Equal(t, []string{bobURN.String()}, resp.GetRevokedUrns())
+		assert.Equal(t, []string{carolURN.String()}, resp.GetNotFoundUrns())
+	})
+
+	t.Run("BatchGetKeys limits the batch size", func(t *testing.T) {
+		// Arrange
+		_, _, client := newServer(t)
+		entityURNs := make([]string, keyservice.MaxBatchGetKeys+1)
+		for i := range entityURNs {
+			entityURNs[i] = aliceURN.String()
+		}
+
+		// Act
+		_, errTooMany := client.BatchGetKeys(ctx, &keyservicepb.BatchGetKeysRequest{EntityUrns: entityURNs})
+		_, errEmpty := client.BatchGetKeys(ctx, &keyservicepb.BatchGetKeysRequest{})
+
+		// Assert
+		assert.Equal(t, codes.InvalidArgument, status.Code(errTooMany))
+		assert.Equal(t, codes.InvalidArgument, status.Code(errEmpty))
+	})
+
+	t.Run("WatchKeys streams the initial state and subsequent changes", func(t *testing.T) {
+		// Arrange
+		_, store, client := newServer(t)
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		defer stopWatching()
+
+		stream, err := client.WatchKeys(watchCtx, &keyservicepb.WatchKeysRequest{EntityUrns: []string{aliceURN.String(), bobURN.String()}})
+		require.NoError(t, err)
+		initial := map[string]keyservicepb.KeyEvent_Type{}
+		for range 2 {
+			event, err := stream.Recv()
+			require.NoError(t, err)
+			initial[event.GetEntityUrn()] = event.GetType()
+		}
+
+		// Act
+		require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+		stored, err := stream.Recv()
+		require.NoError(t, err)
+		require.NoError(t, store.RevokeKey(ctx, aliceURN))
+		revoked, err := stream.Recv()
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, map[string]keyservicepb.KeyEvent_Type{
+			aliceURN.String(): keyservicepb.KeyEvent_STORED,
+			bobURN.String():   keyservicepb.KeyEvent_NOT_FOUND,
+		}, initial)
+		assert.Equal(t, keyservicepb.KeyEvent_STORED, stored.GetType())
+		assert.Equal(t, bobURN.String(), stored.GetEntityUrn())
+		assert.Equal(t, []byte("bob-key"), stored.GetKey().GetKey())
+		assert.Equal(t, keyservicepb.KeyEvent_REVOKED, revoked.GetType())
+		assert.Equal(t, aliceURN.String(), revoked.GetEntityUrn())
+	})
+
+	t.Run("WatchKeys is unavailable without an invalidator", func(t *testing.T) {
+		// Arrange
+		srv, _, _ := newServer(t)
+		srv.Invalidator = nil
+		client := newTestClient(t, srv, nil)
+
+		// Act
+		stream, err := client.WatchKeys(ctx, &keyservicepb.WatchKeysRequest{EntityUrns: []string{aliceURN.String()}})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+
+		// Assert
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+
+	t.Run("Reads follow the read mode", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+		srv := &grpcapi.Server{
+			API:    &api.API{Store: store, Logger: zerolog.Nop(), ReadMode: keyservice.ReadModeContacts},
+			Logger: zerolog.Nop(),
+		}
+		client := newTestClient(t, srv, map[string]func(http.Handler) http.Handler{
+			keyservicepb.KeyService_GetKey_FullMethodName: fakeAuth,
+		})
+
+		// Act
+		_, errAnonymous := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: aliceURN.String()})
+		own, errOwn := client.GetKey(withToken(ctx, "alice"), &keyservicepb.GetKeyRequest{EntityUrn: aliceURN.String()})
+		_, errStranger := client.GetKey(withToken(ctx, "alice"), &keyservicepb.GetKeyRequest{EntityUrn: bobURN.String()})
+
+		// Assert
+		assert.Equal(t, codes.Unauthenticated, status.Code(errAnonymous))
+		require.NoError(t, errOwn)
+		assert.Equal(t, []byte("alice-key"), own.GetKey().GetKey())
+		assert.Equal(t, codes.NotFound, status.Code(errStranger))
+	})
+}
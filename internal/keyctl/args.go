@@ -0,0 +1,25 @@
+package keyctl
+
+import "flag"
+
+// ParseArgs parses args with flags, allowing flags to follow positional
+// arguments as in "keyctl get URN -o pem", and returns the positional
+// arguments in order. The flag package on its own stops at the first
+// positional argument. Arguments after a "--" are all positional.
+func ParseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
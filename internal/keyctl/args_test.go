@@ -0,0 +1,64 @@
+package keyctl_test
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/keyctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseArgs tests that the invocations documented in keyctl's usage
+// parse with flags after the URN.
+func TestParseArgs(t *testing.T) {
+	const testURN = "urn:sm:user:user-123"
+	testCases := []struct {
+		invocation     string
+		wantPositional []string
+		wantFlags      map[string]string
+	}{
+		{"put " + testURN + " -in key.pem", []string{testURN}, map[string]string{"in": "key.pem"}},
+		{"get " + testURN + " -o pem", []string{testURN}, map[string]string{"o": "pem"}},
+		{"get -o jwk " + testURN, []string{testURN}, map[string]string{"o": "jwk"}},
+		{"revoke " + testURN, []string{testURN}, nil},
+		{"list -entity-type user -updated-since 2026-01-01T00:00:00Z -o json", nil, map[string]string{"entity-type": "user", "updated-since": "2026-01-01T00:00:00Z", "o": "json"}},
+		{"fingerprint -in key.pem", nil, map[string]string{"in": "key.pem"}},
+		{"verify " + testURN + " -in key.pem", []string{testURN}, map[string]string{"in": "key.pem"}},
+		{"verify " + testURN + " -fingerprint abc123", []string{testURN}, map[string]string{"fingerprint": "abc123"}},
+		{"get -- -not-a-flag", []string{"-not-a-flag"}, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.invocation, func(t *testing.T) {
+			// Arrange
+			args := strings.Fields(tc.invocation)
+			flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			values := map[string]*string{}
+			for _, name := range []string{"o", "in", "fingerprint", "entity-type", "updated-since"} {
+				values[name] = flags.String(name, "", "")
+			}
+
+			// Act
+			positional, err := keyctl.ParseArgs(flags, args[1:])
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPositional, positional)
+			for name, want := range tc.wantFlags {
+				assert.Equal(t, want, *values[name], name)
+			}
+		})
+	}
+
+	t.Run("Unknown flag after the URN is an error", func(t *testing.T) {
+		flags := flag.NewFlagSet("get", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+
+		_, err := keyctl.ParseArgs(flags, []string{testURN, "-bogus"})
+
+		assert.Error(t, err)
+	})
+}
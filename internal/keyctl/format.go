@@ -0,0 +1,232 @@
+package keyctl
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"text/tabwriter"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+// Format is an output format.
+type Format string
+
+const (
+	// FormatRaw writes the key bytes as stored.
+	FormatRaw Format = "raw"
+	// FormatPEM writes a PKIX key as a PEM PUBLIC KEY block.
+	FormatPEM Format = "pem"
+	// FormatJWK writes a PKIX key as a JSON Web Key (RFC 7517).
+	FormatJWK Format = "jwk"
+	// FormatJSON writes records as JSON, as the admin API returns them.
+	FormatJSON Format = "json"
+	// FormatTable writes records as an aligned table.
+	FormatTable Format = "table"
+)
+
+// ErrNotPKIX is returned, wrapped, when a key must be converted but is not a
+// PKIX public key.
+var ErrNotPKIX = errors.New("key is not a PKIX public key")
+
+// ParseFormat parses an output format, accepting only those listed.
+func ParseFormat(s string, accepted ...Format) (Format, error) {
+	for _, format := range accepted {
+		if Format(s) == format {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q: must be one of %v", s, accepted)
+}
+
+// record is the JSON representation of a key record.
+type record struct {
+	EntityURN  string      `json:"entityUrn"`
+	Key        []byte      `json:"key"`
+	KeyID      string      `json:"keyId,omitempty"`
+	UpdatedAt  time.Time   `json:"updatedAt,omitzero"`
+	Revoked    bool        `json:"revoked,omitempty"`
+	RevokedAt  time.Time   `json:"revokedAt,omitzero"`
+	Locked     bool        `json:"locked,omitempty"`
+	Signatures []signature `json:"signatures,omitempty"`
+}
+
+type signature struct {
+	SignerURN   string `json:"signerUrn"`
+	SignerKeyID string `json:"signerKeyId"`
+	Signature   []byte `json:"signature"`
+}
+
+func newRecord(rec keyservice.KeyRecord) record {
+	r := record{
+		EntityURN: rec.EntityURN.String(),
+		Key:       rec.Key,
+		KeyID:     keyservice.Fingerprint(rec.Key),
+		UpdatedAt: rec.UpdatedAt,
+		Revoked:   rec.Revoked,
+		RevokedAt: rec.RevokedAt,
+		Locked:    rec.Locked,
+	}
+	for _, sig := range rec.Signatures {
+		r.Signatures = append(r.Signatures, signature{SignerURN: sig.SignerURN.String(), SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+	}
+	return r
+}
+
+// WriteKey writes one key record to w in format: raw, pem, jwk or json.
+func WriteKey(w io.Writer, rec keyservice.KeyRecord, format Format) error {
+	switch format {
+	case FormatRaw:
+		_, err := w.Write(rec.Key)
+		return err
+	case FormatPEM:
+		if block, _ := pem.Decode(rec.Key); block != nil {
+			_, err := w.Write(pem.EncodeToMemory(block))
+			return err
+		}
+		if _, err := x509.ParsePKIXPublicKey(rec.Key); err != nil {
+			return fmt.Errorf("cannot write %s as PEM: %w", rec.EntityURN.String(), ErrNotPKIX)
+		}
+		return pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: rec.Key})
+	case FormatJWK:
+		jwk, err := NewJWK(rec.Key)
+		if err != nil {
+			return fmt.Errorf("cannot write %s as a JWK: %w", rec.EntityURN.String(), err)
+		}
+		return writeJSON(w, jwk)
+	case FormatJSON:
+		return writeJSON(w, newRecord(rec))
+	default:
+		return fmt.Errorf("unsupported key format %q", format)
+	}
+}
+
+// WriteRecords writes records to w in format: table or json.
+func WriteRecords(w io.Writer, records []keyservice.KeyRecord, format Format) error {
+	switch format {
+	case FormatJSON:
+		out := make([]record, 0, len(records))
+		for _, rec := range records {
+			out = append(out, newRecord(rec))
+		}
+		return writeJSON(w, out)
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ENTITY URN\tKEY ID\tUPDATED\tSTATE")
+		for _, rec := range records {
+			keyID := keyservice.Fingerprint(rec.Key)
+			if len(keyID) > 16 {
+				keyID = keyID[:16]
+			}
+			updated := "-"
+			if !rec.UpdatedAt.IsZero() {
+				updated = rec.UpdatedAt.UTC().Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rec.EntityURN.String(), keyID, updated, state(rec))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported list format %q", format)
+	}
+}
+
+// state summarises whether a record's key is served.
+func state(rec keyservice.KeyRecord) string {
+	switch {
+	case rec.Revoked && rec.Locked:
+		return "revoked,locked"
+	case rec.Revoked:
+		return "revoked"
+	case rec.Locked:
+		return "locked"
+	default:
+		return "active"
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// JWK is a public JSON Web Key. Kid is the key's keyservice.Fingerprint.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// NewJWK converts a PKIX public key, PEM or DER encoded, to a JWK. Ed25519,
+// X25519, ECDSA P-256, P-384 and P-521, and RSA keys are supported.
+func NewJWK(key []byte) (JWK, error) {
+	der := key
+	if block, _ := pem.Decode(key); block != nil {
+		der = block.Bytes
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return JWK{}, ErrNotPKIX
+	}
+	jwk, err := publicJWK(pub)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk.Kid = keyservice.Fingerprint(key)
+	return jwk, nil
+}
+
+func publicJWK(pub crypto.PublicKey) (JWK, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: b64(key)}, nil
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return JWK{}, fmt.Errorf("unsupported ECDH curve")
+		}
+		return JWK{Kty: "OKP", Crv: "X25519", X: b64(key.Bytes())}, nil
+	case *ecdsa.PublicKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return JWK{}, fmt.Errorf("unsupported ECDSA key: %w", err)
+		}
+		// An uncompressed point is 0x04 || X || Y.
+		point := ecdhKey.Bytes()
+		size := (len(point) - 1) / 2
+		return JWK{Kty: "EC", Crv: curveName(key.Curve), X: b64(point[1 : 1+size]), Y: b64(point[1+size:])}, nil
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+func curveName(curve elliptic.Curve) string {
+	switch curve {
+	case elliptic.P256():
+		return "P-256"
+	case elliptic.P384():
+		return "P-384"
+	case elliptic.P521():
+		return "P-521"
+	default:
+		return curve.Params().Name
+	}
+}
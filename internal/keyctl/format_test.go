@@ -0,0 +1,183 @@
+package keyctl_test
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/keyctl"
+	ks "github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func marshalPKIX(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return der
+}
+
+func TestNewJWK(t *testing.T) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	xPriv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecPoint, err := ecPriv.PublicKey.ECDH()
+	require.NoError(t, err)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		key  []byte
+		want keyctl.JWK
+	}{
+		{"Ed25519", marshalPKIX(t, edPub), keyctl.JWK{Kty: "OKP", Crv: "Ed25519", X: b64(edPub)}},
+		{"X25519", marshalPKIX(t, xPriv.PublicKey()), keyctl.JWK{Kty: "OKP", Crv: "X25519", X: b64(xPriv.PublicKey().Bytes())}},
+		{"ECDSA P-256", marshalPKIX(t, &ecPriv.PublicKey), keyctl.JWK{Kty: "EC", Crv: "P-256", X: b64(ecPoint.Bytes()[1:33]), Y: b64(ecPoint.Bytes()[33:])}},
+		{"RSA", marshalPKIX(t, &rsaPriv.PublicKey), keyctl.JWK{Kty: "RSA", N: b64(rsaPriv.N.Bytes()), E: "AQAB"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			tc.want.Kid = ks.Fingerprint(tc.key)
+
+			// Act
+			jwk, err := keyctl.NewJWK(tc.key)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, jwk)
+		})
+	}
+
+	t.Run("opaque keys are rejected", func(t *testing.T) {
+		// Act
+		_, err := keyctl.NewJWK([]byte("opaque-key"))
+
+		// Assert
+		assert.ErrorIs(t, err, keyctl.ErrNotPKIX)
+	})
+}
+
+func TestWriteKey(t *testing.T) {
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der := marshalPKIX(t, pub)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	t.Run("raw writes the key as stored", func(t *testing.T) {
+		// Arrange
+		var out bytes.Buffer
+
+		// Act
+		err := keyctl.WriteKey(&out, ks.KeyRecord{EntityURN: aliceURN, Key: der}, keyctl.FormatRaw)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, der, out.Bytes())
+	})
+
+	t.Run("pem encodes DER keys and passes PEM keys through", func(t *testing.T) {
+		// Arrange
+		var fromDER, fromPEM bytes.Buffer
+
+		// Act
+		errDER := keyctl.WriteKey(&fromDER, ks.KeyRecord{EntityURN: aliceURN, Key: der}, keyctl.FormatPEM)
+		errPEM := keyctl.WriteKey(&fromPEM, ks.KeyRecord{EntityURN: aliceURN, Key: pemKey}, keyctl.FormatPEM)
+		errOpaque := keyctl.WriteKey(&bytes.Buffer{}, ks.KeyRecord{EntityURN: aliceURN, Key: []byte("opaque")}, keyctl.FormatPEM)
+
+		// Assert
+		require.NoError(t, errDER)
+		require.NoError(t, errPEM)
+		assert.Equal(t, pemKey, fromDER.Bytes())
+		assert.Equal(t, pemKey, fromPEM.Bytes())
+		assert.ErrorIs(t, errOpaque, keyctl.ErrNotPKIX)
+	})
+
+	t.Run("json includes the key ID and state", func(t *testing.T) {
+		// Arrange
+		var out bytes.Buffer
+		rec := ks.KeyRecord{EntityURN: aliceURN, Key: der, Revoked: true, RevokedAt: time.Unix(100, 0).UTC()}
+
+		// Act
+		err := keyctl.WriteKey(&out, rec, keyctl.FormatJSON)
+
+		// Assert
+		require.NoError(t, err)
+		var got map[string]any
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		assert.Equal(t, aliceURN.String(), got["entityUrn"])
+		assert.Equal(t, ks.Fingerprint(der), got["keyId"])
+		assert.Equal(t, true, got["revoked"])
+		assert.NotContains(t, got, "locked")
+	})
+}
+
+func TestWriteRecords(t *testing.T) {
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	records := []ks.KeyRecord{
+		{EntityURN: aliceURN, Key: []byte("alice-key"), UpdatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{EntityURN: bobURN, Key: []byte("bob-key"), Revoked: true},
+	}
+
+	t.Run("table has a row per record", func(t *testing.T) {
+		// Arrange
+		var out bytes.Buffer
+
+		// Act
+		err := keyctl.WriteRecords(&out, records, keyctl.FormatTable)
+
+		// Assert
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 3)
+		assert.Equal(t, []string{"ENTITY", "URN", "KEY", "ID", "UPDATED", "STATE"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{aliceURN.String(), ks.Fingerprint([]byte("alice-key"))[:16], "2026-01-02T03:04:05Z", "active"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{bobURN.String(), ks.Fingerprint([]byte("bob-key"))[:16], "-", "revoked"}, strings.Fields(lines[2]))
+	})
+
+	t.Run("json is an array of records", func(t *testing.T) {
+		// Arrange
+		var out bytes.Buffer
+
+		// Act
+		err := keyctl.WriteRecords(&out, records, keyctl.FormatJSON)
+
+		// Assert
+		require.NoError(t, err)
+		var got []map[string]any
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Len(t, got, 2)
+		assert.Equal(t, bobURN.String(), got[1]["entityUrn"])
+	})
+
+	t.Run("key formats are rejected", func(t *testing.T) {
+		// Act
+		err := keyctl.WriteRecords(&bytes.Buffer{}, records, keyctl.FormatPEM)
+
+		// Assert
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,156 @@
+// Package keyctl implements the keyctl operator command: storing, reading,
+// revoking, listing and verifying keys through the service's HTTP API or,
+// for break-glass access, directly on a keyservice.Store.
+package keyctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/client"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Backend is the key directory keyctl operates on.
+type Backend interface {
+	// StoreKey creates or replaces the entity's key.
+	StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error
+	// GetKey returns the entity's servable key with its signatures,
+	// failing with errors matching keyservice.ErrKeyNotFound and
+	// keyservice.ErrKeyRevoked if there is none.
+	GetKey(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error)
+	// RevokeKey stops the entity's key from being served.
+	RevokeKey(ctx context.Context, entityURN urn.URN) error
+	// ListKeys returns one page of stored records, including revoked keys.
+	ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error)
+}
+
+// APIBackend operates through the service's HTTP API, subject to its
+// authorization policy and audit log. Revoking and listing keys need an
+// administrator's token.
+type APIBackend struct {
+	Client *client.Client
+}
+
+// StoreKey uploads the entity's key.
+func (b APIBackend) StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error {
+	return b.Client.StoreKey(ctx, entityURN, key)
+}
+
+// GetKey fetches the entity's key with its signatures.
+func (b APIBackend) GetKey(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	return b.Client.GetKeyRecord(ctx, entityURN)
+}
+
+// RevokeKey revokes the entity's key through the admin API.
+func (b APIBackend) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	return b.Client.RevokeKey(ctx, entityURN)
+}
+
+// ListKeys lists stored records through the admin API.
+func (b APIBackend) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	return b.Client.ListKeys(ctx, filter, pageToken)
+}
+
+// StoreBackend operates directly on a store, bypassing the service and its
+// authorization policy. Mutations are appended to Audit, if set, as made by
+// Actor, so break-glass changes still show up in the audit log.
+type StoreBackend struct {
+	Store keyservice.Store
+	Audit keyservice.AuditSink
+	Actor string
+}
+
+// StoreKey writes the entity's key.
+func (b StoreBackend) StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error {
+	event := keyservice.AuditEvent{
+		Action:         string(keyservice.ActionStoreKey),
+		EntityURN:      entityURN.String(),
+		OldFingerprint: b.currentFingerprint(ctx, entityURN),
+		NewFingerprint: keyservice.Fingerprint(key),
+	}
+	return b.audit(ctx, event, b.Store.StoreKey(ctx, entityURN, key))
+}
+
+// GetKey reads the entity's record, refusing revoked and empty ones as the
+// service would.
+func (b StoreBackend) GetKey(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	rec, err := b.Store.GetRecord(ctx, entityURN)
+	if err != nil {
+		return keyservice.KeyRecord{}, err
+	}
+	if rec.Revoked {
+		return keyservice.KeyRecord{}, keyservice.ErrKeyRevoked
+	}
+	if len(rec.Key) == 0 {
+		return keyservice.KeyRecord{}, keyservice.ErrKeyNotFound
+	}
+	return rec, nil
+}
+
+// RevokeKey revokes the entity's key in the store.
+func (b StoreBackend) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	event := keyservice.AuditEvent{
+		Action:         "admin:revoke",
+		EntityURN:      entityURN.String(),
+		OldFingerprint: b.currentFingerprint(ctx, entityURN),
+	}
+	return b.audit(ctx, event, b.Store.RevokeKey(ctx, entityURN))
+}
+
+// ListKeys lists the store's records.
+func (b StoreBackend) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	return b.Store.ListKeys(ctx, filter, pageToken)
+}
+
+// currentFingerprint returns the fingerprint of the entity's stored key,
+// including a revoked key, if it is audited.
+func (b StoreBackend) currentFingerprint(ctx context.Context, entityURN urn.URN) string {
+	if b.Audit == nil {
+		return ""
+	}
+	rec, err := b.Store.GetRecord(ctx, entityURN)
+	if err != nil {
+		return ""
+	}
+	return keyservice.Fingerprint(rec.Key)
+}
+
+// audit appends event with the outcome err, returning err joined with any
+// failure to append.
+func (b StoreBackend) audit(ctx context.Context, event keyservice.AuditEvent, err error) error {
+	if b.Audit == nil {
+		return err
+	}
+	event.Time = time.Now()
+	event.Actor = b.Actor
+	event.Outcome = keyservice.AuditSuccess
+	if err != nil {
+		event.Outcome = keyservice.AuditFailure
+		event.Error = err.Error()
+	}
+	if _, appendErr := b.Audit.Append(ctx, event); appendErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to append to the audit log: %w", appendErr))
+	}
+	return err
+}
+
+// ListAll returns every record matching filter, following page tokens.
+func ListAll(ctx context.Context, backend Backend, filter keyservice.ListFilter) ([]keyservice.KeyRecord, error) {
+	var records []keyservice.KeyRecord
+	pageToken := ""
+	for {
+		page, err := backend.ListKeys(ctx, filter, pageToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list keys: %w", err)
+		}
+		records = append(records, page.Records...)
+		if page.NextPageToken == "" {
+			return records, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
@@ -0,0 +1,143 @@
+package keyctl_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/keyctl"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/keyservice"
+	"github.com/illmade-knight/go-key-service/pkg/client"
+	ks "github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/middleware"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuth stands in for the JWKS middleware: the bearer token is taken as
+// the caller's subject.
+func fakeAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subject == "" {
+			response.WriteJSONError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(api.ContextWithUserID(r.Context(), subject)))
+	})
+}
+
+// newBackends returns an API backend authenticated as subject to a service
+// on store, where "admin" is an administrator, and a store backend on the
+// same store.
+func newBackends(t *testing.T, store ks.Store, subject string) map[string]keyctl.Backend {
+	t.Helper()
+	cfg := &ks.Config{
+		HTTPListenAddr: ":0",
+		CorsConfig:     middleware.CorsConfig{AllowedOrigins: []string{"*"}, Role: middleware.CorsRoleDefault},
+		AdminSubjects:  []string{"admin"},
+	}
+	server := httptest.NewServer(keyservice.New(cfg, store, fakeAuth, zerolog.Nop()).Mux())
+	t.Cleanup(server.Close)
+	c, err := client.New(server.URL, client.WithTokenSource(client.StaticToken(subject)))
+	require.NoError(t, err)
+	return map[string]keyctl.Backend{
+		"api":   keyctl.APIBackend{Client: c},
+		"store": keyctl.StoreBackend{Store: store},
+	}
+}
+
+func TestBackends(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	carolURN, err := urn.New(urn.SecureMessaging, "user", "carol")
+	require.NoError(t, err)
+	deviceURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+	require.NoError(t, err)
+
+	for _, name := range []string{"api", "store"} {
+		t.Run(name+" gets, revokes and lists keys", func(t *testing.T) {
+			// Arrange
+			store := inmemory.New()
+			require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+			require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+			require.NoError(t, store.StoreKey(ctx, deviceURN, []byte("device-key")))
+			backend := newBackends(t, store, "admin")[name]
+
+			// Act
+			rec, errGet := backend.GetKey(ctx, aliceURN)
+			errRevoke := backend.RevokeKey(ctx, bobURN)
+			_, errRevoked := backend.GetKey(ctx, bobURN)
+			_, errMissing := backend.GetKey(ctx, carolURN)
+			users, errList := keyctl.ListAll(ctx, backend, ks.ListFilter{EntityType: "user", PageSize: 1})
+
+			// Assert
+			require.NoError(t, errGet)
+			assert.Equal(t, []byte("alice-key"), rec.Key)
+			assert.Equal(t, aliceURN.String(), rec.EntityURN.String())
+			assert.NoError(t, errRevoke)
+			assert.ErrorIs(t, errRevoked, ks.ErrKeyRevoked)
+			assert.ErrorIs(t, errMissing, ks.ErrKeyNotFound)
+			require.NoError(t, errList)
+			require.Len(t, users, 2)
+			states := map[string]bool{}
+			for _, user := range users {
+				states[user.EntityURN.String()] = user.Revoked
+			}
+			assert.Equal(t, map[string]bool{aliceURN.String(): false, bobURN.String(): true}, states)
+		})
+	}
+
+	t.Run("api backend stores keys as the token's subject", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		alice := newBackends(t, store, "alice")["api"]
+
+		// Act
+		errOwn := alice.StoreKey(ctx, aliceURN, []byte("alice-key"))
+		errOther := alice.StoreKey(ctx, bobURN, []byte("bob-key"))
+
+		// Assert
+		assert.NoError(t, errOwn)
+		assert.ErrorIs(t, errOther, client.ErrForbidden)
+		key, err := store.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-key"), key)
+	})
+
+	t.Run("store backend audits its mutations", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		sink := inmemory.NewAuditSink()
+		backend := keyctl.StoreBackend{Store: store, Audit: sink, Actor: "keyctl:ops"}
+
+		// Act
+		require.NoError(t, backend.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		require.NoError(t, backend.RevokeKey(ctx, aliceURN))
+		errRevoke := backend.RevokeKey(ctx, bobURN)
+
+		// Assert
+		assert.ErrorIs(t, errRevoke, ks.ErrKeyNotFound)
+		events, err := sink.List(ctx, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		assert.Equal(t, string(ks.ActionStoreKey), events[0].Action)
+		assert.Equal(t, ks.Fingerprint([]byte("alice-key")), events[0].NewFingerprint)
+		assert.Equal(t, "admin:revoke", events[1].Action)
+		assert.Equal(t, ks.Fingerprint([]byte("alice-key")), events[1].OldFingerprint)
+		assert.Equal(t, ks.AuditFailure, events[2].Outcome)
+		for _, event := range events {
+			assert.Equal(t, "keyctl:ops", event.Actor)
+		}
+	})
+}
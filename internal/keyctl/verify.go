@@ -0,0 +1,88 @@
+package keyctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/illmade-knight/go-key-service/internal/proof"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// ErrVerificationFailed is returned, wrapped, by Verify when any check fails.
+var ErrVerificationFailed = errors.New("verification failed")
+
+// Check is the outcome of one verification check.
+type Check struct {
+	Name string
+	// Err is nil if the check passed.
+	Err error
+}
+
+// Expectation is what the entity's key is checked against. At most one of
+// Key and Fingerprint is set; with neither, only signatures are checked.
+type Expectation struct {
+	// Key is the exact key the entity should have.
+	Key []byte
+	// Fingerprint is the keyservice.Fingerprint the entity's key should have.
+	Fingerprint string
+}
+
+// Verify fetches the entity's key and checks it against want, then checks
+// each signature on it: the signer's current key must be the one that made
+// the signature and the signature must verify. Every check is returned;
+// the error wraps ErrVerificationFailed if any failed.
+func Verify(ctx context.Context, backend Backend, entityURN urn.URN, want Expectation) ([]Check, error) {
+	rec, err := backend.GetKey(ctx, entityURN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key for %s: %w", entityURN.String(), err)
+	}
+
+	var checks []Check
+	fingerprint := keyservice.Fingerprint(rec.Key)
+	switch {
+	case want.Key != nil:
+		var err error
+		if string(want.Key) != string(rec.Key) {
+			err = fmt.Errorf("stored key %s differs from the expected key %s", fingerprint, keyservice.Fingerprint(want.Key))
+		}
+		checks = append(checks, Check{Name: "key", Err: err})
+	case want.Fingerprint != "":
+		var err error
+		if want.Fingerprint != fingerprint {
+			err = fmt.Errorf("stored key %s differs from the expected fingerprint %s", fingerprint, want.Fingerprint)
+		}
+		checks = append(checks, Check{Name: "fingerprint", Err: err})
+	}
+
+	message := keyservice.SignedKeyMessage(entityURN, rec.Key)
+	for _, sig := range rec.Signatures {
+		checks = append(checks, Check{
+			Name: "signature by " + sig.SignerURN.String(),
+			Err:  verifySignature(ctx, backend, sig, message),
+		})
+	}
+
+	for _, check := range checks {
+		if check.Err != nil {
+			return checks, fmt.Errorf("%s: %w", entityURN.String(), ErrVerificationFailed)
+		}
+	}
+	return checks, nil
+}
+
+func verifySignature(ctx context.Context, backend Backend, sig keyservice.KeySignature, message []byte) error {
+	signer, err := backend.GetKey(ctx, sig.SignerURN)
+	if err != nil {
+		return fmt.Errorf("failed to get signer's key: %w", err)
+	}
+	if signerKeyID := keyservice.Fingerprint(signer.Key); signerKeyID != sig.SignerKeyID {
+		return fmt.Errorf("signed with key %s but the signer's key is now %s", sig.SignerKeyID, signerKeyID)
+	}
+	pub, ok := proof.ParseSigningKey(signer.Key)
+	if !ok {
+		return errors.New("signer's key cannot sign")
+	}
+	return proof.Verify(pub, message, sig.Signature)
+}
@@ -0,0 +1,109 @@
+package keyctl_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/keyctl"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	ks "github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	deviceURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+	require.NoError(t, err)
+	identityPub, identityPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	identityKey, err := x509.MarshalPKIXPublicKey(identityPub)
+	require.NoError(t, err)
+	deviceKey := []byte("device-key")
+
+	// newStore returns a store with alice's identity key and a device key
+	// signed by it.
+	newStore := func(t *testing.T, signature []byte) *inmemory.Store {
+		t.Helper()
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, identityKey))
+		require.NoError(t, store.StoreSignedKey(ctx, deviceURN, deviceKey, []ks.KeySignature{{
+			SignerURN:   aliceURN,
+			SignerKeyID: ks.Fingerprint(identityKey),
+			Signature:   signature,
+		}}))
+		return store
+	}
+	goodSignature := ed25519.Sign(identityPriv, ks.SignedKeyMessage(deviceURN, deviceKey))
+
+	for _, backendName := range []string{"api", "store"} {
+		t.Run(backendName+" passes a matching key with valid signatures", func(t *testing.T) {
+			// Arrange
+			backend := newBackends(t, newStore(t, goodSignature), "")[backendName]
+
+			// Act
+			checks, err := keyctl.Verify(ctx, backend, deviceURN, keyctl.Expectation{Key: deviceKey})
+
+			// Assert
+			require.NoError(t, err)
+			require.Len(t, checks, 2)
+			assert.Equal(t, "key", checks[0].Name)
+			assert.Equal(t, "signature by "+aliceURN.String(), checks[1].Name)
+			for _, check := range checks {
+				assert.NoError(t, check.Err)
+			}
+		})
+	}
+
+	t.Run("a different fingerprint fails", func(t *testing.T) {
+		// Arrange
+		backend := keyctl.StoreBackend{Store: newStore(t, goodSignature)}
+
+		// Act
+		checks, err := keyctl.Verify(ctx, backend, deviceURN, keyctl.Expectation{Fingerprint: ks.Fingerprint([]byte("other"))})
+
+		// Assert
+		assert.ErrorIs(t, err, keyctl.ErrVerificationFailed)
+		require.Len(t, checks, 2)
+		assert.Error(t, checks[0].Err)
+		assert.NoError(t, checks[1].Err)
+	})
+
+	t.Run("a forged signature fails", func(t *testing.T) {
+		// Arrange
+		forged := ed25519.Sign(identityPriv, ks.SignedKeyMessage(deviceURN, []byte("other-key")))
+		backend := keyctl.StoreBackend{Store: newStore(t, forged)}
+
+		// Act
+		checks, err := keyctl.Verify(ctx, backend, deviceURN, keyctl.Expectation{})
+
+		// Assert
+		assert.ErrorIs(t, err, keyctl.ErrVerificationFailed)
+		require.Len(t, checks, 1)
+		assert.Error(t, checks[0].Err)
+	})
+
+	t.Run("a signature by a since-replaced signer key fails", func(t *testing.T) {
+		// Arrange
+		store := newStore(t, goodSignature)
+		newPub, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		newIdentityKey, err := x509.MarshalPKIXPublicKey(newPub)
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(ctx, aliceURN, newIdentityKey))
+
+		// Act
+		checks, err := keyctl.Verify(ctx, keyctl.StoreBackend{Store: store}, deviceURN, keyctl.Expectation{})
+
+		// Assert
+		assert.ErrorIs(t, err, keyctl.ErrVerificationFailed)
+		require.Len(t, checks, 1)
+		assert.ErrorContains(t, checks[0].Err, "signer's key is now")
+	})
+}
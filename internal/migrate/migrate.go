@@ -0,0 +1,309 @@
+// Package migrate copies every key record, with its revocation and lock
+// state, from one keyservice.Store to another, with checkpointing so that an
+// interrupted run can be resumed, and verifies the result by comparing
+// record counts and content hashes.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/rs/zerolog"
+)
+
+// DefaultPageSize is used when Options.PageSize is not set.
+const DefaultPageSize = 500
+
+// ErrCheckpointMismatch is returned when the checkpoint was written by a
+// migration between different stores.
+var ErrCheckpointMismatch = errors.New("checkpoint belongs to another migration")
+
+// Options controls how a migration runs.
+type Options struct {
+	// PageSize is the number of records read from the source per page.
+	PageSize int
+	// DryRun reads and compares every record but writes nothing, not even
+	// the checkpoint.
+	DryRun bool
+	// RecordsPerSecond throttles writes to the destination. Zero disables
+	// throttling.
+	RecordsPerSecond float64
+	// CheckpointPath is where progress is saved after every page. An existing
+	// checkpoint is resumed from. Empty disables checkpointing.
+	CheckpointPath string
+	// SourceName and DestinationName identify the stores in the checkpoint.
+	// A checkpoint written for a different pair of stores is refused rather
+	// than resumed.
+	SourceName      string
+	DestinationName string
+}
+
+// Checkpoint records how far a migration has progressed.
+type Checkpoint struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	PageToken   string    `json:"pageToken"`
+	Report      Report    `json:"report"`
+	Completed   bool      `json:"completed"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Report summarises a migration run.
+type Report struct {
+	Read      int `json:"read"`
+	Copied    int `json:"copied"`
+	Unchanged int `json:"unchanged"`
+}
+
+// VerifyReport summarises a verification pass.
+type VerifyReport struct {
+	SourceCount       int
+	DestinationCount  int // -1 if the destination cannot be enumerated.
+	Missing           []string
+	Mismatched        []string
+	SourceDigest      string
+	DestinationDigest string
+}
+
+// OK reports whether the destination matches the source.
+func (v VerifyReport) OK() bool {
+	return len(v.Missing) == 0 && len(v.Mismatched) == 0 &&
+		v.DestinationCount == v.SourceCount &&
+		v.SourceDigest == v.DestinationDigest
+}
+
+// Migrator copies records from Source to Destination.
+type Migrator struct {
+	Source      keyservice.Store
+	Destination keyservice.Store
+	Options     Options
+	Logger      zerolog.Logger
+}
+
+// Run copies every record not already present with identical content in the
+// destination, resuming from the checkpoint if one exists.
+func (m *Migrator) Run(ctx context.Context) (Report, error) {
+	checkpoint, err := m.loadCheckpoint()
+	if err != nil {
+		return Report{}, err
+	}
+	if checkpoint.Completed {
+		m.Logger.Info().Msg("Checkpoint reports a completed migration; nothing to do")
+		return checkpoint.Report, nil
+	}
+	if checkpoint.PageToken != "" {
+		m.Logger.Info().Str("page_token", checkpoint.PageToken).Int("read", checkpoint.Report.Read).Msg("Resuming migration from checkpoint")
+	}
+
+	var throttle <-chan time.Time
+	if m.Options.RecordsPerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / m.Options.RecordsPerSecond))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	report := checkpoint.Report
+	pageToken := checkpoint.PageToken
+	for {
+		page, err := m.Source.ListKeys(ctx, m.filter(), pageToken)
+		if err != nil {
+			return report, fmt.Errorf("failed to read source page: %w", err)
+		}
+
+		for _, rec := range page.Records {
+			report.Read++
+			existing, err := m.Destination.GetRecord(ctx, rec.EntityURN)
+			if err == nil && sameRecord(existing, rec) {
+				report.Unchanged++
+				continue
+			}
+			if m.Options.DryRun {
+				report.Copied++
+				continue
+			}
+			if throttle != nil {
+				select {
+				case <-ctx.Done():
+					return report, ctx.Err()
+				case <-throttle:
+				}
+			}
+			// The record is copied whole in one write, so a destination
+			// lock neither blocks the copy nor survives it half applied.
+			if err := m.Destination.ReplaceRecord(ctx, rec, nil); err != nil {
+				return report, fmt.Errorf("failed to copy key for entity %s: %w", rec.EntityURN.String(), err)
+			}
+			report.Copied++
+		}
+
+		pageToken = page.NextPageToken
+		if err := m.saveCheckpoint(Checkpoint{
+			Source:      m.Options.SourceName,
+			Destination: m.Options.DestinationName,
+			PageToken:   pageToken,
+			Report:      report,
+			Completed:   pageToken == "",
+		}); err != nil {
+			return report, err
+		}
+		m.Logger.Info().Int("read", report.Read).Int("copied", report.Copied).Int("unchanged", report.Unchanged).Msg("Migrated page")
+		if pageToken == "" {
+			return report, nil
+		}
+	}
+}
+
+// Verify compares every source record with the destination and computes a
+// digest over the content of each side.
+func (m *Migrator) Verify(ctx context.Context) (VerifyReport, error) {
+	var report VerifyReport
+
+	sourceHashes := make(map[string]string)
+	destinationHashes := make(map[string]string)
+	err := m.each(ctx, m.Source, func(rec keyservice.KeyRecord) error {
+		entityKey := rec.EntityURN.String()
+		sourceHashes[entityKey] = contentHash(rec.Key)
+
+		existing, err := m.Destination.GetRecord(ctx, rec.EntityURN)
+		if err != nil || (len(existing.Key) == 0 && len(rec.Key) > 0) {
+			report.Missing = append(report.Missing, entityKey)
+			return nil
+		}
+		destinationHashes[entityKey] = contentHash(existing.Key)
+		if !sameRecord(existing, rec) {
+			report.Mismatched = append(report.Mismatched, entityKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	report.SourceCount = len(sourceHashes)
+	report.SourceDigest = digest(sourceHashes)
+	report.DestinationDigest = digest(destinationHashes)
+
+	err = m.each(ctx, m.Destination, func(rec keyservice.KeyRecord) error {
+		report.DestinationCount++
+		return nil
+	})
+	return report, err
+}
+
+// each calls fn for every record in store.
+func (m *Migrator) each(ctx context.Context, store keyservice.Store, fn func(rec keyservice.KeyRecord) error) error {
+	pageToken := ""
+	for {
+		page, err := store.ListKeys(ctx, m.filter(), pageToken)
+		if err != nil {
+			return fmt.Errorf("failed to list keys: %w", err)
+		}
+		for _, rec := range page.Records {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// filter selects every record, including locks on entities with no key,
+// DefaultPageSize at a time unless configured.
+func (m *Migrator) filter() keyservice.ListFilter {
+	pageSize := m.Options.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return keyservice.ListFilter{PageSize: pageSize, IncludeLocked: true}
+}
+
+func (m *Migrator) loadCheckpoint() (Checkpoint, error) {
+	var checkpoint Checkpoint
+	if m.Options.CheckpointPath == "" {
+		return checkpoint, nil
+	}
+	data, err := os.ReadFile(m.Options.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("failed to read checkpoint at %s: %w", m.Options.CheckpointPath, err)
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("failed to parse checkpoint at %s: %w", m.Options.CheckpointPath, err)
+	}
+	if checkpoint.Source != m.Options.SourceName || checkpoint.Destination != m.Options.DestinationName {
+		return checkpoint, fmt.Errorf("%w: checkpoint at %s is for %q to %q, not %q to %q",
+			ErrCheckpointMismatch, m.Options.CheckpointPath,
+			checkpoint.Source, checkpoint.Destination, m.Options.SourceName, m.Options.DestinationName)
+	}
+	return checkpoint, nil
+}
+
+// saveCheckpoint atomically replaces the checkpoint file.
+func (m *Migrator) saveCheckpoint(checkpoint Checkpoint) error {
+	if m.Options.CheckpointPath == "" || m.Options.DryRun {
+		return nil
+	}
+	checkpoint.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.Options.CheckpointPath), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), m.Options.CheckpointPath); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// sameRecord reports whether two records hold the same key, signatures,
+// revocation and lock state.
+func sameRecord(a, b keyservice.KeyRecord) bool {
+	return bytes.Equal(a.Key, b.Key) && a.Revoked == b.Revoked && a.Locked == b.Locked &&
+		keyservice.EqualSignatures(a.Signatures, b.Signatures)
+}
+
+func contentHash(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// digest hashes the sorted (URN, content hash) pairs so two stores holding
+// the same records produce the same digest.
+func digest(hashes map[string]string) string {
+	entityKeys := make([]string, 0, len(hashes))
+	for entityKey := range hashes {
+		entityKeys = append(entityKeys, entityKey)
+	}
+	sort.Strings(entityKeys)
+
+	h := sha256.New()
+	for _, entityKey := range entityKeys {
+		_, _ = fmt.Fprintf(h, "%s\x00%s\n", entityKey, hashes[entityKey])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,209 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/migrate"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore wraps a Store and fails every write after the first limit.
+type failingStore struct {
+	keyservice.Store
+	limit  int
+	writes int
+}
+
+func (f *failingStore) ReplaceRecord(ctx context.Context, rec keyservice.KeyRecord, previousKey []byte) error {
+	if f.writes == f.limit {
+		return errors.New("destination unavailable")
+	}
+	f.writes++
+	return f.Store.ReplaceRecord(ctx, rec, previousKey)
+}
+
+// seed fills a new in-memory store with n user keys.
+func seed(t *testing.T, n int) *inmemory.Store {
+	t.Helper()
+	store := inmemory.New()
+	for i := 0; i < n; i++ {
+		entityURN, err := urn.New(urn.SecureMessaging, "user", fmt.Sprintf("user-%02d", i))
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(context.Background(), entityURN, []byte(fmt.Sprintf("key-%d", i))))
+	}
+	return store
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	t.Run("Copies every record and verifies", func(t *testing.T) {
+		// Arrange
+		source := seed(t, 5)
+		destination := inmemory.New()
+		migrator := &migrate.Migrator{Source: source, Destination: destination, Options: migrate.Options{PageSize: 2}, Logger: logger}
+
+		// Act
+		report, err := migrator.Run(ctx)
+		require.NoError(t, err)
+		verification, err := migrator.Verify(ctx)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, migrate.Report{Read: 5, Copied: 5}, report)
+		assert.True(t, verification.OK())
+		assert.Equal(t, 5, verification.SourceCount)
+		assert.Equal(t, 5, verification.DestinationCount)
+	})
+
+	t.Run("Dry run writes nothing", func(t *testing.T) {
+		// Arrange
+		source := seed(t, 3)
+		destination := inmemory.New()
+		checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+		migrator := &migrate.Migrator{Source: source, Destination: destination, Options: migrate.Options{DryRun: true, CheckpointPath: checkpointPath}, Logger: logger}
+
+		// Act
+		report, err := migrator.Run(ctx)
+		require.NoError(t, err)
+		verification, err := migrator.Verify(ctx)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, 3, report.Copied)
+		assert.False(t, verification.OK())
+		assert.Len(t, verification.Missing, 3)
+		assert.NoFileExists(t, checkpointPath)
+	})
+
+	t.Run("Interrupted run resumes from the checkpoint", func(t *testing.T) {
+		// Arrange: the destination fails on the third write, mid second page.
+		source := seed(t, 5)
+		destination := inmemory.New()
+		checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+		options := migrate.Options{PageSize: 2, CheckpointPath: checkpointPath}
+		failing := &migrate.Migrator{Source: source, Destination: &failingStore{Store: destination, limit: 2}, Options: options, Logger: logger}
+
+		_, err := failing.Run(ctx)
+		require.Error(t, err)
+
+		// Act
+		migrator := &migrate.Migrator{Source: source, Destination: destination, Options: options, Logger: logger}
+		report, err := migrator.Run(ctx)
+		require.NoError(t, err)
+		verification, err := migrator.Verify(ctx)
+		require.NoError(t, err)
+
+		// Assert: the first page was not re-read and the copy is complete.
+		assert.Equal(t, migrate.Report{Read: 5, Copied: 5}, report)
+		assert.True(t, verification.OK())
+	})
+
+	t.Run("Verify detects content drift", func(t *testing.T) {
+		// Arrange
+		source := seed(t, 2)
+		destination := seed(t, 2)
+		drifted, err := urn.New(urn.SecureMessaging, "user", "user-01")
+		require.NoError(t, err)
+		require.NoError(t, destination.StoreKey(ctx, drifted, []byte("tampered")))
+		migrator := &migrate.Migrator{Source: source, Destination: destination, Logger: logger}
+
+		// Act
+		verification, err := migrator.Verify(ctx)
+		require.NoError(t, err)
+
+		// Assert
+		assert.False(t, verification.OK())
+		assert.Equal(t, []string{drifted.String()}, verification.Mismatched)
+		assert.NotEqual(t, verification.SourceDigest, verification.DestinationDigest)
+	})
+
+	t.Run("Copies revocations and locks", func(t *testing.T) {
+		// Arrange
+		source := seed(t, 2)
+		revoked, err := urn.New(urn.SecureMessaging, "user", "user-00")
+		require.NoError(t, err)
+		require.NoError(t, source.RevokeKey(ctx, revoked))
+		locked, err := urn.New(urn.SecureMessaging, "user", "user-01")
+		require.NoError(t, err)
+		require.NoError(t, source.SetLocked(ctx, locked, true))
+		destination := inmemory.New()
+		// A lock already in the destination does not block the copy.
+		require.NoError(t, destination.SetLocked(ctx, revoked, true))
+		migrator := &migrate.Migrator{Source: source, Destination: destination, Logger: logger}
+
+		// Act
+		_, err = migrator.Run(ctx)
+		require.NoError(t, err)
+		verification, err := migrator.Verify(ctx)
+		require.NoError(t, err)
+
+		// Assert
+		assert.True(t, verification.OK())
+		_, err = destination.GetKey(ctx, revoked)
+		assert.ErrorIs(t, err, keyservice.ErrKeyRevoked)
+		revokedRecord, err := destination.GetRecord(ctx, revoked)
+		require.NoError(t, err)
+		assert.False(t, revokedRecord.Locked, "the destination takes the source's lock state")
+		lockedRecord, err := destination.GetRecord(ctx, locked)
+		require.NoError(t, err)
+		assert.True(t, lockedRecord.Locked)
+		assert.Equal(t, []byte("key-1"), lockedRecord.Key)
+	})
+
+	t.Run("Copies locks on entities with no key", func(t *testing.T) {
+		// Arrange
+		source := seed(t, 1)
+		locked, err := urn.New(urn.SecureMessaging, "user", "locked-only")
+		require.NoError(t, err)
+		require.NoError(t, source.SetLocked(ctx, locked, true))
+		destination := inmemory.New()
+		migrator := &migrate.Migrator{Source: source, Destination: destination, Logger: logger}
+
+		// Act
+		report, err := migrator.Run(ctx)
+		require.NoError(t, err)
+		verification, err := migrator.Verify(ctx)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, migrate.Report{Read: 2, Copied: 2}, report)
+		assert.True(t, verification.OK())
+		rec, err := destination.GetRecord(ctx, locked)
+		require.NoError(t, err)
+		assert.True(t, rec.Locked)
+		assert.Empty(t, rec.Key)
+	})
+
+	t.Run("Refuses a checkpoint written for other stores", func(t *testing.T) {
+		// Arrange
+		source := seed(t, 3)
+		checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+		options := migrate.Options{PageSize: 2, CheckpointPath: checkpointPath, SourceName: "old/public-keys", DestinationName: "new/public-keys"}
+		failing := &migrate.Migrator{Source: source, Destination: &failingStore{Store: inmemory.New(), limit: 2}, Options: options, Logger: logger}
+		_, err := failing.Run(ctx)
+		require.Error(t, err)
+
+		// Act
+		options.DestinationName = "other/public-keys"
+		destination := inmemory.New()
+		migrator := &migrate.Migrator{Source: source, Destination: destination, Options: options, Logger: logger}
+		_, err = migrator.Run(ctx)
+
+		// Assert
+		assert.ErrorIs(t, err, migrate.ErrCheckpointMismatch)
+		page, err := destination.ListKeys(ctx, keyservice.ListFilter{}, "")
+		require.NoError(t, err)
+		assert.Empty(t, page.Records)
+	})
+}
@@ -0,0 +1,63 @@
+// Package mtls terminates TLS with hot-reloaded certificates and maps
+// verified client certificates to principals.
+package mtls
+
+import (
+	"crypto/x509"
+	"fmt"
+	"maps"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+// Mapper is a keyservice.ClientCertMapper driven by a static list of
+// mappings. SPIFFE IDs take precedence over subjects.
+type Mapper struct {
+	bySPIFFEID map[string]keyservice.ClientCertMapping
+	bySubject  map[string]keyservice.ClientCertMapping
+}
+
+// NewMapper validates mappings and indexes them.
+func NewMapper(mappings []keyservice.ClientCertMapping) (*Mapper, error) {
+	m := &Mapper{
+		bySPIFFEID: make(map[string]keyservice.ClientCertMapping),
+		bySubject:  make(map[string]keyservice.ClientCertMapping),
+	}
+	for i, mapping := range mappings {
+		if err := mapping.Validate(); err != nil {
+			return nil, fmt.Errorf("client certificate mapping %d: %w", i, err)
+		}
+		if mapping.SPIFFEID != "" {
+			m.bySPIFFEID[mapping.SPIFFEID] = mapping
+		} else {
+			m.bySubject[mapping.Subject] = mapping
+		}
+	}
+	return m, nil
+}
+
+// PrincipalForCert returns the principal mapped to cert's SPIFFE ID or
+// subject. The principal's claims are the mapping's claims plus "sub".
+func (m *Mapper) PrincipalForCert(cert *x509.Certificate) (keyservice.Principal, bool) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+		if mapping, ok := m.bySPIFFEID[uri.String()]; ok {
+			return principal(mapping), true
+		}
+	}
+	if mapping, ok := m.bySubject[cert.Subject.String()]; ok {
+		return principal(mapping), true
+	}
+	return keyservice.Principal{}, false
+}
+
+func principal(mapping keyservice.ClientCertMapping) keyservice.Principal {
+	claims := maps.Clone(mapping.Claims)
+	if claims == nil {
+		claims = make(map[string]any)
+	}
+	claims["sub"] = mapping.Principal
+	return keyservice.Principal{Subject: mapping.Principal, Claims: claims}
+}
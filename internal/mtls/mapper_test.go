@@ -0,0 +1,59 @@
+package mtls_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/mtls"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-key-service/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapper(t *testing.T) {
+	ca, err := test.NewCertificateAuthority("test-ca")
+	require.NoError(t, err)
+	leaf := func(subject pkix.Name, spiffeID string) *x509.Certificate {
+		cert, err := ca.IssueClient(subject, spiffeID)
+		require.NoError(t, err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return parsed
+	}
+
+	mapper, err := mtls.NewMapper([]keyservice.ClientCertMapping{
+		{SPIFFEID: "spiffe://example.org/ns/messaging/sa/message-router", Principal: "service:message-router", Claims: map[string]any{"roles": []any{"keys-reader"}}},
+		{Subject: "CN=notification-service,O=Example", Principal: "service:notification-service"},
+	})
+	require.NoError(t, err)
+
+	t.Run("SPIFFE ID maps to its principal and claims", func(t *testing.T) {
+		principal, ok := mapper.PrincipalForCert(leaf(pkix.Name{CommonName: "ignored"}, "spiffe://example.org/ns/messaging/sa/message-router"))
+
+		require.True(t, ok)
+		assert.Equal(t, "service:message-router", principal.Subject)
+		assert.Equal(t, "service:message-router", principal.Claims["sub"])
+		assert.Equal(t, []any{"keys-reader"}, principal.Claims["roles"])
+	})
+
+	t.Run("Subject maps to its principal", func(t *testing.T) {
+		principal, ok := mapper.PrincipalForCert(leaf(pkix.Name{CommonName: "notification-service", Organization: []string{"Example"}}, ""))
+
+		require.True(t, ok)
+		assert.Equal(t, "service:notification-service", principal.Subject)
+	})
+
+	t.Run("Unknown certificate maps to no principal", func(t *testing.T) {
+		_, ok := mapper.PrincipalForCert(leaf(pkix.Name{CommonName: "stranger"}, "spiffe://example.org/ns/other/sa/stranger"))
+
+		assert.False(t, ok)
+	})
+
+	t.Run("Mapping without a principal is rejected", func(t *testing.T) {
+		_, err := mtls.NewMapper([]keyservice.ClientCertMapping{{SPIFFEID: "spiffe://example.org/x"}})
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,144 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultReloadInterval is how often Watch checks the files for changes.
+const DefaultReloadInterval = 30 * time.Second
+
+// Reloader serves a server certificate and client CA bundle read from disk,
+// picking up replaced files without a restart. A failed reload keeps the
+// previous certificates.
+type Reloader struct {
+	certFile, keyFile, clientCAFile string
+	logger                          zerolog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  []time.Time
+}
+
+// NewReloader loads the server key pair and, if clientCAFile is not empty,
+// the PEM bundle of CAs trusted to issue client certificates.
+func NewReloader(certFile, keyFile, clientCAFile string, logger zerolog.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile, logger: logger}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again.
+func (r *Reloader) Reload() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA bundle %s contains no certificates", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.clientCAs, r.modTimes = &cert, clientCAs, modTimes
+	return nil
+}
+
+// Watch reloads the files whenever their modification times change,
+// checking every interval until ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.logger.Error().Err(err).Msg("Failed to reload TLS certificates; keeping the previous ones")
+				continue
+			}
+			r.logger.Info().Msg("Reloaded TLS certificates")
+		}
+	}
+}
+
+// TLSConfig returns a server configuration that uses the current
+// certificates for every handshake and verifies client certificates
+// according to clientAuth.
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCAs,
+				ClientAuth:   clientAuth,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// changed reports whether any file was modified since the last load.
+func (r *Reloader) changed() bool {
+	modTimes, err := r.stat()
+	if err != nil {
+		r.logger.Warn().Err(err).Msg("Failed to check TLS certificates for changes")
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) stat() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, path := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,148 @@
+package mtls_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/mtls"
+	"github.com/illmade-knight/go-key-service/test"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeServerCert issues a server certificate into dir, returning its
+// serial number.
+func writeServerCert(t *testing.T, ca *test.CertificateAuthority, dir string) string {
+	t.Helper()
+	cert, certPEM, keyPEM, err := ca.IssueServer()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), certPEM, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), keyPEM, 0o600))
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber.String()
+}
+
+// servedSerial performs a handshake with the listener and returns the serial
+// number of the server certificate.
+func servedSerial(t *testing.T, addr string, ca *test.CertificateAuthority, clientCert *tls.Certificate) (string, error) {
+	t.Helper()
+	cfg := &tls.Config{RootCAs: ca.Pool(), ServerName: "localhost"}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = conn.Close() }()
+	// TLS 1.3 reports client certificate rejections on the first read.
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return "", err
+		}
+	}
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.String(), nil
+}
+
+// serve accepts TLS connections with cfg until the test ends, completing
+// each handshake.
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_ = conn.(*tls.Conn).Handshake()
+				time.Sleep(200 * time.Millisecond)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestReloader(t *testing.T) {
+	ca, err := test.NewCertificateAuthority("test-ca")
+	require.NoError(t, err)
+
+	t.Run("Replaced certificate is served after the next check", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		first := writeServerCert(t, ca, dir)
+		reloader, err := mtls.NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "", zerolog.Nop())
+		require.NoError(t, err)
+		addr := serve(t, reloader.TLSConfig(tls.NoClientCert))
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go reloader.Watch(ctx, 10*time.Millisecond)
+
+		serial, err := servedSerial(t, addr, ca, nil)
+		require.NoError(t, err)
+		require.Equal(t, first, serial)
+
+		// Act: replace the files, moving the modification time forward.
+		second := writeServerCert(t, ca, dir)
+		later := time.Now().Add(time.Second)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "tls.crt"), later, later))
+
+		// Assert
+		assert.Eventually(t, func() bool {
+			serial, err := servedSerial(t, addr, ca, nil)
+			return err == nil && serial == second
+		}, 2*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("Client certificates are verified against the CA bundle", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		writeServerCert(t, ca, dir)
+		caFile := filepath.Join(dir, "ca.crt")
+		require.NoError(t, os.WriteFile(caFile, ca.CertPEM, 0o600))
+		reloader, err := mtls.NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), caFile, zerolog.Nop())
+		require.NoError(t, err)
+		addr := serve(t, reloader.TLSConfig(tls.RequireAndVerifyClientCert))
+
+		trusted, err := ca.IssueClient(pkix.Name{CommonName: "message-router"}, "")
+		require.NoError(t, err)
+		otherCA, err := test.NewCertificateAuthority("other-ca")
+		require.NoError(t, err)
+		untrusted, err := otherCA.IssueClient(pkix.Name{CommonName: "message-router"}, "")
+		require.NoError(t, err)
+
+		// Act
+		_, trustedErr := servedSerial(t, addr, ca, &trusted)
+		_, untrustedErr := servedSerial(t, addr, ca, &untrusted)
+		_, missingErr := servedSerial(t, addr, ca, nil)
+
+		// Assert
+		assert.NoError(t, trustedErr)
+		assert.Error(t, untrustedErr)
+		assert.Error(t, missingErr)
+	})
+
+	t.Run("Invalid key pair fails to load", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("not a certificate"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), []byte("not a key"), 0o600))
+
+		_, err := mtls.NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "", zerolog.Nop())
+
+		assert.Error(t, err)
+	})
+}
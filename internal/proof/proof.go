@@ -0,0 +1,61 @@
+// Package proof verifies proof-of-possession signatures over key upload
+// challenges.
+package proof
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrBadSignature is returned, wrapped, by Verify when the signature does
+// not match.
+var ErrBadSignature = errors.New("signature does not verify")
+
+// ParseSigningKey parses a PKIX public key, PEM or DER encoded, and reports
+// whether it belongs to a signature-capable algorithm: Ed25519, ECDSA or
+// RSA. Keys that cannot sign, such as X25519, and opaque keys report false.
+func ParseSigningKey(key []byte) (crypto.PublicKey, bool) {
+	if block, _ := pem.Decode(key); block != nil {
+		key = block.Bytes
+	}
+	pub, err := x509.ParsePKIXPublicKey(key)
+	if err != nil {
+		return nil, false
+	}
+	switch pub.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		return pub, true
+	default:
+		return nil, false
+	}
+}
+
+// Verify checks signature over message with pub. Ed25519 signs the message
+// itself; ECDSA (ASN.1 signatures) and RSA (PKCS #1 v1.5 or PSS) sign its
+// SHA-256 digest.
+func Verify(pub crypto.PublicKey, message, signature []byte) error {
+	digest := sha256.Sum256(message)
+	var ok bool
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, message, signature)
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil ||
+			rsa.VerifyPSS(key, crypto.SHA256, digest[:], signature, nil) == nil
+	default:
+		return fmt.Errorf("unsupported signing key type %T", pub)
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package proof_test
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/proof"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pkix(t *testing.T, pub crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return der
+}
+
+func TestVerify(t *testing.T) {
+	message := []byte("nonce\nurn:sm:user:alice")
+	digest := sha256.Sum256(message)
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecPriv, digest[:])
+	require.NoError(t, err)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaSig, err := rsa.SignPSS(rand.Reader, rsaPriv, crypto.SHA256, digest[:], nil)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name      string
+		key       []byte
+		signature []byte
+	}{
+		{"Ed25519 DER", pkix(t, edPub), ed25519.Sign(edPriv, message)},
+		{"ECDSA PEM", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix(t, &ecPriv.PublicKey)}), ecSig},
+		{"RSA PSS", pkix(t, &rsaPriv.PublicKey), rsaSig},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			pub, ok := proof.ParseSigningKey(tc.key)
+			require.True(t, ok)
+
+			// Act & Assert
+			assert.NoError(t, proof.Verify(pub, message, tc.signature))
+			assert.ErrorIs(t, proof.Verify(pub, []byte("other message"), tc.signature), proof.ErrBadSignature)
+		})
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	_, ok := proof.ParseSigningKey(pkix(t, x25519.PublicKey()))
+	assert.False(t, ok, "X25519 keys cannot sign")
+
+	_, ok = proof.ParseSigningKey([]byte("my-public-key"))
+	assert.False(t, ok, "opaque keys are not parsed")
+}
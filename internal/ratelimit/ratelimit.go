@@ -0,0 +1,192 @@
+// Package ratelimit slows down enumeration of the key directory by limiting
+// key lookups per client, with a separate, smaller budget for lookups of
+// entities that do not exist.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/rs/zerolog"
+)
+
+// Limiter enforces a keyservice.LookupRateLimit using a RateLimitStore.
+type Limiter struct {
+	store  keyservice.RateLimitStore
+	limits keyservice.LookupRateLimit
+	logger zerolog.Logger
+}
+
+// New creates a Limiter. Sharing store between replicas makes the limits
+// global.
+func New(store keyservice.RateLimitStore, limits keyservice.LookupRateLimit, logger zerolog.Logger) *Limiter {
+	if len(limits.KeyBy) == 0 {
+		limits.KeyBy = []keyservice.RateLimitKey{keyservice.RateLimitKeyIP}
+	}
+	return &Limiter{store: store, limits: limits, logger: logger}
+}
+
+// Middleware applies the limits to a lookup handler. A 404 Not Found response
+// counts as a miss. Batch reads are charged per entity through the
+// api.LookupBudget placed in the request context. If the store fails,
+// requests are let through so that an outage of shared limiter state does
+// not take down key lookups.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := l.clientKeys(r)
+
+		for _, key := range keys {
+			if !l.limits.Hits.IsZero() && !l.take(w, r, "hits:"+key, l.limits.Hits, 1) {
+				return
+			}
+			// Refuse all lookups once the miss budget is spent; whether this
+			// lookup misses is only known afterwards.
+			if !l.limits.Misses.IsZero() && !l.take(w, r, "misses:"+key, l.limits.Misses, 0) {
+				return
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		budget := &requestBudget{limiter: l, keys: keys}
+		next.ServeHTTP(recorder, r.WithContext(api.ContextWithLookupBudget(r.Context(), budget)))
+
+		if recorder.status == http.StatusNotFound {
+			l.recordMiss(r.Context(), keys)
+		}
+	})
+}
+
+// recordMiss spends a misses token for each of keys.
+func (l *Limiter) recordMiss(ctx context.Context, keys []string) {
+	if l.limits.Misses.IsZero() {
+		return
+	}
+	for _, key := range keys {
+		if _, err := l.store.Take(ctx, "misses:"+key, l.limits.Misses, 1); err != nil {
+			l.logger.Error().Err(err).Str("key", key).Msg("Failed to record rate limit miss")
+		}
+	}
+}
+
+// take spends n tokens for key, writing a 429 response and returning false
+// if the bucket is exhausted.
+func (l *Limiter) take(w http.ResponseWriter, r *http.Request, key string, limit keyservice.RateLimit, n int) bool {
+	result, ok := l.allow(r.Context(), key, limit, n)
+	if ok {
+		return true
+	}
+	l.logger.Warn().Str("key", key).Str("path", r.URL.Path).Msg("Rate limit exceeded")
+	if result.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+	}
+	response.WriteJSONError(w, http.StatusTooManyRequests, "Too many requests")
+	return false
+}
+
+// allow spends n tokens for key and reports whether the bucket held enough.
+// Store failures allow the lookup.
+func (l *Limiter) allow(ctx context.Context, key string, limit keyservice.RateLimit, n int) (keyservice.RateLimitResult, bool) {
+	result, err := l.store.Take(ctx, key, limit, n)
+	if err != nil {
+		l.logger.Error().Err(err).Str("key", key).Msg("Rate limit check failed; allowing request")
+		return result, true
+	}
+	return result, result.Allowed
+}
+
+// requestBudget charges the lookups of one request to the client's buckets.
+// The first lookup was already charged when the request was admitted.
+type requestBudget struct {
+	limiter *Limiter
+	keys    []string
+	spent   int
+}
+
+// Spend implements api.LookupBudget.
+func (b *requestBudget) Spend(ctx context.Context) bool {
+	b.spent++
+	if b.spent == 1 {
+		return true
+	}
+	l := b.limiter
+	for _, key := range b.keys {
+		if !l.limits.Hits.IsZero() {
+			if _, ok := l.allow(ctx, "hits:"+key, l.limits.Hits, 1); !ok {
+				return false
+			}
+		}
+		if !l.limits.Misses.IsZero() {
+			if _, ok := l.allow(ctx, "misses:"+key, l.limits.Misses, 0); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Miss implements api.LookupBudget.
+func (b *requestBudget) Miss(ctx context.Context) {
+	b.limiter.recordMiss(ctx, b.keys)
+}
+
+// clientKeys returns the bucket keys identifying the request's client.
+func (l *Limiter) clientKeys(r *http.Request) []string {
+	var keys []string
+	ipKey := "ip:" + l.clientIP(r)
+	for _, keyBy := range l.limits.KeyBy {
+		switch keyBy {
+		case keyservice.RateLimitKeySubject:
+			if principal, ok := api.PrincipalFromContext(r.Context()); ok && principal.Subject != "" {
+				keys = append(keys, "sub:"+principal.Subject)
+				continue
+			}
+			fallthrough
+		default:
+			if !slices.Contains(keys, ipKey) {
+				keys = append(keys, ipKey)
+			}
+		}
+	}
+	return keys
+}
+
+// clientIP returns the address of the client. When the proxy in front is
+// trusted it is the last X-Forwarded-For entry, the one that proxy appended;
+// earlier entries are supplied by the client and could be forged.
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.limits.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			entries := strings.Split(forwarded, ",")
+			return strings.TrimSpace(entries[len(entries)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusRecorder captures the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
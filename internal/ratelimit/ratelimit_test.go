@@ -0,0 +1,193 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/ratelimit"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupHandler answers 200 for "/keys/known" and 404 for anything else.
+var lookupHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/keys/known" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+})
+
+func lookup(h http.Handler, path, remoteAddr string, mutate ...func(*http.Request) *http.Request) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	for _, m := range mutate {
+		req = m(req)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestLimiter(t *testing.T) {
+	// Rates are tiny so buckets do not refill during a test.
+	slow := func(burst int) keyservice.RateLimit { return keyservice.RateLimit{Rate: 0.001, Burst: burst} }
+
+	t.Run("Hits budget limits every lookup per IP", func(t *testing.T) {
+		// Arrange
+		limiter := ratelimit.New(inmemory.NewRateLimitStore(), keyservice.LookupRateLimit{Hits: slow(2)}, zerolog.Nop())
+		h := limiter.Middleware(lookupHandler)
+
+		// Act
+		first := lookup(h, "/keys/known", "10.0.0.1:1234")
+		second := lookup(h, "/keys/known", "10.0.0.1:1234")
+		third := lookup(h, "/keys/known", "10.0.0.1:1234")
+		otherClient := lookup(h, "/keys/known", "10.0.0.2:1234")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, http.StatusTooManyRequests, third.Code)
+		assert.NotEmpty(t, third.Header().Get("Retry-After"))
+		assert.Equal(t, http.StatusOK, otherClient.Code)
+	})
+
+	t.Run("Spending the misses budget blocks further lookups", func(t *testing.T) {
+		// Arrange
+		limits := keyservice.LookupRateLimit{Hits: slow(100), Misses: slow(2)}
+		h := ratelimit.New(inmemory.NewRateLimitStore(), limits, zerolog.Nop()).Middleware(lookupHandler)
+
+		// Act: hits do not spend the misses budget
+		for range 5 {
+			assert.Equal(t, http.StatusOK, lookup(h, "/keys/known", "10.0.0.1:1234").Code)
+		}
+		missOne := lookup(h, "/keys/unknown-1", "10.0.0.1:1234")
+		missTwo := lookup(h, "/keys/unknown-2", "10.0.0.1:1234")
+		blocked := lookup(h, "/keys/known", "10.0.0.1:1234")
+
+		// Assert
+		assert.Equal(t, http.StatusNotFound, missOne.Code)
+		assert.Equal(t, http.StatusNotFound, missTwo.Code)
+		assert.Equal(t, http.StatusTooManyRequests, blocked.Code)
+	})
+
+	t.Run("Subject keys count authenticated callers separately", func(t *testing.T) {
+		// Arrange
+		limits := keyservice.LookupRateLimit{Hits: slow(1), KeyBy: []keyservice.RateLimitKey{keyservice.RateLimitKeySubject}}
+		h := ratelimit.New(inmemory.NewRateLimitStore(), limits, zerolog.Nop()).Middleware(lookupHandler)
+		as := func(subject string) func(*http.Request) *http.Request {
+			return func(r *http.Request) *http.Request {
+				return r.WithContext(api.ContextWithUserID(context.Background(), subject))
+			}
+		}
+
+		// Act: two users behind the same IP
+		alice := lookup(h, "/keys/known", "10.0.0.1:1234", as("alice"))
+		bob := lookup(h, "/keys/known", "10.0.0.1:1234", as("bob"))
+		aliceAgain := lookup(h, "/keys/known", "10.0.0.1:1234", as("alice"))
+
+		// Assert
+		assert.Equal(t, http.StatusOK, alice.Code)
+		assert.Equal(t, http.StatusOK, bob.Code)
+		assert.Equal(t, http.StatusTooManyRequests, aliceAgain.Code)
+	})
+
+	t.Run("Trusted X-Forwarded-For uses the entry appended by the proxy", func(t *testing.T) {
+		// Arrange
+		limits := keyservice.LookupRateLimit{Hits: slow(1), TrustForwardedFor: true}
+		h := ratelimit.New(inmemory.NewRateLimitStore(), limits, zerolog.Nop()).Middleware(lookupHandler)
+		forwardedFor := func(value string) func(*http.Request) *http.Request {
+			return func(r *http.Request) *http.Request {
+				r.Header.Set("X-Forwarded-For", value)
+				return r
+			}
+		}
+
+		// Act: the client forges the first entry on its second request
+		first := lookup(h, "/keys/known", "10.9.9.9:1", forwardedFor("203.0.113.7"))
+		forged := lookup(h, "/keys/known", "10.9.9.9:1", forwardedFor("198.51.100.1, 203.0.113.7"))
+
+		// Assert
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, http.StatusTooManyRequests, forged.Code)
+	})
+
+	t.Run("Batch reads are charged per entity", func(t *testing.T) {
+		// Arrange
+		ctx := context.Background()
+		store := inmemory.New()
+		knownURN, _ := urn.New(urn.SecureMessaging, "user", "known")
+		unknownURN, _ := urn.New(urn.SecureMessaging, "user", "unknown")
+		require.NoError(t, store.StoreKey(ctx, knownURN, []byte("key")))
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		limits := keyservice.LookupRateLimit{Hits: slow(3), Misses: slow(1)}
+		h := ratelimit.New(inmemory.NewRateLimitStore(), limits, zerolog.Nop()).Middleware(http.HandlerFunc(apiHandler.BatchGetKeysHandler))
+		batchGet := func(entityURNs ...urn.URN) *httptest.ResponseRecorder {
+			raw := make([]string, 0, len(entityURNs))
+			for _, entityURN := range entityURNs {
+				raw = append(raw, entityURN.String())
+			}
+			body, _ := json.Marshal(map[string][]string{"entityUrns": raw})
+			req := httptest.NewRequest(http.MethodPost, "/keys:batchGet", bytes.NewReader(body))
+			req.RemoteAddr = "10.0.0.1:1234"
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// Act: one batch spends a hit per entity and a miss for the unknown
+		// one, leaving a single hit but no misses
+		first := batchGet(knownURN, unknownURN)
+		second := batchGet(knownURN)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, http.StatusTooManyRequests, second.Code)
+	})
+
+	t.Run("Batch reads stop when the hits budget runs out", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		apiHandler := &api.API{Store: store, Logger: zerolog.Nop()}
+		h := ratelimit.New(inmemory.NewRateLimitStore(), keyservice.LookupRateLimit{Hits: slow(2)}, zerolog.Nop()).Middleware(http.HandlerFunc(apiHandler.BatchGetKeysHandler))
+		body := `{"entityUrns": ["urn:sm:user:a", "urn:sm:user:b", "urn:sm:user:c"]}`
+		req := httptest.NewRequest(http.MethodPost, "/keys:batchGet", strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+
+		// Act
+		h.ServeHTTP(rr, req)
+
+		// Assert
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	})
+
+	t.Run("Store failures let requests through", func(t *testing.T) {
+		// Arrange
+		h := ratelimit.New(failingStore{}, keyservice.LookupRateLimit{Hits: slow(1)}, zerolog.Nop()).Middleware(lookupHandler)
+
+		// Act
+		rr := lookup(h, "/keys/known", "10.0.0.1:1234")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+// failingStore is a keyservice.RateLimitStore that is always unavailable.
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit keyservice.RateLimit, n int) (keyservice.RateLimitResult, error) {
+	return keyservice.RateLimitResult{}, errors.New("store unavailable")
+}
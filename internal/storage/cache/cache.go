@@ -0,0 +1,281 @@
+// Package cache provides a read-through caching decorator for any
+// keyservice.Store, kept coherent across replicas by a keyservice.Invalidator.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// invalidationFailures counts writes whose invalidation could not be
+// published. The write itself succeeded; other replicas serve their cached
+// copy until it expires.
+var invalidationFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "keyservice_cache_invalidation_failures_total",
+	Help: "Key changes that could not be announced to the other replicas' caches.",
+})
+
+// entry is a single cached record and the moment it stops being trusted.
+type entry struct {
+	rec     keyservice.KeyRecord
+	expires time.Time
+}
+
+// pageEntry is a single cached ListKeys page.
+type pageEntry struct {
+	page    keyservice.KeyPage
+	expires time.Time
+}
+
+// Store caches records read from an underlying keyservice.Store for up to
+// ttl, serving GetKey, GetRecord and GetRecords from the same entries, and
+// ListKeys pages. Entries are evicted early whenever the Invalidator reports
+// a change, so the staleness window is bounded by the invalidation delay,
+// and by ttl if an invalidation is ever missed. Cached records are copied
+// out, so callers may modify what they are given.
+type Store struct {
+	sync.RWMutex
+	next        keyservice.Store
+	invalidator keyservice.Invalidator
+	ttl         time.Duration
+	entries     map[string]entry
+	// pages holds ListKeys pages by filter and page token. Any change may
+	// alter any page, so every eviction drops them all.
+	pages map[string]pageEntry
+	// evictions counts invalidations so that a read racing with one does not
+	// re-populate the cache with the value it just invalidated.
+	evictions uint64
+}
+
+// New creates a caching Store in front of next and subscribes to invalidator.
+// The subscription lasts until ctx is cancelled.
+func New(ctx context.Context, next keyservice.Store, invalidator keyservice.Invalidator, ttl time.Duration) (*Store, error) {
+	s := &Store{
+		next:        next,
+		invalidator: invalidator,
+		ttl:         ttl,
+		entries:     make(map[string]entry),
+		pages:       make(map[string]pageEntry),
+	}
+	if err := invalidator.Subscribe(ctx, s.evict); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to key invalidations: %w", err)
+	}
+	return s, nil
+}
+
+// StoreKey writes through to the underlying store, evicts the local entry and
+// announces the change to the other replicas.
+func (s *Store) StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error {
+	if err := s.next.StoreKey(ctx, entityURN, key); err != nil {
+		return err
+	}
+	s.invalidate(ctx, entityURN)
+	return nil
+}
+
+// StoreSignedKey writes through to the underlying store and invalidates the
+// entity like StoreKey.
+func (s *Store) StoreSignedKey(ctx context.Context, entityURN urn.URN, key []byte, signatures []keyservice.KeySignature) error {
+	if err := s.next.StoreSignedKey(ctx, entityURN, key, signatures); err != nil {
+		return err
+	}
+	s.invalidate(ctx, entityURN)
+	return nil
+}
+
+// StoreKeys writes through to the underlying store and invalidates each
+// entity whose key was stored.
+func (s *Store) StoreKeys(ctx context.Context, writes []keyservice.KeyWrite) []error {
+	errs := s.next.StoreKeys(ctx, writes)
+	for i, write := range writes {
+		if errs[i] == nil {
+			s.invalidate(ctx, write.EntityURN)
+		}
+	}
+	return errs
+}
+
+// invalidate evicts the entity locally and tells the other replicas to do
+// the same. The change is already stored, so a failure to announce it is
+// counted rather than reported as the write's failure; the other replicas
+// catch up when their entries expire.
+func (s *Store) invalidate(ctx context.Context, entityURN urn.URN) {
+	s.evict(entityURN)
+	if err := s.invalidator.Publish(ctx, entityURN); err != nil {
+		invalidationFailures.Inc()
+	}
+}
+
+// GetKey serves the key of the entity's cached record if it is still
+// fresh, otherwise it reads and caches the record.
+func (s *Store) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error) {
+	rec, err := s.GetRecord(ctx, entityURN)
+	if err != nil {
+		return nil, err
+	}
+	if len(rec.Key) == 0 {
+		return nil, fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrKeyNotFound)
+	}
+	if rec.Revoked {
+		return nil, fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrKeyRevoked)
+	}
+	return rec.Key, nil
+}
+
+// GetRecord returns the cached record if it is still fresh, otherwise it
+// reads from the underlying store and caches the result.
+func (s *Store) GetRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	s.RLock()
+	e, ok := s.entries[entityURN.String()]
+	evictions := s.evictions
+	s.RUnlock()
+	if ok && time.Now().Before(e.expires) {
+		return cloneRecord(e.rec), nil
+	}
+
+	rec, err := s.next.GetRecord(ctx, entityURN)
+	if err != nil {
+		return keyservice.KeyRecord{}, err
+	}
+	s.cache(evictions, rec)
+	return cloneRecord(rec), nil
+}
+
+// GetRecords serves the fresh cached records and reads the others from the
+// underlying store in one batch, caching those that exist.
+func (s *Store) GetRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, error) {
+	records := make([]keyservice.KeyRecord, len(entityURNs))
+	var missing []urn.URN
+	var positions []int
+	now := time.Now()
+	s.RLock()
+	evictions := s.evictions
+	for i, entityURN := range entityURNs {
+		if e, ok := s.entries[entityURN.String()]; ok && now.Before(e.expires) {
+			records[i] = cloneRecord(e.rec)
+			continue
+		}
+		missing = append(missing, entityURN)
+		positions = append(positions, i)
+	}
+	s.RUnlock()
+	if len(missing) == 0 {
+		return records, nil
+	}
+
+	fetched, err := s.next.GetRecords(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for j, rec := range fetched {
+		// Entities without a record are not cached, so a key stored
+		// elsewhere is not hidden until the entry expires.
+		if len(rec.Key) > 0 || rec.Locked {
+			s.cache(evictions, rec)
+		}
+		records[positions[j]] = cloneRecord(rec)
+	}
+	return records, nil
+}
+
+// cache stores rec unless an invalidation happened since the read began at
+// evictions.
+func (s *Store) cache(evictions uint64, rec keyservice.KeyRecord) {
+	s.Lock()
+	defer s.Unlock()
+	if s.evictions == evictions {
+		s.entries[rec.EntityURN.String()] = entry{rec: cloneRecord(rec), expires: time.Now().Add(s.ttl)}
+	}
+}
+
+// RevokeKey revokes the key in the underlying store and evicts it everywhere
+// like StoreKey.
+func (s *Store) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	if err := s.next.RevokeKey(ctx, entityURN); err != nil {
+		return err
+	}
+	s.invalidate(ctx, entityURN)
+	return nil
+}
+
+// SetLocked writes through to the underlying store and, as cached records
+// carry the lock, evicts the entity everywhere like StoreKey.
+func (s *Store) SetLocked(ctx context.Context, entityURN urn.URN, locked bool) error {
+	if err := s.next.SetLocked(ctx, entityURN, locked); err != nil {
+		return err
+	}
+	s.invalidate(ctx, entityURN)
+	return nil
+}
+
+// ReplaceRecord writes through to the underlying store and invalidates the
+// entity like StoreKey.
+func (s *Store) ReplaceRecord(ctx context.Context, rec keyservice.KeyRecord, previousKey []byte) error {
+	if err := s.next.ReplaceRecord(ctx, rec, previousKey); err != nil {
+		return err
+	}
+	s.invalidate(ctx, rec.EntityURN)
+	return nil
+}
+
+// ListKeys returns the cached page if it is still fresh, otherwise it reads
+// the page from the underlying store and caches it.
+func (s *Store) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	pageKey := fmt.Sprintf("%s\x00%d\x00%d\x00%t\x00%s", filter.EntityType, filter.UpdatedSince.UnixNano(), filter.PageSize, filter.IncludeLocked, pageToken)
+	s.RLock()
+	e, ok := s.pages[pageKey]
+	evictions := s.evictions
+	s.RUnlock()
+	if ok && time.Now().Before(e.expires) {
+		return clonePage(e.page), nil
+	}
+
+	page, err := s.next.ListKeys(ctx, filter, pageToken)
+	if err != nil {
+		return keyservice.KeyPage{}, err
+	}
+	s.Lock()
+	if s.evictions == evictions {
+		s.pages[pageKey] = pageEntry{page: clonePage(page), expires: time.Now().Add(s.ttl)}
+	}
+	s.Unlock()
+	return page, nil
+}
+
+// evict removes any cached record for entityURN and every cached page.
+func (s *Store) evict(entityURN urn.URN) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.entries, entityURN.String())
+	clear(s.pages)
+	s.evictions++
+}
+
+// cloneRecord returns a copy of rec sharing no memory with it.
+func cloneRecord(rec keyservice.KeyRecord) keyservice.KeyRecord {
+	rec.Key = bytes.Clone(rec.Key)
+	rec.Signatures = slices.Clone(rec.Signatures)
+	for i := range rec.Signatures {
+		rec.Signatures[i].Signature = bytes.Clone(rec.Signatures[i].Signature)
+	}
+	return rec
+}
+
+// clonePage returns a copy of page sharing no memory with it.
+func clonePage(page keyservice.KeyPage) keyservice.KeyPage {
+	records := make([]keyservice.KeyRecord, len(page.Records))
+	for i, rec := range page.Records {
+		records[i] = cloneRecord(rec)
+	}
+	page.Records = records
+	return page
+}
@@ -0,0 +1,243 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/storage/cache"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	testURN, err := urn.New(urn.SecureMessaging, "user", "user-123")
+	require.NoError(t, err)
+
+	t.Run("Write on one replica evicts the cached key on another", func(t *testing.T) {
+		// Arrange: two replicas sharing a backing store and invalidation bus.
+		backing := inmemory.New()
+		bus := inmemory.NewInvalidator()
+		replicaA, err := cache.New(ctx, backing, bus, time.Hour)
+		require.NoError(t, err)
+		replicaB, err := cache.New(ctx, backing, bus, time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, replicaA.StoreKey(ctx, testURN, []byte("old-key")))
+		key, err := replicaB.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		require.Equal(t, []byte("old-key"), key)
+
+		// Act: rotate the key through replica A.
+		require.NoError(t, replicaA.StoreKey(ctx, testURN, []byte("new-key")))
+
+		// Assert: replica B serves the fresh key, not its cached copy.
+		key, err = replicaB.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new-key"), key)
+	})
+
+	t.Run("Cached key is served until the TTL expires", func(t *testing.T) {
+		// Arrange: a write that bypasses the cache and its invalidations.
+		backing := inmemory.New()
+		store, err := cache.New(ctx, backing, inmemory.NewInvalidator(), 50*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, backing.StoreKey(ctx, testURN, []byte("old-key")))
+		_, err = store.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		require.NoError(t, backing.StoreKey(ctx, testURN, []byte("new-key")))
+
+		// Act & Assert
+		key, err := store.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("old-key"), key)
+
+		assert.Eventually(t, func() bool {
+			key, err := store.GetKey(ctx, testURN)
+			return err == nil && string(key) == "new-key"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Revoking on one replica evicts the cached key on another", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		bus := inmemory.NewInvalidator()
+		replicaA, err := cache.New(ctx, backing, bus, time.Hour)
+		require.NoError(t, err)
+		replicaB, err := cache.New(ctx, backing, bus, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, replicaA.StoreKey(ctx, testURN, []byte("key")))
+		_, err = replicaB.GetKey(ctx, testURN)
+		require.NoError(t, err)
+
+		// Act
+		require.NoError(t, replicaA.RevokeKey(ctx, testURN))
+
+		// Assert
+		_, err = replicaB.GetKey(ctx, testURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyRevoked)
+	})
+
+	t.Run("Bulk write evicts the stored keys on another replica", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		bus := inmemory.NewInvalidator()
+		replicaA, err := cache.New(ctx, backing, bus, time.Hour)
+		require.NoError(t, err)
+		replicaB, err := cache.New(ctx, backing, bus, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, replicaA.StoreKey(ctx, testURN, []byte("old-key")))
+		_, err = replicaB.GetKey(ctx, testURN)
+		require.NoError(t, err)
+
+		// Act
+		errs := replicaA.StoreKeys(ctx, []keyservice.KeyWrite{{EntityURN: testURN, Key: []byte("new-key")}})
+
+		// Assert
+		assert.Equal(t, []error{nil}, errs)
+		key, err := replicaB.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new-key"), key)
+	})
+
+	t.Run("Keys and records are handed out as copies", func(t *testing.T) {
+		// Arrange
+		store, err := cache.New(ctx, inmemory.New(), inmemory.NewInvalidator(), time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(ctx, testURN, []byte("key")))
+		key, err := store.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		rec, err := store.GetRecord(ctx, testURN)
+		require.NoError(t, err)
+
+		// Act
+		key[0] = 'X'
+		rec.Key[1] = 'X'
+
+		// Assert
+		again, err := store.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("key"), again)
+	})
+
+	t.Run("Records are cached and evicted by lock changes", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		store, err := cache.New(ctx, backing, inmemory.NewInvalidator(), time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, backing.StoreKey(ctx, testURN, []byte("old-key")))
+		_, err = store.GetRecords(ctx, []urn.URN{testURN})
+		require.NoError(t, err)
+		require.NoError(t, backing.StoreKey(ctx, testURN, []byte("new-key")))
+
+		// Act
+		cached, err := store.GetRecord(ctx, testURN)
+		require.NoError(t, err)
+		require.NoError(t, store.SetLocked(ctx, testURN, true))
+		locked, err := store.GetRecords(ctx, []urn.URN{testURN})
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, []byte("old-key"), cached.Key, "served from the cache")
+		require.Len(t, locked, 1)
+		assert.True(t, locked[0].Locked)
+		assert.Equal(t, []byte("new-key"), locked[0].Key)
+	})
+
+	t.Run("A failed invalidation does not fail the write", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		store, err := cache.New(ctx, backing, failingInvalidator{}, time.Hour)
+		require.NoError(t, err)
+
+		// Act
+		err = store.StoreKey(ctx, testURN, []byte("key"))
+		errs := store.StoreKeys(ctx, []keyservice.KeyWrite{{EntityURN: testURN, Key: []byte("next-key")}})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, []error{nil}, errs)
+		key, err := backing.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("next-key"), key)
+	})
+
+	t.Run("Cancelling the context ends the subscription", func(t *testing.T) {
+		// Arrange
+		subCtx, subCancel := context.WithCancel(ctx)
+		backing := inmemory.New()
+		bus := &signallingInvalidator{unsubscribed: make(chan struct{})}
+		store, err := cache.New(subCtx, backing, bus, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, backing.StoreKey(ctx, testURN, []byte("old-key")))
+		_, err = store.GetKey(ctx, testURN)
+		require.NoError(t, err)
+
+		// Act
+		subCancel()
+		require.NoError(t, backing.StoreKey(ctx, testURN, []byte("new-key")))
+		select {
+		case <-bus.unsubscribed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the subscription outlived its context")
+		}
+		require.NoError(t, bus.Publish(ctx, testURN))
+
+		// Assert: the invalidation was no longer delivered.
+		key, err := store.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("old-key"), key)
+	})
+}
+
+// signallingInvalidator is a single-subscriber Invalidator that closes
+// unsubscribed once the subscription's context is cancelled and its handler
+// removed, so tests can wait for it instead of sleeping.
+type signallingInvalidator struct {
+	mu           sync.Mutex
+	fn           func(entityURN urn.URN)
+	unsubscribed chan struct{}
+}
+
+func (i *signallingInvalidator) Publish(ctx context.Context, entityURN urn.URN) error {
+	i.mu.Lock()
+	fn := i.fn
+	i.mu.Unlock()
+	if fn != nil {
+		fn(entityURN)
+	}
+	return nil
+}
+
+func (i *signallingInvalidator) Subscribe(ctx context.Context, fn func(entityURN urn.URN)) error {
+	i.mu.Lock()
+	i.fn = fn
+	i.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		i.mu.Lock()
+		i.fn = nil
+		i.mu.Unlock()
+		close(i.unsubscribed)
+	}()
+	return nil
+}
+
+// failingInvalidator is an Invalidator whose announcements fail.
+type failingInvalidator struct{}
+
+func (failingInvalidator) Publish(ctx context.Context, entityURN urn.URN) error {
+	return errors.New("invalidation bus unavailable")
+}
+
+func (failingInvalidator) Subscribe(ctx context.Context, fn func(entityURN urn.URN)) error {
+	return nil
+}
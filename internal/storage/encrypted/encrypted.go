@@ -0,0 +1,451 @@
+// Package encrypted provides a keyservice.Store decorator that encrypts key
+// material at rest with envelope encryption.
+//
+// Every write generates a fresh 256-bit data key, encrypts the key material
+// with AES-GCM under it, and stores the data key wrapped by a
+// keyservice.KeyEncrypter alongside the ciphertext.
+//
+// The signatures vouching for the key are sealed in the same envelope, as
+// they reveal who signed whose key.
+//
+// Threat model: the decorator protects key material and signatures from
+// anyone who can read the underlying store, its backups or exports, but
+// cannot use the key encryption key. Everything else in a record stays in
+// clear: the entity URN, which is the record's ID, the entity type, the
+// update and revocation times and the lock. So do the device registry,
+// identifier index and audit log, which are separate stores, and the
+// signatures of records written before signatures were sealed, until a
+// Rewrap seals them.
+//
+// The entity URN is bound to the ciphertext as AEAD additional data, so an
+// envelope copied onto another entity's record fails to decrypt rather than
+// serving one entity's key as another's. Someone who can write to the store
+// can still delete records, change the clear fields, or put back an older
+// envelope of the same entity; the decorator does not detect rollback.
+// Whoever holds the key encryption key can decrypt everything.
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// envelopeMagic prefixes every envelope so that records written before
+// encryption was enabled can still be recognised and read.
+var envelopeMagic = []byte("KSENV1:")
+
+// maxConcurrentOpens bounds the envelopes decrypted at once when reading
+// several records, each of which needs its own data key unwrapped.
+const maxConcurrentOpens = 16
+
+// envelope is the serialised form of an encrypted key.
+type envelope struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wdk"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ct"`
+	// Sealed is set when the plaintext is a sealedRecord holding the key
+	// and its signatures. Older envelopes hold the bare key.
+	Sealed bool `json:"sealed,omitempty"`
+}
+
+// sealedRecord is the plaintext of an envelope.
+type sealedRecord struct {
+	Key        []byte            `json:"key"`
+	Signatures []sealedSignature `json:"sigs,omitempty"`
+}
+
+// sealedSignature is the sealed form of a keyservice.KeySignature.
+type sealedSignature struct {
+	SignerURN   string `json:"signer"`
+	SignerKeyID string `json:"kid"`
+	Signature   []byte `json:"sig"`
+}
+
+// Store encrypts keys on their way into the underlying store and decrypts
+// them on the way out.
+type Store struct {
+	next      keyservice.Store
+	encrypter keyservice.KeyEncrypter
+}
+
+// New creates an encrypting Store in front of next.
+func New(next keyservice.Store, encrypter keyservice.KeyEncrypter) *Store {
+	return &Store{next: next, encrypter: encrypter}
+}
+
+// StoreKey encrypts key under a new data key and stores the envelope.
+func (s *Store) StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error {
+	sealed, err := s.seal(ctx, entityURN, key, nil)
+	if err != nil {
+		return err
+	}
+	return s.next.StoreKey(ctx, entityURN, sealed)
+}
+
+// StoreSignedKey encrypts key together with its signatures and stores the
+// envelope. Nothing is stored in the underlying record's signatures.
+func (s *Store) StoreSignedKey(ctx context.Context, entityURN urn.URN, key []byte, signatures []keyservice.KeySignature) error {
+	sealed, err := s.seal(ctx, entityURN, key, signatures)
+	if err != nil {
+		return err
+	}
+	return s.next.StoreSignedKey(ctx, entityURN, sealed, nil)
+}
+
+// StoreKeys encrypts each key under its own data key and stores the
+// envelopes in one batch. Keys that fail to encrypt are not stored.
+func (s *Store) StoreKeys(ctx context.Context, writes []keyservice.KeyWrite) []error {
+	errs := make([]error, len(writes))
+	sealedWrites := make([]keyservice.KeyWrite, 0, len(writes))
+	positions := make([]int, 0, len(writes))
+	for i, write := range writes {
+		sealed, err := s.seal(ctx, write.EntityURN, write.Key, write.Signatures)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		write.Key = sealed
+		write.Signatures = nil
+		sealedWrites = append(sealedWrites, write)
+		positions = append(positions, i)
+	}
+	if len(sealedWrites) == 0 {
+		return errs
+	}
+	for j, err := range s.next.StoreKeys(ctx, sealedWrites) {
+		errs[positions[j]] = err
+	}
+	return errs
+}
+
+// GetKey reads and decrypts the envelope for entityURN. Records stored before
+// encryption was enabled are returned as they are.
+func (s *Store) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error) {
+	stored, err := s.next.GetKey(ctx, entityURN)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := s.open(ctx, keyservice.KeyRecord{EntityURN: entityURN, Key: stored})
+	if err != nil {
+		return nil, err
+	}
+	return rec.Key, nil
+}
+
+// GetRecord reads the underlying record and decrypts its key and
+// signatures, if any.
+func (s *Store) GetRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	rec, err := s.next.GetRecord(ctx, entityURN)
+	if err != nil {
+		return rec, err
+	}
+	return s.open(ctx, rec)
+}
+
+// GetRecords reads the underlying records and decrypts them concurrently.
+func (s *Store) GetRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, error) {
+	records, err := s.next.GetRecords(ctx, entityURNs)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.openAll(ctx, records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// RevokeKey revokes the key in the underlying store.
+func (s *Store) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	return s.next.RevokeKey(ctx, entityURN)
+}
+
+// SetLocked locks or unlocks the entity in the underlying store.
+func (s *Store) SetLocked(ctx context.Context, entityURN urn.URN, locked bool) error {
+	return s.next.SetLocked(ctx, entityURN, locked)
+}
+
+// ReplaceRecord encrypts rec's key and signatures and replaces the
+// underlying record. As
+// envelopes are sealed under fresh data keys, previousKey is compared with
+// the decrypted stored key, and the replacement is conditional on the
+// envelope it was decrypted from.
+func (s *Store) ReplaceRecord(ctx context.Context, rec keyservice.KeyRecord, previousKey []byte) error {
+	var previousEnvelope []byte
+	if previousKey != nil {
+		current, err := s.next.GetRecord(ctx, rec.EntityURN)
+		if err != nil && !errors.Is(err, keyservice.ErrKeyNotFound) {
+			return err
+		}
+		stored, err := s.open(ctx, keyservice.KeyRecord{EntityURN: rec.EntityURN, Key: current.Key})
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(stored.Key, previousKey) {
+			return fmt.Errorf("entity %s: %w", rec.EntityURN.String(), keyservice.ErrKeyChanged)
+		}
+		previousEnvelope = current.Key
+		if previousEnvelope == nil {
+			previousEnvelope = []byte{}
+		}
+	}
+	// A lock-only record has no key to seal.
+	if len(rec.Key) > 0 {
+		sealed, err := s.seal(ctx, rec.EntityURN, rec.Key, rec.Signatures)
+		if err != nil {
+			return err
+		}
+		rec.Key = sealed
+		rec.Signatures = nil
+	}
+	return s.next.ReplaceRecord(ctx, rec, previousEnvelope)
+}
+
+// ListKeys lists the underlying records and decrypts them concurrently.
+func (s *Store) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	page, err := s.next.ListKeys(ctx, filter, pageToken)
+	if err != nil {
+		return keyservice.KeyPage{}, err
+	}
+	if err := s.openAll(ctx, page.Records); err != nil {
+		return keyservice.KeyPage{}, err
+	}
+	return page, nil
+}
+
+// RewrapReport summarises a Rewrap run.
+type RewrapReport struct {
+	Scanned   int
+	Rewrapped int
+	Encrypted int
+}
+
+// Rewrap walks every record and re-wraps data keys that are not wrapped by
+// the encrypter's primary key, which completes a key encryption key rotation.
+// The key ciphertext itself is left untouched. Records stored in clear before
+// encryption was enabled are encrypted, and so are the signatures of records
+// written before signatures were sealed.
+func (s *Store) Rewrap(ctx context.Context) (RewrapReport, error) {
+	var report RewrapReport
+	primaryKeyID, err := s.encrypter.PrimaryKeyID(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to resolve primary key: %w", err)
+	}
+
+	pageToken := ""
+	for {
+		page, err := s.next.ListKeys(ctx, keyservice.ListFilter{}, pageToken)
+		if err != nil {
+			return report, err
+		}
+		for _, rec := range page.Records {
+			report.Scanned++
+			env, ok, err := decodeEnvelope(rec.Key)
+			if err != nil {
+				return report, fmt.Errorf("corrupt envelope for entity %s: %w", rec.EntityURN.String(), err)
+			}
+
+			var sealed []byte
+			switch {
+			case !ok || len(rec.Signatures) > 0:
+				var opened keyservice.KeyRecord
+				if opened, err = s.open(ctx, rec); err == nil {
+					sealed, err = s.seal(ctx, rec.EntityURN, opened.Key, opened.Signatures)
+				}
+				report.Encrypted++
+			case env.KeyID != primaryKeyID:
+				sealed, err = s.rewrap(ctx, env)
+				report.Rewrapped++
+			default:
+				continue
+			}
+			if err != nil {
+				return report, fmt.Errorf("failed to re-encrypt entity %s: %w", rec.EntityURN.String(), err)
+			}
+			// The swap only happens if the envelope was not replaced
+			// meanwhile; a newer upload is already sealed for the primary
+			// key and is left alone.
+			replacement := rec
+			replacement.Key = sealed
+			replacement.Signatures = nil
+			if err := s.next.ReplaceRecord(ctx, replacement, rec.Key); err != nil && !errors.Is(err, keyservice.ErrKeyChanged) {
+				return report, fmt.Errorf("failed to replace envelope for entity %s: %w", rec.EntityURN.String(), err)
+			}
+		}
+		if page.NextPageToken == "" {
+			return report, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// seal encrypts key and its signatures under a new data key.
+func (s *Store) seal(ctx context.Context, entityURN urn.URN, key []byte, signatures []keyservice.KeySignature) ([]byte, error) {
+	plaintext := sealedRecord{Key: key}
+	for _, sig := range signatures {
+		plaintext.Signatures = append(plaintext.Signatures, sealedSignature{SignerURN: sig.SignerURN.String(), SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+	}
+	data, err := json.Marshal(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key for entity %s: %w", entityURN.String(), err)
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	wrapped, keyID, err := s.encrypter.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key for entity %s: %w", entityURN.String(), err)
+	}
+	return encodeEnvelope(envelope{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, data, additionalData(entityURN)),
+		Sealed:     true,
+	})
+}
+
+// open returns rec with its key and signatures decrypted. Records stored
+// before encryption was enabled, and signatures stored before they were
+// sealed, are returned as they are.
+func (s *Store) open(ctx context.Context, rec keyservice.KeyRecord) (keyservice.KeyRecord, error) {
+	entityKey := rec.EntityURN.String()
+	env, ok, err := decodeEnvelope(rec.Key)
+	if err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("corrupt envelope for entity %s: %w", entityKey, err)
+	}
+	if !ok {
+		return rec, nil
+	}
+
+	dataKey, err := s.encrypter.UnwrapKey(ctx, env.KeyID, env.WrappedKey)
+	if err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("failed to unwrap data key for entity %s: %w", entityKey, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return keyservice.KeyRecord{}, err
+	}
+	data, err := aead.Open(nil, env.Nonce, env.Ciphertext, additionalData(rec.EntityURN))
+	if err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("failed to decrypt key for entity %s: %w", entityKey, err)
+	}
+	if !env.Sealed {
+		rec.Key = data
+		return rec, nil
+	}
+
+	var plaintext sealedRecord
+	if err := json.Unmarshal(data, &plaintext); err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("corrupt envelope for entity %s: %w", entityKey, err)
+	}
+	rec.Key = plaintext.Key
+	rec.Signatures = nil
+	for _, sig := range plaintext.Signatures {
+		signerURN, err := urn.Parse(sig.SignerURN)
+		if err != nil {
+			return keyservice.KeyRecord{}, fmt.Errorf("corrupt signature for entity %s: %w", entityKey, err)
+		}
+		rec.Signatures = append(rec.Signatures, keyservice.KeySignature{SignerURN: signerURN, SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+	}
+	return rec, nil
+}
+
+// openAll decrypts records in place, up to maxConcurrentOpens at a time.
+func (s *Store) openAll(ctx context.Context, records []keyservice.KeyRecord) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, maxConcurrentOpens)
+	for i := range records {
+		if len(records[i].Key) == 0 {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			opened, err := s.open(ctx, records[i])
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			records[i] = opened
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (s *Store) rewrap(ctx context.Context, env envelope) ([]byte, error) {
+	dataKey, err := s.encrypter.UnwrapKey(ctx, env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	env.WrappedKey, env.KeyID, err = s.encrypter.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return encodeEnvelope(env)
+}
+
+// additionalData binds a ciphertext to the entity whose record holds it.
+func additionalData(entityURN urn.URN) []byte {
+	return []byte(entityURN.String())
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AES key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func encodeEnvelope(env envelope) ([]byte, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode envelope: %w", err)
+	}
+	return append(append([]byte{}, envelopeMagic...), data...), nil
+}
+
+// decodeEnvelope reports ok=false for data that is not an envelope.
+func decodeEnvelope(data []byte) (envelope, bool, error) {
+	var env envelope
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return env, false, nil
+	}
+	if err := json.Unmarshal(data[len(envelopeMagic):], &env); err != nil {
+		return env, true, err
+	}
+	return env, true, nil
+}
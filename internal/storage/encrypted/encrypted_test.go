@@ -0,0 +1,291 @@
+package encrypted_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/storage/encrypted"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// racingStore stores replacement for entityURN right after the first
+// listing, like an upload landing while Rewrap runs.
+type racingStore struct {
+	keyservice.Store
+	entityURN   urn.URN
+	replacement []byte
+	raced       bool
+}
+
+func (r *racingStore) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	page, err := r.Store.ListKeys(ctx, filter, pageToken)
+	if err == nil && !r.raced {
+		r.raced = true
+		err = r.Store.StoreKey(ctx, r.entityURN, r.replacement)
+	}
+	return page, err
+}
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	publicKey := []byte("alice-public-key")
+
+	keyring := map[string][]byte{"k1": newKey(t)}
+	encrypter, err := encrypted.NewLocalKeyEncrypter("k1", keyring)
+	require.NoError(t, err)
+
+	t.Run("Key is encrypted at rest and decrypted on read", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		store := encrypted.New(backing, encrypter)
+
+		// Act
+		require.NoError(t, store.StoreKey(ctx, aliceURN, publicKey))
+		atRest, err := backing.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		retrieved, err := store.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		page, err := store.ListKeys(ctx, keyservice.ListFilter{}, "")
+		require.NoError(t, err)
+
+		// Assert
+		assert.False(t, bytes.Contains(atRest, publicKey))
+		assert.Equal(t, publicKey, retrieved)
+		require.Len(t, page.Records, 1)
+		assert.Equal(t, publicKey, page.Records[0].Key)
+	})
+
+	t.Run("Bulk writes encrypt each key", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		store := encrypted.New(backing, encrypter)
+		require.NoError(t, backing.SetLocked(ctx, bobURN, true))
+
+		// Act
+		errs := store.StoreKeys(ctx, []keyservice.KeyWrite{
+			{EntityURN: aliceURN, Key: publicKey},
+			{EntityURN: bobURN, Key: []byte("bob-public-key")},
+		})
+		atRest, err := backing.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		retrieved, err := store.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+
+		// Assert
+		require.Len(t, errs, 2)
+		assert.NoError(t, errs[0])
+		assert.ErrorIs(t, errs[1], keyservice.ErrEntityLocked)
+		assert.False(t, bytes.Contains(atRest, publicKey))
+		assert.Equal(t, publicKey, retrieved)
+	})
+
+	t.Run("Envelope moved to another entity fails to decrypt", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		store := encrypted.New(backing, encrypter)
+		require.NoError(t, store.StoreKey(ctx, aliceURN, publicKey))
+		atRest, err := backing.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		require.NoError(t, backing.StoreKey(ctx, bobURN, atRest))
+
+		// Act
+		_, err = store.GetKey(ctx, bobURN)
+
+		// Assert
+		assert.Error(t, err)
+	})
+
+	t.Run("Rewrap moves envelopes to the new primary key and encrypts legacy records", func(t *testing.T) {
+		// Arrange: one record under k1 and one stored before encryption.
+		backing := inmemory.New()
+		require.NoError(t, encrypted.New(backing, encrypter).StoreKey(ctx, aliceURN, publicKey))
+		require.NoError(t, backing.StoreKey(ctx, bobURN, []byte("bob-legacy-key")))
+
+		k2 := newKey(t)
+		rotated, err := encrypted.NewLocalKeyEncrypter("k2", map[string][]byte{"k1": keyring["k1"], "k2": k2})
+		require.NoError(t, err)
+		store := encrypted.New(backing, rotated)
+
+		// Act
+		report, err := store.Rewrap(ctx)
+		require.NoError(t, err)
+
+		// Assert: both records now decrypt with k2 alone.
+		assert.Equal(t, encrypted.RewrapReport{Scanned: 2, Rewrapped: 1, Encrypted: 1}, report)
+		k2Only, err := encrypted.NewLocalKeyEncrypter("k2", map[string][]byte{"k2": k2})
+		require.NoError(t, err)
+		reader := encrypted.New(backing, k2Only)
+		key, err := reader.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		assert.Equal(t, publicKey, key)
+		key, err = reader.GetKey(ctx, bobURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("bob-legacy-key"), key)
+
+		again, err := store.Rewrap(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, encrypted.RewrapReport{Scanned: 2}, again)
+	})
+
+	t.Run("Signatures are sealed with the key and kept by Rewrap", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		signatures := []keyservice.KeySignature{{SignerURN: bobURN, SignerKeyID: "bob-key-id", Signature: []byte("sig")}}
+		require.NoError(t, encrypted.New(backing, encrypter).StoreSignedKey(ctx, aliceURN, publicKey, signatures))
+
+		rotated, err := encrypted.NewLocalKeyEncrypter("k2", map[string][]byte{"k1": keyring["k1"], "k2": newKey(t)})
+		require.NoError(t, err)
+		store := encrypted.New(backing, rotated)
+
+		// Act
+		_, err = store.Rewrap(ctx)
+		require.NoError(t, err)
+		rec, err := store.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+		raw, err := backing.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, publicKey, rec.Key)
+		assert.Equal(t, signatures, rec.Signatures)
+		assert.Empty(t, raw.Signatures)
+		assert.NotContains(t, string(raw.Key), bobURN.String(), "the signer is not readable at rest")
+	})
+
+	t.Run("Rewrap seals signatures stored in clear", func(t *testing.T) {
+		// Arrange: a record stored before encryption was enabled.
+		backing := inmemory.New()
+		signatures := []keyservice.KeySignature{{SignerURN: bobURN, SignerKeyID: "bob-key-id", Signature: []byte("sig")}}
+		require.NoError(t, backing.StoreSignedKey(ctx, aliceURN, []byte("alice-legacy-key"), signatures))
+		store := encrypted.New(backing, encrypter)
+
+		// Act
+		report, err := store.Rewrap(ctx)
+		require.NoError(t, err)
+		rec, err := store.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+		raw, err := backing.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, 1, report.Encrypted)
+		assert.Equal(t, []byte("alice-legacy-key"), rec.Key)
+		assert.Equal(t, signatures, rec.Signatures)
+		assert.Empty(t, raw.Signatures)
+	})
+
+	t.Run("GetRecords decrypts every record", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		store := encrypted.New(backing, encrypter)
+		var entityURNs []urn.URN
+		for i := 0; i < 40; i++ {
+			entityURN, err := urn.New(urn.SecureMessaging, "user", fmt.Sprintf("user-%02d", i))
+			require.NoError(t, err)
+			require.NoError(t, store.StoreKey(ctx, entityURN, []byte(fmt.Sprintf("key-%02d", i))))
+			entityURNs = append(entityURNs, entityURN)
+		}
+		missingURN, err := urn.New(urn.SecureMessaging, "user", "missing")
+		require.NoError(t, err)
+		entityURNs = append(entityURNs, missingURN)
+
+		// Act
+		records, err := store.GetRecords(ctx, entityURNs)
+		require.NoError(t, err)
+
+		// Assert
+		require.Len(t, records, 41)
+		for i, rec := range records[:40] {
+			assert.Equal(t, []byte(fmt.Sprintf("key-%02d", i)), rec.Key)
+		}
+		assert.Empty(t, records[40].Key)
+	})
+
+	t.Run("Rewrap keeps revocation and locks", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		require.NoError(t, encrypted.New(backing, encrypter).StoreKey(ctx, aliceURN, publicKey))
+		require.NoError(t, backing.RevokeKey(ctx, aliceURN))
+		require.NoError(t, backing.SetLocked(ctx, aliceURN, true))
+
+		rotated, err := encrypted.NewLocalKeyEncrypter("k2", map[string][]byte{"k1": keyring["k1"], "k2": newKey(t)})
+		require.NoError(t, err)
+		store := encrypted.New(backing, rotated)
+
+		// Act
+		report, err := store.Rewrap(ctx)
+		require.NoError(t, err)
+		rec, err := store.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, 1, report.Rewrapped)
+		assert.Equal(t, publicKey, rec.Key)
+		assert.True(t, rec.Revoked)
+		assert.True(t, rec.Locked)
+	})
+
+	t.Run("Rewrap leaves keys uploaded meanwhile alone", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		require.NoError(t, encrypted.New(backing, encrypter).StoreKey(ctx, aliceURN, publicKey))
+		rotated, err := encrypted.NewLocalKeyEncrypter("k2", map[string][]byte{"k1": keyring["k1"], "k2": newKey(t)})
+		require.NoError(t, err)
+		sealed := inmemory.New()
+		require.NoError(t, encrypted.New(sealed, rotated).StoreKey(ctx, aliceURN, []byte("alice-new-key")))
+		uploaded, err := sealed.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		store := encrypted.New(&racingStore{Store: backing, entityURN: aliceURN, replacement: uploaded}, rotated)
+
+		// Act
+		_, err = store.Rewrap(ctx)
+		require.NoError(t, err)
+		key, err := store.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, []byte("alice-new-key"), key, "the older envelope is not written back")
+	})
+
+	t.Run("ReplaceRecord only replaces the expected key", func(t *testing.T) {
+		// Arrange
+		backing := inmemory.New()
+		store := encrypted.New(backing, encrypter)
+		require.NoError(t, store.StoreKey(ctx, aliceURN, publicKey))
+		replacement := keyservice.KeyRecord{EntityURN: aliceURN, Key: []byte("alice-new-key"), Locked: true}
+
+		// Act
+		stale := store.ReplaceRecord(ctx, replacement, []byte("some-other-key"))
+		current := store.ReplaceRecord(ctx, replacement, publicKey)
+
+		// Assert
+		assert.ErrorIs(t, stale, keyservice.ErrKeyChanged)
+		require.NoError(t, current)
+		rec, err := store.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-new-key"), rec.Key)
+		assert.True(t, rec.Locked)
+		raw, err := backing.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+		assert.NotContains(t, string(raw.Key), "alice-new-key", "the replacement is encrypted")
+	})
+}
@@ -0,0 +1,52 @@
+package encrypted
+
+import (
+	"context"
+	"fmt"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+)
+
+// KMSKeyEncrypter is a keyservice.KeyEncrypter backed by a Cloud KMS
+// symmetric crypto key. Rotation is managed in KMS: once a new primary
+// version exists, a re-wrap moves every envelope onto it.
+type KMSKeyEncrypter struct {
+	client  *kms.KeyManagementClient
+	keyName string
+}
+
+// NewKMSKeyEncrypter creates a KMSKeyEncrypter for the crypto key keyName,
+// of the form projects/P/locations/L/keyRings/R/cryptoKeys/K.
+func NewKMSKeyEncrypter(client *kms.KeyManagementClient, keyName string) *KMSKeyEncrypter {
+	return &KMSKeyEncrypter{client: client, keyName: keyName}
+}
+
+// WrapKey encrypts dataKey with the crypto key's primary version and returns
+// the name of that version.
+func (k *KMSKeyEncrypter) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	resp, err := k.client.Encrypt(ctx, &kmspb.EncryptRequest{Name: k.keyName, Plaintext: dataKey})
+	if err != nil {
+		return nil, "", fmt.Errorf("kms encrypt failed: %w", err)
+	}
+	return resp.GetCiphertext(), resp.GetName(), nil
+}
+
+// UnwrapKey decrypts a wrapped data key. KMS identifies the version from the
+// ciphertext itself, so keyID is only used for bookkeeping.
+func (k *KMSKeyEncrypter) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	resp, err := k.client.Decrypt(ctx, &kmspb.DecryptRequest{Name: k.keyName, Ciphertext: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt with %s failed: %w", keyID, err)
+	}
+	return resp.GetPlaintext(), nil
+}
+
+// PrimaryKeyID returns the name of the crypto key's primary version.
+func (k *KMSKeyEncrypter) PrimaryKeyID(ctx context.Context) (string, error) {
+	cryptoKey, err := k.client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: k.keyName})
+	if err != nil {
+		return "", fmt.Errorf("kms get crypto key failed: %w", err)
+	}
+	return cryptoKey.GetPrimary().GetName(), nil
+}
@@ -0,0 +1,89 @@
+package encrypted
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// keyringFile is the on-disk format read by LoadLocalKeyEncrypter:
+//
+//	{"primary": "2025-06", "keys": {"2025-01": "<base64>", "2025-06": "<base64>"}}
+//
+// Each key is 32 random bytes. Rotating means adding a key, making it the
+// primary, and running a re-wrap; old keys must stay until that completes.
+type keyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// LocalKeyEncrypter is a keyservice.KeyEncrypter backed by a local keyring of
+// AES-256 key encryption keys.
+type LocalKeyEncrypter struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewLocalKeyEncrypter creates a LocalKeyEncrypter that wraps with the key
+// named primary and can unwrap with any key in keys.
+func NewLocalKeyEncrypter(primary string, keys map[string][]byte) (*LocalKeyEncrypter, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+	for keyID, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", keyID, len(key))
+		}
+	}
+	return &LocalKeyEncrypter{primary: primary, keys: keys}, nil
+}
+
+// LoadLocalKeyEncrypter reads a JSON keyring file.
+func LoadLocalKeyEncrypter(path string) (*LocalKeyEncrypter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring at %s: %w", path, err)
+	}
+	var kf keyringFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring at %s: %w", path, err)
+	}
+	return NewLocalKeyEncrypter(kf.Primary, kf.Keys)
+}
+
+// WrapKey encrypts dataKey with the primary key using AES-GCM.
+func (l *LocalKeyEncrypter) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	aead, err := newAEAD(l.keys[l.primary])
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(l.primary)), l.primary, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by the keyring key named keyID.
+func (l *LocalKeyEncrypter) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := l.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q is not in the keyring", keyID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(keyID))
+}
+
+// PrimaryKeyID returns the name of the primary keyring key.
+func (l *LocalKeyEncrypter) PrimaryKeyID(ctx context.Context) (string, error) {
+	return l.primary, nil
+}
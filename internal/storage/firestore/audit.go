@@ -0,0 +1,181 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// auditHeadID is the document holding the latest event of the chain. It has
+// no sequence field, so it never appears in List queries.
+const auditHeadID = "_head"
+
+// auditDocument is the structure stored in a Firestore document keyed by
+// the zero-padded event sequence.
+type auditDocument struct {
+	Sequence       int64     `firestore:"sequence"`
+	Time           time.Time `firestore:"time"`
+	Action         string    `firestore:"action"`
+	Actor          string    `firestore:"actor"`
+	EntityURN      string    `firestore:"entityUrn,omitempty"`
+	OldFingerprint string    `firestore:"oldFingerprint,omitempty"`
+	NewFingerprint string    `firestore:"newFingerprint,omitempty"`
+	ClientIP       string    `firestore:"clientIp,omitempty"`
+	ForwardedFor   string    `firestore:"forwardedFor,omitempty"`
+	RequestID      string    `firestore:"requestId,omitempty"`
+	Outcome        string    `firestore:"outcome"`
+	Error          string    `firestore:"error,omitempty"`
+	PrevHash       string    `firestore:"prevHash"`
+	Hash           string    `firestore:"hash"`
+}
+
+// auditHead points at the latest event of the chain.
+type auditHead struct {
+	Sequence int64  `firestore:"lastSequence"`
+	Hash     string `firestore:"lastHash"`
+}
+
+// maxAuditEventsPerTransaction bounds the events AppendAll writes in one
+// transaction, keeping each commit well inside Firestore's limits.
+const maxAuditEventsPerTransaction = 250
+
+// AuditSink is an implementation of the keyservice.AuditSink interface
+// using Firestore. Appends run in transactions on a single head document,
+// which serializes them; that caps the sustained rate at roughly one
+// transaction per second, so bulk uploads append their events together with
+// AppendAll.
+type AuditSink struct {
+	client     *firestore.Client
+	collection *firestore.CollectionRef
+}
+
+// NewAuditSink creates a new Firestore-backed audit sink.
+func NewAuditSink(client *firestore.Client, collectionName string) *AuditSink {
+	return &AuditSink{
+		client:     client,
+		collection: client.Collection(collectionName),
+	}
+}
+
+// Append links event to the end of the chain and stores it.
+func (s *AuditSink) Append(ctx context.Context, event keyservice.AuditEvent) (keyservice.AuditEvent, error) {
+	stored, err := s.AppendAll(ctx, []keyservice.AuditEvent{event})
+	if err != nil {
+		return keyservice.AuditEvent{}, err
+	}
+	return stored[0], nil
+}
+
+// AppendAll links events to the end of the chain, writing up to
+// maxAuditEventsPerTransaction of them and the head in each transaction.
+func (s *AuditSink) AppendAll(ctx context.Context, events []keyservice.AuditEvent) ([]keyservice.AuditEvent, error) {
+	stored := make([]keyservice.AuditEvent, 0, len(events))
+	for start := 0; start < len(events); start += maxAuditEventsPerTransaction {
+		chunk, err := s.appendChunk(ctx, events[start:min(start+maxAuditEventsPerTransaction, len(events))])
+		if err != nil {
+			return stored, fmt.Errorf("failed to append audit event: %w", err)
+		}
+		stored = append(stored, chunk...)
+	}
+	return stored, nil
+}
+
+// appendChunk links events to the end of the chain in one transaction.
+func (s *AuditSink) appendChunk(ctx context.Context, events []keyservice.AuditEvent) ([]keyservice.AuditEvent, error) {
+	headRef := s.collection.Doc(auditHeadID)
+	var stored []keyservice.AuditEvent
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var head auditHead
+		doc, err := tx.Get(headRef)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			if err := doc.DataTo(&head); err != nil {
+				return err
+			}
+		}
+
+		stored = make([]keyservice.AuditEvent, 0, len(events))
+		prev := keyservice.AuditEvent{Sequence: uint64(head.Sequence), Hash: head.Hash}
+		for _, event := range events {
+			prev = keyservice.ChainAuditEvent(prev, event)
+			if err := tx.Create(s.collection.Doc(auditEventID(prev.Sequence)), newAuditDocument(prev)); err != nil {
+				return err
+			}
+			stored = append(stored, prev)
+		}
+		return tx.Set(headRef, auditHead{Sequence: int64(prev.Sequence), Hash: prev.Hash})
+	})
+	return stored, err
+}
+
+// List returns up to limit events after afterSequence.
+func (s *AuditSink) List(ctx context.Context, afterSequence uint64, limit int) ([]keyservice.AuditEvent, error) {
+	query := s.collection.Where("sequence", ">", int64(afterSequence)).OrderBy("sequence", firestore.Asc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	events := make([]keyservice.AuditEvent, 0, len(docs))
+	for _, doc := range docs {
+		var ad auditDocument
+		if err := doc.DataTo(&ad); err != nil {
+			return nil, fmt.Errorf("failed to decode audit event %s: %w", doc.Ref.ID, err)
+		}
+		events = append(events, ad.auditEvent())
+	}
+	return events, nil
+}
+
+// auditEventID zero-pads the sequence so document IDs sort in chain order.
+func auditEventID(sequence uint64) string {
+	return fmt.Sprintf("%020d", sequence)
+}
+
+func newAuditDocument(e keyservice.AuditEvent) auditDocument {
+	return auditDocument{
+		Sequence:       int64(e.Sequence),
+		Time:           e.Time,
+		Action:         e.Action,
+		Actor:          e.Actor,
+		EntityURN:      e.EntityURN,
+		OldFingerprint: e.OldFingerprint,
+		NewFingerprint: e.NewFingerprint,
+		ClientIP:       e.ClientIP,
+		ForwardedFor:   e.ForwardedFor,
+		RequestID:      e.RequestID,
+		Outcome:        e.Outcome,
+		Error:          e.Error,
+		PrevHash:       e.PrevHash,
+		Hash:           e.Hash,
+	}
+}
+
+func (d auditDocument) auditEvent() keyservice.AuditEvent {
+	return keyservice.AuditEvent{
+		Sequence:       uint64(d.Sequence),
+		Time:           d.Time.UTC(),
+		Action:         d.Action,
+		Actor:          d.Actor,
+		EntityURN:      d.EntityURN,
+		OldFingerprint: d.OldFingerprint,
+		NewFingerprint: d.NewFingerprint,
+		ClientIP:       d.ClientIP,
+		ForwardedFor:   d.ForwardedFor,
+		RequestID:      d.RequestID,
+		Outcome:        d.Outcome,
+		Error:          d.Error,
+		PrevHash:       d.PrevHash,
+		Hash:           d.Hash,
+	}
+}
@@ -0,0 +1,54 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	fsAdaper "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-test/emulators"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirestoreAuditSink_Integration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	const projectID = "test-project-audit"
+	firestoreConn := emulators.SetupFirestoreEmulator(t, ctx, emulators.GetDefaultFirestoreConfig(projectID))
+	fsClient, err := firestore.NewClient(context.Background(), projectID, firestoreConn.ClientOptions...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = fsClient.Close() })
+	sink := fsAdaper.NewAuditSink(fsClient, "audit-log")
+
+	// Act: append one event, then two together
+	_, err = sink.Append(ctx, keyservice.AuditEvent{Action: "keys:write", Actor: "admin-1", Time: time.Now()})
+	require.NoError(t, err)
+	appended, err := sink.AppendAll(ctx, []keyservice.AuditEvent{
+		{Action: "admin:revoke", Actor: "admin-1", Time: time.Now()},
+		{Action: "admin:lock", Actor: "admin-1", Time: time.Now()},
+	})
+	require.NoError(t, err)
+	require.Len(t, appended, 2)
+
+	// Assert: the events read back in order and still verify
+	events, err := sink.List(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	var prev keyservice.AuditEvent
+	for _, event := range events {
+		assert.NoError(t, keyservice.VerifyAuditEvent(prev, event))
+		prev = event
+	}
+
+	rest, err := sink.List(ctx, 2, 10)
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	assert.Equal(t, "admin:lock", rest[0].Action)
+	assert.Equal(t, events[1:], appended)
+}
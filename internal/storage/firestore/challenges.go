@@ -0,0 +1,84 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// challengeDocument is the structure stored in a Firestore document keyed
+// by the nonce. Configure a Firestore TTL policy on expiresAt to delete
+// challenges that are never redeemed.
+type challengeDocument struct {
+	EntityURN string    `firestore:"entityUrn"`
+	ExpiresAt time.Time `firestore:"expiresAt"`
+}
+
+// ChallengeStore is an implementation of the keyservice.ChallengeStore
+// interface using Firestore, so challenges can be redeemed on any replica.
+type ChallengeStore struct {
+	client     *firestore.Client
+	collection *firestore.CollectionRef
+}
+
+// NewChallengeStore creates a new Firestore-backed challenge store.
+func NewChallengeStore(client *firestore.Client, collectionName string) *ChallengeStore {
+	return &ChallengeStore{
+		client:     client,
+		collection: client.Collection(collectionName),
+	}
+}
+
+// Issue creates a random challenge for entityURN valid for ttl.
+func (s *ChallengeStore) Issue(ctx context.Context, entityURN urn.URN, ttl time.Duration) (keyservice.Challenge, error) {
+	nonce, err := keyservice.NewNonce()
+	if err != nil {
+		return keyservice.Challenge{}, err
+	}
+	challenge := keyservice.Challenge{Nonce: nonce, EntityURN: entityURN, ExpiresAt: time.Now().Add(ttl).UTC()}
+	_, err = s.collection.Doc(nonce).Create(ctx, challengeDocument{EntityURN: entityURN.String(), ExpiresAt: challenge.ExpiresAt})
+	if err != nil {
+		return keyservice.Challenge{}, fmt.Errorf("failed to issue challenge for entity %s: %w", entityURN.String(), err)
+	}
+	return challenge, nil
+}
+
+// Consume redeems the challenge once, deleting it in the same transaction
+// that checks it.
+func (s *ChallengeStore) Consume(ctx context.Context, entityURN urn.URN, nonce string) error {
+	invalid := fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrChallengeInvalid)
+	if !keyservice.ValidNonce(nonce) {
+		return invalid
+	}
+	ref := s.collection.Doc(nonce)
+	var valid bool
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		valid = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var cd challengeDocument
+		if err := doc.DataTo(&cd); err != nil {
+			return err
+		}
+		valid = cd.EntityURN == entityURN.String() && time.Now().Before(cd.ExpiresAt)
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to consume challenge: %w", err)
+	}
+	if !valid {
+		return invalid
+	}
+	return nil
+}
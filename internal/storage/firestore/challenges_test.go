@@ -0,0 +1,49 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	fsAdaper "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/illmade-knight/go-test/emulators"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirestoreChallengeStore_Integration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	const projectID = "test-project-challenges"
+	firestoreConn := emulators.SetupFirestoreEmulator(t, ctx, emulators.GetDefaultFirestoreConfig(projectID))
+	fsClient, err := firestore.NewClient(context.Background(), projectID, firestoreConn.ClientOptions...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = fsClient.Close() })
+	store := fsAdaper.NewChallengeStore(fsClient, "key-challenges")
+
+	// Arrange
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+
+	// Act & Assert: A challenge is redeemed once
+	challenge, err := store.Issue(ctx, alice, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, store.Consume(ctx, alice, challenge.Nonce))
+	assert.ErrorIs(t, store.Consume(ctx, alice, challenge.Nonce), keyservice.ErrChallengeInvalid)
+
+	// Act & Assert: A challenge cannot be redeemed for another entity
+	challenge, err = store.Issue(ctx, alice, time.Minute)
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.Consume(ctx, bob, challenge.Nonce), keyservice.ErrChallengeInvalid)
+
+	// Act & Assert: Malformed nonces are rejected without a lookup
+	assert.ErrorIs(t, store.Consume(ctx, alice, "a/b"), keyservice.ErrChallengeInvalid)
+}
@@ -0,0 +1,133 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deviceDocument is the structure stored in a Firestore document keyed by
+// the device URN.
+type deviceDocument struct {
+	Owner      string    `firestore:"owner"`
+	EnrolledAt time.Time `firestore:"enrolledAt"`
+}
+
+// DeviceRegistry is an implementation of the keyservice.DeviceRegistry
+// interface using Firestore. Ownership changes run in transactions so two
+// owners cannot enroll the same device concurrently.
+type DeviceRegistry struct {
+	client     *firestore.Client
+	collection *firestore.CollectionRef
+}
+
+// NewDeviceRegistry creates a new Firestore-backed device registry.
+func NewDeviceRegistry(client *firestore.Client, collectionName string) *DeviceRegistry {
+	return &DeviceRegistry{
+		client:     client,
+		collection: client.Collection(collectionName),
+	}
+}
+
+// EnrollDevice records owner as the owner of device.
+func (r *DeviceRegistry) EnrollDevice(ctx context.Context, owner, device urn.URN) error {
+	ref := r.collection.Doc(device.String())
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, found, err := getDevice(tx, ref)
+		if err != nil {
+			return err
+		}
+		if found {
+			if current.Owner != owner.String() {
+				return fmt.Errorf("device %s: %w", device.String(), keyservice.ErrDeviceOwnedByOther)
+			}
+			return nil
+		}
+		return tx.Set(ref, deviceDocument{Owner: owner.String(), EnrolledAt: time.Now().UTC()})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enroll device %s: %w", device.String(), err)
+	}
+	return nil
+}
+
+// UnenrollDevice removes owner's ownership of device.
+func (r *DeviceRegistry) UnenrollDevice(ctx context.Context, owner, device urn.URN) error {
+	ref := r.collection.Doc(device.String())
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, found, err := getDevice(tx, ref)
+		if err != nil {
+			return err
+		}
+		if !found || current.Owner != owner.String() {
+			return fmt.Errorf("device %s for owner %s: %w", device.String(), owner.String(), keyservice.ErrDeviceNotEnrolled)
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unenroll device %s: %w", device.String(), err)
+	}
+	return nil
+}
+
+// OwnerOf returns the owner of device.
+func (r *DeviceRegistry) OwnerOf(ctx context.Context, device urn.URN) (urn.URN, error) {
+	doc, err := r.collection.Doc(device.String()).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return urn.URN{}, fmt.Errorf("device %s: %w", device.String(), keyservice.ErrDeviceNotEnrolled)
+		}
+		return urn.URN{}, fmt.Errorf("failed to get owner of device %s: %w", device.String(), err)
+	}
+	var dd deviceDocument
+	if err := doc.DataTo(&dd); err != nil {
+		return urn.URN{}, fmt.Errorf("failed to decode device %s: %w", device.String(), err)
+	}
+	owner, err := urn.Parse(dd.Owner)
+	if err != nil {
+		return urn.URN{}, fmt.Errorf("device %s has an invalid owner URN: %w", device.String(), err)
+	}
+	return owner, nil
+}
+
+// ListDevices returns owner's devices ordered by URN.
+func (r *DeviceRegistry) ListDevices(ctx context.Context, owner urn.URN) ([]urn.URN, error) {
+	docs, err := r.collection.Where("owner", "==", owner.String()).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices of %s: %w", owner.String(), err)
+	}
+	devices := make([]urn.URN, 0, len(docs))
+	for _, doc := range docs {
+		device, err := urn.Parse(doc.Ref.ID)
+		if err != nil {
+			return nil, fmt.Errorf("document %s has an invalid URN: %w", doc.Ref.ID, err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// getDevice reads a device document inside a transaction, reporting whether
+// it exists.
+func getDevice(tx *firestore.Transaction, ref *firestore.DocumentRef) (deviceDocument, bool, error) {
+	var dd deviceDocument
+	doc, err := tx.Get(ref)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return dd, false, nil
+		}
+		return dd, false, err
+	}
+	if err := doc.DataTo(&dd); err != nil {
+		return dd, false, err
+	}
+	return dd, true, nil
+}
@@ -0,0 +1,62 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	fsAdaper "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/illmade-knight/go-test/emulators"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirestoreDeviceRegistry_Integration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	const projectID = "test-project-devices"
+	firestoreConn := emulators.SetupFirestoreEmulator(t, ctx, emulators.GetDefaultFirestoreConfig(projectID))
+	fsClient, err := firestore.NewClient(context.Background(), projectID, firestoreConn.ClientOptions...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = fsClient.Close() })
+	registry := fsAdaper.NewDeviceRegistry(fsClient, "device-owners")
+
+	// Arrange
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	phone, err := urn.New(urn.SecureMessaging, "device", "phone")
+	require.NoError(t, err)
+	laptop, err := urn.New(urn.SecureMessaging, "device", "laptop")
+	require.NoError(t, err)
+
+	// Act & Assert: Enrollment is idempotent for the same owner
+	require.NoError(t, registry.EnrollDevice(ctx, alice, phone))
+	require.NoError(t, registry.EnrollDevice(ctx, alice, phone))
+	require.NoError(t, registry.EnrollDevice(ctx, alice, laptop))
+
+	owner, err := registry.OwnerOf(ctx, phone)
+	require.NoError(t, err)
+	assert.Equal(t, alice, owner)
+
+	devices, err := registry.ListDevices(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, []urn.URN{laptop, phone}, devices)
+
+	// Act & Assert: Another owner cannot take over or unenroll the device
+	assert.ErrorIs(t, registry.EnrollDevice(ctx, bob, phone), keyservice.ErrDeviceOwnedByOther)
+	assert.ErrorIs(t, registry.UnenrollDevice(ctx, bob, phone), keyservice.ErrDeviceNotEnrolled)
+
+	// Act & Assert: Unenrolling releases the device
+	require.NoError(t, registry.UnenrollDevice(ctx, alice, phone))
+	_, err = registry.OwnerOf(ctx, phone)
+	assert.ErrorIs(t, err, keyservice.ErrDeviceNotEnrolled)
+	require.NoError(t, registry.EnrollDevice(ctx, bob, phone))
+}
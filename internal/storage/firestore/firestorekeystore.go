@@ -5,18 +5,74 @@
 package firestore
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
 	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 // keyDocument is the structure stored in a Firestore document.
+// A locked entity may have a document without a publicKey.
 type keyDocument struct {
-	PublicKey []byte `firestore:"publicKey"`
+	PublicKey  []byte              `firestore:"publicKey"`
+	EntityType string              `firestore:"entityType"`
+	UpdatedAt  time.Time           `firestore:"updatedAt"`
+	RevokedAt  time.Time           `firestore:"revokedAt,omitempty"`
+	Locked     bool                `firestore:"locked,omitempty"`
+	Signatures []signatureDocument `firestore:"signatures,omitempty"`
+}
+
+// signatureDocument is a keyservice.KeySignature as stored in a keyDocument.
+type signatureDocument struct {
+	SignerURN   string `firestore:"signerUrn"`
+	SignerKeyID string `firestore:"signerKeyId"`
+	Signature   []byte `firestore:"signature"`
+}
+
+// keyRecord converts a document to its public form. Signatures whose signer
+// URN no longer parses are dropped.
+func (kd keyDocument) keyRecord(entityURN urn.URN) keyservice.KeyRecord {
+	rec := keyservice.KeyRecord{
+		EntityURN: entityURN,
+		Key:       kd.PublicKey,
+		UpdatedAt: kd.UpdatedAt,
+		Revoked:   !kd.RevokedAt.IsZero(),
+		RevokedAt: kd.RevokedAt,
+		Locked:    kd.Locked,
+	}
+	for _, sd := range kd.Signatures {
+		signerURN, err := urn.Parse(sd.SignerURN)
+		if err != nil {
+			continue
+		}
+		rec.Signatures = append(rec.Signatures, keyservice.KeySignature{
+			SignerURN:   signerURN,
+			SignerKeyID: sd.SignerKeyID,
+			Signature:   sd.Signature,
+		})
+	}
+	return rec
+}
+
+// signatureDocuments converts signatures to their stored form.
+func signatureDocuments(signatures []keyservice.KeySignature) []signatureDocument {
+	docs := make([]signatureDocument, 0, len(signatures))
+	for _, sig := range signatures {
+		docs = append(docs, signatureDocument{
+			SignerURN:   sig.SignerURN.String(),
+			SignerKeyID: sig.SignerKeyID,
+			Signature:   sig.Signature,
+		})
+	}
+	return docs
 }
 
 // Store is a concrete implementation of the keyservice.Store interface using Firestore.
@@ -33,24 +89,122 @@ func New(client *firestore.Client, collectionName string) *Store {
 	}
 }
 
-// StoreKey creates or overwrites a document with the entity's public key.
+// StoreKey creates or overwrites a document with the entity's public key. It
+// runs in a transaction so that a concurrent lock is never bypassed.
 func (s *Store) StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error {
+	return s.StoreSignedKey(ctx, entityURN, key, nil)
+}
+
+// StoreSignedKey is StoreKey with the key's signatures stored alongside it.
+func (s *Store) StoreSignedKey(ctx context.Context, entityURN urn.URN, key []byte, signatures []keyservice.KeySignature) error {
 	entityKey := entityURN.String()
-	doc := s.collection.Doc(entityKey)
-	_, err := doc.Set(ctx, keyDocument{PublicKey: key})
+	signatureDocs := signatureDocuments(signatures)
+	ref := s.collection.Doc(entityKey)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, found, err := getKeyDocument(tx, ref)
+		if err != nil {
+			return err
+		}
+		if found && current.Locked {
+			return fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrEntityLocked)
+		}
+		return tx.Set(ref, keyDocument{
+			PublicKey:  key,
+			EntityType: entityURN.EntityType(),
+			UpdatedAt:  time.Now().UTC(),
+			Signatures: signatureDocs,
+		})
+	})
 	if err != nil {
 		return fmt.Errorf("failed to store key for entity %s: %w", entityKey, err)
 	}
 	return nil
 }
 
+// StoreKeys reads the entities' documents in one batch and then writes the
+// keys with a BulkWriter. Transactions cannot span the bulk writes, so each
+// write is conditional instead: a new document is created only if it still
+// does not exist, and an existing one is updated only if it has not changed
+// since it was read, so that a concurrent lock is never bypassed. Writes that
+// lose such a race fail and can be retried.
+func (s *Store) StoreKeys(ctx context.Context, writes []keyservice.KeyWrite) []error {
+	errs := make([]error, len(writes))
+	if len(writes) == 0 {
+		return errs
+	}
+	refs := make([]*firestore.DocumentRef, len(writes))
+	for i, write := range writes {
+		refs[i] = s.collection.Doc(write.EntityURN.String())
+	}
+	docs, err := s.client.GetAll(ctx, refs)
+	if err != nil {
+		for i, write := range writes {
+			errs[i] = fmt.Errorf("failed to store key for entity %s: %w", write.EntityURN.String(), err)
+		}
+		return errs
+	}
+
+	bw := s.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, len(writes))
+	now := time.Now().UTC()
+	for i, write := range writes {
+		entityKey := write.EntityURN.String()
+		kd := keyDocument{
+			PublicKey:  write.Key,
+			EntityType: write.EntityURN.EntityType(),
+			UpdatedAt:  now,
+			Signatures: signatureDocuments(write.Signatures),
+		}
+		var err error
+		if !docs[i].Exists() {
+			jobs[i], err = bw.Create(refs[i], kd)
+		} else {
+			var current keyDocument
+			if err = docs[i].DataTo(&current); err == nil && current.Locked {
+				err = keyservice.ErrEntityLocked
+			}
+			if err == nil {
+				var signatures any = firestore.Delete
+				if len(kd.Signatures) > 0 {
+					signatures = kd.Signatures
+				}
+				jobs[i], err = bw.Update(refs[i], []firestore.Update{
+					{Path: "publicKey", Value: kd.PublicKey},
+					{Path: "entityType", Value: kd.EntityType},
+					{Path: "updatedAt", Value: kd.UpdatedAt},
+					{Path: "revokedAt", Value: firestore.Delete},
+					{Path: "signatures", Value: signatures},
+				}, firestore.LastUpdateTime(docs[i].UpdateTime))
+			}
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to store key for entity %s: %w", entityKey, err)
+		}
+	}
+	bw.End()
+
+	for i, job := range jobs {
+		if job == nil {
+			continue
+		}
+		if _, err := job.Results(); err != nil {
+			entityKey := writes[i].EntityURN.String()
+			if code := status.Code(err); code == codes.AlreadyExists || code == codes.FailedPrecondition {
+				err = fmt.Errorf("document changed concurrently, retry: %w", err)
+			}
+			errs[i] = fmt.Errorf("failed to store key for entity %s: %w", entityKey, err)
+		}
+	}
+	return errs
+}
+
 // GetKey retrieves an entity's public key from a Firestore document.
 func (s *Store) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error) {
 	entityKey := entityURN.String()
 	doc, err := s.collection.Doc(entityKey).Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			return nil, fmt.Errorf("key for entity %s not found", entityKey)
+			return nil, fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyNotFound)
 		}
 		return nil, fmt.Errorf("failed to get key for entity %s: %w", entityKey, err)
 	}
@@ -59,5 +213,239 @@ func (s *Store) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error) {
 	if err := doc.DataTo(&kd); err != nil {
 		return nil, fmt.Errorf("failed to decode key for entity %s: %w", entityKey, err)
 	}
+	if len(kd.PublicKey) == 0 {
+		return nil, fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyNotFound)
+	}
+	if !kd.RevokedAt.IsZero() {
+		return nil, fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyRevoked)
+	}
 	return kd.PublicKey, nil
 }
+
+// GetRecord returns the entity's document, including a revoked key.
+func (s *Store) GetRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	entityKey := entityURN.String()
+	doc, err := s.collection.Doc(entityKey).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return keyservice.KeyRecord{}, fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyNotFound)
+		}
+		return keyservice.KeyRecord{}, fmt.Errorf("failed to get key for entity %s: %w", entityKey, err)
+	}
+
+	var kd keyDocument
+	if err := doc.DataTo(&kd); err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("failed to decode key for entity %s: %w", entityKey, err)
+	}
+	if len(kd.PublicKey) == 0 && !kd.Locked {
+		return keyservice.KeyRecord{}, fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyNotFound)
+	}
+	return kd.keyRecord(entityURN), nil
+}
+
+// GetRecords reads the entities' documents with one batched get.
+func (s *Store) GetRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, error) {
+	records := make([]keyservice.KeyRecord, len(entityURNs))
+	if len(entityURNs) == 0 {
+		return records, nil
+	}
+	refs := make([]*firestore.DocumentRef, len(entityURNs))
+	for i, entityURN := range entityURNs {
+		refs[i] = s.collection.Doc(entityURN.String())
+	}
+	docs, err := s.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get keys: %w", err)
+	}
+	for i, doc := range docs {
+		records[i] = keyservice.KeyRecord{EntityURN: entityURNs[i]}
+		if !doc.Exists() {
+			continue
+		}
+		var kd keyDocument
+		if err := doc.DataTo(&kd); err != nil {
+			return nil, fmt.Errorf("failed to decode key for entity %s: %w", entityURNs[i].String(), err)
+		}
+		records[i] = kd.keyRecord(entityURNs[i])
+	}
+	return records, nil
+}
+
+// RevokeKey marks the entity's key as revoked.
+func (s *Store) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	entityKey := entityURN.String()
+	ref := s.collection.Doc(entityKey)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, found, err := getKeyDocument(tx, ref)
+		if err != nil {
+			return err
+		}
+		if !found || len(current.PublicKey) == 0 {
+			return fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyNotFound)
+		}
+		if !current.RevokedAt.IsZero() {
+			return nil
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "revokedAt", Value: time.Now().UTC()}})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke key for entity %s: %w", entityKey, err)
+	}
+	return nil
+}
+
+// SetLocked locks or unlocks the entity against uploads. Locking an entity
+// without a key creates a document holding only the lock.
+func (s *Store) SetLocked(ctx context.Context, entityURN urn.URN, locked bool) error {
+	entityKey := entityURN.String()
+	_, err := s.collection.Doc(entityKey).Set(ctx, map[string]any{
+		"entityType": entityURN.EntityType(),
+		"locked":     locked,
+	}, firestore.MergeAll)
+	if err != nil {
+		return fmt.Errorf("failed to set lock for entity %s: %w", entityKey, err)
+	}
+	return nil
+}
+
+// ReplaceRecord writes rec in a transaction, so no other write can come
+// between the check of previousKey and the replacement.
+func (s *Store) ReplaceRecord(ctx context.Context, rec keyservice.KeyRecord, previousKey []byte) error {
+	entityKey := rec.EntityURN.String()
+	kd := keyDocument{
+		PublicKey:  rec.Key,
+		EntityType: rec.EntityURN.EntityType(),
+		UpdatedAt:  rec.UpdatedAt,
+		Locked:     rec.Locked,
+		Signatures: signatureDocuments(rec.Signatures),
+	}
+	if kd.UpdatedAt.IsZero() {
+		kd.UpdatedAt = time.Now().UTC()
+	}
+	if rec.Revoked {
+		kd.RevokedAt = rec.RevokedAt
+		if kd.RevokedAt.IsZero() {
+			kd.RevokedAt = time.Now().UTC()
+		}
+	}
+	ref := s.collection.Doc(entityKey)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if previousKey != nil {
+			current, _, err := getKeyDocument(tx, ref)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(current.PublicKey, previousKey) {
+				return fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyChanged)
+			}
+		}
+		return tx.Set(ref, kd)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace record for entity %s: %w", entityKey, err)
+	}
+	return nil
+}
+
+// pageCursor is the decoded form of a ListKeys page token: the sort key of
+// the last document on the previous page.
+type pageCursor struct {
+	ID        string    `json:"id"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
+
+// ListKeys returns one page of matching records using cursor queries. Without
+// an UpdatedSince filter records are ordered by document ID (the URN);
+// otherwise they are ordered by update time and then document ID, which
+// Firestore requires for the range filter. Documents written before the
+// entityType and updatedAt fields existed only match an empty filter.
+func (s *Store) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = keyservice.DefaultPageSize
+	}
+
+	query := s.collection.Query
+	if filter.EntityType != "" {
+		query = query.Where("entityType", "==", filter.EntityType)
+	}
+	byTime := !filter.UpdatedSince.IsZero()
+	if byTime {
+		query = query.Where("updatedAt", ">=", filter.UpdatedSince).OrderBy("updatedAt", firestore.Asc)
+	}
+	query = query.OrderBy(firestore.DocumentID, firestore.Asc)
+
+	if pageToken != "" {
+		cursor, err := decodePageToken(pageToken)
+		if err != nil {
+			return keyservice.KeyPage{}, err
+		}
+		if byTime {
+			query = query.StartAfter(cursor.UpdatedAt, cursor.ID)
+		} else {
+			query = query.StartAfter(cursor.ID)
+		}
+	}
+
+	docs, err := query.Limit(pageSize).Documents(ctx).GetAll()
+	if err != nil {
+		return keyservice.KeyPage{}, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	var page keyservice.KeyPage
+	var lastUpdatedAt time.Time
+	for _, doc := range docs {
+		entityURN, err := urn.Parse(doc.Ref.ID)
+		if err != nil {
+			return keyservice.KeyPage{}, fmt.Errorf("document %s has an invalid URN: %w", doc.Ref.ID, err)
+		}
+		var kd keyDocument
+		if err := doc.DataTo(&kd); err != nil {
+			return keyservice.KeyPage{}, fmt.Errorf("failed to decode key for entity %s: %w", doc.Ref.ID, err)
+		}
+		lastUpdatedAt = kd.UpdatedAt
+		if len(kd.PublicKey) == 0 && !(filter.IncludeLocked && kd.Locked) {
+			// A lock without a key; the page may come out short.
+			continue
+		}
+		page.Records = append(page.Records, kd.keyRecord(entityURN))
+	}
+	if len(docs) == pageSize {
+		page.NextPageToken = encodePageToken(pageCursor{ID: docs[len(docs)-1].Ref.ID, UpdatedAt: lastUpdatedAt})
+	}
+	return page, nil
+}
+
+func encodePageToken(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(pageToken string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid page token: %w", err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("invalid page token: %w", err)
+	}
+	return cursor, nil
+}
+
+// getKeyDocument reads a key document inside a transaction, reporting
+// whether it exists.
+func getKeyDocument(tx *firestore.Transaction, ref *firestore.DocumentRef) (keyDocument, bool, error) {
+	var kd keyDocument
+	doc, err := tx.Get(ref)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return kd, false, nil
+		}
+		return kd, false, err
+	}
+	if err := doc.DataTo(&kd); err != nil {
+		return kd, false, err
+	}
+	return kd, true, nil
+}
@@ -74,4 +74,91 @@ func TestFirestoreStore_Integration(t *testing.T) {
 	_, err = store.GetKey(ctx, nonExistentURN)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "not found")
+
+	// Act & Assert: Listing filters by entity type and pages with a cursor
+	page, err := store.ListKeys(ctx, keyservice.ListFilter{EntityType: "device"}, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	assert.Equal(t, deviceURN, page.Records[0].EntityURN)
+
+	first, err := store.ListKeys(ctx, keyservice.ListFilter{PageSize: 1}, "")
+	require.NoError(t, err)
+	require.Len(t, first.Records, 1)
+	require.NotEmpty(t, first.NextPageToken)
+	second, err := store.ListKeys(ctx, keyservice.ListFilter{PageSize: 1}, first.NextPageToken)
+	require.NoError(t, err)
+	require.Len(t, second.Records, 1)
+	assert.NotEqual(t, first.Records[0].EntityURN, second.Records[0].EntityURN)
+
+	// Act & Assert: A revoked key is not served but stays on record
+	require.NoError(t, store.RevokeKey(ctx, userURN))
+	_, err = store.GetKey(ctx, userURN)
+	assert.ErrorIs(t, err, keyservice.ErrKeyRevoked)
+	rec, err := store.GetRecord(ctx, userURN)
+	require.NoError(t, err)
+	assert.True(t, rec.Revoked)
+	assert.Equal(t, userKey, rec.Key)
+
+	// Act & Assert: A locked entity rejects uploads until unlocked
+	require.NoError(t, store.SetLocked(ctx, deviceURN, true))
+	assert.ErrorIs(t, store.StoreKey(ctx, deviceURN, []byte("replacement")), keyservice.ErrEntityLocked)
+	require.NoError(t, store.SetLocked(ctx, deviceURN, false))
+	assert.NoError(t, store.StoreKey(ctx, deviceURN, []byte("replacement")))
+
+	// Act & Assert: Bulk writes create and replace keys, clear revocations
+	// and fail locked entities individually
+	newURN, err := urn.New("user", "user-new", urn.SecureMessaging)
+	require.NoError(t, err)
+	require.NoError(t, store.SetLocked(ctx, deviceURN, true))
+	errs := store.StoreKeys(ctx, []keyservice.KeyWrite{
+		{EntityURN: newURN, Key: []byte("new-key")},
+		{EntityURN: userURN, Key: []byte("rotated-key")},
+		{EntityURN: deviceURN, Key: []byte("locked-key")},
+	})
+	require.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.ErrorIs(t, errs[2], keyservice.ErrEntityLocked)
+	retrievedNewKey, err := store.GetKey(ctx, newURN)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new-key"), retrievedNewKey)
+	rec, err = store.GetRecord(ctx, userURN)
+	require.NoError(t, err)
+	assert.False(t, rec.Revoked)
+	assert.Equal(t, []byte("rotated-key"), rec.Key)
+	require.NoError(t, store.SetLocked(ctx, deviceURN, false))
+
+	// Act & Assert: Signatures round-trip and are cleared by an unsigned upload
+	signatures := []keyservice.KeySignature{{SignerURN: userURN, SignerKeyID: keyservice.Fingerprint(userKey), Signature: []byte("sig")}}
+	require.NoError(t, store.StoreSignedKey(ctx, deviceURN, []byte("signed"), signatures))
+	rec, err = store.GetRecord(ctx, deviceURN)
+	require.NoError(t, err)
+	assert.Equal(t, signatures, rec.Signatures)
+	require.NoError(t, store.StoreKey(ctx, deviceURN, []byte("unsigned")))
+	rec, err = store.GetRecord(ctx, deviceURN)
+	require.NoError(t, err)
+	assert.Empty(t, rec.Signatures)
+
+	// Act & Assert: GetRecords reads many records in order, missing ones
+	// holding only their URN
+	missingURN, err := urn.New(urn.SecureMessaging, "user", "missing")
+	require.NoError(t, err)
+	records, err := store.GetRecords(ctx, []urn.URN{deviceURN, missingURN, newURN})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []byte("unsigned"), records[0].Key)
+	assert.Equal(t, keyservice.KeyRecord{EntityURN: missingURN}, records[1])
+	assert.Equal(t, []byte("new-key"), records[2].Key)
+
+	// Act & Assert: ReplaceRecord writes the whole record, lock included,
+	// only while the key is the expected one
+	require.NoError(t, store.SetLocked(ctx, deviceURN, true))
+	replacement := keyservice.KeyRecord{EntityURN: deviceURN, Key: []byte("replaced"), Revoked: true, Locked: true}
+	assert.ErrorIs(t, store.ReplaceRecord(ctx, replacement, []byte("stale")), keyservice.ErrKeyChanged)
+	require.NoError(t, store.ReplaceRecord(ctx, replacement, []byte("unsigned")))
+	rec, err = store.GetRecord(ctx, deviceURN)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("replaced"), rec.Key)
+	assert.True(t, rec.Revoked)
+	assert.True(t, rec.Locked)
 }
@@ -0,0 +1,146 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// identifierDocument is the structure stored in a Firestore document keyed
+// by the identifier hash.
+type identifierDocument struct {
+	Owner        string    `firestore:"owner"`
+	RegisteredAt time.Time `firestore:"registeredAt"`
+}
+
+// IdentifierIndex is an implementation of the keyservice.IdentifierIndex
+// interface using Firestore. Registrations run in transactions so two
+// entities cannot register the same hash concurrently.
+type IdentifierIndex struct {
+	client     *firestore.Client
+	collection *firestore.CollectionRef
+}
+
+// NewIdentifierIndex creates a new Firestore-backed identifier index.
+func NewIdentifierIndex(client *firestore.Client, collectionName string) *IdentifierIndex {
+	return &IdentifierIndex{
+		client:     client,
+		collection: client.Collection(collectionName),
+	}
+}
+
+// RegisterIdentifier maps hash to owner.
+func (idx *IdentifierIndex) RegisterIdentifier(ctx context.Context, hash string, owner urn.URN) error {
+	ref := idx.collection.Doc(hash)
+	err := idx.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err == nil {
+			var current identifierDocument
+			if err := doc.DataTo(&current); err != nil {
+				return err
+			}
+			if current.Owner != owner.String() {
+				return fmt.Errorf("identifier %s: %w", hash, keyservice.ErrIdentifierTaken)
+			}
+			return nil
+		}
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+		return tx.Set(ref, identifierDocument{Owner: owner.String(), RegisteredAt: time.Now().UTC()})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register identifier %s: %w", hash, err)
+	}
+	return nil
+}
+
+// UnregisterIdentifier removes owner's registration of hash. The check and
+// the delete run in one transaction so a concurrent reassignment is not
+// undone.
+func (idx *IdentifierIndex) UnregisterIdentifier(ctx context.Context, hash string, owner urn.URN) error {
+	ref := idx.collection.Doc(hash)
+	err := idx.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return fmt.Errorf("identifier %s: %w", hash, keyservice.ErrIdentifierNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		var current identifierDocument
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.Owner != owner.String() {
+			return fmt.Errorf("identifier %s: %w", hash, keyservice.ErrIdentifierNotFound)
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unregister identifier %s: %w", hash, err)
+	}
+	return nil
+}
+
+// AssignIdentifier maps hash to owner whoever held it before.
+func (idx *IdentifierIndex) AssignIdentifier(ctx context.Context, hash string, owner urn.URN) error {
+	if _, err := idx.collection.Doc(hash).Set(ctx, identifierDocument{Owner: owner.String(), RegisteredAt: time.Now().UTC()}); err != nil {
+		return fmt.Errorf("failed to assign identifier %s: %w", hash, err)
+	}
+	return nil
+}
+
+// LookupIdentifier returns the entity that registered hash.
+func (idx *IdentifierIndex) LookupIdentifier(ctx context.Context, hash string) (urn.URN, error) {
+	doc, err := idx.collection.Doc(hash).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return urn.URN{}, fmt.Errorf("identifier %s: %w", hash, keyservice.ErrIdentifierNotFound)
+		}
+		return urn.URN{}, fmt.Errorf("failed to look up identifier %s: %w", hash, err)
+	}
+	var id identifierDocument
+	if err := doc.DataTo(&id); err != nil {
+		return urn.URN{}, fmt.Errorf("failed to decode identifier %s: %w", hash, err)
+	}
+	owner, err := urn.Parse(id.Owner)
+	if err != nil {
+		return urn.URN{}, fmt.Errorf("identifier %s has an invalid owner URN: %w", hash, err)
+	}
+	return owner, nil
+}
+
+// LookupPrefix returns up to limit registrations whose hash starts with
+// prefix, ordered by hash.
+func (idx *IdentifierIndex) LookupPrefix(ctx context.Context, prefix string, limit int) ([]keyservice.IdentifierEntry, error) {
+	// Hashes only use ASCII characters, which all sort before \uf8ff.
+	docs, err := idx.collection.
+		Where(firestore.DocumentID, ">=", idx.collection.Doc(prefix)).
+		Where(firestore.DocumentID, "<", idx.collection.Doc(prefix+"\uf8ff")).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up identifiers with prefix %s: %w", prefix, err)
+	}
+	entries := make([]keyservice.IdentifierEntry, 0, len(docs))
+	for _, doc := range docs {
+		var id identifierDocument
+		if err := doc.DataTo(&id); err != nil {
+			return nil, fmt.Errorf("failed to decode identifier %s: %w", doc.Ref.ID, err)
+		}
+		owner, err := urn.Parse(id.Owner)
+		if err != nil {
+			return nil, fmt.Errorf("identifier %s has an invalid owner URN: %w", doc.Ref.ID, err)
+		}
+		entries = append(entries, keyservice.IdentifierEntry{Hash: doc.Ref.ID, Owner: owner})
+	}
+	return entries, nil
+}
@@ -0,0 +1,69 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	fsAdaper "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/illmade-knight/go-test/emulators"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirestoreIdentifierIndex_Integration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	const projectID = "test-project-identifiers"
+	firestoreConn := emulators.SetupFirestoreEmulator(t, ctx, emulators.GetDefaultFirestoreConfig(projectID))
+	fsClient, err := firestore.NewClient(context.Background(), projectID, firestoreConn.ClientOptions...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = fsClient.Close() })
+	index := fsAdaper.NewIdentifierIndex(fsClient, "identifier-hashes")
+
+	// Arrange
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	hash, err := keyservice.HashIdentifier("salt", "alice@example.com")
+	require.NoError(t, err)
+	otherHash, err := keyservice.HashIdentifier("salt", "+44 20 7946 0000")
+	require.NoError(t, err)
+
+	// Act & Assert: Registration is idempotent for the same owner
+	require.NoError(t, index.RegisterIdentifier(ctx, hash, alice))
+	require.NoError(t, index.RegisterIdentifier(ctx, hash, alice))
+
+	owner, err := index.LookupIdentifier(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, alice, owner)
+
+	// Act & Assert: Another entity cannot take over the hash
+	assert.ErrorIs(t, index.RegisterIdentifier(ctx, hash, bob), keyservice.ErrIdentifierTaken)
+
+	// Act & Assert: Unknown hashes are not found
+	_, err = index.LookupIdentifier(ctx, otherHash)
+	assert.ErrorIs(t, err, keyservice.ErrIdentifierNotFound)
+
+	// Act & Assert: Prefix lookups return the hashes sharing the prefix
+	entries, err := index.LookupPrefix(ctx, hash[:keyservice.DiscoveryPrefixLength], keyservice.MaxDiscoveryMatches)
+	require.NoError(t, err)
+	assert.Equal(t, []keyservice.IdentifierEntry{{Hash: hash, Owner: alice}}, entries)
+
+	// Act & Assert: Only the owner can unregister, an administrator can reassign
+	assert.ErrorIs(t, index.UnregisterIdentifier(ctx, hash, bob), keyservice.ErrIdentifierNotFound)
+	require.NoError(t, index.AssignIdentifier(ctx, hash, bob))
+	owner, err = index.LookupIdentifier(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, bob, owner)
+	require.NoError(t, index.UnregisterIdentifier(ctx, hash, bob))
+	_, err = index.LookupIdentifier(ctx, hash)
+	assert.ErrorIs(t, err, keyservice.ErrIdentifierNotFound)
+}
@@ -0,0 +1,87 @@
+package firestore
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// listenerRetryDelay is how long the Invalidator waits before re-opening a
+// snapshot listener that failed.
+const listenerRetryDelay = time.Second
+
+// Invalidator is an implementation of the keyservice.Invalidator interface
+// that uses a Firestore snapshot listener on the key collection. Every write
+// to the collection, from any replica, is observed by every subscriber, so
+// Publish has nothing to do.
+type Invalidator struct {
+	collection *firestore.CollectionRef
+	logger     zerolog.Logger
+}
+
+// NewInvalidator creates an Invalidator that listens to the given collection.
+func NewInvalidator(client *firestore.Client, collectionName string, logger zerolog.Logger) *Invalidator {
+	return &Invalidator{
+		collection: client.Collection(collectionName),
+		logger:     logger,
+	}
+}
+
+// Publish is a no-op: the Firestore write itself triggers the snapshot
+// listeners of every replica.
+func (i *Invalidator) Publish(ctx context.Context, entityURN urn.URN) error {
+	return nil
+}
+
+// Subscribe starts a snapshot listener that calls fn for every document that
+// changes after the subscription was established. The listener is re-opened
+// after transient failures and stops when ctx is cancelled.
+func (i *Invalidator) Subscribe(ctx context.Context, fn func(entityURN urn.URN)) error {
+	go func() {
+		for ctx.Err() == nil {
+			err := i.listen(ctx, fn)
+			if ctx.Err() != nil || status.Code(err) == codes.Canceled {
+				return
+			}
+			i.logger.Warn().Err(err).Msg("Key invalidation listener failed, restarting")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(listenerRetryDelay):
+			}
+		}
+	}()
+	return nil
+}
+
+// listen consumes snapshots until an error occurs. The first snapshot lists
+// every existing document and is skipped.
+func (i *Invalidator) listen(ctx context.Context, fn func(entityURN urn.URN)) error {
+	it := i.collection.Snapshots(ctx)
+	defer it.Stop()
+
+	first := true
+	for {
+		snap, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if first {
+			first = false
+			continue
+		}
+		for _, change := range snap.Changes {
+			entityURN, err := urn.Parse(change.Doc.Ref.ID)
+			if err != nil {
+				i.logger.Warn().Err(err).Str("doc_id", change.Doc.Ref.ID).Msg("Ignoring change for document with invalid URN")
+				continue
+			}
+			fn(entityURN)
+		}
+	}
+}
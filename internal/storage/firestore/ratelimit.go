@@ -0,0 +1,100 @@
+package firestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// bucketDocument is a token bucket's state at the time it was last updated,
+// stored in a document keyed by the hash of the bucket key. expiresAt is
+// when the bucket will have refilled completely, unset for buckets that
+// never refill; configure a Firestore TTL policy on it to delete idle
+// buckets, which are indistinguishable from new ones.
+type bucketDocument struct {
+	Key       string     `firestore:"key"`
+	Tokens    float64    `firestore:"tokens"`
+	UpdatedAt time.Time  `firestore:"updatedAt"`
+	ExpiresAt *time.Time `firestore:"expiresAt,omitempty"`
+}
+
+// RateLimitStore is an implementation of the keyservice.RateLimitStore
+// interface using Firestore, so every replica draws on the same buckets and
+// the buckets survive restarts. Each Take is a transaction on the bucket's
+// document, so a single bucket sustains about one Take per second.
+type RateLimitStore struct {
+	client     *firestore.Client
+	collection *firestore.CollectionRef
+}
+
+// NewRateLimitStore creates a new Firestore-backed token bucket store.
+func NewRateLimitStore(client *firestore.Client, collectionName string) *RateLimitStore {
+	return &RateLimitStore{
+		client:     client,
+		collection: client.Collection(collectionName),
+	}
+}
+
+// Take removes n tokens from the bucket for key if it holds enough, in a
+// transaction so concurrent takes on different replicas cannot overspend.
+func (s *RateLimitStore) Take(ctx context.Context, key string, limit keyservice.RateLimit, n int) (keyservice.RateLimitResult, error) {
+	// Bucket keys hold IP addresses and subjects, which may contain
+	// characters not allowed in document IDs.
+	sum := sha256.Sum256([]byte(key))
+	ref := s.collection.Doc(hex.EncodeToString(sum[:]))
+
+	var result keyservice.RateLimitResult
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		now := time.Now().UTC()
+		bd := bucketDocument{Key: key, Tokens: float64(limit.Burst), UpdatedAt: now}
+		doc, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			if err := doc.DataTo(&bd); err != nil {
+				return err
+			}
+		}
+		tokens := math.Min(float64(limit.Burst), bd.Tokens+now.Sub(bd.UpdatedAt).Seconds()*limit.Rate)
+
+		need := float64(max(n, 1))
+		if tokens < need {
+			result = keyservice.RateLimitResult{RetryAfter: retryAfter(need-tokens, limit.Rate)}
+			return nil
+		}
+		result = keyservice.RateLimitResult{Allowed: true}
+		if n == 0 {
+			return nil
+		}
+		tokens -= float64(n)
+		updated := bucketDocument{Key: key, Tokens: tokens, UpdatedAt: now}
+		if limit.Rate > 0 {
+			expiresAt := now.Add(retryAfter(float64(limit.Burst)-tokens, limit.Rate))
+			updated.ExpiresAt = &expiresAt
+		}
+		return tx.Set(ref, updated)
+	})
+	if err != nil {
+		return keyservice.RateLimitResult{}, fmt.Errorf("failed to take from rate limit bucket: %w", err)
+	}
+	return result, nil
+}
+
+// retryAfter is how long refilling missing tokens takes at rate per second,
+// or zero if the bucket never refills.
+func retryAfter(missing, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(missing / rate * float64(time.Second))
+}
@@ -0,0 +1,53 @@
+//go:build integration
+
+package firestore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	fsAdaper "github.com/illmade-knight/go-key-service/internal/storage/firestore"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-test/emulators"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirestoreRateLimitStore_Integration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	t.Cleanup(cancel)
+
+	const projectID = "test-project-ratelimits"
+	firestoreConn := emulators.SetupFirestoreEmulator(t, ctx, emulators.GetDefaultFirestoreConfig(projectID))
+	fsClient, err := firestore.NewClient(context.Background(), projectID, firestoreConn.ClientOptions...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = fsClient.Close() })
+
+	// Arrange: two stores on the same collection stand in for two replicas.
+	first := fsAdaper.NewRateLimitStore(fsClient, "rate-limits")
+	second := fsAdaper.NewRateLimitStore(fsClient, "rate-limits")
+	limit := keyservice.RateLimit{Rate: 0.001, Burst: 2}
+
+	// Act & Assert: The replicas draw on one bucket
+	result, err := first.Take(ctx, "sub:alice/with-slash", limit, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = second.Take(ctx, "sub:alice/with-slash", limit, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = first.Take(ctx, "sub:alice/with-slash", limit, 1)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Greater(t, result.RetryAfter, time.Duration(0))
+
+	// Act & Assert: Other keys have their own bucket, and taking more than
+	// is left spends nothing
+	result, err = second.Take(ctx, "sub:bob", limit, 3)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	result, err = second.Take(ctx, "sub:bob", limit, 2)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
@@ -0,0 +1,63 @@
+package inmemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+// AuditSink is a thread-safe in-memory implementation of the
+// keyservice.AuditSink interface.
+type AuditSink struct {
+	sync.RWMutex
+	events []keyservice.AuditEvent
+}
+
+// NewAuditSink creates a new, empty in-memory audit sink.
+func NewAuditSink() *AuditSink {
+	return &AuditSink{}
+}
+
+// Append links event to the end of the chain and stores it.
+func (s *AuditSink) Append(ctx context.Context, event keyservice.AuditEvent) (keyservice.AuditEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+	var prev keyservice.AuditEvent
+	if len(s.events) > 0 {
+		prev = s.events[len(s.events)-1]
+	}
+	event = keyservice.ChainAuditEvent(prev, event)
+	s.events = append(s.events, event)
+	return event, nil
+}
+
+// AppendAll links events to the end of the chain under a single lock.
+func (s *AuditSink) AppendAll(ctx context.Context, events []keyservice.AuditEvent) ([]keyservice.AuditEvent, error) {
+	s.Lock()
+	defer s.Unlock()
+	stored := make([]keyservice.AuditEvent, 0, len(events))
+	for _, event := range events {
+		var prev keyservice.AuditEvent
+		if len(s.events) > 0 {
+			prev = s.events[len(s.events)-1]
+		}
+		event = keyservice.ChainAuditEvent(prev, event)
+		s.events = append(s.events, event)
+		stored = append(stored, event)
+	}
+	return stored, nil
+}
+
+// List returns up to limit events after afterSequence.
+func (s *AuditSink) List(ctx context.Context, afterSequence uint64, limit int) ([]keyservice.AuditEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+	start := sort.Search(len(s.events), func(i int) bool { return s.events[i].Sequence > afterSequence })
+	end := min(start+limit, len(s.events))
+	if limit <= 0 {
+		end = len(s.events)
+	}
+	return append([]keyservice.AuditEvent(nil), s.events[start:end]...), nil
+}
@@ -0,0 +1,41 @@
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditSink(t *testing.T) {
+	ctx := context.Background()
+
+	// Arrange
+	sink := inmemory.NewAuditSink()
+	_, err := sink.Append(ctx, keyservice.AuditEvent{Action: "keys:write", Time: time.Now()})
+	require.NoError(t, err)
+	appended, err := sink.AppendAll(ctx, []keyservice.AuditEvent{
+		{Action: "admin:revoke", Time: time.Now()},
+		{Action: "admin:lock", Time: time.Now()},
+	})
+	require.NoError(t, err)
+
+	// Act
+	first, err := sink.List(ctx, 0, 2)
+	require.NoError(t, err)
+	rest, err := sink.List(ctx, first[len(first)-1].Sequence, 2)
+	require.NoError(t, err)
+
+	// Assert
+	require.Len(t, first, 2)
+	require.Len(t, rest, 1)
+	assert.Equal(t, "admin:lock", rest[0].Action)
+	assert.Equal(t, uint64(3), rest[0].Sequence)
+	assert.NoError(t, keyservice.VerifyAuditEvent(first[0], first[1]))
+	assert.NoError(t, keyservice.VerifyAuditEvent(first[1], rest[0]))
+	assert.Equal(t, append(first[1:], rest...), appended)
+}
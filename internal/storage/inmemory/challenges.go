@@ -0,0 +1,61 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// ChallengeStore is a thread-safe in-memory implementation of the
+// keyservice.ChallengeStore interface. Challenges are only valid on the
+// replica that issued them.
+type ChallengeStore struct {
+	sync.Mutex
+	challenges map[string]keyservice.Challenge
+}
+
+// NewChallengeStore creates a new in-memory challenge store.
+func NewChallengeStore() *ChallengeStore {
+	return &ChallengeStore{challenges: make(map[string]keyservice.Challenge)}
+}
+
+// Issue creates a random challenge for entityURN valid for ttl.
+func (s *ChallengeStore) Issue(ctx context.Context, entityURN urn.URN, ttl time.Duration) (keyservice.Challenge, error) {
+	nonce, err := keyservice.NewNonce()
+	if err != nil {
+		return keyservice.Challenge{}, err
+	}
+	challenge := keyservice.Challenge{Nonce: nonce, EntityURN: entityURN, ExpiresAt: time.Now().Add(ttl)}
+
+	s.Lock()
+	defer s.Unlock()
+	s.sweep()
+	s.challenges[nonce] = challenge
+	return challenge, nil
+}
+
+// Consume redeems the challenge once.
+func (s *ChallengeStore) Consume(ctx context.Context, entityURN urn.URN, nonce string) error {
+	s.Lock()
+	defer s.Unlock()
+	challenge, ok := s.challenges[nonce]
+	delete(s.challenges, nonce)
+	if !ok || challenge.EntityURN.String() != entityURN.String() || time.Now().After(challenge.ExpiresAt) {
+		return fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrChallengeInvalid)
+	}
+	return nil
+}
+
+// sweep drops expired challenges. The caller must hold the lock.
+func (s *ChallengeStore) sweep() {
+	now := time.Now()
+	for nonce, challenge := range s.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(s.challenges, nonce)
+		}
+	}
+}
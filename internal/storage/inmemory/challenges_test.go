@@ -0,0 +1,48 @@
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallengeStore(t *testing.T) {
+	ctx := context.Background()
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+
+	t.Run("Challenge can be consumed once", func(t *testing.T) {
+		store := inmemory.NewChallengeStore()
+		challenge, err := store.Issue(ctx, alice, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, keyservice.ValidNonce(challenge.Nonce))
+
+		require.NoError(t, store.Consume(ctx, alice, challenge.Nonce))
+		assert.ErrorIs(t, store.Consume(ctx, alice, challenge.Nonce), keyservice.ErrChallengeInvalid)
+	})
+
+	t.Run("Challenge is bound to its entity", func(t *testing.T) {
+		store := inmemory.NewChallengeStore()
+		challenge, err := store.Issue(ctx, alice, time.Minute)
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, store.Consume(ctx, bob, challenge.Nonce), keyservice.ErrChallengeInvalid)
+	})
+
+	t.Run("Expired challenge is rejected", func(t *testing.T) {
+		store := inmemory.NewChallengeStore()
+		challenge, err := store.Issue(ctx, alice, time.Millisecond)
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+
+		assert.ErrorIs(t, store.Consume(ctx, alice, challenge.Nonce), keyservice.ErrChallengeInvalid)
+	})
+}
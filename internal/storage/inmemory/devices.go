@@ -0,0 +1,77 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// DeviceRegistry is a thread-safe in-memory implementation of the
+// keyservice.DeviceRegistry interface.
+type DeviceRegistry struct {
+	sync.RWMutex
+	owners map[string]enrollment
+}
+
+// enrollment is a device and its owner.
+type enrollment struct {
+	device urn.URN
+	owner  urn.URN
+}
+
+// NewDeviceRegistry creates a new in-memory device registry.
+func NewDeviceRegistry() *DeviceRegistry {
+	return &DeviceRegistry{owners: make(map[string]enrollment)}
+}
+
+// EnrollDevice records owner as the owner of device.
+func (r *DeviceRegistry) EnrollDevice(ctx context.Context, owner, device urn.URN) error {
+	r.Lock()
+	defer r.Unlock()
+	if current, ok := r.owners[device.String()]; ok && current.owner.String() != owner.String() {
+		return fmt.Errorf("device %s: %w", device.String(), keyservice.ErrDeviceOwnedByOther)
+	}
+	r.owners[device.String()] = enrollment{device: device, owner: owner}
+	return nil
+}
+
+// UnenrollDevice removes owner's ownership of device.
+func (r *DeviceRegistry) UnenrollDevice(ctx context.Context, owner, device urn.URN) error {
+	r.Lock()
+	defer r.Unlock()
+	current, ok := r.owners[device.String()]
+	if !ok || current.owner.String() != owner.String() {
+		return fmt.Errorf("device %s for owner %s: %w", device.String(), owner.String(), keyservice.ErrDeviceNotEnrolled)
+	}
+	delete(r.owners, device.String())
+	return nil
+}
+
+// OwnerOf returns the owner of device.
+func (r *DeviceRegistry) OwnerOf(ctx context.Context, device urn.URN) (urn.URN, error) {
+	r.RLock()
+	defer r.RUnlock()
+	enrolled, ok := r.owners[device.String()]
+	if !ok {
+		return urn.URN{}, fmt.Errorf("device %s: %w", device.String(), keyservice.ErrDeviceNotEnrolled)
+	}
+	return enrolled.owner, nil
+}
+
+// ListDevices returns owner's devices ordered by URN.
+func (r *DeviceRegistry) ListDevices(ctx context.Context, owner urn.URN) ([]urn.URN, error) {
+	r.RLock()
+	defer r.RUnlock()
+	var devices []urn.URN
+	for _, enrolled := range r.owners {
+		if enrolled.owner.String() == owner.String() {
+			devices = append(devices, enrolled.device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].String() < devices[j].String() })
+	return devices, nil
+}
@@ -0,0 +1,73 @@
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceRegistry(t *testing.T) {
+	ctx := context.Background()
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	phone, err := urn.New(urn.SecureMessaging, "device", "phone")
+	require.NoError(t, err)
+	laptop, err := urn.New(urn.SecureMessaging, "device", "laptop")
+	require.NoError(t, err)
+
+	t.Run("Enrolled devices are listed in URN order", func(t *testing.T) {
+		// Arrange
+		registry := inmemory.NewDeviceRegistry()
+		require.NoError(t, registry.EnrollDevice(ctx, alice, phone))
+		require.NoError(t, registry.EnrollDevice(ctx, alice, laptop))
+		require.NoError(t, registry.EnrollDevice(ctx, alice, phone))
+
+		// Act
+		devices, err := registry.ListDevices(ctx, alice)
+		require.NoError(t, err)
+		owner, ownerErr := registry.OwnerOf(ctx, phone)
+
+		// Assert
+		assert.Equal(t, []urn.URN{laptop, phone}, devices)
+		require.NoError(t, ownerErr)
+		assert.Equal(t, alice, owner)
+	})
+
+	t.Run("A device cannot be enrolled or unenrolled by another owner", func(t *testing.T) {
+		// Arrange
+		registry := inmemory.NewDeviceRegistry()
+		require.NoError(t, registry.EnrollDevice(ctx, alice, phone))
+
+		// Act
+		enrollErr := registry.EnrollDevice(ctx, bob, phone)
+		unenrollErr := registry.UnenrollDevice(ctx, bob, phone)
+
+		// Assert
+		assert.ErrorIs(t, enrollErr, keyservice.ErrDeviceOwnedByOther)
+		assert.ErrorIs(t, unenrollErr, keyservice.ErrDeviceNotEnrolled)
+	})
+
+	t.Run("Unenrolling releases the device", func(t *testing.T) {
+		// Arrange
+		registry := inmemory.NewDeviceRegistry()
+		require.NoError(t, registry.EnrollDevice(ctx, alice, phone))
+
+		// Act
+		require.NoError(t, registry.UnenrollDevice(ctx, alice, phone))
+
+		// Assert
+		_, err := registry.OwnerOf(ctx, phone)
+		assert.ErrorIs(t, err, keyservice.ErrDeviceNotEnrolled)
+		devices, err := registry.ListDevices(ctx, alice)
+		require.NoError(t, err)
+		assert.Empty(t, devices)
+		assert.NoError(t, registry.EnrollDevice(ctx, bob, phone))
+	})
+}
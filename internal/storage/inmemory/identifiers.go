@@ -0,0 +1,83 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// IdentifierIndex is a thread-safe in-memory implementation of the
+// keyservice.IdentifierIndex interface.
+type IdentifierIndex struct {
+	sync.RWMutex
+	owners map[string]urn.URN
+}
+
+// NewIdentifierIndex creates a new in-memory identifier index.
+func NewIdentifierIndex() *IdentifierIndex {
+	return &IdentifierIndex{owners: make(map[string]urn.URN)}
+}
+
+// RegisterIdentifier maps hash to owner.
+func (idx *IdentifierIndex) RegisterIdentifier(ctx context.Context, hash string, owner urn.URN) error {
+	idx.Lock()
+	defer idx.Unlock()
+	if current, ok := idx.owners[hash]; ok && current.String() != owner.String() {
+		return fmt.Errorf("identifier %s: %w", hash, keyservice.ErrIdentifierTaken)
+	}
+	idx.owners[hash] = owner
+	return nil
+}
+
+// UnregisterIdentifier removes owner's registration of hash.
+func (idx *IdentifierIndex) UnregisterIdentifier(ctx context.Context, hash string, owner urn.URN) error {
+	idx.Lock()
+	defer idx.Unlock()
+	if current, ok := idx.owners[hash]; !ok || current.String() != owner.String() {
+		return fmt.Errorf("identifier %s: %w", hash, keyservice.ErrIdentifierNotFound)
+	}
+	delete(idx.owners, hash)
+	return nil
+}
+
+// AssignIdentifier maps hash to owner whoever held it before.
+func (idx *IdentifierIndex) AssignIdentifier(ctx context.Context, hash string, owner urn.URN) error {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.owners[hash] = owner
+	return nil
+}
+
+// LookupIdentifier returns the entity that registered hash.
+func (idx *IdentifierIndex) LookupIdentifier(ctx context.Context, hash string) (urn.URN, error) {
+	idx.RLock()
+	defer idx.RUnlock()
+	owner, ok := idx.owners[hash]
+	if !ok {
+		return urn.URN{}, fmt.Errorf("identifier %s: %w", hash, keyservice.ErrIdentifierNotFound)
+	}
+	return owner, nil
+}
+
+// LookupPrefix returns up to limit registrations whose hash starts with
+// prefix, ordered by hash.
+func (idx *IdentifierIndex) LookupPrefix(ctx context.Context, prefix string, limit int) ([]keyservice.IdentifierEntry, error) {
+	idx.RLock()
+	defer idx.RUnlock()
+	var entries []keyservice.IdentifierEntry
+	for hash, owner := range idx.owners {
+		if strings.HasPrefix(hash, prefix) {
+			entries = append(entries, keyservice.IdentifierEntry{Hash: hash, Owner: owner})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Hash < entries[j].Hash })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
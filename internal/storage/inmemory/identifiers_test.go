@@ -0,0 +1,119 @@
+package inmemory_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifierIndex(t *testing.T) {
+	ctx := context.Background()
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	hash, err := keyservice.HashIdentifier("salt", "alice@example.com")
+	require.NoError(t, err)
+
+	t.Run("Registered hashes resolve to their owner", func(t *testing.T) {
+		// Arrange
+		index := inmemory.NewIdentifierIndex()
+		require.NoError(t, index.RegisterIdentifier(ctx, hash, alice))
+		require.NoError(t, index.RegisterIdentifier(ctx, hash, alice))
+
+		// Act
+		owner, err := index.LookupIdentifier(ctx, hash)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, alice, owner)
+	})
+
+	t.Run("A hash cannot be registered by another entity", func(t *testing.T) {
+		// Arrange
+		index := inmemory.NewIdentifierIndex()
+		require.NoError(t, index.RegisterIdentifier(ctx, hash, alice))
+
+		// Act
+		err := index.RegisterIdentifier(ctx, hash, bob)
+		owner, lookupErr := index.LookupIdentifier(ctx, hash)
+
+		// Assert
+		assert.ErrorIs(t, err, keyservice.ErrIdentifierTaken)
+		require.NoError(t, lookupErr)
+		assert.Equal(t, alice, owner)
+	})
+
+	t.Run("Unknown hashes are not found", func(t *testing.T) {
+		// Act
+		_, err := inmemory.NewIdentifierIndex().LookupIdentifier(ctx, hash)
+
+		// Assert
+		assert.ErrorIs(t, err, keyservice.ErrIdentifierNotFound)
+	})
+	t.Run("Only the owner can unregister a hash", func(t *testing.T) {
+		// Arrange
+		index := inmemory.NewIdentifierIndex()
+		require.NoError(t, index.RegisterIdentifier(ctx, hash, alice))
+
+		// Act
+		byOther := index.UnregisterIdentifier(ctx, hash, bob)
+		byOwner := index.UnregisterIdentifier(ctx, hash, alice)
+		_, lookupErr := index.LookupIdentifier(ctx, hash)
+
+		// Assert
+		assert.ErrorIs(t, byOther, keyservice.ErrIdentifierNotFound)
+		assert.NoError(t, byOwner)
+		assert.ErrorIs(t, lookupErr, keyservice.ErrIdentifierNotFound)
+	})
+
+	t.Run("Assigning a hash overrides its owner", func(t *testing.T) {
+		// Arrange
+		index := inmemory.NewIdentifierIndex()
+		require.NoError(t, index.RegisterIdentifier(ctx, hash, alice))
+
+		// Act
+		err := index.AssignIdentifier(ctx, hash, bob)
+		owner, lookupErr := index.LookupIdentifier(ctx, hash)
+
+		// Assert
+		require.NoError(t, err)
+		require.NoError(t, lookupErr)
+		assert.Equal(t, bob, owner)
+	})
+
+	t.Run("Prefix lookups return matching hashes in order, up to the limit", func(t *testing.T) {
+		// Arrange
+		index := inmemory.NewIdentifierIndex()
+		prefix := hash[:keyservice.DiscoveryPrefixLength]
+		sharing := []string{prefix + strings.Repeat("y", keyservice.IdentifierHashLength-len(prefix)), hash, prefix + strings.Repeat("9", keyservice.IdentifierHashLength-len(prefix))}
+		for _, h := range sharing {
+			require.NoError(t, index.RegisterIdentifier(ctx, h, alice))
+		}
+		other, err := keyservice.HashIdentifier("salt", "bob@example.com")
+		require.NoError(t, err)
+		require.NoError(t, index.RegisterIdentifier(ctx, other, bob))
+
+		// Act
+		all, err := index.LookupPrefix(ctx, prefix, 10)
+		require.NoError(t, err)
+		limited, err := index.LookupPrefix(ctx, prefix, 2)
+		require.NoError(t, err)
+
+		// Assert
+		sort.Strings(sharing)
+		require.Len(t, all, 3)
+		for i, entry := range all {
+			assert.Equal(t, sharing[i], entry.Hash)
+			assert.Equal(t, alice, entry.Owner)
+		}
+		assert.Equal(t, all[:2], limited)
+	})
+}
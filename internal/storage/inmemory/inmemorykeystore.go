@@ -4,39 +4,220 @@
 package inmemory
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
 	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
 )
 
+// record is a stored key, the time it was last written and the entity's
+// administrative state. A locked entity may have a record without a key.
+type record struct {
+	entityURN  urn.URN
+	key        []byte
+	updatedAt  time.Time
+	revokedAt  time.Time
+	locked     bool
+	signatures []keyservice.KeySignature
+}
+
+// keyRecord converts rec to its public form.
+func (rec record) keyRecord() keyservice.KeyRecord {
+	return keyservice.KeyRecord{
+		EntityURN:  rec.entityURN,
+		Key:        rec.key,
+		UpdatedAt:  rec.updatedAt,
+		Revoked:    !rec.revokedAt.IsZero(),
+		RevokedAt:  rec.revokedAt,
+		Locked:     rec.locked,
+		Signatures: rec.signatures,
+	}
+}
+
 // Store is a concrete, thread-safe in-memory implementation of the keyservice.Store interface.
 type Store struct {
 	sync.RWMutex
-	keys map[string][]byte
+	keys map[string]record
 }
 
 // New creates a new in-memory key store.
 func New() *Store {
-	return &Store{keys: make(map[string][]byte)}
+	return &Store{keys: make(map[string]record)}
 }
 
 // StoreKey adds a key to the in-memory map using the URN's string representation as the key.
 func (s *Store) StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error {
+	return s.StoreSignedKey(ctx, entityURN, key, nil)
+}
+
+// StoreSignedKey stores the key together with its signatures.
+func (s *Store) StoreSignedKey(ctx context.Context, entityURN urn.URN, key []byte, signatures []keyservice.KeySignature) error {
 	s.Lock()
 	defer s.Unlock()
-	s.keys[entityURN.String()] = key
+	if s.keys[entityURN.String()].locked {
+		return fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrEntityLocked)
+	}
+	s.keys[entityURN.String()] = record{entityURN: entityURN, key: key, updatedAt: time.Now().UTC(), signatures: signatures}
 	return nil
 }
 
+// StoreKeys stores every write under a single lock, so readers see either
+// none or all of the batch's keys. Locked entities fail individually.
+func (s *Store) StoreKeys(ctx context.Context, writes []keyservice.KeyWrite) []error {
+	s.Lock()
+	defer s.Unlock()
+	errs := make([]error, len(writes))
+	now := time.Now().UTC()
+	for i, write := range writes {
+		entityKey := write.EntityURN.String()
+		if s.keys[entityKey].locked {
+			errs[i] = fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrEntityLocked)
+			continue
+		}
+		s.keys[entityKey] = record{entityURN: write.EntityURN, key: write.Key, updatedAt: now, signatures: write.Signatures}
+	}
+	return errs
+}
+
 // GetKey retrieves a key from the in-memory map using the URN's string representation.
 func (s *Store) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error) {
 	s.RLock()
 	defer s.RUnlock()
-	key, ok := s.keys[entityURN.String()]
+	rec, ok := s.keys[entityURN.String()]
+	if !ok || rec.key == nil {
+		return nil, fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrKeyNotFound)
+	}
+	if !rec.revokedAt.IsZero() {
+		return nil, fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrKeyRevoked)
+	}
+	return rec.key, nil
+}
+
+// GetRecord returns the entity's record, including a revoked key.
+func (s *Store) GetRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	s.RLock()
+	defer s.RUnlock()
+	rec, ok := s.keys[entityURN.String()]
+	if !ok || (rec.key == nil && !rec.locked) {
+		return keyservice.KeyRecord{}, fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrKeyNotFound)
+	}
+	return rec.keyRecord(), nil
+}
+
+// GetRecords returns the entities' records under a single read lock.
+func (s *Store) GetRecords(ctx context.Context, entityURNs []urn.URN) ([]keyservice.KeyRecord, error) {
+	s.RLock()
+	defer s.RUnlock()
+	records := make([]keyservice.KeyRecord, len(entityURNs))
+	for i, entityURN := range entityURNs {
+		rec, ok := s.keys[entityURN.String()]
+		if !ok {
+			records[i] = keyservice.KeyRecord{EntityURN: entityURN}
+			continue
+		}
+		records[i] = rec.keyRecord()
+	}
+	return records, nil
+}
+
+// RevokeKey marks the entity's key as revoked.
+func (s *Store) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	s.Lock()
+	defer s.Unlock()
+	rec, ok := s.keys[entityURN.String()]
+	if !ok || rec.key == nil {
+		return fmt.Errorf("entity %s: %w", entityURN.String(), keyservice.ErrKeyNotFound)
+	}
+	if rec.revokedAt.IsZero() {
+		rec.revokedAt = time.Now().UTC()
+		s.keys[entityURN.String()] = rec
+	}
+	return nil
+}
+
+// SetLocked locks or unlocks the entity against uploads.
+func (s *Store) SetLocked(ctx context.Context, entityURN urn.URN, locked bool) error {
+	s.Lock()
+	defer s.Unlock()
+	rec, ok := s.keys[entityURN.String()]
 	if !ok {
-		return nil, fmt.Errorf("key for entity %s not found", entityURN.String())
+		if !locked {
+			return nil
+		}
+		rec = record{entityURN: entityURN}
+	}
+	rec.locked = locked
+	s.keys[entityURN.String()] = rec
+	return nil
+}
+
+// ReplaceRecord writes rec under the store's lock, so no other write can
+// come between the check of previousKey and the replacement.
+func (s *Store) ReplaceRecord(ctx context.Context, rec keyservice.KeyRecord, previousKey []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	entityKey := rec.EntityURN.String()
+	if previousKey != nil && !bytes.Equal(s.keys[entityKey].key, previousKey) {
+		return fmt.Errorf("entity %s: %w", entityKey, keyservice.ErrKeyChanged)
+	}
+	replacement := record{
+		entityURN:  rec.EntityURN,
+		key:        rec.Key,
+		updatedAt:  rec.UpdatedAt,
+		locked:     rec.Locked,
+		signatures: rec.Signatures,
+	}
+	if replacement.updatedAt.IsZero() {
+		replacement.updatedAt = time.Now().UTC()
+	}
+	if rec.Revoked {
+		replacement.revokedAt = rec.RevokedAt
+		if replacement.revokedAt.IsZero() {
+			replacement.revokedAt = time.Now().UTC()
+		}
+	}
+	s.keys[entityKey] = replacement
+	return nil
+}
+
+// ListKeys returns one page of matching records ordered by URN. The page
+// token is the URN of the last record on the previous page.
+func (s *Store) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = keyservice.DefaultPageSize
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	entityKeys := make([]string, 0, len(s.keys))
+	for entityKey, rec := range s.keys {
+		if entityKey <= pageToken || (rec.key == nil && !(filter.IncludeLocked && rec.locked)) {
+			continue
+		}
+		if filter.EntityType != "" && rec.entityURN.EntityType() != filter.EntityType {
+			continue
+		}
+		if rec.updatedAt.Before(filter.UpdatedSince) {
+			continue
+		}
+		entityKeys = append(entityKeys, entityKey)
+	}
+	sort.Strings(entityKeys)
+
+	var page keyservice.KeyPage
+	for i, entityKey := range entityKeys {
+		if i == pageSize {
+			page.NextPageToken = entityKeys[i-1]
+			break
+		}
+		page.Records = append(page.Records, s.keys[entityKey].keyRecord())
 	}
-	return key, nil
+	return page, nil
 }
@@ -6,8 +6,10 @@ package inmemory_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
 	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -46,5 +48,187 @@ func TestStore(t *testing.T) {
 		// Assert
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
+		assert.ErrorIs(t, err, keyservice.ErrKeyNotFound)
+	})
+	t.Run("ListKeys pages through matching records in URN order", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		var users []urn.URN
+		for _, id := range []string{"carol", "alice", "bob"} {
+			userURN, err := urn.New(urn.SecureMessaging, "user", id)
+			require.NoError(t, err)
+			require.NoError(t, store.StoreKey(ctx, userURN, []byte(id)))
+			users = append(users, userURN)
+		}
+		deviceURN, err := urn.New(urn.SecureMessaging, "device", "device-abc")
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(ctx, deviceURN, []byte("device")))
+		filter := keyservice.ListFilter{EntityType: "user", PageSize: 2}
+
+		// Act
+		first, err := store.ListKeys(ctx, filter, "")
+		require.NoError(t, err)
+		second, err := store.ListKeys(ctx, filter, first.NextPageToken)
+		require.NoError(t, err)
+
+		// Assert
+		require.Len(t, first.Records, 2)
+		assert.Equal(t, users[1], first.Records[0].EntityURN)
+		assert.Equal(t, users[2], first.Records[1].EntityURN)
+		assert.NotEmpty(t, first.NextPageToken)
+		require.Len(t, second.Records, 1)
+		assert.Equal(t, users[0], second.Records[0].EntityURN)
+		assert.Empty(t, second.NextPageToken)
+	})
+
+	t.Run("ListKeys filters by update time", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		oldURN, err := urn.New(urn.SecureMessaging, "user", "old")
+		require.NoError(t, err)
+		newURN, err := urn.New(urn.SecureMessaging, "user", "new")
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(ctx, oldURN, []byte("old")))
+		time.Sleep(2 * time.Millisecond)
+		since := time.Now()
+		require.NoError(t, store.StoreKey(ctx, newURN, []byte("new")))
+
+		// Act
+		page, err := store.ListKeys(ctx, keyservice.ListFilter{UpdatedSince: since}, "")
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, page.Records, 1)
+		assert.Equal(t, newURN, page.Records[0].EntityURN)
+		assert.False(t, page.Records[0].UpdatedAt.Before(since))
+	})
+
+	t.Run("Revoked key is kept on record but not served", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		testURN, err := urn.New(urn.SecureMessaging, "user", "revoked")
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(ctx, testURN, []byte("key")))
+
+		// Act
+		require.NoError(t, store.RevokeKey(ctx, testURN))
+		_, getErr := store.GetKey(ctx, testURN)
+		rec, recErr := store.GetRecord(ctx, testURN)
+
+		// Assert
+		assert.ErrorIs(t, getErr, keyservice.ErrKeyRevoked)
+		require.NoError(t, recErr)
+		assert.True(t, rec.Revoked)
+		assert.False(t, rec.RevokedAt.IsZero())
+		assert.Equal(t, []byte("key"), rec.Key)
+
+		require.NoError(t, store.StoreKey(ctx, testURN, []byte("new-key")))
+		key, err := store.GetKey(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new-key"), key)
+	})
+
+	t.Run("Locked entity rejects uploads and is not listed without a key", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		testURN, err := urn.New(urn.SecureMessaging, "user", "locked")
+		require.NoError(t, err)
+
+		// Act
+		require.NoError(t, store.SetLocked(ctx, testURN, true))
+		storeErr := store.StoreKey(ctx, testURN, []byte("key"))
+		page, err := store.ListKeys(ctx, keyservice.ListFilter{}, "")
+		require.NoError(t, err)
+
+		// Assert
+		assert.ErrorIs(t, storeErr, keyservice.ErrEntityLocked)
+		assert.Empty(t, page.Records)
+		require.NoError(t, store.SetLocked(ctx, testURN, false))
+		assert.NoError(t, store.StoreKey(ctx, testURN, []byte("key")))
+	})
+
+	t.Run("StoreKeys stores each key and fails locked entities individually", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+		require.NoError(t, err)
+		lockedURN, err := urn.New(urn.SecureMessaging, "user", "locked")
+		require.NoError(t, err)
+		ownerURN, err := urn.New(urn.SecureMessaging, "user", "owner")
+		require.NoError(t, err)
+		require.NoError(t, store.SetLocked(ctx, lockedURN, true))
+		signatures := []keyservice.KeySignature{{SignerURN: ownerURN, SignerKeyID: "owner-key-id", Signature: []byte("sig")}}
+
+		// Act
+		errs := store.StoreKeys(ctx, []keyservice.KeyWrite{
+			{EntityURN: aliceURN, Key: []byte("alice-key"), Signatures: signatures},
+			{EntityURN: lockedURN, Key: []byte("locked-key")},
+		})
+
+		// Assert
+		require.Len(t, errs, 2)
+		assert.NoError(t, errs[0])
+		assert.ErrorIs(t, errs[1], keyservice.ErrEntityLocked)
+		rec, err := store.GetRecord(ctx, aliceURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-key"), rec.Key)
+		assert.Equal(t, signatures, rec.Signatures)
+		_, err = store.GetKey(ctx, lockedURN)
+		assert.ErrorIs(t, err, keyservice.ErrKeyNotFound)
+	})
+
+	t.Run("Signatures are kept until the key is replaced", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		deviceURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+		require.NoError(t, err)
+		ownerURN, err := urn.New(urn.SecureMessaging, "user", "owner")
+		require.NoError(t, err)
+		signatures := []keyservice.KeySignature{{SignerURN: ownerURN, SignerKeyID: "owner-key-id", Signature: []byte("sig")}}
+
+		// Act
+		require.NoError(t, store.StoreSignedKey(ctx, deviceURN, []byte("key"), signatures))
+		signed, err := store.GetRecord(ctx, deviceURN)
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(ctx, deviceURN, []byte("new-key")))
+		unsigned, err := store.GetRecord(ctx, deviceURN)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, signatures, signed.Signatures)
+		assert.Empty(t, unsigned.Signatures)
+	})
+
+	t.Run("ReplaceRecord writes the whole record if the key is unchanged", func(t *testing.T) {
+		// Arrange
+		store := inmemory.New()
+		testURN, err := urn.New(urn.SecureMessaging, "user", "replaced")
+		require.NoError(t, err)
+		require.NoError(t, store.StoreKey(ctx, testURN, []byte("old-key")))
+		require.NoError(t, store.SetLocked(ctx, testURN, true))
+		updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		replacement := keyservice.KeyRecord{EntityURN: testURN, Key: []byte("new-key"), UpdatedAt: updatedAt, Revoked: true, Locked: true}
+
+		// Act
+		stale := store.ReplaceRecord(ctx, replacement, []byte("other-key"))
+		current := store.ReplaceRecord(ctx, replacement, []byte("old-key"))
+
+		// Assert
+		assert.ErrorIs(t, stale, keyservice.ErrKeyChanged)
+		require.NoError(t, current, "the lock does not block replacements")
+		rec, err := store.GetRecord(ctx, testURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new-key"), rec.Key)
+		assert.Equal(t, updatedAt, rec.UpdatedAt)
+		assert.True(t, rec.Revoked)
+		assert.True(t, rec.Locked)
+	})
+
+	t.Run("RevokeKey of an unknown entity returns ErrKeyNotFound", func(t *testing.T) {
+		store := inmemory.New()
+		testURN, err := urn.New(urn.SecureMessaging, "user", "missing")
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, store.RevokeKey(ctx, testURN), keyservice.ErrKeyNotFound)
 	})
 }
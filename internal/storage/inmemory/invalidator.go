@@ -0,0 +1,55 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Invalidator is an in-process implementation of the keyservice.Invalidator
+// interface. Every subscriber sharing the same Invalidator is notified
+// synchronously on Publish, which makes it suitable for tests that simulate
+// several replicas in a single process.
+type Invalidator struct {
+	sync.RWMutex
+	nextID      int
+	subscribers map[int]func(entityURN urn.URN)
+}
+
+// NewInvalidator creates a new in-memory invalidation bus.
+func NewInvalidator() *Invalidator {
+	return &Invalidator{subscribers: make(map[int]func(entityURN urn.URN))}
+}
+
+// Publish notifies every active subscriber that the key for entityURN changed.
+func (i *Invalidator) Publish(ctx context.Context, entityURN urn.URN) error {
+	i.RLock()
+	subscribers := make([]func(entityURN urn.URN), 0, len(i.subscribers))
+	for _, fn := range i.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	i.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(entityURN)
+	}
+	return nil
+}
+
+// Subscribe registers fn until ctx is cancelled.
+func (i *Invalidator) Subscribe(ctx context.Context, fn func(entityURN urn.URN)) error {
+	i.Lock()
+	id := i.nextID
+	i.nextID++
+	i.subscribers[id] = fn
+	i.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		i.Lock()
+		delete(i.subscribers, id)
+		i.Unlock()
+	}()
+	return nil
+}
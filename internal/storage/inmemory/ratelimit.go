@@ -0,0 +1,80 @@
+package inmemory
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+// rateLimitSweepInterval is how often idle, refilled buckets are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// bucket is a token bucket's state at the time it was last updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   keyservice.RateLimit
+}
+
+// RateLimitStore is a thread-safe in-memory implementation of the
+// keyservice.RateLimitStore interface. It limits a single replica.
+type RateLimitStore struct {
+	sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimitStore creates a new in-memory token bucket store.
+func NewRateLimitStore() *RateLimitStore {
+	return &RateLimitStore{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Take removes n tokens from the bucket for key if it holds enough.
+func (s *RateLimitStore) Take(ctx context.Context, key string, limit keyservice.RateLimit, n int) (keyservice.RateLimitResult, error) {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	need := float64(max(n, 1))
+	if b.tokens < need {
+		return keyservice.RateLimitResult{RetryAfter: retryAfter(need-b.tokens, limit.Rate)}, nil
+	}
+	b.tokens -= float64(n)
+	return keyservice.RateLimitResult{Allowed: true}, nil
+}
+
+// sweep drops buckets that have refilled completely, which are
+// indistinguishable from new ones. The caller must hold the lock.
+func (s *RateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// retryAfter is how long refilling missing tokens takes at rate per second,
+// or zero if the bucket never refills.
+func retryAfter(missing, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(missing / rate * float64(time.Second))
+}
@@ -0,0 +1,71 @@
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("A bucket allows its burst, then reports when to retry", func(t *testing.T) {
+		// Arrange
+		store := inmemory.NewRateLimitStore()
+		limit := keyservice.RateLimit{Rate: 0.5, Burst: 2}
+
+		// Act
+		first, err := store.Take(ctx, "client", limit, 1)
+		require.NoError(t, err)
+		second, err := store.Take(ctx, "client", limit, 1)
+		require.NoError(t, err)
+		third, err := store.Take(ctx, "client", limit, 1)
+		require.NoError(t, err)
+
+		// Assert
+		assert.True(t, first.Allowed)
+		assert.True(t, second.Allowed)
+		assert.False(t, third.Allowed)
+		assert.InDelta(t, 2*time.Second, third.RetryAfter, float64(100*time.Millisecond))
+	})
+
+	t.Run("Taking zero tokens only checks availability", func(t *testing.T) {
+		// Arrange
+		store := inmemory.NewRateLimitStore()
+		limit := keyservice.RateLimit{Rate: 0.001, Burst: 1}
+
+		// Act
+		check, err := store.Take(ctx, "client", limit, 0)
+		require.NoError(t, err)
+		spend, err := store.Take(ctx, "client", limit, 1)
+		require.NoError(t, err)
+		recheck, err := store.Take(ctx, "client", limit, 0)
+		require.NoError(t, err)
+
+		// Assert
+		assert.True(t, check.Allowed)
+		assert.True(t, spend.Allowed)
+		assert.False(t, recheck.Allowed)
+	})
+
+	t.Run("Buckets refill over time", func(t *testing.T) {
+		// Arrange
+		store := inmemory.NewRateLimitStore()
+		limit := keyservice.RateLimit{Rate: 100, Burst: 1}
+		_, err := store.Take(ctx, "client", limit, 1)
+		require.NoError(t, err)
+
+		// Act
+		time.Sleep(20 * time.Millisecond)
+		result, err := store.Take(ctx, "client", limit, 1)
+		require.NoError(t, err)
+
+		// Assert
+		assert.True(t, result.Allowed)
+	})
+}
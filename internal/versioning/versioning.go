@@ -0,0 +1,50 @@
+// Package versioning tags HTTP API responses with the deprecation policy of
+// the API version they were served under and counts requests per version,
+// so that old versions can be retired once their clients have moved on.
+package versioning
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// requests counts HTTP API requests by API version and route pattern.
+// Unversioned aliases are counted under v1 with their own route, so their
+// remaining use can be told apart.
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "keyservice_api_requests_total",
+	Help: "HTTP API requests by API version and route.",
+}, []string{"version", "route"})
+
+// Middleware serves the route registered under pattern as part of version.
+// Responses carry the Deprecation (RFC 9745), Sunset (RFC 8594) and Link
+// headers of policy, and the version is recorded in the request context for
+// api.APIVersionFromContext.
+func Middleware(version keyservice.APIVersion, policy keyservice.VersionPolicy, pattern string) func(http.Handler) http.Handler {
+	counter := requests.WithLabelValues(string(version), pattern)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter.Inc()
+			setPolicyHeaders(w.Header(), policy)
+			next.ServeHTTP(w, r.WithContext(api.ContextWithAPIVersion(r.Context(), version)))
+		})
+	}
+}
+
+// setPolicyHeaders announces policy in h.
+func setPolicyHeaders(h http.Header, policy keyservice.VersionPolicy) {
+	if !policy.Deprecated.IsZero() {
+		h.Set("Deprecation", "@"+strconv.FormatInt(policy.Deprecated.Unix(), 10))
+	}
+	if !policy.Sunset.IsZero() {
+		h.Set("Sunset", policy.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if policy.Link != "" {
+		h.Add("Link", "<"+policy.Link+`>; rel="deprecation"; type="text/html"`)
+	}
+}
@@ -0,0 +1,98 @@
+package versioning_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/versioning"
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requestCount reads keyservice_api_requests_total for version and route
+// from the default registry.
+func requestCount(t *testing.T, version, route string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "keyservice_api_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["version"] == version && labels["route"] == route {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestMiddleware(t *testing.T) {
+	var gotVersion keyservice.APIVersion
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotVersion = api.APIVersionFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(mw func(http.Handler) http.Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mw(handler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/keys/urn:sm:user:alice", nil))
+		return rr
+	}
+
+	t.Run("Deprecated versions announce their policy", func(t *testing.T) {
+		// Arrange
+		policy := keyservice.VersionPolicy{
+			Deprecated: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Sunset:     time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+			Link:       "https://keys.example.com/docs/v2-migration",
+		}
+		mw := versioning.Middleware(keyservice.APIVersionV1, policy, "GET /v1/keys/{entityURN}")
+
+		// Act
+		rr := serve(mw)
+
+		// Assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, keyservice.APIVersionV1, gotVersion)
+		assert.Equal(t, "@1767225600", rr.Header().Get("Deprecation"))
+		assert.Equal(t, "Wed, 01 Jul 2026 00:00:00 GMT", rr.Header().Get("Sunset"))
+		assert.Equal(t, `<https://keys.example.com/docs/v2-migration>; rel="deprecation"; type="text/html"`, rr.Header().Get("Link"))
+	})
+
+	t.Run("Current versions send no policy headers", func(t *testing.T) {
+		// Arrange
+		mw := versioning.Middleware(keyservice.APIVersionV2, keyservice.VersionPolicy{}, "GET /v2/keys/{entityURN}")
+
+		// Act
+		rr := serve(mw)
+
+		// Assert
+		assert.Equal(t, keyservice.APIVersionV2, gotVersion)
+		assert.Empty(t, rr.Header().Get("Deprecation"))
+		assert.Empty(t, rr.Header().Get("Sunset"))
+		assert.Empty(t, rr.Header().Get("Link"))
+	})
+
+	t.Run("Requests are counted per version and route", func(t *testing.T) {
+		// Arrange
+		mw := versioning.Middleware(keyservice.APIVersionV1, keyservice.VersionPolicy{}, "GET /keys/{entityURN}")
+		before := requestCount(t, "v1", "GET /keys/{entityURN}")
+
+		// Act
+		serve(mw)
+		serve(mw)
+
+		// Assert
+		assert.Equal(t, before+2, requestCount(t, "v1", "GET /keys/{entityURN}"))
+	})
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
 	"gopkg.in/yaml.v3"
 )
 
@@ -13,11 +15,163 @@ type Config struct {
 	ProjectID          string `yaml:"project_id"`
 	HTTPListenAddr     string `yaml:"http_listen_addr"`
 	IdentityServiceURL string `yaml:"identity_service_url"`
+	// GRPCListenAddr serves the gRPC API on this address if set. It uses
+	// the same TLS configuration as HTTP.
+	GRPCListenAddr string `yaml:"grpc_listen_addr"`
 
 	// CORS configuration is now also loaded from the YAML file.
 	Cors struct {
 		AllowedOrigins []string `yaml:"allowed_origins"`
 	} `yaml:"cors"`
+
+	// Cache configures the per-replica key record cache. A zero TTL disables
+	// caching. Cached records are evicted across replicas by a Firestore
+	// snapshot listener; the TTL bounds staleness should an invalidation
+	// ever be missed.
+	Cache struct {
+		TTL time.Duration `yaml:"ttl"`
+	} `yaml:"cache"`
+
+	// Admin controls access to the /admin routes: callers must be one of
+	// Subjects or hold Role in their RoleClaim (default "roles"). If
+	// JWKSURL is set, admin tokens are validated against it instead of the
+	// identity service.
+	Admin struct {
+		Subjects  []string `yaml:"subjects"`
+		RoleClaim string   `yaml:"role_claim"`
+		Role      string   `yaml:"role"`
+		JWKSURL   string   `yaml:"jwks_url"`
+	} `yaml:"admin"`
+
+	// Archive configures the keys used to sign exports and verify imports.
+	// Both are PEM files: a PKCS #8 Ed25519 private key for signing and PKIX
+	// Ed25519 public keys for verification.
+	Archive struct {
+		SigningKeyFile  string   `yaml:"signing_key_file"`
+		TrustedKeyFiles []string `yaml:"trusted_key_files"`
+	} `yaml:"archive"`
+
+	// Encryption enables envelope encryption of stored keys. Set at most one
+	// of KeyringFile (a local JSON keyring of AES-256 keys) or KMSKey (a
+	// Cloud KMS crypto key name). Leaving both empty stores keys in clear.
+	Encryption struct {
+		KeyringFile string `yaml:"keyring_file"`
+		KMSKey      string `yaml:"kms_key"`
+	} `yaml:"encryption"`
+
+	// Authorization points at a policy file governing key writes. If empty,
+	// keyservice.DefaultPolicy applies.
+	Authorization struct {
+		PolicyFile string `yaml:"policy_file"`
+	} `yaml:"authorization"`
+
+	// Tokens sets the aud, iss and scope claims required of bearer tokens.
+	// The top-level fields apply to every authenticated route; Routes
+	// refines them per route pattern, e.g. "POST /keys/{entityURN}".
+	Tokens struct {
+		keyservice.TokenRequirements `yaml:",inline"`
+		Routes                       map[string]keyservice.TokenRequirements `yaml:"routes"`
+	} `yaml:"tokens"`
+
+	// Reads controls who may fetch keys: public (the default), authenticated
+	// or contacts. In contacts mode a reader may fetch their own keys and
+	// those of the entities listed in the ContactsClaim of their token.
+	Reads struct {
+		Mode          string `yaml:"mode"`
+		ContactsClaim string `yaml:"contacts_claim"`
+	} `yaml:"reads"`
+
+	// RateLimit slows down enumeration through key lookups. Rates are tokens
+	// per second per client; every lookup spends a hits token and lookups of
+	// unknown entities also spend a misses token. Unset limits are
+	// unlimited. KeyBy may only include subject in an authenticated read
+	// mode. Buckets, and the discovery quotas, are kept in the Firestore
+	// Collection, shared by every replica and kept across restarts, or in
+	// memory, per replica, if it is empty.
+	RateLimit struct {
+		Hits              keyservice.RateLimit      `yaml:"hits"`
+		Misses            keyservice.RateLimit      `yaml:"misses"`
+		KeyBy             []keyservice.RateLimitKey `yaml:"key_by"`
+		TrustForwardedFor bool                      `yaml:"trust_forwarded_for"`
+		Collection        string                    `yaml:"collection"`
+	} `yaml:"rate_limit"`
+
+	// Identifiers sets the Salt clients hash email addresses and phone
+	// numbers with for GET /.well-known/keys/hu/{hash}. Uploads may only
+	// register the hashes of their caller's verified "email" and
+	// "phone_number" claims; registration is disabled while Salt is empty.
+	// The salt is not secret.
+	Identifiers struct {
+		Salt string `yaml:"salt"`
+	} `yaml:"identifiers"`
+
+	// Discovery sets each subject's quota of hash prefixes for
+	// POST /discovery, in prefixes per second; unset applies
+	// keyservice.DefaultDiscoveryRateLimit. Quotas are kept with the
+	// RateLimit buckets, and discovery is only served when those are kept
+	// in the shared RateLimit.Collection.
+	Discovery struct {
+		RateLimit keyservice.RateLimit `yaml:"rate_limit"`
+	} `yaml:"discovery"`
+
+	// ProofOfPossession makes uploads of signature-capable keys sign a
+	// challenge from POST /keys/{entityURN}/challenge if Required. The
+	// challenges are kept in the Firestore Collection, default
+	// "key-challenges", and expire after ChallengeTTL.
+	ProofOfPossession struct {
+		Required     bool          `yaml:"required"`
+		ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+		Collection   string        `yaml:"collection"`
+	} `yaml:"proof_of_possession"`
+
+	// CrossSigning makes every device key upload carry a signature by the
+	// owner's identity key if Required. Signed uploads are verified either
+	// way.
+	CrossSigning struct {
+		Required bool `yaml:"required"`
+	} `yaml:"cross_signing"`
+
+	// TLS terminates HTTPS in the service if CertFile and KeyFile are set.
+	// Client certificates issued by a CA in ClientCAFile are verified
+	// according to ClientAuth (none, optional or require) and those matching
+	// one of Clients authenticate as its principal in place of a token. All
+	// files are re-read within ReloadInterval of changing.
+	TLS struct {
+		CertFile       string                         `yaml:"cert_file"`
+		KeyFile        string                         `yaml:"key_file"`
+		ClientCAFile   string                         `yaml:"client_ca_file"`
+		ClientAuth     string                         `yaml:"client_auth"`
+		ReloadInterval time.Duration                  `yaml:"reload_interval"`
+		Clients        []keyservice.ClientCertMapping `yaml:"clients"`
+	} `yaml:"tls"`
+
+	// APIVersions announces the deprecation of HTTP API versions (v1, v2)
+	// through the Deprecation, Sunset and Link headers of their responses.
+	// Unversioned paths are aliases of v1 and share its policy.
+	APIVersions keyservice.VersionPolicies `yaml:"api_versions"`
+
+	// Audit appends a hash-chained record of every key mutation to the
+	// Firestore Collection; keyservice-audit verifies the chain. If empty,
+	// mutations are only audited in the log. Required makes mutations
+	// whose record cannot be appended fail; it needs a Collection.
+	Audit struct {
+		Collection string `yaml:"collection"`
+		Required   bool   `yaml:"required"`
+	} `yaml:"audit"`
+
+	// Federation resolves the keys of entities in TrustedDomains, those
+	// whose ID ends in @domain, from the domains' own key services, found
+	// through https://{domain}/.well-known/key-service and cached for
+	// CacheTTL (default 5m). If SigningKeyFile, a PEM PKCS #8 Ed25519
+	// private key, is set this service answers partners' lookups of the
+	// entities of Domain in turn, advertising itself at PublicURL.
+	Federation struct {
+		Domain         string                       `yaml:"domain"`
+		PublicURL      string                       `yaml:"public_url"`
+		SigningKeyFile string                       `yaml:"signing_key_file"`
+		CacheTTL       time.Duration                `yaml:"cache_ttl"`
+		TrustedDomains []keyservice.FederatedDomain `yaml:"trusted_domains"`
+	} `yaml:"federation"`
 }
 
 // Load reads a YAML file from the given path and returns a Config struct.
@@ -35,3 +189,21 @@ func Load(path string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// LoadPolicy reads and validates an authorization policy YAML file.
+func LoadPolicy(path string) (*keyservice.Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file at %s: %w", path, err)
+	}
+
+	var policy keyservice.Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy YAML: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy in %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
@@ -1,19 +1,211 @@
 package keyservice
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/grpcapi"
+	"github.com/illmade-knight/go-key-service/internal/ratelimit"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/internal/versioning"
 	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-key-service/pkg/keyservicepb"
 	"github.com/illmade-knight/go-microservice-base/pkg/microservice"
 	"github.com/illmade-knight/go-microservice-base/pkg/middleware"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // Wrapper now embeds the BaseServer to inherit standard server functionality.
 type Wrapper struct {
 	*microservice.BaseServer
 	logger zerolog.Logger
+	// tlsServer serves the base server's mux over TLS when WithTLS is used.
+	tlsServer *http.Server
+	// grpcServer serves the gRPC API on grpcAddr when GRPCListenAddr is
+	// set; health reports its readiness.
+	grpcServer *grpc.Server
+	grpcAddr   string
+	health     *health.Server
+	// routes lists the patterns registered by New.
+	routes []string
+}
+
+// Routes returns the patterns of the HTTP routes registered by New, in the
+// order they were registered, including the /v1 and /v2 variants of each.
+// The base server's own routes are not listed.
+func (w *Wrapper) Routes() []string {
+	return w.routes
+}
+
+// GRPCServer returns the gRPC server, or nil if the gRPC API is disabled.
+// It can be served on a listener of the caller's choosing instead of
+// through Start.
+func (w *Wrapper) GRPCServer() *grpc.Server {
+	return w.grpcServer
+}
+
+// SetReady marks the service ready or not, over HTTP and gRPC health.
+func (w *Wrapper) SetReady(ready bool) {
+	w.BaseServer.SetReady(ready)
+	if w.health == nil {
+		return
+	}
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if ready {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	w.health.SetServingStatus("", status)
+	w.health.SetServingStatus(keyservicepb.KeyService_ServiceDesc.ServiceName, status)
+}
+
+// Start serves the service, over TLS if it was configured with WithTLS. The
+// gRPC API, if enabled, is served in the background.
+func (w *Wrapper) Start() error {
+	if w.grpcServer != nil {
+		lis, err := net.Listen("tcp", w.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for gRPC on %s: %w", w.grpcAddr, err)
+		}
+		go func() {
+			if err := w.grpcServer.Serve(lis); err != nil {
+				w.logger.Error().Err(err).Msg("gRPC server failed")
+			}
+		}()
+		w.logger.Info().Str("address", w.grpcAddr).Msg("gRPC server listening")
+	}
+	if w.tlsServer == nil {
+		return w.BaseServer.Start()
+	}
+	return w.tlsServer.ListenAndServeTLS("", "")
+}
+
+// Shutdown gracefully stops the service. Open gRPC streams are cut off if
+// they outlast ctx.
+func (w *Wrapper) Shutdown(ctx context.Context) error {
+	if w.grpcServer != nil {
+		w.health.Shutdown()
+		stopped := make(chan struct{})
+		go func() {
+			w.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			w.grpcServer.Stop()
+		}
+	}
+	if w.tlsServer == nil {
+		return w.BaseServer.Shutdown(ctx)
+	}
+	return errors.Join(w.tlsServer.Shutdown(ctx), w.BaseServer.Shutdown(ctx))
+}
+
+// Option customises the service assembled by New.
+type Option func(*options)
+
+// options holds the optional dependencies of the service.
+type options struct {
+	authorizer keyservice.Authorizer
+	devices    keyservice.DeviceRegistry
+	readAuthz  keyservice.ReadAuthorizer
+	rateLimits keyservice.RateLimitStore
+	adminAuth  func(http.Handler) http.Handler
+	auditSink  keyservice.AuditSink
+	tlsConfig  *tls.Config
+	certMapper keyservice.ClientCertMapper
+	challenges keyservice.ChallengeStore
+	invalidate keyservice.Invalidator
+	resolver   keyservice.KeyResolver
+	hashIndex  keyservice.IdentifierIndex
+}
+
+// WithAuthorizer replaces the default authorization policy for key writes.
+func WithAuthorizer(authorizer keyservice.Authorizer) Option {
+	return func(o *options) { o.authorizer = authorizer }
+}
+
+// WithDeviceRegistry enables the device enrollment routes and lets device
+// owners store their devices' keys.
+func WithDeviceRegistry(devices keyservice.DeviceRegistry) Option {
+	return func(o *options) { o.devices = devices }
+}
+
+// WithReadAuthorizer decides which other entities' keys a reader may fetch
+// when the configured ReadMode is contacts.
+func WithReadAuthorizer(readAuthorizer keyservice.ReadAuthorizer) Option {
+	return func(o *options) { o.readAuthz = readAuthorizer }
+}
+
+// WithRateLimitStore holds the lookup rate limit buckets and discovery
+// quotas in store, which may be shared between replicas. By default each
+// replica keeps its own lookup buckets in memory and contact discovery is
+// disabled, as quotas kept in memory would reset on every restart and
+// multiply with the replicas.
+func WithRateLimitStore(store keyservice.RateLimitStore) Option {
+	return func(o *options) { o.rateLimits = store }
+}
+
+// WithAdminAuthMiddleware authenticates the /admin routes with adminAuth,
+// typically validating tokens against a separate admin JWKS, instead of the
+// middleware used for the other routes.
+func WithAdminAuthMiddleware(adminAuth func(http.Handler) http.Handler) Option {
+	return func(o *options) { o.adminAuth = adminAuth }
+}
+
+// WithAuditSink appends a hash-chained record of every key mutation to
+// sink. Without it, mutations are only audited in the log.
+func WithAuditSink(sink keyservice.AuditSink) Option {
+	return func(o *options) { o.auditSink = sink }
+}
+
+// WithTLS makes Start serve HTTPS using tlsConfig, which also decides
+// whether clients must present certificates.
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(o *options) { o.tlsConfig = tlsConfig }
+}
+
+// WithClientCertMapper lets callers presenting a verified TLS client
+// certificate that mapper maps to a principal use the authenticated routes
+// without a bearer token. It only takes effect together with WithTLS.
+func WithClientCertMapper(mapper keyservice.ClientCertMapper) Option {
+	return func(o *options) { o.certMapper = mapper }
+}
+
+// WithChallengeStore keeps proof-of-possession challenges in store, which
+// should be shared between replicas. By default each replica keeps its own
+// challenges in memory, so a challenge must be redeemed where it was issued.
+func WithChallengeStore(store keyservice.ChallengeStore) Option {
+	return func(o *options) { o.challenges = store }
+}
+
+// WithInvalidator lets gRPC clients watch for key changes announced by
+// invalidator. It should observe writes from every replica.
+func WithInvalidator(invalidator keyservice.Invalidator) Option {
+	return func(o *options) { o.invalidate = invalidator }
+}
+
+// WithKeyResolver resolves the keys of entities in trusted federated
+// domains through resolver instead of the store.
+func WithKeyResolver(resolver keyservice.KeyResolver) Option {
+	return func(o *options) { o.resolver = resolver }
+}
+
+// WithIdentifierIndex enables the registration of hashed identifiers at
+// key upload and their lookup at /.well-known/keys/hu/{hash}.
+func WithIdentifierIndex(identifiers keyservice.IdentifierIndex) Option {
+	return func(o *options) { o.hashIndex = identifiers }
 }
 
 // New creates and wires up the entire key service.
@@ -22,15 +214,78 @@ func New(
 	store keyservice.Store,
 	authMiddleware func(http.Handler) http.Handler, // Accept middleware via DI
 	logger zerolog.Logger,
+	opts ...Option,
 ) *Wrapper {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	// 1. Create the standard base server.
 	baseServer := microservice.NewBaseServer(logger, cfg.HTTPListenAddr)
 
 	// 2. Create the service-specific API handlers.
-	apiHandler := &api.API{Store: store, Logger: logger}
+	adminRoleClaim := cfg.AdminRoleClaim
+	if adminRoleClaim == "" {
+		adminRoleClaim = "roles"
+	}
+	rateLimits := o.rateLimits
+	if rateLimits == nil {
+		rateLimits = inmemory.NewRateLimitStore()
+	}
+	challenges := o.challenges
+	if challenges == nil {
+		challenges = inmemory.NewChallengeStore()
+	}
+	apiHandler := &api.API{
+		Store:                     store,
+		Logger:                    logger,
+		AdminSubjects:             cfg.AdminSubjects,
+		AdminRoleClaim:            adminRoleClaim,
+		AdminRole:                 cfg.AdminRole,
+		ArchiveSigningKey:         cfg.ArchiveSigningKey,
+		ArchiveTrustedKeys:        cfg.ArchiveTrustedKeys,
+		Authorizer:                o.authorizer,
+		Devices:                   o.devices,
+		ReadMode:                  cfg.ReadMode,
+		ReadAuthorizer:            o.readAuthz,
+		AuditSink:                 o.auditSink,
+		Challenges:                challenges,
+		ChallengeTTL:              cfg.ChallengeTTL,
+		RequireProofOfPossession:  cfg.RequireProofOfPossession,
+		RequireIdentitySignatures: cfg.RequireIdentitySignatures,
+		RequireAuditLog:           cfg.RequireAuditLog,
+		KeyResolver:               o.resolver,
+		FederationSigningKey:      cfg.FederationSigningKey,
+		FederationDomain:          strings.ToLower(cfg.FederationDomain),
+		FederationURL:             cfg.FederationURL,
+		Identifiers:               o.hashIndex,
+		IdentifierSalt:            cfg.IdentifierSalt,
+		DiscoveryQuotas:           o.rateLimits,
+		DiscoveryRateLimit:        cfg.DiscoveryRateLimit,
+	}
 
 	// 3. Get the mux from the base server and register routes.
 	mux := baseServer.Mux()
+	// Every route is served under each API version's prefix and, as an
+	// alias of v1, without one.
+	type versionPrefix struct {
+		prefix  string
+		version keyservice.APIVersion
+	}
+	prefixes := []versionPrefix{{"", keyservice.APIVersionV1}}
+	for _, version := range keyservice.APIVersions {
+		prefixes = append(prefixes, versionPrefix{"/" + string(version), version})
+	}
+	var routes []string
+	handle := func(pattern string, h http.Handler) {
+		method, path, _ := strings.Cut(pattern, " ")
+		for _, p := range prefixes {
+			versioned := method + " " + p.prefix + path
+			routes = append(routes, versioned)
+			mux.Handle(versioned, versioning.Middleware(p.version, cfg.APIVersions[p.version], versioned)(h))
+		}
+	}
 
 	// 4. Create CORS middleware from the loaded config.
 	corsMiddleware := middleware.NewCorsMiddleware(middleware.CorsConfig{
@@ -38,20 +293,147 @@ func New(
 		Role:           middleware.CorsRoleDefault,
 	})
 
-	// 5. Apply middleware to the handlers.
-	storeKeyHandler := http.HandlerFunc(apiHandler.StoreKeyHandler)
-	mux.Handle("POST /keys/{entityURN}", corsMiddleware(authMiddleware(storeKeyHandler)))
+	// 5. Apply middleware to the handlers. Authenticated routes also expose
+	// the token's claims to the authorization layer and enforce the
+	// audience, issuer and scopes configured for their pattern.
+	// Callers with a mapped client certificate may stand in for a token.
+	if o.certMapper != nil {
+		authMiddleware = api.ClientCertAuth(o.certMapper, authMiddleware)
+		if o.adminAuth != nil {
+			o.adminAuth = api.ClientCertAuth(o.certMapper, o.adminAuth)
+		}
+	}
+	authChain := func(auth func(http.Handler) http.Handler, pattern string) func(http.Handler) http.Handler {
+		requireToken := apiHandler.RequireToken(cfg.TokenRequirementsFor(pattern))
+		return func(h http.Handler) http.Handler {
+			return auth(api.ClaimsMiddleware(requireToken(h)))
+		}
+	}
+	authenticatedWith := func(auth func(http.Handler) http.Handler, pattern string, h http.Handler) {
+		handle(pattern, corsMiddleware(authChain(auth, pattern)(h)))
+	}
+	authenticated := func(pattern string, h http.Handler) {
+		authenticatedWith(authMiddleware, pattern, h)
+	}
+	adminAuth := authMiddleware
+	if o.adminAuth != nil {
+		adminAuth = o.adminAuth
+	}
+	admin := func(pattern string, h http.HandlerFunc) {
+		authenticatedWith(adminAuth, pattern, apiHandler.AdminOnly(h))
+	}
+
+	// Read endpoints only need CORS in the default public read mode; the
+	// other modes authenticate them like writes. Lookups are rate limited if
+	// configured.
+	limitLookups := func(h http.Handler) http.Handler { return h }
+	if !cfg.LookupRateLimit.IsZero() {
+		limitLookups = ratelimit.New(rateLimits, cfg.LookupRateLimit, logger).Middleware
+	}
+	readChain := func(pattern string) func(http.Handler) http.Handler {
+		if cfg.ReadMode == "" || cfg.ReadMode == keyservice.ReadModePublic {
+			return limitLookups
+		}
+		auth := authChain(authMiddleware, pattern)
+		return func(h http.Handler) http.Handler { return auth(limitLookups(h)) }
+	}
+	readable := func(pattern string, h http.Handler) {
+		handle(pattern, corsMiddleware(readChain(pattern)(h)))
+	}
+
+	authenticated("POST /keys/{entityURN}", http.HandlerFunc(apiHandler.StoreKeyHandler))
+	authenticated("POST /keys:batchStore", http.HandlerFunc(apiHandler.BatchStoreKeysHandler))
+	readable("GET /keys/{entityURN}", http.HandlerFunc(apiHandler.GetKeyHandler))
+	readable("POST /keys:batchGet", http.HandlerFunc(apiHandler.BatchGetKeysHandler))
+	authenticated("POST /keys/{entityURN}/challenge", http.HandlerFunc(apiHandler.ChallengeHandler))
 
-	// Public endpoint, only needs CORS.
-	getKeyHandler := http.HandlerFunc(apiHandler.GetKeyHandler)
-	mux.Handle("GET /keys/{entityURN}", corsMiddleware(getKeyHandler))
+	// Device ownership: enrollment is authenticated, listing device keys
+	// follows the read mode like GET /keys/{entityURN}.
+	authenticated("PUT /keys/{entityURN}/devices/{deviceURN}", http.HandlerFunc(apiHandler.EnrollDeviceHandler))
+	authenticated("DELETE /keys/{entityURN}/devices/{deviceURN}", http.HandlerFunc(apiHandler.UnenrollDeviceHandler))
+	authenticated("POST /keys/{entityURN}/devices/{deviceURN}/challenge", http.HandlerFunc(apiHandler.EnrollmentChallengeHandler))
+	readable("GET /keys/{entityURN}/devices", http.HandlerFunc(apiHandler.ListDeviceKeysHandler))
+
+	// Admin endpoints require authentication and an administrator subject
+	// or role.
+	admin("GET /admin/keys", apiHandler.ListKeysHandler)
+	admin("GET /admin/keys/{entityURN}", apiHandler.InspectKeyHandler)
+	admin("POST /admin/keys/{entityURN}/revoke", apiHandler.RevokeKeyHandler)
+	admin("PUT /admin/keys/{entityURN}/lock", apiHandler.LockEntityHandler)
+	admin("DELETE /admin/keys/{entityURN}/lock", apiHandler.UnlockEntityHandler)
+	admin("POST /admin/bulk", apiHandler.BulkAdminHandler)
+	admin("GET /admin/export", apiHandler.ExportHandler)
+	admin("POST /admin/import", apiHandler.ImportHandler)
+	admin("PUT /admin/identifiers/{hash}", apiHandler.AssignIdentifierHandler)
+	admin("DELETE /admin/identifiers/{hash}", apiHandler.RemoveIdentifierHandler)
+
+	// Federation: partner domains discover this service through the public
+	// discovery document and look keys up like any other reader.
+	handle("GET "+keyservice.FederationDiscoveryPath, corsMiddleware(http.HandlerFunc(apiHandler.FederationDocumentHandler)))
+	readable("GET /federation/keys/{entityURN}", http.HandlerFunc(apiHandler.FederatedKeyHandler))
+
+	// Web Key Directory style lookup by the hash of an email address or
+	// phone number, following the read mode like GET /keys/{entityURN}.
+	readable("GET /.well-known/keys/hu/{hash}", http.HandlerFunc(apiHandler.IdentifierKeyHandler))
+	authenticated("DELETE /keys/{entityURN}/identifiers/{hash}", http.HandlerFunc(apiHandler.UnregisterIdentifierHandler))
+
+	// Contact discovery is always authenticated: its quota is per subject.
+	authenticated("POST /discovery", http.HandlerFunc(apiHandler.DiscoveryHandler))
+
+	// The OpenAPI description of these routes is public.
+	handle("GET /openapi.json", corsMiddleware(http.HandlerFunc(serveOpenAPI)))
 
 	// OPTIONS handler for CORS preflight requests.
 	optionsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-	mux.Handle("OPTIONS /keys/{entityURN}", corsMiddleware(optionsHandler))
+	handle("OPTIONS /keys/{entityURN}", corsMiddleware(optionsHandler))
+	handle("OPTIONS /keys:batchGet", corsMiddleware(optionsHandler))
+	handle("OPTIONS /keys:batchStore", corsMiddleware(optionsHandler))
+	handle("OPTIONS /keys/{entityURN}/challenge", corsMiddleware(optionsHandler))
+	handle("OPTIONS /keys/{entityURN}/devices/{deviceURN}", corsMiddleware(optionsHandler))
+	handle("OPTIONS /keys/{entityURN}/devices/{deviceURN}/challenge", corsMiddleware(optionsHandler))
+	handle("OPTIONS /keys/{entityURN}/identifiers/{hash}", corsMiddleware(optionsHandler))
+	handle("OPTIONS /discovery", corsMiddleware(optionsHandler))
 
-	return &Wrapper{
+	wrapper := &Wrapper{
 		BaseServer: baseServer,
 		logger:     logger,
+		routes:     routes,
+	}
+
+	// 6. Serve the gRPC API if configured. Its methods are authenticated and
+	// rate limited by the same chains as the equivalent HTTP routes.
+	if cfg.GRPCListenAddr != "" {
+		authenticator := &grpcapi.Authenticator{Routes: map[string]func(http.Handler) http.Handler{
+			keyservicepb.KeyService_StoreKey_FullMethodName:     authChain(authMiddleware, "POST /keys/{entityURN}"),
+			keyservicepb.KeyService_GetKey_FullMethodName:       readChain("GET /keys/{entityURN}"),
+			keyservicepb.KeyService_BatchGetKeys_FullMethodName: readChain("POST /keys:batchGet"),
+			keyservicepb.KeyService_WatchKeys_FullMethodName:    readChain("POST /keys:batchGet"),
+		}}
+		serverOpts := []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(authenticator.UnaryInterceptor()),
+			grpc.ChainStreamInterceptor(authenticator.StreamInterceptor()),
+		}
+		if o.tlsConfig != nil {
+			serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(o.tlsConfig)))
+		}
+		wrapper.grpcServer = grpc.NewServer(serverOpts...)
+		wrapper.grpcAddr = cfg.GRPCListenAddr
+		keyservicepb.RegisterKeyServiceServer(wrapper.grpcServer, &grpcapi.Server{
+			API:         apiHandler,
+			Invalidator: o.invalidate,
+			Logger:      logger,
+		})
+		wrapper.health = health.NewServer()
+		healthpb.RegisterHealthServer(wrapper.grpcServer, wrapper.health)
+		wrapper.SetReady(false)
+	}
+	if o.tlsConfig != nil {
+		wrapper.tlsServer = &http.Server{
+			Addr:              cfg.HTTPListenAddr,
+			Handler:           mux,
+			TLSConfig:         o.tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
 	}
+	return wrapper
 }
@@ -4,23 +4,41 @@ package keyservice_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/illmade-knight/go-key-service/internal/mtls"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/keyservice"
+	ks "github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-key-service/pkg/keyservicepb"
 	"github.com/illmade-knight/go-key-service/test"
 	"github.com/illmade-knight/go-microservice-base/pkg/middleware"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
 	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 // --- Test Setup Helpers ---
@@ -62,6 +80,25 @@ func createTestToken(t *testing.T, privateKey *rsa.PrivateKey, userID string) st
 	return string(signed)
 }
 
+// createScopedTestToken generates a valid RS256 JWT carrying an audience,
+// issuer and space-delimited scope claim.
+func createScopedTestToken(t *testing.T, privateKey *rsa.PrivateKey, userID, audience, issuer, scope string) string {
+	t.Helper()
+	token, err := jwt.NewBuilder().
+		Subject(userID).
+		Audience([]string{audience}).
+		Issuer(issuer).
+		Claim("scope", scope).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(time.Hour)).
+		Build()
+	require.NoError(t, err)
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, privateKey))
+	require.NoError(t, err)
+	return string(signed)
+}
+
 // --- Main Test ---
 
 func TestServiceIntegration(t *testing.T) {
@@ -143,3 +180,314 @@ func TestServiceIntegration(t *testing.T) {
 		assert.Equal(t, "the-key-to-find", string(body))
 	})
 }
+
+func TestServiceTokenRequirements(t *testing.T) {
+	// --- 1. Setup ---
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwksServer := newJWKSTestServer(t, privateKey)
+	t.Cleanup(jwksServer.Close)
+	authMiddleware, err := middleware.NewJWKSAuthMiddleware(jwksServer.URL)
+	require.NoError(t, err)
+
+	const audience = "key-service"
+	const issuer = "https://id.example.com"
+	cfg := &ks.Config{
+		HTTPListenAddr: ":0",
+		CorsConfig: middleware.CorsConfig{
+			AllowedOrigins: []string{"*"},
+			Role:           middleware.CorsRoleDefault,
+		},
+		TokenRequirements: ks.TokenRequirements{Audiences: []string{audience}, Issuer: issuer},
+		RouteTokenRequirements: map[string]ks.TokenRequirements{
+			"POST /keys/{entityURN}": {Scopes: []string{"keys:write"}},
+		},
+	}
+	service := keyservice.New(cfg, inmemory.New(), authMiddleware, zerolog.Nop())
+	require.NoError(t, cfg.ValidateTokenRoutes(service.Routes()))
+	keyServiceServer := httptest.NewServer(service.Mux())
+	t.Cleanup(keyServiceServer.Close)
+
+	testURN, _ := urn.New(urn.SecureMessaging, "user", "user-123")
+	storeKey := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, keyServiceServer.URL+"/keys/"+testURN.String(), bytes.NewBufferString("my-public-key"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	// --- 2. Test Cases ---
+
+	t.Run("StoreKey - Success with audience, issuer and scope", func(t *testing.T) {
+		resp := storeKey(createScopedTestToken(t, privateKey, "user-123", audience, issuer, "keys:write"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+
+	t.Run("StoreKey - 401 for a token meant for another audience", func(t *testing.T) {
+		resp := storeKey(createScopedTestToken(t, privateKey, "user-123", "another-service", issuer, "keys:write"))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		var errResp response.APIError
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+		assert.Equal(t, "Invalid token audience", errResp.Error)
+	})
+
+	t.Run("StoreKey - 401 for a token from another issuer", func(t *testing.T) {
+		resp := storeKey(createScopedTestToken(t, privateKey, "user-123", audience, "https://evil.example.com", "keys:write"))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("StoreKey - 403 without the keys:write scope", func(t *testing.T) {
+		resp := storeKey(createScopedTestToken(t, privateKey, "user-123", audience, issuer, "keys:read"))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestServiceAuthenticatedReads(t *testing.T) {
+	// --- 1. Setup ---
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwksServer := newJWKSTestServer(t, privateKey)
+	t.Cleanup(jwksServer.Close)
+	authMiddleware, err := middleware.NewJWKSAuthMiddleware(jwksServer.URL)
+	require.NoError(t, err)
+
+	cfg := &ks.Config{
+		HTTPListenAddr: ":0",
+		CorsConfig: middleware.CorsConfig{
+			AllowedOrigins: []string{"*"},
+			Role:           middleware.CorsRoleDefault,
+		},
+		ReadMode: ks.ReadModeAuthenticated,
+	}
+	store := inmemory.New()
+	testURN, _ := urn.New(urn.SecureMessaging, "user", "user-123")
+	require.NoError(t, store.StoreKey(context.Background(), testURN, []byte("my-public-key")))
+	service := keyservice.New(cfg, store, authMiddleware, zerolog.Nop())
+	keyServiceServer := httptest.NewServer(service.Mux())
+	t.Cleanup(keyServiceServer.Close)
+
+	getKey := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, keyServiceServer.URL+"/keys/"+testURN.String(), nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	// --- 2. Test Cases ---
+
+	t.Run("GetKey - 401 without a token", func(t *testing.T) {
+		resp := getKey("")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("GetKey - Success with a valid token for another user", func(t *testing.T) {
+		resp := getKey(createTestToken(t, privateKey, "another-user-456"))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "my-public-key", string(body))
+	})
+}
+
+func TestServiceMutualTLS(t *testing.T) {
+	// --- 1. Setup ---
+	ca, err := test.NewCertificateAuthority("test-ca")
+	require.NoError(t, err)
+	serverCert, _, _, err := ca.IssueServer()
+	require.NoError(t, err)
+	routerCert, err := ca.IssueClient(pkix.Name{CommonName: "message-router"}, "spiffe://example.org/ns/messaging/sa/message-router")
+	require.NoError(t, err)
+	strangerCert, err := ca.IssueClient(pkix.Name{CommonName: "stranger"}, "")
+	require.NoError(t, err)
+
+	mapper, err := mtls.NewMapper([]ks.ClientCertMapping{
+		{SPIFFEID: "spiffe://example.org/ns/messaging/sa/message-router", Principal: "service:message-router"},
+	})
+	require.NoError(t, err)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+
+	cfg := &ks.Config{
+		HTTPListenAddr: ":0",
+		CorsConfig: middleware.CorsConfig{
+			AllowedOrigins: []string{"*"},
+			Role:           middleware.CorsRoleDefault,
+		},
+		ReadMode:          ks.ReadModeAuthenticated,
+		TokenRequirements: ks.TokenRequirements{Audiences: []string{"key-service"}},
+	}
+	store := inmemory.New()
+	testURN, _ := urn.New(urn.SecureMessaging, "user", "user-123")
+	require.NoError(t, store.StoreKey(context.Background(), testURN, []byte("my-public-key")))
+	service := keyservice.New(cfg, store, func(next http.Handler) http.Handler { return next }, zerolog.Nop(),
+		keyservice.WithTLS(tlsConfig), keyservice.WithClientCertMapper(mapper))
+
+	server := httptest.NewUnstartedServer(service.Mux())
+	server.TLS = tlsConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	getKey := func(clientCert *tls.Certificate) *http.Response {
+		clientTLS := &tls.Config{RootCAs: ca.Pool(), ServerName: "localhost"}
+		if clientCert != nil {
+			clientTLS.Certificates = []tls.Certificate{*clientCert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+		resp, err := client.Get(server.URL + "/keys/" + testURN.String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	// --- 2. Test Cases ---
+
+	t.Run("GetKey - Success with a mapped client certificate and no token", func(t *testing.T) {
+		resp := getKey(&routerCert)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "my-public-key", string(body))
+	})
+
+	t.Run("GetKey - 401 with an unmapped client certificate", func(t *testing.T) {
+		resp := getKey(&strangerCert)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("GetKey - 401 without a client certificate or token", func(t *testing.T) {
+		resp := getKey(nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestServiceGRPC(t *testing.T) {
+	// --- 1. Setup ---
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwksServer := newJWKSTestServer(t, privateKey)
+	t.Cleanup(jwksServer.Close)
+	authMiddleware, err := middleware.NewJWKSAuthMiddleware(jwksServer.URL)
+	require.NoError(t, err)
+
+	const audience = "key-service"
+	const issuer = "https://id.example.com"
+	cfg := &ks.Config{
+		HTTPListenAddr: ":0",
+		GRPCListenAddr: ":0",
+		CorsConfig: middleware.CorsConfig{
+			AllowedOrigins: []string{"*"},
+			Role:           middleware.CorsRoleDefault,
+		},
+		TokenRequirements: ks.TokenRequirements{Audiences: []string{audience}, Issuer: issuer},
+		RouteTokenRequirements: map[string]ks.TokenRequirements{
+			"POST /keys/{entityURN}": {Scopes: []string{"keys:write"}},
+		},
+	}
+	service := keyservice.New(cfg, inmemory.New(), authMiddleware, zerolog.Nop(),
+		keyservice.WithInvalidator(inmemory.NewInvalidator()))
+	require.NotNil(t, service.GRPCServer())
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = service.GRPCServer().Serve(lis) }()
+	t.Cleanup(service.GRPCServer().Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	client := keyservicepb.NewKeyServiceClient(conn)
+	healthClient := healthpb.NewHealthClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	testURN, _ := urn.New(urn.SecureMessaging, "user", "user-123")
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	// --- 2. Test Cases ---
+
+	t.Run("Health - Follows readiness", func(t *testing.T) {
+		notReady, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		service.SetReady(true)
+		ready, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: keyservicepb.KeyService_ServiceDesc.ServiceName})
+		require.NoError(t, err)
+
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, notReady.GetStatus())
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, ready.GetStatus())
+	})
+
+	t.Run("StoreKey - PermissionDenied without the keys:write scope", func(t *testing.T) {
+		token := createScopedTestToken(t, privateKey, "user-123", audience, issuer, "keys:read")
+		_, err := client.StoreKey(withToken(token), &keyservicepb.StoreKeyRequest{EntityUrn: testURN.String(), Key: []byte("my-public-key")})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("StoreKey - Unauthenticated for a token meant for another audience", func(t *testing.T) {
+		token := createScopedTestToken(t, privateKey, "user-123", "another-service", issuer, "keys:write")
+		_, err := client.StoreKey(withToken(token), &keyservicepb.StoreKeyRequest{EntityUrn: testURN.String(), Key: []byte("my-public-key")})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, "Invalid token audience", status.Convert(err).Message())
+	})
+
+	t.Run("StoreKey and GetKey - Success over gRPC", func(t *testing.T) {
+		token := createScopedTestToken(t, privateKey, "user-123", audience, issuer, "keys:write")
+		_, err := client.StoreKey(withToken(token), &keyservicepb.StoreKeyRequest{EntityUrn: testURN.String(), Key: []byte("my-public-key")})
+		require.NoError(t, err)
+
+		resp, err := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: testURN.String()})
+		require.NoError(t, err)
+		assert.Equal(t, []byte("my-public-key"), resp.GetKey().GetKey())
+	})
+}
+
+func TestServiceGRPCRateLimit(t *testing.T) {
+	// Arrange: public reads with a miss budget of one lookup
+	cfg := &ks.Config{
+		HTTPListenAddr: ":0",
+		GRPCListenAddr: ":0",
+		CorsConfig: middleware.CorsConfig{
+			AllowedOrigins: []string{"*"},
+			Role:           middleware.CorsRoleDefault,
+		},
+		LookupRateLimit: ks.LookupRateLimit{
+			Hits:   ks.RateLimit{Rate: 0.001, Burst: 10},
+			Misses: ks.RateLimit{Rate: 0.001, Burst: 1},
+		},
+	}
+	store := inmemory.New()
+	testURN, _ := urn.New(urn.SecureMessaging, "user", "user-123")
+	missingURN, _ := urn.New(urn.SecureMessaging, "user", "nobody")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	require.NoError(t, store.StoreKey(ctx, testURN, []byte("my-public-key")))
+	service := keyservice.New(cfg, store, func(h http.Handler) http.Handler { return h }, zerolog.Nop())
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = service.GRPCServer().Serve(lis) }()
+	t.Cleanup(service.GRPCServer().Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	client := keyservicepb.NewKeyServiceClient(conn)
+
+	// Act
+	_, errMissing := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: missingURN.String()})
+	_, errLimited := client.GetKey(ctx, &keyservicepb.GetKeyRequest{EntityUrn: testURN.String()})
+
+	// Assert
+	assert.Equal(t, codes.NotFound, status.Code(errMissing))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errLimited))
+}
@@ -0,0 +1,18 @@
+package keyservice
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3.1 description of the routes registered by
+// New. The contract test in openapi_test.go keeps the two in step.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// serveOpenAPI manages GET /openapi.json.
+func serveOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
@@ -0,0 +1,503 @@
+package keyservice_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/keyservice"
+	ks "github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/middleware"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openAPIDocument is the part of an OpenAPI document the contract test
+// inspects.
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]any `json:"schemas"`
+		Responses map[string]any `json:"responses"`
+	} `json:"components"`
+}
+
+// openAPIOperation is the part of an operation the contract test inspects.
+type openAPIOperation struct {
+	Responses map[string]map[string]any `json:"responses"`
+}
+
+// subjectAuth stands in for the JWKS middleware: the bearer token is taken
+// as the caller's subject, whose verified email address is
+// subject@example.com.
+func subjectAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subject == "" {
+			response.WriteJSONError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		ctx := api.ContextWithUserID(r.Context(), subject)
+		ctx = api.ContextWithClaims(ctx, map[string]any{"email": subject + "@example.com", "email_verified": true})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newContractService returns a service with every optional route enabled.
+func newContractService(t *testing.T) *keyservice.Wrapper {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	cfg := &ks.Config{
+		HTTPListenAddr:     ":0",
+		CorsConfig:         middleware.CorsConfig{AllowedOrigins: []string{"*"}, Role: middleware.CorsRoleDefault},
+		AdminSubjects:      []string{"admin"},
+		ArchiveSigningKey:  privateKey,
+		ArchiveTrustedKeys: []ed25519.PublicKey{publicKey},
+
+		FederationSigningKey: privateKey,
+		FederationDomain:     "example.com",
+		FederationURL:        "https://keys.example.com",
+
+		IdentifierSalt: "salt",
+	}
+	return keyservice.New(cfg, inmemory.New(), subjectAuth, zerolog.Nop(),
+		keyservice.WithDeviceRegistry(inmemory.NewDeviceRegistry()),
+		keyservice.WithIdentifierIndex(inmemory.NewIdentifierIndex()),
+		keyservice.WithRateLimitStore(inmemory.NewRateLimitStore()))
+}
+
+// fetchOpenAPI fetches and decodes the document served by server.
+func fetchOpenAPI(t *testing.T, server *httptest.Server) openAPIDocument {
+	t.Helper()
+	resp, err := http.Get(server.URL + "/openapi.json")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var doc openAPIDocument
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	return doc
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	// Arrange
+	service := newContractService(t)
+	server := httptest.NewServer(service.Mux())
+	t.Cleanup(server.Close)
+
+	// Act
+	doc := fetchOpenAPI(t, server)
+
+	// Assert
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	var registered []string
+	for _, route := range service.Routes() {
+		method, path, ok := strings.Cut(route, " ")
+		require.True(t, ok, "route %q has no method", route)
+		// CORS preflight routes are not part of the API.
+		if method == http.MethodOptions {
+			continue
+		}
+		registered = append(registered, route)
+		_, documented := doc.Paths[unversioned(path)][strings.ToLower(method)]
+		assert.True(t, documented, "route %q is missing from the OpenAPI document", route)
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			route := strings.ToUpper(method) + " " + path
+			assert.Contains(t, registered, route, "OpenAPI operation %q is not registered", route)
+		}
+	}
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	service := newContractService(t)
+	server := httptest.NewServer(service.Mux())
+	t.Cleanup(server.Close)
+	doc := fetchOpenAPI(t, server)
+
+	const (
+		alice = "/keys/urn:sm:user:alice"
+		phone = "urn:sm:device:phone"
+	)
+	frankHash, err := ks.HashIdentifier("salt", "frank@example.com")
+	require.NoError(t, err)
+	graceHash, err := ks.HashIdentifier("salt", "grace@example.com")
+	require.NoError(t, err)
+	var exported []byte
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		subject    string
+		header     http.Header
+		body       func() []byte
+		wantStatus int
+	}{
+		{name: "Store key", method: http.MethodPost, path: alice, subject: "alice", body: raw("alice-key"), wantStatus: http.StatusCreated},
+		{name: "Store key anonymously", method: http.MethodPost, path: alice, body: raw("k"), wantStatus: http.StatusUnauthorized},
+		{name: "Store another's key", method: http.MethodPost, path: alice, subject: "bob", body: raw("k"), wantStatus: http.StatusForbidden},
+		{name: "Store key with invalid URN", method: http.MethodPost, path: "/keys/not-a-urn", subject: "alice", body: raw("k"), wantStatus: http.StatusBadRequest},
+		{name: "Get raw key", method: http.MethodGet, path: alice, wantStatus: http.StatusOK},
+		{name: "Get signed key", method: http.MethodGet, path: "/v2" + alice, header: http.Header{"Accept": {"application/json"}}, wantStatus: http.StatusOK},
+		{name: "Get missing key", method: http.MethodGet, path: "/keys/urn:sm:user:carol", wantStatus: http.StatusNotFound},
+		{name: "Get key with invalid URN", method: http.MethodGet, path: "/keys/not-a-urn", wantStatus: http.StatusBadRequest},
+		{name: "Batch get", method: http.MethodPost, path: "/keys:batchGet", body: raw(`{"entityUrns": ["urn:sm:user:alice", "urn:sm:user:carol"]}`), wantStatus: http.StatusOK},
+		{name: "Stream batch get", method: http.MethodPost, path: "/keys:batchGet", header: http.Header{"Accept": {"application/x-ndjson"}}, body: raw(`{"entityUrns": ["urn:sm:user:alice", "urn:sm:user:carol"]}`), wantStatus: http.StatusOK},
+		{name: "Federation document", method: http.MethodGet, path: "/.well-known/key-service", wantStatus: http.StatusOK},
+		{name: "Store federated entity's key", method: http.MethodPost, path: "/keys/urn:sm:user:carol@example.com", subject: "carol@example.com", body: raw("carol-key"), wantStatus: http.StatusCreated},
+		{name: "Federated lookup", method: http.MethodGet, path: "/federation/keys/urn:sm:user:carol@example.com", wantStatus: http.StatusOK},
+		{name: "Federated lookup of another domain", method: http.MethodGet, path: "/federation/keys/urn:sm:user:alice", wantStatus: http.StatusNotFound},
+		{name: "Store key with identifier hash", method: http.MethodPost, path: "/keys/urn:sm:user:frank", subject: "frank", header: http.Header{"X-Identifier-Hashes": {frankHash}}, body: raw("frank-key"), wantStatus: http.StatusCreated},
+		{name: "Store key with another's identifier hash", method: http.MethodPost, path: "/keys/urn:sm:user:grace", subject: "grace", header: http.Header{"X-Identifier-Hashes": {frankHash}}, body: raw("grace-key"), wantStatus: http.StatusForbidden},
+		{name: "Store key with invalid identifier hash", method: http.MethodPost, path: "/keys/urn:sm:user:grace", subject: "grace", header: http.Header{"X-Identifier-Hashes": {"frank@example.com"}}, body: raw("grace-key"), wantStatus: http.StatusBadRequest},
+		{name: "Get key by identifier", method: http.MethodGet, path: "/.well-known/keys/hu/" + frankHash, wantStatus: http.StatusOK},
+		{name: "Get signed key by identifier", method: http.MethodGet, path: "/v2/.well-known/keys/hu/" + frankHash, header: http.Header{"Accept": {"application/json"}}, wantStatus: http.StatusOK},
+		{name: "Get key by unknown identifier", method: http.MethodGet, path: "/.well-known/keys/hu/" + graceHash, wantStatus: http.StatusNotFound},
+		{name: "Get key by invalid identifier", method: http.MethodGet, path: "/.well-known/keys/hu/not-a-hash", wantStatus: http.StatusBadRequest},
+		{name: "Discover contacts", method: http.MethodPost, path: "/discovery", subject: "alice", body: raw(`{"prefixes": ["` + frankHash[:4] + `", "` + graceHash[:4] + `"]}`), wantStatus: http.StatusOK},
+		{name: "Discover contacts anonymously", method: http.MethodPost, path: "/discovery", body: raw(`{"prefixes": ["` + frankHash[:4] + `"]}`), wantStatus: http.StatusUnauthorized},
+		{name: "Discover contacts by full hash", method: http.MethodPost, path: "/discovery", subject: "alice", body: raw(`{"prefixes": ["` + frankHash + `"]}`), wantStatus: http.StatusBadRequest},
+		{name: "Unregister identifier", method: http.MethodDelete, path: "/keys/urn:sm:user:frank/identifiers/" + frankHash, subject: "frank", wantStatus: http.StatusNoContent},
+		{name: "Unregister unregistered identifier", method: http.MethodDelete, path: "/keys/urn:sm:user:frank/identifiers/" + frankHash, subject: "frank", wantStatus: http.StatusNotFound},
+		{name: "Unregister another's identifier", method: http.MethodDelete, path: "/keys/urn:sm:user:frank/identifiers/" + frankHash, subject: "grace", wantStatus: http.StatusForbidden},
+		{name: "Reassign identifier", method: http.MethodPut, path: "/admin/identifiers/" + frankHash, subject: "admin", body: raw(`{"entityUrn": "urn:sm:user:grace"}`), wantStatus: http.StatusNoContent},
+		{name: "Reassign identifier to invalid URN", method: http.MethodPut, path: "/admin/identifiers/" + frankHash, subject: "admin", body: raw(`{"entityUrn": "not-a-urn"}`), wantStatus: http.StatusBadRequest},
+		{name: "Reassign identifier as non-admin", method: http.MethodPut, path: "/admin/identifiers/" + frankHash, subject: "grace", body: raw(`{"entityUrn": "urn:sm:user:grace"}`), wantStatus: http.StatusForbidden},
+		{name: "Remove identifier", method: http.MethodDelete, path: "/admin/identifiers/" + frankHash, subject: "admin", wantStatus: http.StatusNoContent},
+		{name: "Remove unregistered identifier", method: http.MethodDelete, path: "/admin/identifiers/" + frankHash, subject: "admin", wantStatus: http.StatusNotFound},
+		{name: "Batch get nothing", method: http.MethodPost, path: "/keys:batchGet", body: raw(`{"entityUrns": []}`), wantStatus: http.StatusBadRequest},
+		{name: "Batch store", method: http.MethodPost, path: "/keys:batchStore", subject: "erin", body: raw(`{"keys": [{"entityUrn": "urn:sm:user:erin", "key": "ZXJpbi1rZXk="}, {"entityUrn": "urn:sm:user:alice", "key": "aw=="}, {"entityUrn": "not-a-urn", "key": "aw=="}]}`), wantStatus: http.StatusOK},
+		{name: "Batch store nothing", method: http.MethodPost, path: "/keys:batchStore", subject: "erin", body: raw(`{"keys": []}`), wantStatus: http.StatusBadRequest},
+		{name: "Issue challenge", method: http.MethodPost, path: alice + "/challenge", subject: "alice", wantStatus: http.StatusOK},
+		{name: "Enroll device", method: http.MethodPut, path: alice + "/devices/" + phone, subject: "alice", wantStatus: http.StatusNoContent},
+		{name: "Enroll device to another owner", method: http.MethodPut, path: "/keys/urn:sm:user:bob/devices/" + phone, subject: "bob", wantStatus: http.StatusConflict},
+		{name: "Store device key", method: http.MethodPost, path: "/keys/" + phone, subject: "alice", body: raw("phone-key"), wantStatus: http.StatusCreated},
+		{name: "List device keys", method: http.MethodGet, path: alice + "/devices", wantStatus: http.StatusOK},
+		{name: "Unenroll device", method: http.MethodDelete, path: alice + "/devices/" + phone, subject: "alice", wantStatus: http.StatusNoContent},
+		{name: "Unenroll unenrolled device", method: http.MethodDelete, path: alice + "/devices/" + phone, subject: "alice", wantStatus: http.StatusNotFound},
+		{name: "List keys", method: http.MethodGet, path: "/admin/keys?pageSize=10", subject: "admin", wantStatus: http.StatusOK},
+		{name: "Stream keys", method: http.MethodGet, path: "/admin/keys?pageSize=1", subject: "admin", header: http.Header{"Accept": {"application/x-ndjson"}}, wantStatus: http.StatusOK},
+		{name: "List keys as non-admin", method: http.MethodGet, path: "/admin/keys", subject: "alice", wantStatus: http.StatusForbidden},
+		{name: "List keys with invalid page size", method: http.MethodGet, path: "/admin/keys?pageSize=0", subject: "admin", wantStatus: http.StatusBadRequest},
+		{name: "Inspect key", method: http.MethodGet, path: "/admin/keys/urn:sm:user:alice", subject: "admin", wantStatus: http.StatusOK},
+		{name: "Inspect missing key", method: http.MethodGet, path: "/admin/keys/urn:sm:user:carol", subject: "admin", wantStatus: http.StatusNotFound},
+		{name: "Bulk operation", method: http.MethodPost, path: "/admin/bulk", subject: "admin", body: raw(`{"operation": "lock", "entityUrns": ["urn:sm:user:carol", "not-a-urn"]}`), wantStatus: http.StatusOK},
+		{name: "Lock entity", method: http.MethodPut, path: "/admin/keys/urn:sm:user:alice/lock", subject: "admin", wantStatus: http.StatusNoContent},
+		{name: "Store key of locked entity", method: http.MethodPost, path: alice, subject: "alice", body: raw("k"), wantStatus: http.StatusLocked},
+		{name: "Unlock entity", method: http.MethodDelete, path: "/admin/keys/urn:sm:user:alice/lock", subject: "admin", wantStatus: http.StatusNoContent},
+		{name: "Export", method: http.MethodGet, path: "/admin/export", subject: "admin", wantStatus: http.StatusOK},
+		{name: "Import", method: http.MethodPost, path: "/admin/import?format=ndjson", subject: "admin", body: func() []byte { return exported }, wantStatus: http.StatusOK},
+		{name: "Import with invalid format", method: http.MethodPost, path: "/admin/import?format=zip", subject: "admin", wantStatus: http.StatusBadRequest},
+		{name: "Revoke key", method: http.MethodPost, path: "/admin/keys/urn:sm:user:alice/revoke", subject: "admin", wantStatus: http.StatusNoContent},
+		{name: "Get revoked key", method: http.MethodGet, path: alice, wantStatus: http.StatusGone},
+		{name: "Get OpenAPI document", method: http.MethodGet, path: "/openapi.json", wantStatus: http.StatusOK},
+		{name: "Store key in v1", method: http.MethodPost, path: "/v1/keys/urn:sm:user:dave", subject: "dave", body: raw("dave-key"), wantStatus: http.StatusCreated},
+		{name: "Get raw key in v1", method: http.MethodGet, path: "/v1/keys/urn:sm:user:dave", wantStatus: http.StatusOK},
+		{name: "Get key in v2", method: http.MethodGet, path: "/v2/keys/urn:sm:user:dave", wantStatus: http.StatusOK},
+		{name: "Get raw key in v2", method: http.MethodGet, path: "/v2/keys/urn:sm:user:dave", header: http.Header{"Accept": {"application/octet-stream"}}, wantStatus: http.StatusOK},
+		{name: "Batch get in v2", method: http.MethodPost, path: "/v2/keys:batchGet", body: raw(`{"entityUrns": ["urn:sm:user:dave"]}`), wantStatus: http.StatusOK},
+	}
+
+	// The steps share the service's state, so they run in order.
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			// Arrange
+			var body io.Reader
+			if step.body != nil {
+				body = bytes.NewReader(step.body())
+			}
+			req, err := http.NewRequest(step.method, server.URL+step.path, body)
+			require.NoError(t, err)
+			for name, values := range step.header {
+				req.Header[name] = values
+			}
+			if step.subject != "" {
+				req.Header.Set("Authorization", "Bearer "+step.subject)
+			}
+
+			// Act
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			// Assert
+			require.Equal(t, step.wantStatus, resp.StatusCode, "body: %s", respBody)
+			for _, problem := range checkResponse(doc, step.method, req.URL.Path, resp, respBody) {
+				t.Error(problem)
+			}
+			if step.name == "Export" {
+				exported = respBody
+			}
+		})
+	}
+}
+
+// TestV1ResponsesFrozen pins the exact responses of v1 key lookups, which
+// existing clients depend on. Clients that send
+// "Accept: application/json, */*" must keep getting the raw key, as they did
+// before signed keys were served as JSON from v2.
+func TestV1ResponsesFrozen(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(newContractService(t).Mux())
+	t.Cleanup(server.Close)
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/keys/urn:sm:user:alice", strings.NewReader("alice-key"))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer alice")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	for _, path := range []string{"/keys/urn:sm:user:alice", "/v1/keys/urn:sm:user:alice"} {
+		for _, accept := range []string{"", "*/*", "application/json, */*", "application/json"} {
+			t.Run(path+" "+accept, func(t *testing.T) {
+				req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+				require.NoError(t, err)
+				if accept != "" {
+					req.Header.Set("Accept", accept)
+				}
+
+				// Act
+				resp, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer func() { _ = resp.Body.Close() }()
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+
+				// Assert
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+				assert.Equal(t, []byte("alice-key"), body)
+			})
+		}
+	}
+}
+
+// raw returns a fixed request body.
+func raw(body string) func() []byte {
+	return func() []byte { return []byte(body) }
+}
+
+// unversioned strips the API version prefix from a path; the document's
+// servers serve every path under each version.
+func unversioned(path string) string {
+	for _, version := range ks.APIVersions {
+		if rest, ok := strings.CutPrefix(path, "/"+string(version)+"/"); ok {
+			return "/" + rest
+		}
+	}
+	return path
+}
+
+// checkResponse lists the ways a response departs from the document.
+func checkResponse(doc openAPIDocument, method, path string, resp *http.Response, body []byte) []string {
+	template, ok := matchPath(doc, unversioned(path))
+	if !ok {
+		return []string{fmt.Sprintf("no OpenAPI path matches %s", path)}
+	}
+	var op openAPIOperation
+	if err := json.Unmarshal(doc.Paths[template][strings.ToLower(method)], &op); err != nil {
+		return []string{fmt.Sprintf("%s %s is not a documented operation", method, template)}
+	}
+	documented, ok := op.Responses[strconv.Itoa(resp.StatusCode)]
+	if !ok {
+		return []string{fmt.Sprintf("%s %s: status %d is not documented", method, template, resp.StatusCode)}
+	}
+	v := schemaValidator{doc: doc}
+	documented = v.resolve(documented)
+
+	content, _ := documented["content"].(map[string]any)
+	if len(body) == 0 && len(content) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return []string{fmt.Sprintf("%s %s: invalid Content-Type %q", method, template, resp.Header.Get("Content-Type"))}
+	}
+	media, ok := content[mediaType].(map[string]any)
+	if !ok {
+		return []string{fmt.Sprintf("%s %s: %d response of type %s is not documented", method, template, resp.StatusCode, mediaType)}
+	}
+	schema, _ := media["schema"].(map[string]any)
+	at := fmt.Sprintf("%s %s %d", method, template, resp.StatusCode)
+	switch mediaType {
+	case "application/json":
+		var value any
+		if err := json.Unmarshal(body, &value); err != nil {
+			return []string{fmt.Sprintf("%s %s: invalid JSON body: %v", method, template, err)}
+		}
+		return v.validate(at, schema, value)
+	case "application/x-ndjson":
+		// Each line is a value of the schema, unless the body is documented
+		// as an opaque string, like the export archive.
+		if schema["type"] == "string" {
+			return nil
+		}
+		var problems []string
+		for i, line := range bytes.SplitAfter(body, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var value any
+			if err := json.Unmarshal(line, &value); err != nil {
+				return append(problems, fmt.Sprintf("%s %s: invalid JSON line %d: %v", method, template, i, err))
+			}
+			problems = append(problems, v.validate(fmt.Sprintf("%s line %d", at, i), schema, value)...)
+		}
+		return problems
+	}
+	return nil
+}
+
+// matchPath finds the document path template matching a request path.
+func matchPath(doc openAPIDocument, path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	for template := range doc.Paths {
+		templateSegments := strings.Split(template, "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, s := range templateSegments {
+			if s != segments[i] && !(strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return template, true
+		}
+	}
+	return "", false
+}
+
+// schemaValidator checks JSON values against the subset of JSON Schema the
+// document uses. Objects are treated as closed, so a property the service
+// returns but the document does not describe is reported as drift.
+type schemaValidator struct {
+	doc openAPIDocument
+}
+
+// resolve follows a local $ref.
+func (v schemaValidator) resolve(schema map[string]any) map[string]any {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema
+	}
+	var resolved any
+	switch {
+	case strings.HasPrefix(ref, "#/components/schemas/"):
+		resolved = v.doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+	case strings.HasPrefix(ref, "#/components/responses/"):
+		resolved = v.doc.Components.Responses[strings.TrimPrefix(ref, "#/components/responses/")]
+	}
+	m, _ := resolved.(map[string]any)
+	return m
+}
+
+// validate lists the ways value departs from schema.
+func (v schemaValidator) validate(at string, schema map[string]any, value any) []string {
+	schema = v.resolve(schema)
+	if schema == nil {
+		return []string{at + ": unresolvable schema"}
+	}
+
+	// allOf members are merged into one closed object schema.
+	properties := map[string]any{}
+	var required []any
+	for _, s := range append([]map[string]any{schema}, v.allOf(schema)...) {
+		if props, ok := s["properties"].(map[string]any); ok {
+			for name, prop := range props {
+				properties[name] = prop
+			}
+		}
+		if req, ok := s["required"].([]any); ok {
+			required = append(required, req...)
+		}
+	}
+
+	var problems []string
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		if len(properties) == 0 && schema["type"] != "object" {
+			return append(problems, at+": unexpected object")
+		}
+		if len(properties) == 0 {
+			return problems
+		}
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required property %q", at, name))
+			}
+		}
+		for name, prop := range value {
+			propSchema, ok := properties[name].(map[string]any)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: undocumented property %q", at, name))
+				continue
+			}
+			problems = append(problems, v.validate(at+"."+name, propSchema, prop)...)
+		}
+	case []any:
+		if schema["type"] != "array" {
+			return append(problems, at+": unexpected array")
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range value {
+			problems = append(problems, v.validate(fmt.Sprintf("%s[%d]", at, i), items, item)...)
+		}
+	case string:
+		if schema["type"] != "string" {
+			problems = append(problems, at+": unexpected string")
+		}
+	case float64:
+		if schema["type"] != "number" && !(schema["type"] == "integer" && value == float64(int64(value))) {
+			problems = append(problems, at+": unexpected number")
+		}
+	case bool:
+		if schema["type"] != "boolean" {
+			problems = append(problems, at+": unexpected boolean")
+		}
+	case nil:
+		problems = append(problems, at+": unexpected null")
+	}
+	return problems
+}
+
+// allOf returns the resolved allOf members of schema.
+func (v schemaValidator) allOf(schema map[string]any) []map[string]any {
+	members, _ := schema["allOf"].([]any)
+	var resolved []map[string]any
+	for _, member := range members {
+		if m, ok := member.(map[string]any); ok {
+			resolved = append(resolved, v.resolve(m))
+		}
+	}
+	return resolved
+}
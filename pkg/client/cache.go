@@ -0,0 +1,91 @@
+package client
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// MaxCachedKeys bounds the keys a cache holds. Once it is full, caching
+// another key evicts the one cached longest ago.
+const MaxCachedKeys = 10000
+
+// keyCache holds fetched keys for a fixed TTL. Keys are copied in and out,
+// so callers may modify the slices they are given. A nil *keyCache caches
+// nothing.
+type keyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*list.Element
+	// order lists the cached entries, the one cached longest ago first.
+	order *list.List
+}
+
+type cacheEntry struct {
+	entityURN string
+	key       []byte
+	expires   time.Time
+}
+
+func newKeyCache(ttl time.Duration, max int) *keyCache {
+	return &keyCache{ttl: ttl, max: max, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns a copy of entityURN's cached key if it has not expired.
+func (c *keyCache) get(entityURN urn.URN) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[entityURN.String()]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	return bytes.Clone(entry.key), true
+}
+
+// put caches a copy of entityURN's key, evicting the key cached longest ago
+// if the cache is full.
+func (c *keyCache) put(entityURN urn.URN, key []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entityURN.String()]; ok {
+		c.remove(elem)
+	}
+	for c.order.Len() >= c.max {
+		c.remove(c.order.Front())
+	}
+	entry := &cacheEntry{entityURN: entityURN.String(), key: bytes.Clone(key), expires: time.Now().Add(c.ttl)}
+	c.entries[entry.entityURN] = c.order.PushBack(entry)
+}
+
+// evict drops entityURN's cached key.
+func (c *keyCache) evict(entityURN urn.URN) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entityURN.String()]; ok {
+		c.remove(elem)
+	}
+}
+
+// remove drops a cached entry. The caller holds c.mu.
+func (c *keyCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).entityURN)
+}
@@ -0,0 +1,718 @@
+// Package client is a Go client for the key service's HTTP API. It handles
+// URN escaping, bearer tokens, retries of failed reads and the service's
+// JSON error responses, and can cache fetched keys.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Retry defaults: a read failing with a 5xx status or a transport error is
+// retried up to DefaultMaxRetries times, waiting DefaultBackoff before the
+// first retry and twice as long before each further one. Writes are not
+// retried; see idempotent.
+const (
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 100 * time.Millisecond
+)
+
+// Headers understood by POST /keys/{entityURN}, mirroring internal/api.
+const (
+	challengeHeader         = "X-Key-Challenge"
+	signatureHeader         = "X-Key-Signature"
+	signingKeyURNHeader     = "X-Signing-Key-URN"
+	identitySignatureHeader = "X-Identity-Signature"
+	identifierHashesHeader  = "X-Identifier-Hashes"
+	entityURNHeader         = "X-Entity-URN"
+)
+
+// maxErrorBody bounds how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+// TokenSource supplies the bearer token sent with each request.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token calls f.
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// StaticToken returns a TokenSource that always supplies token.
+func StaticToken(token string) TokenSource {
+	return TokenSourceFunc(func(context.Context) (string, error) { return token, nil })
+}
+
+// Client calls a key service. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	tokens     TokenSource
+	maxRetries int
+	backoff    time.Duration
+	cache      *keyCache
+}
+
+// Option customises a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends requests with httpClient instead of
+// http.DefaultClient, e.g. to present a TLS client certificate.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithTokenSource authenticates requests with tokens from tokens. Without
+// one, requests are sent without an Authorization header.
+func WithTokenSource(tokens TokenSource) Option {
+	return func(c *Client) { c.tokens = tokens }
+}
+
+// WithRetries replaces the default retry policy. A maxRetries of zero
+// disables retries.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// WithCache keeps up to MaxCachedKeys keys fetched by GetKey and
+// BatchGetKeys for ttl. Keys stored or revoked through this client are
+// evicted at once; changes made elsewhere are seen once the cached copy
+// expires.
+func WithCache(ttl time.Duration) Option {
+	return func(c *Client) { c.cache = newKeyCache(ttl, MaxCachedKeys) }
+}
+
+// New creates a Client for the key service at baseURL, e.g.
+// "https://keys.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	c := &Client{
+		baseURL:    strings.TrimSuffix(u.String(), "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: DefaultMaxRetries,
+		backoff:    DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Challenge is a proof-of-possession nonce issued for a key upload.
+type Challenge struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// UploadOption attaches proofs to a StoreKey call.
+type UploadOption func(http.Header)
+
+// WithProof proves possession of the uploaded key, or of the key named by
+// WithSigningKeyURN, with a signature over keyservice.ProofMessage for a
+// nonce from Client.Challenge.
+func WithProof(nonce string, signature []byte) UploadOption {
+	return func(h http.Header) {
+		h.Set(challengeHeader, nonce)
+		h.Set(signatureHeader, base64.StdEncoding.EncodeToString(signature))
+	}
+}
+
+// WithSigningKeyURN names the entity whose stored key made the WithProof
+// signature, for keys that cannot sign.
+func WithSigningKeyURN(signingKeyURN urn.URN) UploadOption {
+	return func(h http.Header) { h.Set(signingKeyURNHeader, signingKeyURN.String()) }
+}
+
+// WithIdentitySignature attaches the device owner's identity key signature
+// over keyservice.SignedKeyMessage to a device key upload.
+func WithIdentitySignature(signature []byte) UploadOption {
+	return func(h http.Header) {
+		h.Set(identitySignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	}
+}
+
+// WithIdentifierHashes registers the uploaded key's entity under hashes
+// from keyservice.HashIdentifier, so contacts knowing the entity's email
+// address or phone number can find the key with GetKeyByIdentifier. The
+// service only accepts the hashes of identifiers the caller's token
+// verifies.
+func WithIdentifierHashes(hashes ...string) UploadOption {
+	return func(h http.Header) { h.Set(identifierHashesHeader, strings.Join(hashes, ",")) }
+}
+
+// StoreKey creates or replaces entityURN's key.
+func (c *Client) StoreKey(ctx context.Context, entityURN urn.URN, key []byte, opts ...UploadOption) error {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/octet-stream")
+	for _, opt := range opts {
+		opt(header)
+	}
+	resp, err := c.do(ctx, http.MethodPost, keyPath(entityURN), header, key)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	c.cache.evict(entityURN)
+	return expectStatus(resp, http.StatusCreated)
+}
+
+// KeyUpload is one key for StoreKeys, with the options StoreKey would take.
+type KeyUpload struct {
+	EntityURN urn.URN
+	Key       []byte
+	Options   []UploadOption
+}
+
+// StoreResult is the outcome of one upload in StoreKeys.
+type StoreResult struct {
+	EntityURN urn.URN
+	// Status is "created", "forbidden", "invalid", "locked" or "failed".
+	Status string
+	// Message explains any status other than "created".
+	Message string
+}
+
+// Err returns nil if the key was stored, and otherwise an *Error matching
+// the sentinel StoreKey would have failed with.
+func (r StoreResult) Err() error {
+	statusCodes := map[string]int{
+		"forbidden": http.StatusForbidden,
+		"invalid":   http.StatusBadRequest,
+		"locked":    http.StatusLocked,
+	}
+	if r.Status == "created" {
+		return nil
+	}
+	statusCode, ok := statusCodes[r.Status]
+	if !ok {
+		statusCode = http.StatusInternalServerError
+	}
+	return &Error{StatusCode: statusCode, Message: r.Message}
+}
+
+// batchStoreRequest and batchStoreResponse are the JSON bodies of
+// POST /keys:batchStore.
+type batchStoreRequest struct {
+	Keys []batchStoreItem `json:"keys"`
+}
+
+type batchStoreItem struct {
+	EntityURN         string `json:"entityUrn"`
+	Key               []byte `json:"key"`
+	Challenge         string `json:"challenge,omitempty"`
+	Signature         string `json:"signature,omitempty"`
+	SigningKeyURN     string `json:"signingKeyUrn,omitempty"`
+	IdentitySignature string `json:"identitySignature,omitempty"`
+}
+
+type batchStoreResponse struct {
+	Results []struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"results"`
+}
+
+// StoreKeys creates or replaces the keys of uploads, sending as many
+// requests of up to keyservice.MaxBatchStoreKeys keys as needed. It returns
+// one result per upload, in order; an error means a request as a whole
+// failed, and results are returned for the requests sent before it.
+func (c *Client) StoreKeys(ctx context.Context, uploads []KeyUpload) ([]StoreResult, error) {
+	results := make([]StoreResult, 0, len(uploads))
+	for start := 0; start < len(uploads); start += keyservice.MaxBatchStoreKeys {
+		chunk := uploads[start:min(start+keyservice.MaxBatchStoreKeys, len(uploads))]
+		req := batchStoreRequest{Keys: make([]batchStoreItem, 0, len(chunk))}
+		for _, upload := range chunk {
+			header := make(http.Header)
+			for _, opt := range upload.Options {
+				opt(header)
+			}
+			req.Keys = append(req.Keys, batchStoreItem{
+				EntityURN:         upload.EntityURN.String(),
+				Key:               upload.Key,
+				Challenge:         header.Get(challengeHeader),
+				Signature:         header.Get(signatureHeader),
+				SigningKeyURN:     header.Get(signingKeyURNHeader),
+				IdentitySignature: header.Get(identitySignatureHeader),
+			})
+		}
+
+		var resp batchStoreResponse
+		if err := c.doJSON(ctx, http.MethodPost, "/keys:batchStore", req, &resp); err != nil {
+			return results, err
+		}
+		if len(resp.Results) != len(chunk) {
+			return results, fmt.Errorf("key service returned %d results for %d keys", len(resp.Results), len(chunk))
+		}
+		for i, result := range resp.Results {
+			c.cache.evict(chunk[i].EntityURN)
+			results = append(results, StoreResult{EntityURN: chunk[i].EntityURN, Status: result.Status, Message: result.Error})
+		}
+	}
+	return results, nil
+}
+
+// Challenge requests a proof-of-possession nonce for the next upload of
+// entityURN's key.
+func (c *Client) Challenge(ctx context.Context, entityURN urn.URN) (Challenge, error) {
+	var challenge Challenge
+	err := c.doJSON(ctx, http.MethodPost, keyPath(entityURN)+"/challenge", nil, &challenge)
+	return challenge, err
+}
+
+// GetKey returns entityURN's key. Missing and revoked keys return errors
+// matching keyservice.ErrKeyNotFound and keyservice.ErrKeyRevoked.
+func (c *Client) GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error) {
+	if key, ok := c.cache.get(entityURN); ok {
+		return key, nil
+	}
+	header := make(http.Header)
+	header.Set("Accept", "application/octet-stream")
+	resp, err := c.do(ctx, http.MethodGet, keyPath(entityURN), header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	key, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key for %s: %w", entityURN.String(), err)
+	}
+	c.cache.put(entityURN, key)
+	return key, nil
+}
+
+// GetKeyByIdentifier returns the key of the entity that registered hash,
+// from keyservice.HashIdentifier, and the entity's URN, bypassing the
+// cache. Unknown hashes return an error matching keyservice.ErrKeyNotFound.
+func (c *Client) GetKeyByIdentifier(ctx context.Context, hash string) (urn.URN, []byte, error) {
+	header := make(http.Header)
+	header.Set("Accept", "application/octet-stream")
+	resp, err := c.do(ctx, http.MethodGet, "/.well-known/keys/hu/"+url.PathEscape(hash), header, nil)
+	if err != nil {
+		return urn.URN{}, nil, err
+	}
+	defer closeBody(resp)
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return urn.URN{}, nil, err
+	}
+	entityURN, err := urn.Parse(resp.Header.Get(entityURNHeader))
+	if err != nil {
+		return urn.URN{}, nil, fmt.Errorf("key service returned an invalid entity URN: %w", err)
+	}
+	key, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return urn.URN{}, nil, fmt.Errorf("failed to read key for identifier %s: %w", hash, err)
+	}
+	return entityURN, key, nil
+}
+
+// discoveryRequest and discoveryResponse are the JSON bodies of
+// POST /discovery.
+type discoveryRequest struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+type discoveryResponse struct {
+	Matches []struct {
+		HashPrefix string `json:"hashPrefix"`
+		keyRecord
+	} `json:"matches"`
+	Truncated []string `json:"truncated"`
+}
+
+// DiscoverContacts reports which of identifiers, email addresses or phone
+// numbers, have registered keys, keyed by identifier as given. Identifiers
+// are hashed with salt as by keyservice.HashIdentifier, but only the first
+// keyservice.DiscoveryPrefixLength characters of each hash are sent, in
+// requests of up to keyservice.MaxDiscoveryPrefixes. The service answers
+// with truncated hashes, so each contact matching one, or falling in a
+// bucket with too many registrations to list, is confirmed by full hash as
+// in GetKeyByIdentifier. Every distinct prefix spends the caller's discovery
+// quota, so callers should remember the outcome and only ask about new
+// contacts.
+func (c *Client) DiscoverContacts(ctx context.Context, salt string, identifiers []string) (map[string]keyservice.KeyRecord, error) {
+	byHash := make(map[string][]string)
+	byPrefix := make(map[string][]string)
+	var prefixes []string
+	for _, identifier := range identifiers {
+		hash, err := keyservice.HashIdentifier(salt, identifier)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := byHash[hash]; !ok {
+			prefix := hash[:keyservice.DiscoveryPrefixLength]
+			if len(byPrefix[prefix]) == 0 {
+				prefixes = append(prefixes, prefix)
+			}
+			byPrefix[prefix] = append(byPrefix[prefix], hash)
+		}
+		byHash[hash] = append(byHash[hash], identifier)
+	}
+
+	found := make(map[string]keyservice.KeyRecord)
+	for start := 0; start < len(prefixes); start += keyservice.MaxDiscoveryPrefixes {
+		chunk := prefixes[start:min(start+keyservice.MaxDiscoveryPrefixes, len(prefixes))]
+		var resp discoveryResponse
+		if err := c.doJSON(ctx, http.MethodPost, "/discovery", discoveryRequest{Prefixes: chunk}, &resp); err != nil {
+			return found, err
+		}
+		candidates := make(map[string]keyservice.KeyRecord)
+		for _, match := range resp.Matches {
+			if len(match.HashPrefix) < keyservice.DiscoveryPrefixLength {
+				continue
+			}
+			rec, err := match.keyRecord.keyRecord()
+			if err != nil {
+				return found, err
+			}
+			for _, hash := range byPrefix[match.HashPrefix[:keyservice.DiscoveryPrefixLength]] {
+				if strings.HasPrefix(hash, match.HashPrefix) {
+					candidates[hash] = rec
+				}
+			}
+		}
+		for _, prefix := range resp.Truncated {
+			for _, hash := range byPrefix[prefix] {
+				if _, ok := candidates[hash]; !ok {
+					candidates[hash] = keyservice.KeyRecord{}
+				}
+			}
+		}
+		for hash, rec := range candidates {
+			entityURN, key, err := c.GetKeyByIdentifier(ctx, hash)
+			if errors.Is(err, keyservice.ErrKeyNotFound) || errors.Is(err, keyservice.ErrKeyRevoked) {
+				continue
+			}
+			if err != nil {
+				return found, err
+			}
+			// A truncated hash may have matched another registration; the
+			// full hash decides whose key this is.
+			if rec.EntityURN.String() != entityURN.String() || !bytes.Equal(rec.Key, key) {
+				rec = keyservice.KeyRecord{EntityURN: entityURN, Key: key}
+			}
+			for _, identifier := range byHash[hash] {
+				found[identifier] = rec
+			}
+		}
+	}
+	return found, nil
+}
+
+// GetKeyRecord returns entityURN's key with its signatures, bypassing the
+// cache. Missing and revoked keys fail as in GetKey. Signed keys are only
+// served by API v2.
+func (c *Client) GetKeyRecord(ctx context.Context, entityURN urn.URN) (keyservice.KeyRecord, error) {
+	var rec keyRecord
+	if err := c.doJSON(ctx, http.MethodGet, "/"+string(keyservice.APIVersionV2)+keyPath(entityURN), nil, &rec); err != nil {
+		return keyservice.KeyRecord{}, err
+	}
+	return rec.keyRecord()
+}
+
+// Batch is the outcome of BatchGetKeys.
+type Batch struct {
+	Keys []keyservice.KeyRecord
+	// NotFound lists entities without a key, or whose key the caller may
+	// not read.
+	NotFound []urn.URN
+	Revoked  []urn.URN
+}
+
+// batchGetRequest and batchGetResponse are the JSON bodies of
+// POST /keys:batchGet.
+type batchGetRequest struct {
+	EntityURNs []string `json:"entityUrns"`
+}
+
+type batchGetResponse struct {
+	Keys     []keyRecord `json:"keys"`
+	NotFound []string    `json:"notFound"`
+	Revoked  []string    `json:"revoked"`
+}
+
+// keyRecord is the JSON representation of a key record.
+type keyRecord struct {
+	EntityURN  string    `json:"entityUrn"`
+	Key        []byte    `json:"key"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Revoked    bool      `json:"revoked"`
+	RevokedAt  time.Time `json:"revokedAt"`
+	Locked     bool      `json:"locked"`
+	Signatures []struct {
+		SignerURN   string `json:"signerUrn"`
+		SignerKeyID string `json:"signerKeyId"`
+		Signature   []byte `json:"signature"`
+	} `json:"signatures"`
+}
+
+// BatchGetKeys returns the keys of entityURNs, sending as many requests of
+// up to keyservice.MaxBatchGetKeys entities as needed. Cached keys are not
+// requested again and are returned without their signatures.
+func (c *Client) BatchGetKeys(ctx context.Context, entityURNs []urn.URN) (Batch, error) {
+	var batch Batch
+	var pending []string
+	for _, entityURN := range entityURNs {
+		if key, ok := c.cache.get(entityURN); ok {
+			batch.Keys = append(batch.Keys, keyservice.KeyRecord{EntityURN: entityURN, Key: key})
+			continue
+		}
+		pending = append(pending, entityURN.String())
+	}
+
+	for len(pending) > 0 {
+		n := min(len(pending), keyservice.MaxBatchGetKeys)
+		var resp batchGetResponse
+		if err := c.doJSON(ctx, http.MethodPost, "/keys:batchGet", batchGetRequest{EntityURNs: pending[:n]}, &resp); err != nil {
+			return Batch{}, err
+		}
+		pending = pending[n:]
+
+		for _, rec := range resp.Keys {
+			keyRec, err := rec.keyRecord()
+			if err != nil {
+				return Batch{}, err
+			}
+			c.cache.put(keyRec.EntityURN, keyRec.Key)
+			batch.Keys = append(batch.Keys, keyRec)
+		}
+		notFound, err := parseURNs(resp.NotFound)
+		if err != nil {
+			return Batch{}, err
+		}
+		revoked, err := parseURNs(resp.Revoked)
+		if err != nil {
+			return Batch{}, err
+		}
+		batch.NotFound = append(batch.NotFound, notFound...)
+		batch.Revoked = append(batch.Revoked, revoked...)
+	}
+	return batch, nil
+}
+
+// RevokeKey stops entityURN's key from being served. The caller must be an
+// administrator.
+func (c *Client) RevokeKey(ctx context.Context, entityURN urn.URN) error {
+	resp, err := c.do(ctx, http.MethodPost, "/admin"+keyPath(entityURN)+"/revoke", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	c.cache.evict(entityURN)
+	return expectStatus(resp, http.StatusNoContent)
+}
+
+// listKeysResponse is the JSON body of GET /admin/keys.
+type listKeysResponse struct {
+	Keys          []keyRecord `json:"keys"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+// ListKeys returns one page of the stored key records matching filter,
+// including revoked keys. Pass the previous page's NextPageToken to
+// continue. The caller must be an administrator.
+func (c *Client) ListKeys(ctx context.Context, filter keyservice.ListFilter, pageToken string) (keyservice.KeyPage, error) {
+	query := make(url.Values)
+	if filter.EntityType != "" {
+		query.Set("entityType", filter.EntityType)
+	}
+	if !filter.UpdatedSince.IsZero() {
+		query.Set("updatedSince", filter.UpdatedSince.Format(time.RFC3339Nano))
+	}
+	if filter.PageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(filter.PageSize))
+	}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	path := "/admin/keys"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var resp listKeysResponse
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return keyservice.KeyPage{}, err
+	}
+	page := keyservice.KeyPage{Records: make([]keyservice.KeyRecord, 0, len(resp.Keys)), NextPageToken: resp.NextPageToken}
+	for _, rec := range resp.Keys {
+		keyRec, err := rec.keyRecord()
+		if err != nil {
+			return keyservice.KeyPage{}, err
+		}
+		page.Records = append(page.Records, keyRec)
+	}
+	return page, nil
+}
+
+// doJSON sends in, if not nil, as JSON and decodes a 200 response into out.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	header := make(http.Header)
+	header.Set("Accept", "application/json")
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.do(ctx, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a request, retrying idempotent requests that fail with a
+// transport error or a 5xx response with exponential backoff. The caller
+// must close the returned response's body.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, body []byte) (*http.Response, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if c.tokens != nil {
+			token, err := c.tokens.Token(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get token: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		retryable := idempotent(method, path) && (err != nil || resp.StatusCode >= http.StatusInternalServerError)
+		if !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			if err != nil {
+				return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			closeBody(resp)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// idempotent reports whether a failed request may be sent again: reads,
+// including batch reads sent with POST. Writes are not, as the first
+// attempt may have been applied, and an upload has spent its single-use
+// challenge, so a retry would fail in a way that hides the first outcome.
+func idempotent(method, path string) bool {
+	return method == http.MethodGet || method == http.MethodHead || path == "/keys:batchGet"
+}
+
+// expectStatus returns nil if resp has the wanted status and the decoded
+// *Error otherwise.
+func expectStatus(resp *http.Response, want int) error {
+	if resp.StatusCode == want {
+		return nil
+	}
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	var body response.APIError
+	if json.NewDecoder(io.LimitReader(resp.Body, maxErrorBody)).Decode(&body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	}
+	return apiErr
+}
+
+// closeBody drains and closes a response body so the connection can be
+// reused.
+func closeBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	_ = resp.Body.Close()
+}
+
+// keyPath returns the path of entityURN's key.
+func keyPath(entityURN urn.URN) string {
+	return "/keys/" + url.PathEscape(entityURN.String())
+}
+
+// keyRecord converts a JSON key record.
+func (r keyRecord) keyRecord() (keyservice.KeyRecord, error) {
+	entityURN, err := urn.Parse(r.EntityURN)
+	if err != nil {
+		return keyservice.KeyRecord{}, fmt.Errorf("invalid entity URN %q in response: %w", r.EntityURN, err)
+	}
+	rec := keyservice.KeyRecord{
+		EntityURN: entityURN,
+		Key:       r.Key,
+		UpdatedAt: r.UpdatedAt,
+		Revoked:   r.Revoked,
+		RevokedAt: r.RevokedAt,
+		Locked:    r.Locked,
+	}
+	for _, sig := range r.Signatures {
+		signerURN, err := urn.Parse(sig.SignerURN)
+		if err != nil {
+			return keyservice.KeyRecord{}, fmt.Errorf("invalid signer URN %q in response: %w", sig.SignerURN, err)
+		}
+		rec.Signatures = append(rec.Signatures, keyservice.KeySignature{SignerURN: signerURN, SignerKeyID: sig.SignerKeyID, Signature: sig.Signature})
+	}
+	return rec, nil
+}
+
+// parseURNs parses the URNs listed in a response.
+func parseURNs(raw []string) ([]urn.URN, error) {
+	entityURNs := make([]urn.URN, 0, len(raw))
+	for _, r := range raw {
+		entityURN, err := urn.Parse(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entity URN %q in response: %w", r, err)
+		}
+		entityURNs = append(entityURNs, entityURN)
+	}
+	return entityURNs, nil
+}
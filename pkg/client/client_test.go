@@ -0,0 +1,433 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/internal/api"
+	"github.com/illmade-knight/go-key-service/internal/storage/inmemory"
+	"github.com/illmade-knight/go-key-service/keyservice"
+	"github.com/illmade-knight/go-key-service/pkg/client"
+	ks "github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-key-service/test"
+	"github.com/illmade-knight/go-microservice-base/pkg/middleware"
+	"github.com/illmade-knight/go-microservice-base/pkg/response"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuth stands in for the JWKS middleware: the bearer token is taken as
+// the caller's subject, whose verified identifiers are in subjectClaims.
+func fakeAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subject == "" {
+			response.WriteJSONError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		ctx := api.ContextWithClaims(api.ContextWithUserID(r.Context(), subject), subjectClaims[subject])
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// subjectClaims holds the token claims fakeAuth gives each subject.
+var subjectClaims = map[string]map[string]any{
+	"alice": {"email": "alice@example.com", "email_verified": true, "phone_number": "+44 20 7946 0000", "phone_number_verified": true},
+	"bob":   {"email": "bob@example.com", "email_verified": true},
+}
+
+// newClient returns a client for server authenticating as subject with
+// fast retries.
+func newClient(t *testing.T, server *httptest.Server, subject string, opts ...client.Option) *client.Client {
+	t.Helper()
+	opts = append([]client.Option{client.WithRetries(2, time.Millisecond)}, opts...)
+	if subject != "" {
+		opts = append(opts, client.WithTokenSource(client.StaticToken(subject)))
+	}
+	c, err := client.New(server.URL, opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	aliceURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bobURN, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+
+	t.Run("StoreKey and GetKey round trip", func(t *testing.T) {
+		// Arrange
+		server := test.NewTestServer(fakeAuth)
+		t.Cleanup(server.Close)
+		alice := newClient(t, server, "alice")
+
+		// Act
+		err := alice.StoreKey(ctx, aliceURN, []byte("alice-key"))
+		require.NoError(t, err)
+		key, err := newClient(t, server, "").GetKey(ctx, aliceURN)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-key"), key)
+	})
+
+	t.Run("Error responses decode into typed errors", func(t *testing.T) {
+		// Arrange
+		server := test.NewTestServer(fakeAuth)
+		t.Cleanup(server.Close)
+
+		// Act
+		errForbidden := newClient(t, server, "bob").StoreKey(ctx, aliceURN, []byte("k"))
+		errAnonymous := newClient(t, server, "").StoreKey(ctx, aliceURN, []byte("k"))
+		_, errMissing := newClient(t, server, "").GetKey(ctx, bobURN)
+
+		// Assert
+		assert.ErrorIs(t, errForbidden, client.ErrForbidden)
+		assert.ErrorIs(t, errAnonymous, client.ErrUnauthorized)
+		assert.ErrorIs(t, errMissing, ks.ErrKeyNotFound)
+		var apiErr *client.Error
+		require.True(t, errors.As(errAnonymous, &apiErr))
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+		assert.Equal(t, "Invalid token", apiErr.Message)
+	})
+
+	t.Run("BatchGetKeys splits large batches", func(t *testing.T) {
+		// Arrange
+		server := test.NewTestServer(fakeAuth)
+		t.Cleanup(server.Close)
+		require.NoError(t, newClient(t, server, "alice").StoreKey(ctx, aliceURN, []byte("alice-key")))
+		entityURNs := []urn.URN{aliceURN}
+		for i := range ks.MaxBatchGetKeys {
+			entityURN, err := urn.New(urn.SecureMessaging, "user", fmt.Sprintf("missing-%d", i))
+			require.NoError(t, err)
+			entityURNs = append(entityURNs, entityURN)
+		}
+
+		// Act
+		batch, err := newClient(t, server, "").BatchGetKeys(ctx, entityURNs)
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, batch.Keys, 1)
+		assert.Equal(t, aliceURN.String(), batch.Keys[0].EntityURN.String())
+		assert.Equal(t, []byte("alice-key"), batch.Keys[0].Key)
+		assert.Len(t, batch.NotFound, ks.MaxBatchGetKeys)
+		assert.Empty(t, batch.Revoked)
+	})
+
+	t.Run("StoreKeys returns a result per key", func(t *testing.T) {
+		// Arrange
+		server := test.NewTestServer(fakeAuth)
+		t.Cleanup(server.Close)
+		alice := newClient(t, server, "alice")
+
+		// Act
+		results, err := alice.StoreKeys(ctx, []client.KeyUpload{
+			{EntityURN: aliceURN, Key: []byte("alice-key")},
+			{EntityURN: bobURN, Key: []byte("bob-key")},
+		})
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, "created", results[0].Status)
+		assert.NoError(t, results[0].Err())
+		assert.Equal(t, bobURN.String(), results[1].EntityURN.String())
+		assert.ErrorIs(t, results[1].Err(), client.ErrForbidden)
+		key, err := newClient(t, server, "").GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-key"), key)
+	})
+
+	t.Run("RevokeKey revokes as an administrator", func(t *testing.T) {
+		// Arrange
+		cfg := &ks.Config{
+			HTTPListenAddr: ":0",
+			CorsConfig:     middleware.CorsConfig{AllowedOrigins: []string{"*"}, Role: middleware.CorsRoleDefault},
+			AdminSubjects:  []string{"admin"},
+		}
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		server := httptest.NewServer(keyservice.New(cfg, store, fakeAuth, zerolog.Nop()).Mux())
+		t.Cleanup(server.Close)
+
+		// Act
+		errNotAdmin := newClient(t, server, "alice").RevokeKey(ctx, aliceURN)
+		errAdmin := newClient(t, server, "admin").RevokeKey(ctx, aliceURN)
+		_, errRevoked := newClient(t, server, "").GetKey(ctx, aliceURN)
+
+		// Assert
+		assert.ErrorIs(t, errNotAdmin, client.ErrForbidden)
+		assert.NoError(t, errAdmin)
+		assert.ErrorIs(t, errRevoked, ks.ErrKeyRevoked)
+	})
+
+	t.Run("GetKeyRecord returns the key with its metadata", func(t *testing.T) {
+		// Arrange
+		server := test.NewTestServer(fakeAuth)
+		t.Cleanup(server.Close)
+		require.NoError(t, newClient(t, server, "alice").StoreKey(ctx, aliceURN, []byte("alice-key")))
+
+		// Act
+		rec, err := newClient(t, server, "").GetKeyRecord(ctx, aliceURN)
+		_, errMissing := newClient(t, server, "").GetKeyRecord(ctx, bobURN)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, aliceURN.String(), rec.EntityURN.String())
+		assert.Equal(t, []byte("alice-key"), rec.Key)
+		assert.False(t, rec.UpdatedAt.IsZero())
+		assert.ErrorIs(t, errMissing, ks.ErrKeyNotFound)
+	})
+
+	t.Run("GetKeyByIdentifier finds a key by its owner's hashed email", func(t *testing.T) {
+		// Arrange
+		server := test.NewTestServer(fakeAuth)
+		t.Cleanup(server.Close)
+		hash, err := ks.HashIdentifier("salt", "alice@example.com")
+		require.NoError(t, err)
+		unknown, err := ks.HashIdentifier("salt", "bob@example.com")
+		require.NoError(t, err)
+		require.NoError(t, newClient(t, server, "alice").StoreKey(ctx, aliceURN, []byte("alice-key"), client.WithIdentifierHashes(hash)))
+
+		// Act
+		entityURN, key, err := newClient(t, server, "").GetKeyByIdentifier(ctx, hash)
+		_, _, errMissing := newClient(t, server, "").GetKeyByIdentifier(ctx, unknown)
+		errUnverified := newClient(t, server, "bob").StoreKey(ctx, bobURN, []byte("bob-key"), client.WithIdentifierHashes(hash))
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, aliceURN.String(), entityURN.String())
+		assert.Equal(t, []byte("alice-key"), key)
+		assert.ErrorIs(t, errMissing, ks.ErrKeyNotFound)
+		assert.ErrorIs(t, errUnverified, client.ErrForbidden, "bob's token does not verify alice's email")
+	})
+
+	t.Run("DiscoverContacts finds registered contacts by truncated hash", func(t *testing.T) {
+		// Arrange
+		server := test.NewTestServer(fakeAuth)
+		t.Cleanup(server.Close)
+		hash, err := ks.HashIdentifier("salt", "+44 20 7946 0000")
+		require.NoError(t, err)
+		require.NoError(t, newClient(t, server, "alice").StoreKey(ctx, aliceURN, []byte("alice-key"), client.WithIdentifierHashes(hash)))
+
+		// Act
+		found, err := newClient(t, server, "bob").DiscoverContacts(ctx, "salt", []string{"+44 (20) 7946-0000", "carol@example.com"})
+		_, errAnonymous := newClient(t, server, "").DiscoverContacts(ctx, "salt", []string{"carol@example.com"})
+		_, errInvalid := newClient(t, server, "bob").DiscoverContacts(ctx, "salt", []string{"carol"})
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		assert.Equal(t, aliceURN.String(), found["+44 (20) 7946-0000"].EntityURN.String())
+		assert.Equal(t, []byte("alice-key"), found["+44 (20) 7946-0000"].Key)
+		assert.ErrorIs(t, errAnonymous, client.ErrUnauthorized)
+		assert.ErrorIs(t, errInvalid, ks.ErrInvalidIdentifier)
+	})
+
+	t.Run("ListKeys pages through records as an administrator", func(t *testing.T) {
+		// Arrange
+		cfg := &ks.Config{
+			HTTPListenAddr: ":0",
+			CorsConfig:     middleware.CorsConfig{AllowedOrigins: []string{"*"}, Role: middleware.CorsRoleDefault},
+			AdminSubjects:  []string{"admin"},
+		}
+		store := inmemory.New()
+		require.NoError(t, store.StoreKey(ctx, aliceURN, []byte("alice-key")))
+		require.NoError(t, store.StoreKey(ctx, bobURN, []byte("bob-key")))
+		require.NoError(t, store.RevokeKey(ctx, bobURN))
+		server := httptest.NewServer(keyservice.New(cfg, store, fakeAuth, zerolog.Nop()).Mux())
+		t.Cleanup(server.Close)
+		admin := newClient(t, server, "admin")
+
+		// Act
+		first, err := admin.ListKeys(ctx, ks.ListFilter{EntityType: "user", PageSize: 1}, "")
+		require.NoError(t, err)
+		second, err := admin.ListKeys(ctx, ks.ListFilter{EntityType: "user", PageSize: 1}, first.NextPageToken)
+		require.NoError(t, err)
+		_, errNotAdmin := newClient(t, server, "alice").ListKeys(ctx, ks.ListFilter{}, "")
+
+		// Assert
+		require.Len(t, first.Records, 1)
+		require.Len(t, second.Records, 1)
+		assert.NotEmpty(t, first.NextPageToken)
+		byURN := map[string]ks.KeyRecord{}
+		for _, rec := range append(first.Records, second.Records...) {
+			byURN[rec.EntityURN.String()] = rec
+		}
+		assert.Equal(t, []byte("alice-key"), byURN[aliceURN.String()].Key)
+		assert.True(t, byURN[bobURN.String()].Revoked)
+		assert.ErrorIs(t, errNotAdmin, client.ErrForbidden)
+	})
+
+	t.Run("Server errors are retried with backoff", func(t *testing.T) {
+		// Arrange
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				response.WriteJSONError(w, http.StatusServiceUnavailable, "Try again")
+				return
+			}
+			_, _ = w.Write([]byte("alice-key"))
+		}))
+		t.Cleanup(server.Close)
+
+		// Act
+		key, err := newClient(t, server, "").GetKey(ctx, aliceURN)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-key"), key)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("Retries give up after the configured attempts", func(t *testing.T) {
+		// Arrange
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			response.WriteJSONError(w, http.StatusInternalServerError, "Internal server error")
+		}))
+		t.Cleanup(server.Close)
+
+		// Act
+		_, err := newClient(t, server, "").GetKey(ctx, aliceURN)
+
+		// Assert
+		var apiErr *client.Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("Client errors are not retried", func(t *testing.T) {
+		// Arrange
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			response.WriteJSONError(w, http.StatusNotFound, "Key not found")
+		}))
+		t.Cleanup(server.Close)
+
+		// Act
+		_, err := newClient(t, server, "").GetKey(ctx, aliceURN)
+
+		// Assert
+		assert.ErrorIs(t, err, ks.ErrKeyNotFound)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("Writes are not retried", func(t *testing.T) {
+		// Arrange
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			response.WriteJSONError(w, http.StatusServiceUnavailable, "Try again")
+		}))
+		t.Cleanup(server.Close)
+
+		// Act
+		err := newClient(t, server, "alice").StoreKey(ctx, aliceURN, []byte("alice-key"))
+
+		// Assert
+		var apiErr *client.Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode, "the first attempt's outcome is reported")
+		assert.Equal(t, int32(1), calls.Load(), "a retry would reuse the spent challenge")
+	})
+
+	t.Run("URNs are escaped in paths", func(t *testing.T) {
+		// Arrange
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.EscapedPath()
+			_, _ = w.Write([]byte("key"))
+		}))
+		t.Cleanup(server.Close)
+		oddURN, err := urn.New(urn.SecureMessaging, "user", "a b?c")
+		require.NoError(t, err)
+
+		// Act
+		_, err = newClient(t, server, "").GetKey(ctx, oddURN)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "/keys/urn:sm:user:a%20b%3Fc", path)
+	})
+
+	t.Run("Cache serves repeated reads until evicted", func(t *testing.T) {
+		// Arrange
+		var reads atomic.Int32
+		inner := test.NewTestServer(fakeAuth)
+		t.Cleanup(inner.Close)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				reads.Add(1)
+			}
+			proxied, err := http.NewRequestWithContext(r.Context(), r.Method, inner.URL+r.URL.RequestURI(), r.Body)
+			require.NoError(t, err)
+			proxied.Header = r.Header
+			resp, err := http.DefaultClient.Do(proxied)
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+			w.WriteHeader(resp.StatusCode)
+			_, _ = io.Copy(w, resp.Body)
+		}))
+		t.Cleanup(server.Close)
+		alice := newClient(t, server, "alice", client.WithCache(time.Minute))
+		require.NoError(t, alice.StoreKey(ctx, aliceURN, []byte("first")))
+
+		// Act
+		first, err := alice.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		cached, err := alice.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		require.NoError(t, alice.StoreKey(ctx, aliceURN, []byte("second")))
+		second, err := alice.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, []byte("first"), first)
+		assert.Equal(t, []byte("first"), cached)
+		assert.Equal(t, []byte("second"), second)
+		assert.Equal(t, int32(2), reads.Load())
+	})
+
+	t.Run("Cache hands out copies of its keys", func(t *testing.T) {
+		// Arrange
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("alice-key"))
+		}))
+		t.Cleanup(server.Close)
+		alice := newClient(t, server, "alice", client.WithCache(time.Minute))
+		first, err := alice.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+
+		// Act
+		first[0] = 'X'
+		cached, err := alice.GetKey(ctx, aliceURN)
+		require.NoError(t, err)
+		cached[1] = 'X'
+		again, err := alice.GetKey(ctx, aliceURN)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []byte("alice-key"), again)
+	})
+
+	t.Run("New rejects invalid base URLs", func(t *testing.T) {
+		_, err := client.New("keys.example.com")
+		assert.Error(t, err)
+	})
+}
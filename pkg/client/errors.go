@@ -0,0 +1,57 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+)
+
+// Errors matched by errors.Is against an *Error. Missing, revoked and locked
+// keys match keyservice.ErrKeyNotFound, keyservice.ErrKeyRevoked and
+// keyservice.ErrEntityLocked.
+var (
+	// ErrUnauthorized means the token was missing, invalid or expired.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden means the caller may not perform the operation.
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalidRequest means the service rejected the request as malformed.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrRateLimited means the caller made too many lookups.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// Error is an error response from the key service.
+type Error struct {
+	StatusCode int
+	// Message is the "error" field of the response body, or the status
+	// text if the body had none.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("key service responded %d: %s", e.StatusCode, e.Message)
+}
+
+// Is matches the sentinel error for the response status.
+func (e *Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrInvalidRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == keyservice.ErrKeyNotFound
+	case http.StatusGone:
+		return target == keyservice.ErrKeyRevoked
+	case http.StatusLocked:
+		return target == keyservice.ErrEntityLocked
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	default:
+		return false
+	}
+}
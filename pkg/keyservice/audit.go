@@ -0,0 +1,118 @@
+package keyservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAuditChainBroken is returned, wrapped, by VerifyAuditEvent when an
+// event does not follow its predecessor or its hash does not match its
+// contents.
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// Audit outcomes. AuditPending marks an event appended before its mutation
+// was attempted; an event with the same action, entity and request ID
+// records the outcome, unless the service failed in between.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditPending = "pending"
+)
+
+// AuditEvent records one mutation of the key directory. Events form a hash
+// chain: each carries the Hash of its predecessor in PrevHash and a Hash
+// over its own contents, so deleting, reordering or editing an event breaks
+// the chain from that point on.
+type AuditEvent struct {
+	// Sequence numbers events from 1 without gaps.
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+	// Action is what was attempted, e.g. "keys:write" or "admin:revoke".
+	Action string `json:"action"`
+	// Actor is the authenticated subject who made the request.
+	Actor     string `json:"actor"`
+	EntityURN string `json:"entityUrn,omitempty"`
+	// OldFingerprint and NewFingerprint identify the entity's key before
+	// and after the action; see Fingerprint. For the event of an archive
+	// import as a whole, which has no entity, NewFingerprint is the
+	// archive's SHA-256 digest.
+	OldFingerprint string `json:"oldFingerprint,omitempty"`
+	NewFingerprint string `json:"newFingerprint,omitempty"`
+	// ClientIP is the address of the connecting peer; ForwardedFor holds
+	// any X-Forwarded-For chain it presented, unverified.
+	ClientIP     string `json:"clientIp,omitempty"`
+	ForwardedFor string `json:"forwardedFor,omitempty"`
+	RequestID    string `json:"requestId,omitempty"`
+	// Outcome is AuditSuccess, AuditFailure with the reason in Error, or
+	// AuditPending.
+	Outcome  string `json:"outcome"`
+	Error    string `json:"error,omitempty"`
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// AuditSink durably appends audit events and reads them back in order.
+type AuditSink interface {
+	// Append links event to the end of the chain with ChainAuditEvent and
+	// stores it, returning the stored event. Appends are serialized so the
+	// chain never forks.
+	Append(ctx context.Context, event AuditEvent) (AuditEvent, error)
+	// AppendAll is Append for many events, linked in order, in as few
+	// writes as the sink allows. It returns the stored events.
+	AppendAll(ctx context.Context, events []AuditEvent) ([]AuditEvent, error)
+	// List returns up to limit events with a Sequence greater than
+	// afterSequence, in sequence order. A limit of zero or less returns
+	// all of them.
+	List(ctx context.Context, afterSequence uint64, limit int) ([]AuditEvent, error)
+}
+
+// Fingerprint identifies a key in the audit log without recording the key
+// itself. It is the hex SHA-256 of the key, or empty if there is no key.
+func Fingerprint(key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// ChainAuditEvent returns event as the successor of prev, which is the zero
+// AuditEvent for the first event in a chain. The time is normalized to UTC
+// microseconds so the hash survives storage round trips.
+func ChainAuditEvent(prev, event AuditEvent) AuditEvent {
+	event.Sequence = prev.Sequence + 1
+	event.PrevHash = prev.Hash
+	event.Time = event.Time.UTC().Truncate(time.Microsecond)
+	event.Hash = HashAuditEvent(event)
+	return event
+}
+
+// HashAuditEvent returns the hex SHA-256 of the event's canonical JSON
+// encoding, excluding its own Hash.
+func HashAuditEvent(event AuditEvent) string {
+	event.Hash = ""
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditEvent checks that event directly follows prev and that its
+// hash matches its contents. Pass the zero AuditEvent as prev for the first
+// event.
+func VerifyAuditEvent(prev, event AuditEvent) error {
+	if event.Sequence != prev.Sequence+1 {
+		return fmt.Errorf("%w: expected sequence %d, found %d", ErrAuditChainBroken, prev.Sequence+1, event.Sequence)
+	}
+	if event.PrevHash != prev.Hash {
+		return fmt.Errorf("%w: event %d does not link to event %d", ErrAuditChainBroken, event.Sequence, prev.Sequence)
+	}
+	if HashAuditEvent(event) != event.Hash {
+		return fmt.Errorf("%w: event %d was modified", ErrAuditChainBroken, event.Sequence)
+	}
+	return nil
+}
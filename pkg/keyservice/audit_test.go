@@ -0,0 +1,38 @@
+package keyservice_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditChain(t *testing.T) {
+	first := keyservice.ChainAuditEvent(keyservice.AuditEvent{}, keyservice.AuditEvent{Action: "keys:write", Time: time.Now()})
+	second := keyservice.ChainAuditEvent(first, keyservice.AuditEvent{Action: "admin:revoke", Time: time.Now()})
+
+	t.Run("Chained events verify", func(t *testing.T) {
+		assert.Equal(t, uint64(1), first.Sequence)
+		assert.Equal(t, first.Hash, second.PrevHash)
+		require.NoError(t, keyservice.VerifyAuditEvent(keyservice.AuditEvent{}, first))
+		require.NoError(t, keyservice.VerifyAuditEvent(first, second))
+	})
+
+	t.Run("Modified event is detected", func(t *testing.T) {
+		tampered := second
+		tampered.Actor = "someone-else"
+		assert.ErrorIs(t, keyservice.VerifyAuditEvent(first, tampered), keyservice.ErrAuditChainBroken)
+	})
+
+	t.Run("Missing event is detected", func(t *testing.T) {
+		assert.ErrorIs(t, keyservice.VerifyAuditEvent(keyservice.AuditEvent{}, second), keyservice.ErrAuditChainBroken)
+	})
+}
+
+func TestFingerprint(t *testing.T) {
+	assert.Empty(t, keyservice.Fingerprint(nil))
+	assert.Len(t, keyservice.Fingerprint([]byte("key")), 64)
+	assert.NotEqual(t, keyservice.Fingerprint([]byte("key-1")), keyservice.Fingerprint([]byte("key-2")))
+}
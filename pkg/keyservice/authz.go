@@ -0,0 +1,123 @@
+package keyservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Action is an operation subject to authorization.
+type Action string
+
+const (
+	// ActionStoreKey is uploading a key for an entity.
+	ActionStoreKey Action = "keys:write"
+	// ActionManageDevices is enrolling or unenrolling devices of an owner.
+	ActionManageDevices Action = "devices:write"
+)
+
+// Effect is the outcome of a matching policy rule.
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// SubjectRelation constrains how the caller relates to the target entity.
+type SubjectRelation string
+
+const (
+	// SubjectAny places no constraint on the caller.
+	SubjectAny SubjectRelation = ""
+	// SubjectEntityID requires the caller's subject to equal the target URN's
+	// entity ID.
+	SubjectEntityID SubjectRelation = "entity_id"
+	// SubjectDeviceOwner requires the target to be a device enrolled to an
+	// owner whose entity ID equals the caller's subject.
+	SubjectDeviceOwner SubjectRelation = "device_owner"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Subject is the caller's identity, normally the JWT "sub" claim.
+	Subject string
+	// Claims holds every claim of the caller's token.
+	Claims map[string]any
+}
+
+// Authorizer decides whether a principal may perform an action on an entity.
+type Authorizer interface {
+	Authorize(ctx context.Context, principal Principal, action Action, target urn.URN) (bool, error)
+}
+
+// Policy is a declarative set of authorization rules. A request is allowed if
+// at least one allow rule matches it and no deny rule does.
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule matches requests by action, target entity type, the caller's
+// relation to the target and the caller's claims. Empty fields match
+// anything.
+type PolicyRule struct {
+	Name        string          `yaml:"name"`
+	Effect      Effect          `yaml:"effect"`
+	Actions     []Action        `yaml:"actions"`
+	EntityTypes []string        `yaml:"entity_types"`
+	Subject     SubjectRelation `yaml:"subject"`
+	// Claims must all be present on the caller's token. A string claim must
+	// equal the value; a list claim must contain it.
+	Claims map[string]string `yaml:"claims"`
+}
+
+// Validate checks that every rule uses a known effect, action and subject
+// relation.
+func (p Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return fmt.Errorf("rule %d (%s): effect must be allow or deny, got %q", i, rule.Name, rule.Effect)
+		}
+		for _, action := range rule.Actions {
+			switch action {
+			case ActionStoreKey, ActionManageDevices:
+			default:
+				return fmt.Errorf("rule %d (%s): unknown action %q", i, rule.Name, action)
+			}
+		}
+		switch rule.Subject {
+		case SubjectAny, SubjectEntityID, SubjectDeviceOwner:
+		default:
+			return fmt.Errorf("rule %d (%s): unknown subject relation %q", i, rule.Name, rule.Subject)
+		}
+	}
+	return nil
+}
+
+// DefaultPolicy lets any caller store a key for an entity whose ID equals
+// their own subject, manage their own devices, and store keys for the devices
+// they own.
+func DefaultPolicy() Policy {
+	return Policy{Rules: []PolicyRule{
+		{
+			Name:    "store-own-key",
+			Effect:  EffectAllow,
+			Actions: []Action{ActionStoreKey},
+			Subject: SubjectEntityID,
+		},
+		{
+			Name:    "manage-own-devices",
+			Effect:  EffectAllow,
+			Actions: []Action{ActionManageDevices},
+			Subject: SubjectEntityID,
+		},
+		{
+			Name:        "store-owned-device-key",
+			Effect:      EffectAllow,
+			Actions:     []Action{ActionStoreKey},
+			EntityTypes: []string{DeviceEntityType},
+			Subject:     SubjectDeviceOwner,
+		},
+	}}
+}
@@ -0,0 +1,78 @@
+package keyservice
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// ClientCertMode controls whether TLS clients must present a certificate.
+type ClientCertMode string
+
+const (
+	// ClientCertNone does not ask clients for a certificate.
+	ClientCertNone ClientCertMode = "none"
+	// ClientCertOptional verifies a certificate if the client presents one,
+	// so callers without one can still use public routes and tokens. It is
+	// the default.
+	ClientCertOptional ClientCertMode = "optional"
+	// ClientCertRequire rejects handshakes without a valid certificate.
+	ClientCertRequire ClientCertMode = "require"
+)
+
+// ParseClientCertMode parses a configured client certificate mode. An empty
+// string is optional.
+func ParseClientCertMode(s string) (ClientCertMode, error) {
+	switch mode := ClientCertMode(s); mode {
+	case "":
+		return ClientCertOptional, nil
+	case ClientCertNone, ClientCertOptional, ClientCertRequire:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown client certificate mode %q: must be none, optional or require", s)
+	}
+}
+
+// TLSClientAuth returns the crypto/tls policy implementing the mode.
+func (m ClientCertMode) TLSClientAuth() tls.ClientAuthType {
+	switch m {
+	case ClientCertNone:
+		return tls.NoClientCert
+	case ClientCertRequire:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.VerifyClientCertIfGiven
+	}
+}
+
+// ClientCertMapping turns a verified client certificate into a principal.
+// A certificate matches if it carries the SPIFFEID as a URI SAN or, when
+// SPIFFEID is empty, if its subject distinguished name equals Subject, e.g.
+// "CN=message-router,O=Example".
+type ClientCertMapping struct {
+	SPIFFEID string `yaml:"spiffe_id"`
+	Subject  string `yaml:"subject"`
+	// Principal is the subject the authorization layer sees.
+	Principal string `yaml:"principal"`
+	// Claims are exposed to the authorization layer as if they were token
+	// claims, e.g. {"roles": ["keys-reader"]}.
+	Claims map[string]any `yaml:"claims"`
+}
+
+// Validate reports whether the mapping can match a certificate.
+func (m ClientCertMapping) Validate() error {
+	if m.Principal == "" {
+		return fmt.Errorf("client certificate mapping needs a principal")
+	}
+	if (m.SPIFFEID == "") == (m.Subject == "") {
+		return fmt.Errorf("client certificate mapping for %s needs exactly one of spiffe_id or subject", m.Principal)
+	}
+	return nil
+}
+
+// ClientCertMapper maps verified client certificates to principals.
+type ClientCertMapper interface {
+	// PrincipalForCert returns the principal of cert, which has already been
+	// verified against the trusted CAs, or false if it maps to none.
+	PrincipalForCert(cert *x509.Certificate) (Principal, bool)
+}
@@ -0,0 +1,31 @@
+package keyservice_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClientCertMode(t *testing.T) {
+	mode, err := keyservice.ParseClientCertMode("")
+	require.NoError(t, err)
+	assert.Equal(t, keyservice.ClientCertOptional, mode, "empty verifies certificates if given")
+	assert.Equal(t, tls.VerifyClientCertIfGiven, mode.TLSClientAuth())
+
+	mode, err = keyservice.ParseClientCertMode("require")
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, mode.TLSClientAuth())
+
+	_, err = keyservice.ParseClientCertMode("request")
+	assert.Error(t, err)
+}
+
+func TestClientCertMappingValidate(t *testing.T) {
+	assert.NoError(t, keyservice.ClientCertMapping{SPIFFEID: "spiffe://example.org/a", Principal: "service:a"}.Validate())
+	assert.NoError(t, keyservice.ClientCertMapping{Subject: "CN=a", Principal: "service:a"}.Validate())
+	assert.Error(t, keyservice.ClientCertMapping{SPIFFEID: "spiffe://example.org/a"}.Validate(), "principal is required")
+	assert.Error(t, keyservice.ClientCertMapping{SPIFFEID: "spiffe://example.org/a", Subject: "CN=a", Principal: "service:a"}.Validate(), "ambiguous match")
+}
@@ -1,12 +1,70 @@
 package keyservice
 
-import "github.com/illmade-knight/go-microservice-base/pkg/middleware"
+import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/illmade-knight/go-microservice-base/pkg/middleware"
+)
 
 // Config holds all necessary configuration for the key service.
 type Config struct {
 	HTTPListenAddr string
+	// GRPCListenAddr serves the gRPC API on this address if set.
+	GRPCListenAddr string
 	// ADDED: The secret key for validating JWTs. It will be loaded
 	// from the "JWT_SECRET" environment variable.
 	CorsConfig middleware.CorsConfig
 	JWTSecret  string `env:"JWT_SECRET,required"`
+	// AdminSubjects lists the JWT subjects allowed to call the /admin routes.
+	AdminSubjects []string
+	// AdminRoleClaim names the token claim checked for AdminRole; it
+	// defaults to "roles".
+	AdminRoleClaim string
+	// AdminRole admits any caller whose AdminRoleClaim holds it to the
+	// /admin routes. Unused if empty.
+	AdminRole string
+	// ArchiveSigningKey signs archives produced by GET /admin/export.
+	ArchiveSigningKey ed25519.PrivateKey
+	// ArchiveTrustedKeys are accepted as signers by POST /admin/import.
+	ArchiveTrustedKeys []ed25519.PublicKey
+	// TokenRequirements apply to every authenticated route.
+	TokenRequirements TokenRequirements
+	// RouteTokenRequirements refine TokenRequirements per route, keyed by
+	// the route's unversioned pattern; see ValidateTokenRoutes.
+	RouteTokenRequirements map[string]TokenRequirements
+	// ReadMode controls who may fetch keys; empty means ReadModePublic.
+	ReadMode ReadMode
+	// LookupRateLimit limits key lookups per client; zero means unlimited.
+	LookupRateLimit LookupRateLimit
+	// IdentifierSalt is the salt, shared with clients, under which uploads
+	// may register the hashes of their caller's verified email address and
+	// phone number; empty disables registration.
+	IdentifierSalt string
+	// DiscoveryRateLimit limits the hash prefixes each subject may send to
+	// POST /discovery; zero means DefaultDiscoveryRateLimit.
+	DiscoveryRateLimit RateLimit
+	// RequireProofOfPossession makes uploads of signature-capable keys sign
+	// a challenge from POST /keys/{entityURN}/challenge.
+	RequireProofOfPossession bool
+	// ChallengeTTL bounds how long a challenge stays valid; zero means
+	// DefaultChallengeTTL.
+	ChallengeTTL time.Duration
+	// RequireIdentitySignatures makes device key uploads carry a signature
+	// by the owner's identity key.
+	RequireIdentitySignatures bool
+	// RequireAuditLog records every mutation in the audit sink before it
+	// is applied and refuses it with 503 Service Unavailable if it cannot
+	// be recorded, instead of only counting the failure.
+	RequireAuditLog bool
+	// APIVersions announces the deprecation of API versions to their
+	// clients.
+	APIVersions VersionPolicies
+	// FederationSigningKey signs the answers to partner domains' key
+	// lookups; serving them is disabled if nil. FederationDomain is the
+	// domain whose entities are served and FederationURL the base URL of
+	// this service advertised in its discovery document.
+	FederationSigningKey ed25519.PrivateKey
+	FederationDomain     string
+	FederationURL        string
 }
@@ -0,0 +1,42 @@
+package keyservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// DeviceEntityType is the URN entity type of a device.
+const DeviceEntityType = "device"
+
+var (
+	// ErrDeviceNotEnrolled is returned when a device has no owner, or is
+	// not owned by the given owner.
+	ErrDeviceNotEnrolled = errors.New("device not enrolled")
+	// ErrDeviceOwnedByOther is returned when enrolling a device that is
+	// already enrolled to a different owner.
+	ErrDeviceOwnedByOther = errors.New("device enrolled to another owner")
+)
+
+// EnrollmentMessage is the message a device's key signs to consent to being
+// enrolled to owner: "enroll", the nonce of a single-use challenge issued
+// for the enrollment, owner's URN and the device's URN, separated by
+// newlines.
+func EnrollmentMessage(nonce string, owner, device urn.URN) []byte {
+	return []byte("enroll\n" + nonce + "\n" + owner.String() + "\n" + device.String())
+}
+
+// DeviceRegistry records which entity, normally a user, owns each device.
+// A device has at most one owner at a time.
+type DeviceRegistry interface {
+	// EnrollDevice makes owner the owner of device. Enrolling a device that
+	// owner already owns is a no-op.
+	EnrollDevice(ctx context.Context, owner, device urn.URN) error
+	// UnenrollDevice removes owner's ownership of device.
+	UnenrollDevice(ctx context.Context, owner, device urn.URN) error
+	// OwnerOf returns the owner of device.
+	OwnerOf(ctx context.Context, device urn.URN) (urn.URN, error)
+	// ListDevices returns owner's devices ordered by URN.
+	ListDevices(ctx context.Context, owner urn.URN) ([]urn.URN, error)
+}
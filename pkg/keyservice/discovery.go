@@ -0,0 +1,39 @@
+package keyservice
+
+// Contact discovery matches truncated identifier hashes, so callers never
+// send the hashes of their whole address book, and answers with truncated
+// hashes too, so the service never hands out a full hash that could be
+// tested offline against every phone number. Each prefix reveals to the
+// caller the registrations in its bucket, so what one subject can learn of
+// the directory is bounded by a quota of prefixes.
+const (
+	// DiscoveryPrefixLength is the length of the hash prefixes accepted by
+	// POST /discovery: four z-base-32 characters, 20 bits, splitting the
+	// directory into about a million buckets.
+	DiscoveryPrefixLength = 4
+	// MaxDiscoveryPrefixes bounds the prefixes in one discovery request.
+	MaxDiscoveryPrefixes = 1000
+	// MaxDiscoveryMatches bounds the registrations returned per prefix.
+	// Prefixes with more are listed as truncated in the response.
+	MaxDiscoveryMatches = 100
+	// MaxDiscoveryResponseMatches bounds the registrations read for one
+	// discovery request across all its prefixes. Prefixes beyond it are
+	// listed as truncated too.
+	MaxDiscoveryResponseMatches = 1000
+	// DiscoveryMatchLength is the length of the hash prefixes returned for
+	// discovery matches: eight characters, 40 bits. They pick out the
+	// caller's candidate contacts within a bucket, which the caller
+	// confirms by looking up their full hashes.
+	DiscoveryMatchLength = 8
+)
+
+// DefaultDiscoveryRateLimit is the discovery quota of each subject when
+// none is configured: an address book of 1000 contacts at once, then 1000
+// prefixes a day.
+var DefaultDiscoveryRateLimit = RateLimit{Rate: 1000.0 / 86400, Burst: 1000}
+
+// ValidIdentifierPrefix reports whether prefix is a well-formed discovery
+// prefix.
+func ValidIdentifierPrefix(prefix string) bool {
+	return len(prefix) == DiscoveryPrefixLength && validZBase32(prefix)
+}
@@ -0,0 +1,17 @@
+package keyservice
+
+import "context"
+
+// KeyEncrypter wraps and unwraps the data keys used to encrypt stored key
+// material at rest (envelope encryption). The key encryption keys never leave
+// the implementation, which may be a local keyring or a cloud KMS.
+type KeyEncrypter interface {
+	// WrapKey encrypts dataKey with the current primary key encryption key
+	// and returns the ID of the key used.
+	WrapKey(ctx context.Context, dataKey []byte) (wrapped []byte, keyID string, err error)
+	// UnwrapKey decrypts a data key previously wrapped with keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// PrimaryKeyID returns the ID WrapKey currently wraps with. Envelopes
+	// wrapped under any other ID are due for re-wrapping.
+	PrimaryKeyID(ctx context.Context) (string, error)
+}
@@ -0,0 +1,48 @@
+package keyservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// FederationDiscoveryPath is where a domain publishes the document
+// describing its key service, relative to https://{domain}.
+const FederationDiscoveryPath = "/.well-known/key-service"
+
+// ErrUntrustedDomain is returned when resolving the key of an entity whose
+// domain is not a trusted federation peer.
+var ErrUntrustedDomain = errors.New("domain is not a trusted federation peer")
+
+// FederatedDomain is a partner domain whose entities' keys are resolved from
+// its own key service rather than the local store.
+type FederatedDomain struct {
+	Domain string `yaml:"domain"`
+	// DiscoveryURL overrides the location of the domain's discovery
+	// document, https://{Domain}/.well-known/key-service.
+	DiscoveryURL string `yaml:"discovery_url"`
+}
+
+// EntityDomain returns the domain an entity belongs to: the part of its ID
+// after the last "@", as in urn:sm:user:alice@example.com. Entities without
+// one belong to no domain.
+func EntityDomain(entityURN urn.URN) (string, bool) {
+	i := strings.LastIndex(entityURN.EntityID(), "@")
+	if i < 0 || i == len(entityURN.EntityID())-1 {
+		return "", false
+	}
+	return strings.ToLower(entityURN.EntityID()[i+1:]), true
+}
+
+// KeyResolver resolves the keys of entities owned by other domains.
+type KeyResolver interface {
+	// Resolves reports whether entityURN belongs to a trusted foreign
+	// domain, so its key must be resolved instead of read from the store.
+	Resolves(entityURN urn.URN) bool
+	// ResolveKey returns the entity's key record as published by its
+	// domain's key service. Like Store.GetKey it fails with ErrKeyNotFound
+	// or ErrKeyRevoked if there is none to serve.
+	ResolveKey(ctx context.Context, entityURN urn.URN) (KeyRecord, error)
+}
@@ -0,0 +1,35 @@
+package keyservice_test
+
+import (
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityDomain(t *testing.T) {
+	testCases := []struct {
+		id         string
+		wantDomain string
+		wantOK     bool
+	}{
+		{id: "alice@example.com", wantDomain: "example.com", wantOK: true},
+		{id: "alice@Partner.Example", wantDomain: "partner.example", wantOK: true},
+		{id: "a@b@example.com", wantDomain: "example.com", wantOK: true},
+		{id: "alice", wantOK: false},
+		{id: "alice@", wantOK: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.id, func(t *testing.T) {
+			entityURN, err := urn.New(urn.SecureMessaging, "user", tc.id)
+			require.NoError(t, err)
+
+			domain, ok := keyservice.EntityDomain(entityURN)
+
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantDomain, domain)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package keyservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// IdentifierHashLength is the length of an identifier hash: the z-base-32
+// encoding of a SHA-256 digest, as in the OpenPGP Web Key Directory.
+const IdentifierHashLength = 52
+
+// MaxIdentifierHashes bounds the identifier hashes registered with one key
+// upload.
+const MaxIdentifierHashes = 10
+
+var (
+	// ErrIdentifierNotFound is returned when no entity registered an
+	// identifier hash.
+	ErrIdentifierNotFound = errors.New("identifier not found")
+	// ErrIdentifierTaken is returned when registering an identifier hash
+	// that another entity already registered.
+	ErrIdentifierTaken = errors.New("identifier registered to another entity")
+	// ErrInvalidIdentifier is returned when an identifier is neither an
+	// email address nor an E.164 phone number.
+	ErrInvalidIdentifier = errors.New("identifier must be an email address or an E.164 phone number")
+)
+
+// zBase32Alphabet is the human-oriented base-32 alphabet WKD hashes are
+// written in.
+const zBase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+var zBase32 = base32.NewEncoding(zBase32Alphabet).WithPadding(base32.NoPadding)
+
+// IdentifierIndex maps salted hashes of external identifiers, such as email
+// addresses and phone numbers, to the entities that registered them. Only
+// the hashes are stored, never the identifiers.
+type IdentifierIndex interface {
+	// RegisterIdentifier maps hash to owner. Registering a hash owner
+	// already holds is a no-op; one held by another entity fails with
+	// ErrIdentifierTaken.
+	RegisterIdentifier(ctx context.Context, hash string, owner urn.URN) error
+	// UnregisterIdentifier removes owner's registration of hash. It fails
+	// with ErrIdentifierNotFound if owner does not hold hash.
+	UnregisterIdentifier(ctx context.Context, hash string, owner urn.URN) error
+	// AssignIdentifier maps hash to owner whoever held it before. It is
+	// the administrative override of RegisterIdentifier.
+	AssignIdentifier(ctx context.Context, hash string, owner urn.URN) error
+	// LookupIdentifier returns the entity that registered hash.
+	LookupIdentifier(ctx context.Context, hash string) (urn.URN, error)
+	// LookupPrefix returns up to limit registrations whose hash starts with
+	// prefix, ordered by hash.
+	LookupPrefix(ctx context.Context, prefix string, limit int) ([]IdentifierEntry, error)
+}
+
+// IdentifierEntry is an identifier hash and the entity that registered it.
+type IdentifierEntry struct {
+	Hash  string
+	Owner urn.URN
+}
+
+// HashIdentifier returns the hash under which identifier is registered and
+// looked up: the z-base-32 encoded SHA-256 digest of salt, a zero byte and
+// the normalized identifier. Clients and the deployment agree on salt, so
+// a leaked index cannot be matched against precomputed tables of other
+// deployments. The salt is not a secret, though: phone numbers are few
+// enough that anyone holding full hashes can recover them by trying every
+// number, so the service only hands out hashes callers already sent it.
+func HashIdentifier(salt, identifier string) (string, error) {
+	normalized, err := NormalizeIdentifier(identifier)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(salt + "\x00" + normalized))
+	return zBase32.EncodeToString(sum[:]), nil
+}
+
+// Claims holding the caller's email address and phone number, and whether
+// the identity provider verified them, as in OpenID Connect.
+const (
+	EmailClaim               = "email"
+	EmailVerifiedClaim       = "email_verified"
+	PhoneNumberClaim         = "phone_number"
+	PhoneNumberVerifiedClaim = "phone_number_verified"
+)
+
+// VerifiedIdentifiers returns the normalized email address and phone number
+// in claims that the identity provider marked as verified. Only these may be
+// registered for the caller's keys, so nobody can claim another person's
+// identifier.
+func VerifiedIdentifiers(claims map[string]any) []string {
+	var identifiers []string
+	for _, pair := range [][2]string{{EmailClaim, EmailVerifiedClaim}, {PhoneNumberClaim, PhoneNumberVerifiedClaim}} {
+		value, _ := claims[pair[0]].(string)
+		if verified, _ := claims[pair[1]].(bool); !verified || value == "" {
+			continue
+		}
+		if normalized, err := NormalizeIdentifier(value); err == nil {
+			identifiers = append(identifiers, normalized)
+		}
+	}
+	return identifiers
+}
+
+// NormalizeIdentifier returns the canonical form of an email address,
+// lower-cased, or of a phone number in international format, a plus sign
+// followed by its digits without separators.
+func NormalizeIdentifier(identifier string) (string, error) {
+	identifier = strings.TrimSpace(identifier)
+	if strings.HasPrefix(identifier, "+") {
+		digits := strings.Map(func(r rune) rune {
+			switch {
+			case r >= '0' && r <= '9':
+				return r
+			case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+				return -1
+			default:
+				return 'x'
+			}
+		}, identifier[1:])
+		if len(digits) < 8 || len(digits) > 15 || strings.Contains(digits, "x") {
+			return "", fmt.Errorf("phone number %q: %w", identifier, ErrInvalidIdentifier)
+		}
+		return "+" + digits, nil
+	}
+	local, domain, ok := strings.Cut(identifier, "@")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "@") || strings.ContainsAny(identifier, " \t\r\n") {
+		return "", fmt.Errorf("%q: %w", identifier, ErrInvalidIdentifier)
+	}
+	return strings.ToLower(identifier), nil
+}
+
+// ValidIdentifierHash reports whether hash is a well-formed identifier
+// hash.
+func ValidIdentifierHash(hash string) bool {
+	return len(hash) == IdentifierHashLength && validZBase32(hash)
+}
+
+// validZBase32 reports whether s only holds z-base-32 characters.
+func validZBase32(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune(zBase32Alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package keyservice_test
+
+import (
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeIdentifier(t *testing.T) {
+	testCases := []struct {
+		identifier string
+		want       string
+		wantErr    bool
+	}{
+		{identifier: " Alice@Example.COM ", want: "alice@example.com"},
+		{identifier: "+44 (20) 7946-0000", want: "+442079460000"},
+		{identifier: "+1.555.010.9999", want: "+15550109999"},
+		{identifier: "alice", wantErr: true},
+		{identifier: "@example.com", wantErr: true},
+		{identifier: "a@b@example.com", wantErr: true},
+		{identifier: "+12345", wantErr: true},
+		{identifier: "+44 20 7946 000x", wantErr: true},
+		{identifier: "020 7946 0000", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.identifier, func(t *testing.T) {
+			// Act
+			got, err := keyservice.NormalizeIdentifier(tc.identifier)
+
+			// Assert
+			if tc.wantErr {
+				assert.ErrorIs(t, err, keyservice.ErrInvalidIdentifier)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestVerifiedIdentifiers(t *testing.T) {
+	// Act
+	identifiers := keyservice.VerifiedIdentifiers(map[string]any{
+		"email":                 "Alice@Example.com",
+		"email_verified":        true,
+		"phone_number":          "+44 20 7946 0000",
+		"phone_number_verified": false,
+	})
+
+	// Assert
+	assert.Equal(t, []string{"alice@example.com"}, identifiers)
+	assert.Empty(t, keyservice.VerifiedIdentifiers(map[string]any{"email": "alice@example.com"}), "unverified claims are ignored")
+}
+
+func TestHashIdentifier(t *testing.T) {
+	// Act
+	hash, err := keyservice.HashIdentifier("salt", "alice@example.com")
+	require.NoError(t, err)
+	sameHash, err := keyservice.HashIdentifier("salt", "ALICE@example.com")
+	require.NoError(t, err)
+	otherSalt, err := keyservice.HashIdentifier("pepper", "alice@example.com")
+	require.NoError(t, err)
+	_, invalidErr := keyservice.HashIdentifier("salt", "alice")
+
+	// Assert
+	assert.Len(t, hash, keyservice.IdentifierHashLength)
+	assert.True(t, keyservice.ValidIdentifierHash(hash))
+	assert.Equal(t, hash, sameHash, "identifiers are normalized before hashing")
+	assert.NotEqual(t, hash, otherSalt)
+	assert.ErrorIs(t, invalidErr, keyservice.ErrInvalidIdentifier)
+}
+
+func TestValidIdentifierHash(t *testing.T) {
+	hash, err := keyservice.HashIdentifier("salt", "alice@example.com")
+	require.NoError(t, err)
+
+	assert.True(t, keyservice.ValidIdentifierHash(hash))
+	assert.False(t, keyservice.ValidIdentifierHash(hash[:40]))
+	assert.False(t, keyservice.ValidIdentifierHash("l"+hash[1:]), "l is not in the z-base-32 alphabet")
+	assert.False(t, keyservice.ValidIdentifierHash(""))
+}
+
+func TestValidIdentifierPrefix(t *testing.T) {
+	hash, err := keyservice.HashIdentifier("salt", "alice@example.com")
+	require.NoError(t, err)
+
+	assert.True(t, keyservice.ValidIdentifierPrefix(hash[:keyservice.DiscoveryPrefixLength]))
+	assert.False(t, keyservice.ValidIdentifierPrefix(hash), "full hashes are not accepted")
+	assert.False(t, keyservice.ValidIdentifierPrefix(hash[:keyservice.DiscoveryPrefixLength-1]))
+	assert.False(t, keyservice.ValidIdentifierPrefix("lll0"))
+}
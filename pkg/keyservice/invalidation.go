@@ -0,0 +1,19 @@
+package keyservice
+
+import (
+	"context"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// Invalidator broadcasts key changes between service replicas so that any
+// locally cached copies of a key can be evicted.
+// Implementations may be backed by an in-process bus (tests), a Firestore
+// snapshot listener, or any pub/sub system shared by the replicas.
+type Invalidator interface {
+	// Publish announces that the key for entityURN has changed.
+	Publish(ctx context.Context, entityURN urn.URN) error
+	// Subscribe registers fn to be called for every announced change. The
+	// subscription stays active until ctx is cancelled.
+	Subscribe(ctx context.Context, fn func(entityURN urn.URN)) error
+}
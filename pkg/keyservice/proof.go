@@ -0,0 +1,62 @@
+package keyservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// DefaultChallengeTTL is how long a proof-of-possession challenge stays
+// valid when the configuration does not say otherwise.
+const DefaultChallengeTTL = 5 * time.Minute
+
+// ErrChallengeInvalid is returned, possibly wrapped, by
+// ChallengeStore.Consume when the nonce was never issued for the entity, has
+// expired or has already been used.
+var ErrChallengeInvalid = errors.New("challenge invalid")
+
+// Challenge is a single-use nonce that a key upload for EntityURN must sign
+// to prove possession of the private key.
+type Challenge struct {
+	Nonce     string
+	EntityURN urn.URN
+	ExpiresAt time.Time
+}
+
+// ChallengeStore issues and redeems proof-of-possession challenges. Stores
+// shared between replicas let a challenge issued by one replica be redeemed
+// on another.
+type ChallengeStore interface {
+	// Issue creates a random challenge for entityURN valid for ttl.
+	Issue(ctx context.Context, entityURN urn.URN, ttl time.Duration) (Challenge, error)
+	// Consume redeems the challenge, which can only succeed once. It fails
+	// with ErrChallengeInvalid if nonce was not issued for entityURN or has
+	// expired.
+	Consume(ctx context.Context, entityURN urn.URN, nonce string) error
+}
+
+// ProofMessage is the message a proof-of-possession signature covers: the
+// challenge nonce, a newline and the entity URN.
+func ProofMessage(nonce string, entityURN urn.URN) []byte {
+	return []byte(nonce + "\n" + entityURN.String())
+}
+
+// NewNonce returns 32 random bytes, base64url encoded without padding.
+func NewNonce() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(nonce), nil
+}
+
+// ValidNonce reports whether nonce has the shape of one made by NewNonce.
+func ValidNonce(nonce string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(nonce)
+	return err == nil && len(raw) == 32
+}
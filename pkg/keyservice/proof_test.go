@@ -0,0 +1,28 @@
+package keyservice_test
+
+import (
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofMessage(t *testing.T) {
+	entityURN, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+
+	assert.Equal(t, "nonce-1\n"+entityURN.String(), string(keyservice.ProofMessage("nonce-1", entityURN)))
+}
+
+func TestNewNonce(t *testing.T) {
+	first, err := keyservice.NewNonce()
+	require.NoError(t, err)
+	second, err := keyservice.NewNonce()
+	require.NoError(t, err)
+
+	assert.True(t, keyservice.ValidNonce(first))
+	assert.NotEqual(t, first, second)
+	assert.False(t, keyservice.ValidNonce("a/b"))
+}
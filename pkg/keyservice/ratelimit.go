@@ -0,0 +1,105 @@
+package keyservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RateLimit is a token bucket holding up to Burst tokens, refilled at Rate
+// tokens per second.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// IsZero reports whether the limit is unset, meaning unlimited.
+func (l RateLimit) IsZero() bool {
+	return l.Rate == 0 && l.Burst == 0
+}
+
+// Validate checks that a set limit has a non-negative rate and a burst of
+// at least 1.
+func (l RateLimit) Validate() error {
+	if !l.IsZero() && (l.Rate < 0 || l.Burst < 1) {
+		return errors.New("limit needs a non-negative rate and a burst of at least 1")
+	}
+	return nil
+}
+
+// RateLimitResult is the outcome of RateLimitStore.Take.
+type RateLimitResult struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available when not Allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore holds token buckets by key. A store shared by every replica
+// enforces a global limit; a per-process store limits each replica
+// separately.
+type RateLimitStore interface {
+	// Take removes n tokens from the bucket for key, created full if it does
+	// not exist, and reports whether there were enough. Nothing is removed
+	// when there are not. An n of zero only reports whether a token is
+	// available.
+	Take(ctx context.Context, key string, limit RateLimit, n int) (RateLimitResult, error)
+}
+
+// RateLimitKey selects what a lookup rate limit is counted against.
+type RateLimitKey string
+
+const (
+	// RateLimitKeyIP counts requests per client IP address.
+	RateLimitKeyIP RateLimitKey = "ip"
+	// RateLimitKeySubject counts requests per authenticated JWT subject.
+	// Unauthenticated requests fall back to their IP address. Lookups in
+	// ReadModePublic are not authenticated, so it cannot be used there.
+	RateLimitKeySubject RateLimitKey = "subject"
+)
+
+// LookupRateLimit limits key lookups to slow down enumeration of the
+// directory. Every lookup spends a Hits token; lookups for unknown entities
+// also spend a Misses token, and no lookups are served while the Misses
+// budget is exhausted.
+type LookupRateLimit struct {
+	Hits   RateLimit
+	Misses RateLimit
+	// KeyBy lists the keys each limit is counted against; a request must be
+	// within the limit for all of them. Empty means RateLimitKeyIP.
+	KeyBy []RateLimitKey
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For
+	// entry, appended by a trusted proxy, instead of the connection address.
+	TrustForwardedFor bool
+}
+
+// IsZero reports whether no lookup limits are configured.
+func (l LookupRateLimit) IsZero() bool {
+	return l.Hits.IsZero() && l.Misses.IsZero()
+}
+
+// Validate checks that the limits are usable and KeyBy names known keys.
+func (l LookupRateLimit) Validate() error {
+	for name, limit := range map[string]RateLimit{"hits": l.Hits, "misses": l.Misses} {
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("%s %w", name, err)
+		}
+	}
+	for _, key := range l.KeyBy {
+		if key != RateLimitKeyIP && key != RateLimitKeySubject {
+			return fmt.Errorf("unknown rate limit key %q: must be ip or subject", key)
+		}
+	}
+	return nil
+}
+
+// ValidateReadMode checks that the limits can be counted in mode: lookups
+// in ReadModePublic carry no subject, so counting them by subject would
+// silently count them by IP address instead.
+func (l LookupRateLimit) ValidateReadMode(mode ReadMode) error {
+	if (mode == "" || mode == ReadModePublic) && slices.Contains(l.KeyBy, RateLimitKeySubject) {
+		return errors.New("rate limit key subject needs an authenticated read mode")
+	}
+	return nil
+}
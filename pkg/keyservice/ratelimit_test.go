@@ -0,0 +1,37 @@
+package keyservice_test
+
+import (
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupRateLimitValidate(t *testing.T) {
+	assert.NoError(t, keyservice.LookupRateLimit{}.Validate(), "no limits is valid")
+	assert.NoError(t, keyservice.LookupRateLimit{
+		Hits:  keyservice.RateLimit{Rate: 1, Burst: 10},
+		KeyBy: []keyservice.RateLimitKey{keyservice.RateLimitKeyIP, keyservice.RateLimitKeySubject},
+	}.Validate())
+
+	assert.Error(t, keyservice.LookupRateLimit{Misses: keyservice.RateLimit{Rate: 1}}.Validate(), "zero burst")
+	assert.Error(t, keyservice.LookupRateLimit{KeyBy: []keyservice.RateLimitKey{"cookie"}}.Validate())
+}
+
+func TestLookupRateLimitValidateReadMode(t *testing.T) {
+	bySubject := keyservice.LookupRateLimit{KeyBy: []keyservice.RateLimitKey{keyservice.RateLimitKeyIP, keyservice.RateLimitKeySubject}}
+	byIP := keyservice.LookupRateLimit{KeyBy: []keyservice.RateLimitKey{keyservice.RateLimitKeyIP}}
+
+	assert.NoError(t, byIP.ValidateReadMode(keyservice.ReadModePublic))
+	assert.NoError(t, bySubject.ValidateReadMode(keyservice.ReadModeAuthenticated))
+	assert.Error(t, bySubject.ValidateReadMode(keyservice.ReadModePublic), "public lookups have no subject")
+	assert.Error(t, bySubject.ValidateReadMode(""), "the default read mode is public")
+}
+
+func TestRateLimitValidate(t *testing.T) {
+	assert.NoError(t, keyservice.RateLimit{}.Validate(), "an unset limit is valid")
+	assert.NoError(t, keyservice.DefaultDiscoveryRateLimit.Validate())
+
+	assert.Error(t, keyservice.RateLimit{Rate: 1}.Validate(), "zero burst")
+	assert.Error(t, keyservice.RateLimit{Rate: -1, Burst: 1}.Validate(), "negative rate")
+}
@@ -0,0 +1,43 @@
+package keyservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// ReadMode controls who may fetch keys.
+type ReadMode string
+
+const (
+	// ReadModePublic lets anyone fetch any key. It is the default.
+	ReadModePublic ReadMode = "public"
+	// ReadModeAuthenticated requires a valid token to fetch keys.
+	ReadModeAuthenticated ReadMode = "authenticated"
+	// ReadModeContacts requires a valid token and limits callers to their
+	// own keys and those a ReadAuthorizer allows, typically their contacts'.
+	ReadModeContacts ReadMode = "contacts"
+)
+
+// MaxBatchGetKeys is the largest number of entities a single batch lookup
+// or watch may name.
+const MaxBatchGetKeys = 100
+
+// ParseReadMode parses a configured read mode. An empty string is public.
+func ParseReadMode(s string) (ReadMode, error) {
+	switch mode := ReadMode(s); mode {
+	case "":
+		return ReadModePublic, nil
+	case ReadModePublic, ReadModeAuthenticated, ReadModeContacts:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown read mode %q: must be public, authenticated or contacts", s)
+	}
+}
+
+// ReadAuthorizer decides whether an authenticated reader may fetch the key of
+// another entity in ReadModeContacts.
+type ReadAuthorizer interface {
+	AuthorizeRead(ctx context.Context, reader Principal, target urn.URN) (bool, error)
+}
@@ -0,0 +1,22 @@
+package keyservice_test
+
+import (
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReadMode(t *testing.T) {
+	mode, err := keyservice.ParseReadMode("")
+	require.NoError(t, err)
+	assert.Equal(t, keyservice.ReadModePublic, mode, "empty keeps reads public")
+
+	mode, err = keyservice.ParseReadMode("contacts")
+	require.NoError(t, err)
+	assert.Equal(t, keyservice.ReadModeContacts, mode)
+
+	_, err = keyservice.ParseReadMode("friends")
+	assert.Error(t, err)
+}
@@ -0,0 +1,46 @@
+package keyservice
+
+import (
+	"bytes"
+
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+)
+
+// MaxSignatureChainDepth bounds how many signers are followed when a
+// record's signature chain is resolved.
+const MaxSignatureChainDepth = 4
+
+// KeySignature is a signature over an entity's key by another entity's key,
+// typically a device key signed by its owner's long-term identity key.
+type KeySignature struct {
+	SignerURN urn.URN
+	// SignerKeyID is the Fingerprint of the signer's key at the time of
+	// signing, so a signature made by a since-replaced key can be told apart.
+	SignerKeyID string
+	Signature   []byte
+}
+
+// SignedKeyMessage returns the message a KeySignature covers: the signed
+// entity's URN, a newline and its key.
+func SignedKeyMessage(entityURN urn.URN, key []byte) []byte {
+	msg := make([]byte, 0, len(entityURN.String())+1+len(key))
+	msg = append(msg, entityURN.String()...)
+	msg = append(msg, '\n')
+	return append(msg, key...)
+}
+
+// EqualSignatures reports whether a and b hold the same signatures in the
+// same order.
+func EqualSignatures(a, b []KeySignature) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].SignerURN.String() != b[i].SignerURN.String() ||
+			a[i].SignerKeyID != b[i].SignerKeyID ||
+			!bytes.Equal(a[i].Signature, b[i].Signature) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package keyservice_test
+
+import (
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedKeyMessage(t *testing.T) {
+	entityURN, err := urn.New(urn.SecureMessaging, "device", "phone")
+	require.NoError(t, err)
+
+	assert.Equal(t, entityURN.String()+"\nkey", string(keyservice.SignedKeyMessage(entityURN, []byte("key"))))
+}
+
+func TestEqualSignatures(t *testing.T) {
+	alice, err := urn.New(urn.SecureMessaging, "user", "alice")
+	require.NoError(t, err)
+	bob, err := urn.New(urn.SecureMessaging, "user", "bob")
+	require.NoError(t, err)
+	signatures := []keyservice.KeySignature{{SignerURN: alice, SignerKeyID: "k1", Signature: []byte("sig")}}
+
+	assert.True(t, keyservice.EqualSignatures(nil, []keyservice.KeySignature{}))
+	assert.True(t, keyservice.EqualSignatures(signatures, []keyservice.KeySignature{{SignerURN: alice, SignerKeyID: "k1", Signature: []byte("sig")}}))
+	assert.False(t, keyservice.EqualSignatures(signatures, nil))
+	assert.False(t, keyservice.EqualSignatures(signatures, []keyservice.KeySignature{{SignerURN: bob, SignerKeyID: "k1", Signature: []byte("sig")}}))
+	assert.False(t, keyservice.EqualSignatures(signatures, []keyservice.KeySignature{{SignerURN: alice, SignerKeyID: "k2", Signature: []byte("sig")}}))
+}
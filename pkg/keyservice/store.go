@@ -9,14 +9,121 @@ package keyservice
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/illmade-knight/go-secure-messaging/pkg/urn"
 )
 
+// DefaultPageSize is the page size used by ListKeys when the filter does not
+// set one.
+const DefaultPageSize = 100
+
+// MaxBatchStoreKeys is the largest number of keys a single bulk upload may
+// store.
+const MaxBatchStoreKeys = 500
+
+var (
+	// ErrKeyNotFound is returned, possibly wrapped, by GetKey when no key is
+	// stored for the entity.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrKeyRevoked is returned, possibly wrapped, by GetKey when the
+	// entity's key has been revoked.
+	ErrKeyRevoked = errors.New("key revoked")
+	// ErrEntityLocked is returned, possibly wrapped, by StoreKey when the
+	// entity is locked against uploads.
+	ErrEntityLocked = errors.New("entity locked")
+	// ErrKeyChanged is returned, possibly wrapped, by ReplaceRecord when the
+	// stored key no longer is the one the caller expected to replace.
+	ErrKeyChanged = errors.New("key changed concurrently")
+)
+
 // Store defines the public interface for key persistence.
 // Any component that can store and retrieve keys (in-memory, Firestore, etc.)
 // must implement this interface.
 type Store interface {
+	// StoreKey creates or replaces the entity's key, clearing any
+	// revocation. It fails with ErrEntityLocked if the entity is locked.
 	StoreKey(ctx context.Context, entityURN urn.URN, key []byte) error
+	// StoreSignedKey is StoreKey for a key that comes with signatures by
+	// other entities' keys. StoreKey stores a key without signatures,
+	// replacing any the previous key had.
+	StoreSignedKey(ctx context.Context, entityURN urn.URN, key []byte, signatures []KeySignature) error
+	// StoreKeys is StoreSignedKey for many entities at once. It returns one
+	// error per write, in order, nil for each key stored; the writes are not
+	// atomic as a whole. Each entity may appear at most once.
+	StoreKeys(ctx context.Context, writes []KeyWrite) []error
+	// GetKey returns the entity's key, failing with ErrKeyNotFound or
+	// ErrKeyRevoked if there is none to serve.
 	GetKey(ctx context.Context, entityURN urn.URN) ([]byte, error)
+	// GetRecord returns everything stored for the entity, including a
+	// revoked key. A locked entity without a key has a record with an empty
+	// Key; any other entity without a key fails with ErrKeyNotFound.
+	GetRecord(ctx context.Context, entityURN urn.URN) (KeyRecord, error)
+	// GetRecords is GetRecord for many entities in one read. It returns one
+	// record per entity, in order; entities without a record get a
+	// KeyRecord holding only their URN.
+	GetRecords(ctx context.Context, entityURNs []urn.URN) ([]KeyRecord, error)
+	// RevokeKey stops the entity's key from being served until a new key is
+	// stored. It fails with ErrKeyNotFound if there is no key.
+	RevokeKey(ctx context.Context, entityURN urn.URN) error
+	// SetLocked locks or unlocks the entity against uploads.
+	SetLocked(ctx context.Context, entityURN urn.URN, locked bool) error
+	// ReplaceRecord writes rec as it is in one atomic step: key,
+	// signatures, update time, revocation and lock state, a zero UpdatedAt
+	// meaning now. Unlike StoreKey it ignores the entity's lock and keeps
+	// the record's revocation, which suits copying and re-encrypting
+	// records rather than uploads. If previousKey is not nil the record is
+	// only written while the stored key still equals it, failing with
+	// ErrKeyChanged otherwise.
+	ReplaceRecord(ctx context.Context, rec KeyRecord, previousKey []byte) error
+	// ListKeys returns one page of records matching filter in a stable order.
+	// An empty pageToken starts from the beginning; the returned
+	// NextPageToken continues from where the page ended. Page tokens are
+	// opaque and only valid with the same filter. Revoked keys are listed;
+	// locked entities without a key are not.
+	ListKeys(ctx context.Context, filter ListFilter, pageToken string) (KeyPage, error)
+}
+
+// KeyWrite is one key to store with StoreKeys. Signatures may be empty.
+type KeyWrite struct {
+	EntityURN  urn.URN
+	Key        []byte
+	Signatures []KeySignature
+}
+
+// KeyRecord is a single entity key as held by a Store.
+type KeyRecord struct {
+	EntityURN urn.URN
+	Key       []byte
+	UpdatedAt time.Time
+	// Revoked keys are kept for inspection but not served.
+	Revoked   bool
+	RevokedAt time.Time
+	// Locked entities reject uploads.
+	Locked bool
+	// Signatures vouch for Key; see KeySignature.
+	Signatures []KeySignature
+}
+
+// ListFilter narrows the records returned by ListKeys. Zero values match
+// everything.
+type ListFilter struct {
+	// EntityType matches the URN entity type, e.g. "user" or "device".
+	EntityType string
+	// UpdatedSince matches records stored at or after this instant.
+	UpdatedSince time.Time
+	// PageSize caps the number of records per page; zero means the store's
+	// default.
+	PageSize int
+	// IncludeLocked also returns locked entities that hold no key, which
+	// are otherwise skipped.
+	IncludeLocked bool
+}
+
+// KeyPage is one page of records returned by ListKeys. NextPageToken is empty
+// once the last page has been returned.
+type KeyPage struct {
+	Records       []KeyRecord
+	NextPageToken string
 }
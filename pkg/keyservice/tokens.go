@@ -0,0 +1,75 @@
+package keyservice
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// TokenRequirements are claims a bearer token must carry, beyond a valid
+// signature, to be accepted on a route. Empty fields impose no requirement.
+type TokenRequirements struct {
+	// Audiences lists accepted "aud" values; the token must name at least
+	// one of them.
+	Audiences []string `yaml:"audiences"`
+	// Issuer is the required "iss" value.
+	Issuer string `yaml:"issuer"`
+	// Scopes must all be granted by the token's "scope" or "scp" claim.
+	Scopes []string `yaml:"scopes"`
+}
+
+// IsZero reports whether r imposes no requirements.
+func (r TokenRequirements) IsZero() bool {
+	return len(r.Audiences) == 0 && r.Issuer == "" && len(r.Scopes) == 0
+}
+
+// ValidateTokenRoutes checks that every RouteTokenRequirements key is one
+// of routes, the patterns the service registered, so that a misspelt route
+// does not silently go without its requirements. Keys must use the
+// unversioned pattern, which covers the /v1 and /v2 variants too.
+func (c *Config) ValidateTokenRoutes(routes []string) error {
+	var unknown []string
+	for pattern := range c.RouteTokenRequirements {
+		if !slices.Contains(routes, pattern) || versioned(pattern) {
+			unknown = append(unknown, pattern)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("token requirements name unknown routes %q; use unversioned patterns such as \"POST /keys/{entityURN}\"", unknown)
+	}
+	return nil
+}
+
+// versioned reports whether pattern's path starts with a version prefix.
+func versioned(pattern string) bool {
+	_, path, _ := strings.Cut(pattern, " ")
+	for _, version := range APIVersions {
+		if strings.HasPrefix(path, "/"+string(version)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenRequirementsFor returns the requirements for the authenticated route
+// registered with pattern, e.g. "POST /keys/{entityURN}". Fields left empty in
+// RouteTokenRequirements inherit from TokenRequirements.
+func (c *Config) TokenRequirementsFor(pattern string) TokenRequirements {
+	reqs := c.TokenRequirements
+	route, ok := c.RouteTokenRequirements[pattern]
+	if !ok {
+		return reqs
+	}
+	if len(route.Audiences) > 0 {
+		reqs.Audiences = route.Audiences
+	}
+	if route.Issuer != "" {
+		reqs.Issuer = route.Issuer
+	}
+	if len(route.Scopes) > 0 {
+		reqs.Scopes = route.Scopes
+	}
+	return reqs
+}
@@ -0,0 +1,50 @@
+package keyservice_test
+
+import (
+	"testing"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTokenRequirementsFor tests that route requirements inherit unset
+// fields from the service-wide requirements.
+func TestTokenRequirementsFor(t *testing.T) {
+	// Arrange
+	cfg := &keyservice.Config{
+		TokenRequirements: keyservice.TokenRequirements{
+			Audiences: []string{"key-service"},
+			Issuer:    "https://id.example.com",
+		},
+		RouteTokenRequirements: map[string]keyservice.TokenRequirements{
+			"GET /admin/keys": {Scopes: []string{"keys:admin"}},
+		},
+	}
+
+	// Act
+	admin := cfg.TokenRequirementsFor("GET /admin/keys")
+	other := cfg.TokenRequirementsFor("POST /keys/{entityURN}")
+
+	// Assert
+	assert.Equal(t, []string{"key-service"}, admin.Audiences)
+	assert.Equal(t, "https://id.example.com", admin.Issuer)
+	assert.Equal(t, []string{"keys:admin"}, admin.Scopes)
+	assert.Equal(t, cfg.TokenRequirements, other)
+	assert.True(t, keyservice.TokenRequirements{}.IsZero())
+}
+
+// TestValidateTokenRoutes tests that requirements for routes the service
+// does not register are rejected.
+func TestValidateTokenRoutes(t *testing.T) {
+	routes := []string{"GET /admin/keys", "GET /v1/admin/keys", "GET /v2/admin/keys"}
+	requirements := func(pattern string) *keyservice.Config {
+		return &keyservice.Config{RouteTokenRequirements: map[string]keyservice.TokenRequirements{
+			pattern: {Scopes: []string{"keys:admin"}},
+		}}
+	}
+
+	assert.NoError(t, (&keyservice.Config{}).ValidateTokenRoutes(routes))
+	assert.NoError(t, requirements("GET /admin/keys").ValidateTokenRoutes(routes))
+	assert.ErrorContains(t, requirements("GET /admin/key").ValidateTokenRoutes(routes), "GET /admin/key")
+	assert.Error(t, requirements("GET /v2/admin/keys").ValidateTokenRoutes(routes), "versioned patterns are never looked up")
+}
@@ -0,0 +1,53 @@
+package keyservice
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// APIVersion names a version of the HTTP API. Routes are served under a
+// /{version} prefix; unversioned paths are aliases of APIVersionV1.
+type APIVersion string
+
+const (
+	// APIVersionV1 is the original API, in which GET /keys/{entityURN}
+	// always returns the raw key, whatever the client accepts.
+	APIVersionV1 APIVersion = "v1"
+	// APIVersionV2 returns keys from GET /keys/{entityURN} as JSON unless
+	// the client accepts only application/octet-stream.
+	APIVersionV2 APIVersion = "v2"
+)
+
+// APIVersions lists the served API versions, oldest first.
+var APIVersions = []APIVersion{APIVersionV1, APIVersionV2}
+
+// VersionPolicy announces the retirement of an API version to its clients
+// through the Deprecation, Sunset and Link response headers.
+type VersionPolicy struct {
+	// Deprecated is when the version was, or will be, deprecated. Zero
+	// means it is not.
+	Deprecated time.Time `yaml:"deprecated"`
+	// Sunset is when the version is expected to stop being served. Zero
+	// means no date has been set.
+	Sunset time.Time `yaml:"sunset"`
+	// Link points at migration notes for clients of the version.
+	Link string `yaml:"link"`
+}
+
+// VersionPolicies holds the policy of each API version that has one.
+type VersionPolicies map[APIVersion]VersionPolicy
+
+// Validate checks that every policy names a served version and that no
+// version is sunset before it is deprecated.
+func (p VersionPolicies) Validate() error {
+	for version, policy := range p {
+		if !slices.Contains(APIVersions, version) {
+			return fmt.Errorf("unknown API version %q", version)
+		}
+		if !policy.Sunset.IsZero() && policy.Sunset.Before(policy.Deprecated) {
+			return fmt.Errorf("API version %s is sunset before it is deprecated", version)
+		}
+	}
+	return nil
+}
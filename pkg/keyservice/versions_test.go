@@ -0,0 +1,24 @@
+package keyservice_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/illmade-knight/go-key-service/pkg/keyservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionPoliciesValidate(t *testing.T) {
+	deprecated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, keyservice.VersionPolicies{}.Validate(), "no policies is valid")
+	assert.NoError(t, keyservice.VersionPolicies{
+		keyservice.APIVersionV1: {Deprecated: deprecated, Sunset: deprecated.AddDate(0, 6, 0)},
+		keyservice.APIVersionV2: {},
+	}.Validate())
+
+	assert.Error(t, keyservice.VersionPolicies{"v0": {}}.Validate(), "unknown version")
+	assert.Error(t, keyservice.VersionPolicies{
+		keyservice.APIVersionV1: {Deprecated: deprecated, Sunset: deprecated.AddDate(0, -1, 0)},
+	}.Validate(), "sunset before deprecation")
+}
@@ -23,11 +23,14 @@ func NewTestServer(authMiddleware func(http.Handler) http.Handler) *httptest.Ser
 			AllowedOrigins: []string{"*"}, // Allow all for tests
 			Role:           middleware.CorsRoleDefault,
 		},
+		IdentifierSalt: "salt",
 	}
 	store := inmemorystore.New()
 	logger := zerolog.Nop()
 
-	service := keyservice.New(cfg, store, authMiddleware, logger)
+	service := keyservice.New(cfg, store, authMiddleware, logger,
+		keyservice.WithIdentifierIndex(inmemorystore.NewIdentifierIndex()),
+		keyservice.WithRateLimitStore(inmemorystore.NewRateLimitStore()))
 	server := httptest.NewServer(service.Mux())
 
 	return server